@@ -0,0 +1,122 @@
+// Package alert evaluates outbreak alert rules over records and
+// discoveries, raises alerts for the countries and diseases that meet
+// them, and passes new alerts on to notifiers.
+//
+// Records of the same country and disease from different public servants
+// are added up, so rules look at each country and disease as a whole.
+package alert
+
+import (
+	"database/sql"
+	"fmt"
+	"myapp/models"
+	"sort"
+	"time"
+)
+
+// Data is what rules are evaluated over.
+type Data struct {
+	Now       time.Time
+	Records   []models.Record
+	Discovers []models.Discover
+
+	// Past holds the records as they were WindowDays days ago, keyed by
+	// WindowDays, for the patient growth rules.
+	Past map[int][]models.Record
+}
+
+// Evaluate returns the countries and diseases that meet rule, sorted.
+func Evaluate(rule *models.AlertRule, d *Data) ([]models.AlertFinding, error) {
+	var findings []models.AlertFinding
+	switch rule.Kind {
+	case models.RuleFatalityRate:
+		for s, t := range totals(rule, d.Records) {
+			if t.patients == 0 || t.patients < rule.MinPatients {
+				continue
+			}
+			rate := 100 * float64(t.deaths) / float64(t.patients)
+			if rate > rule.Threshold {
+				findings = append(findings, finding(s, rate, "Case fatality rate of %s in %s is %.1f%% (%d deaths, %d patients), above %g%%",
+					s.disease, s.country, rate, t.deaths, t.patients, rule.Threshold))
+			}
+		}
+
+	case models.RuleNewDiscovery:
+		since := d.Now.AddDate(0, 0, -rule.WindowDays)
+		for _, x := range d.Discovers {
+			s := subject{x.CName, x.DiseaseCode}
+			if !matches(rule, s) || x.FirstEncDate.Before(since) {
+				continue
+			}
+			findings = append(findings, models.AlertFinding{
+				CName:       s.country,
+				DiseaseCode: s.disease,
+				Message:     fmt.Sprintf("%s discovered in %s, first encountered %s", s.disease, s.country, x.FirstEncDate.Format("2006-01-02")),
+			})
+		}
+
+	case models.RulePatientGrowth:
+		past, ok := d.Past[rule.WindowDays]
+		if !ok {
+			return nil, fmt.Errorf("no records from %d days ago", rule.WindowDays)
+		}
+		before := totals(rule, past)
+		for s, t := range totals(rule, d.Records) {
+			b := before[s].patients
+			if b == 0 || b < rule.MinPatients {
+				continue
+			}
+			growth := 100 * float64(t.patients-b) / float64(b)
+			if growth > rule.Threshold {
+				findings = append(findings, finding(s, growth, "Patients with %s in %s rose %.1f%% in %d days, from %d to %d, above %g%%",
+					s.disease, s.country, growth, rule.WindowDays, b, t.patients, rule.Threshold))
+			}
+		}
+
+	default:
+		return nil, fmt.Errorf("unknown rule kind %q", rule.Kind)
+	}
+
+	sort.Slice(findings, func(i, j int) bool {
+		if findings[i].CName != findings[j].CName {
+			return findings[i].CName < findings[j].CName
+		}
+		return findings[i].DiseaseCode < findings[j].DiseaseCode
+	})
+	return findings, nil
+}
+
+// subject is a country and disease.
+type subject struct{ country, disease string }
+
+type total struct{ deaths, patients int }
+
+func matches(rule *models.AlertRule, s subject) bool {
+	return (!rule.CName.Valid || rule.CName.String == s.country) &&
+		(!rule.DiseaseCode.Valid || rule.DiseaseCode.String == s.disease)
+}
+
+// totals adds up the records of each subject the rule covers.
+func totals(rule *models.AlertRule, records []models.Record) map[subject]total {
+	sums := make(map[subject]total)
+	for _, r := range records {
+		s := subject{r.CName, r.DiseaseCode}
+		if !matches(rule, s) {
+			continue
+		}
+		t := sums[s]
+		t.deaths += r.TotalDeaths
+		t.patients += r.TotalPatients
+		sums[s] = t
+	}
+	return sums
+}
+
+func finding(s subject, value float64, format string, args ...any) models.AlertFinding {
+	return models.AlertFinding{
+		CName:       s.country,
+		DiseaseCode: s.disease,
+		Message:     fmt.Sprintf(format, args...),
+		Value:       sql.NullFloat64{Float64: value, Valid: true},
+	}
+}
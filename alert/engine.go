@@ -0,0 +1,128 @@
+package alert
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"myapp/models"
+	"time"
+)
+
+// Engine evaluates the active rules and notifies about new alerts.
+type Engine struct {
+	DB        *sql.DB
+	Notifiers []Notifier
+	Interval  time.Duration // between evaluations in Run
+}
+
+// NewEngine returns an engine evaluating every five minutes.
+func NewEngine(db *sql.DB, notifiers ...Notifier) *Engine {
+	return &Engine{DB: db, Notifiers: notifiers, Interval: 5 * time.Minute}
+}
+
+// Run evaluates and notifies until ctx is done, for each organization in
+// turn: rules only see the data of their own organization.
+func (e *Engine) Run(ctx context.Context) {
+	for {
+		err := models.ForEachOrganization(ctx, e.DB, func(ctx context.Context, _ *models.Organization) error {
+			var errs []error
+			if _, err := e.Evaluate(ctx); err != nil {
+				errs = append(errs, fmt.Errorf("evaluating alert rules: %w", err))
+			}
+			if err := e.Notify(ctx); err != nil {
+				errs = append(errs, fmt.Errorf("sending alert notifications: %w", err))
+			}
+			return errors.Join(errs...)
+		})
+		if err != nil && ctx.Err() == nil {
+			log.Printf("Error running alerts: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(e.Interval):
+		}
+	}
+}
+
+// Evaluate evaluates every active rule and returns the alerts raised. A
+// rule that fails does not stop the others; the errors are joined.
+func (e *Engine) Evaluate(ctx context.Context) ([]models.Alert, error) {
+	rules, err := models.GetAlertRules(ctx, e.DB)
+	if err != nil {
+		return nil, err
+	}
+	d := &Data{Now: time.Now(), Past: make(map[int][]models.Record)}
+	if d.Records, err = models.GetAllRecords(ctx, e.DB); err != nil {
+		return nil, err
+	}
+	if d.Discovers, err = models.GetAllDiscovers(ctx, e.DB); err != nil {
+		return nil, err
+	}
+
+	var raised []models.Alert
+	var errs []error
+	for i := range rules {
+		rule := &rules[i]
+		if !rule.Active {
+			continue
+		}
+		if rule.Kind == models.RulePatientGrowth {
+			if _, ok := d.Past[rule.WindowDays]; !ok {
+				past, err := models.GetRecordsAsOf(ctx, e.DB, d.Now.AddDate(0, 0, -rule.WindowDays))
+				if err != nil {
+					return raised, err
+				}
+				d.Past[rule.WindowDays] = past
+			}
+		}
+		findings, err := Evaluate(rule, d)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("rule %q: %w", rule.Name, err))
+			continue
+		}
+		alerts, err := models.RaiseAlerts(ctx, e.DB, rule, findings)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("rule %q: %w", rule.Name, err))
+			continue
+		}
+		raised = append(raised, alerts...)
+	}
+	return raised, errors.Join(errs...)
+}
+
+// Notify passes the alerts not yet notified to every notifier. An alert
+// is retried on the next call until all notifiers accept it, so one that
+// succeeded may see it again.
+func (e *Engine) Notify(ctx context.Context) error {
+	alerts, err := models.GetUnnotifiedAlerts(ctx, e.DB)
+	if err != nil || len(alerts) == 0 {
+		return err
+	}
+
+	var errs []error
+	failed := make(map[int64]bool)
+	for _, n := range e.Notifiers {
+		if err := n.Notify(ctx, alerts); err != nil {
+			errs = append(errs, err)
+			var ne *NotifyError
+			if !errors.As(err, &ne) {
+				return errors.Join(errs...) // none delivered
+			}
+			for _, id := range ne.Failed {
+				failed[id] = true
+			}
+		}
+	}
+	for _, a := range alerts {
+		if failed[a.ID] {
+			continue
+		}
+		if err := models.MarkAlertNotified(ctx, e.DB, a.ID); err != nil {
+			return errors.Join(append(errs, err)...)
+		}
+	}
+	return errors.Join(errs...)
+}
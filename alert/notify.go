@@ -0,0 +1,112 @@
+package alert
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"myapp/models"
+	"net/http"
+	"time"
+)
+
+// Notifier passes new alerts on, e.g. to people or another system.
+type Notifier interface {
+	// Notify is given the alerts raised since the last successful call.
+	// It returns a *NotifyError when only some alerts failed.
+	Notify(ctx context.Context, alerts []models.Alert) error
+}
+
+// NotifierFunc adapts a function to Notifier.
+type NotifierFunc func(ctx context.Context, alerts []models.Alert) error
+
+func (f NotifierFunc) Notify(ctx context.Context, alerts []models.Alert) error {
+	return f(ctx, alerts)
+}
+
+// NotifyError reports the alerts a notifier could not pass on; the
+// others were.
+type NotifyError struct {
+	Failed []int64 // alert IDs
+	Err    error
+}
+
+func (e *NotifyError) Error() string {
+	return fmt.Sprintf("%d alerts not notified: %v", len(e.Failed), e.Err)
+}
+
+func (e *NotifyError) Unwrap() error { return e.Err }
+
+// LogNotifier writes every alert to the standard logger.
+type LogNotifier struct{}
+
+func (LogNotifier) Notify(ctx context.Context, alerts []models.Alert) error {
+	for _, a := range alerts {
+		log.Printf("Alert %d [%s] %s: %s", a.ID, a.Severity, a.RuleName, a.Message)
+	}
+	return nil
+}
+
+// HTTPNotifier posts the alerts as a JSON array to URL, in one request.
+type HTTPNotifier struct {
+	URL    string
+	Client *http.Client
+}
+
+// NewHTTPNotifier returns a notifier posting to url with a 10 second
+// timeout.
+func NewHTTPNotifier(url string) *HTTPNotifier {
+	return &HTTPNotifier{URL: url, Client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+// alertJSON is the shape of an alert sent by HTTPNotifier.
+type alertJSON struct {
+	ID          int64     `json:"id"`
+	Rule        string    `json:"rule"`
+	Severity    string    `json:"severity"`
+	Country     string    `json:"country"`
+	DiseaseCode string    `json:"disease_code"`
+	Message     string    `json:"message"`
+	Value       *float64  `json:"value"`
+	RaisedAt    time.Time `json:"raised_at"`
+}
+
+func (n *HTTPNotifier) Notify(ctx context.Context, alerts []models.Alert) error {
+	out := make([]alertJSON, len(alerts))
+	for i, a := range alerts {
+		out[i] = alertJSON{
+			ID:          a.ID,
+			Rule:        a.RuleName,
+			Severity:    a.Severity,
+			Country:     a.CName,
+			DiseaseCode: a.DiseaseCode,
+			Message:     a.Message,
+			RaisedAt:    a.RaisedAt,
+		}
+		if a.Value.Valid {
+			out[i].Value = &a.Value.Float64
+		}
+	}
+	body, err := json.Marshal(out)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := n.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("alert notifier %s: %s", n.URL, resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,227 @@
+// Package backup dumps the application tables to a portable archive and
+// restores them from it.
+//
+// An archive is a tar file. Its first entry, manifest.json, gives the
+// archive format, the schema version (the last migration applied) and,
+// for every table, its columns, row count and the SHA-256 of its rows.
+// The rows follow, one gzipped JSON lines entry per table, in dependency
+// order and by primary key. lib/pq cannot COPY TO STDOUT, so rows are
+// streamed out with a query; they are loaded back with COPY FROM STDIN.
+package backup
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"myapp/models"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Format is the version of the archive layout.
+const Format = 1
+
+// Table is an application table.
+type Table struct {
+	Name   string
+	Key    []string // the primary key
+	Serial string   // column whose sequence is reset on restore, if any
+}
+
+// Tables are the organizations and the application tables, in dependency
+// order: each only references tables before it. The archive holds the
+// rows of every organization.
+var Tables = []Table{
+	{Name: "organization", Key: []string{"id"}, Serial: "id"},
+	{Name: "country", Key: []string{"tenant_id", "cname"}},
+	{Name: "users", Key: []string{"tenant_id", "email"}},
+	{Name: "diseasetype", Key: []string{"tenant_id", "id"}, Serial: "id"},
+	{Name: "disease", Key: []string{"tenant_id", "disease_code"}},
+	{Name: "discover", Key: []string{"tenant_id", "cname", "disease_code"}},
+	{Name: "patients", Key: []string{"tenant_id", "email"}},
+	{Name: "publicservant", Key: []string{"tenant_id", "email"}},
+	{Name: "doctor", Key: []string{"tenant_id", "email"}},
+	{Name: "specialize", Key: []string{"tenant_id", "id", "email"}},
+	{Name: "patientdisease", Key: []string{"tenant_id", "email", "disease_code"}},
+	{Name: "record", Key: []string{"tenant_id", "email", "cname", "disease_code"}},
+}
+
+// Manifest describes an archive.
+type Manifest struct {
+	Format        int         `json:"format"`
+	SchemaVersion string      `json:"schema_version"`
+	CreatedAt     time.Time   `json:"created_at"`
+	Tables        []TableDump `json:"tables"`
+}
+
+// TableDump describes the rows of a table in an archive.
+type TableDump struct {
+	Name    string   `json:"name"`
+	File    string   `json:"file"`
+	Columns []string `json:"columns"`
+	Rows    int64    `json:"rows"`
+	SHA256  string   `json:"sha256"` // of the uncompressed JSON lines
+}
+
+const manifestName = "manifest.json"
+
+// Backup writes an archive of the application tables to w. The tables
+// are read in one snapshot, so the archive is consistent.
+func Backup(ctx context.Context, db *sql.DB, w io.Writer) (*Manifest, error) {
+	ctx = models.WithAllTenants(ctx)
+	tx, err := db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	m := &Manifest{Format: Format, CreatedAt: time.Now().UTC()}
+	if m.SchemaVersion, err = schemaVersion(ctx, tx); err != nil {
+		return nil, err
+	}
+
+	// The size of each entry goes before it, so tables are dumped to
+	// temporary files first.
+	var files []*os.File
+	defer func() {
+		for _, f := range files {
+			f.Close()
+			os.Remove(f.Name())
+		}
+	}()
+	for _, t := range Tables {
+		f, err := os.CreateTemp("", "backup-"+t.Name+"-*.jsonl.gz")
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, f)
+		d, err := dumpTable(ctx, tx, t, f)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", t.Name, err)
+		}
+		m.Tables = append(m.Tables, *d)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	tw := tar.NewWriter(w)
+	manifest, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := tw.WriteHeader(&tar.Header{Name: manifestName, Mode: 0644, Size: int64(len(manifest)), ModTime: m.CreatedAt}); err != nil {
+		return nil, err
+	}
+	if _, err := tw.Write(manifest); err != nil {
+		return nil, err
+	}
+	for i, f := range files {
+		size, err := f.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+		if err := tw.WriteHeader(&tar.Header{Name: m.Tables[i].File, Mode: 0644, Size: size, ModTime: m.CreatedAt}); err != nil {
+			return nil, err
+		}
+		if _, err := io.Copy(tw, f); err != nil {
+			return nil, err
+		}
+	}
+	return m, tw.Close()
+}
+
+// dumpTable writes the rows of t to w as gzipped JSON lines.
+func dumpTable(ctx context.Context, tx *sql.Tx, t Table, w io.Writer) (*TableDump, error) {
+	d := &TableDump{Name: t.Name, File: t.Name + ".jsonl.gz"}
+	var err error
+	if d.Columns, err = columns(ctx, tx, t.Name); err != nil {
+		return nil, err
+	}
+
+	rows, err := tx.QueryContext(ctx, "SELECT row_to_json(t)::text FROM (SELECT "+quoteList(d.Columns)+
+		" FROM "+pq.QuoteIdentifier(t.Name)+" ORDER BY "+quoteList(t.Key)+") t")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	gz := gzip.NewWriter(w)
+	sum := sha256.New()
+	out := bufio.NewWriter(io.MultiWriter(gz, sum))
+	for rows.Next() {
+		var line []byte
+		if err := rows.Scan(&line); err != nil {
+			return nil, err
+		}
+		out.Write(line)
+		out.WriteByte('\n')
+		d.Rows++
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if err := out.Flush(); err != nil {
+		return nil, err
+	}
+	if err := gz.Close(); err != nil {
+		return nil, err
+	}
+	d.SHA256 = hex.EncodeToString(sum.Sum(nil))
+	return d, nil
+}
+
+// schemaVersion returns the last migration applied to the database.
+func schemaVersion(ctx context.Context, tx *sql.Tx) (string, error) {
+	var version sql.NullString
+	err := tx.QueryRowContext(ctx, "SELECT max(version) FROM schema_migrations").Scan(&version)
+	return version.String, err
+}
+
+// columns returns the columns of a table in order.
+func columns(ctx context.Context, tx *sql.Tx, table string) ([]string, error) {
+	rows, err := tx.QueryContext(ctx, "SELECT column_name FROM information_schema.columns"+
+		" WHERE table_schema = current_schema() AND table_name = $1 ORDER BY ordinal_position", table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var cols []string
+	for rows.Next() {
+		var c string
+		if err := rows.Scan(&c); err != nil {
+			return nil, err
+		}
+		cols = append(cols, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(cols) == 0 {
+		return nil, fmt.Errorf("no table %s", table)
+	}
+	return cols, nil
+}
+
+// quoteList quotes identifiers and joins them with commas.
+func quoteList(names []string) string {
+	quoted := make([]string, len(names))
+	for i, n := range names {
+		quoted[i] = pq.QuoteIdentifier(n)
+	}
+	return strings.Join(quoted, ", ")
+}
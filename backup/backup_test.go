@@ -0,0 +1,127 @@
+package backup_test
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
+	"math/rand/v2"
+	"myapp/backup"
+	"myapp/db"
+	"myapp/models"
+	"os"
+	"slices"
+	"testing"
+)
+
+// This test needs a database:
+//
+//	DATABASE_URL=... go test -p 1 ./backup
+//
+// Restoring replaces every table, so rows other packages' tests add
+// while it runs would be lost; use a scratch database, one package at a
+// time.
+
+// openDB connects to DATABASE_URL and migrates it, or skips the test.
+func openDB(t *testing.T) *sql.DB {
+	t.Helper()
+	dbURL := os.Getenv("DATABASE_URL")
+	if dbURL == "" {
+		t.Skip("DATABASE_URL is not set")
+	}
+	conn, err := db.NewPostgresDB(dbURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	if err := db.Migrate(context.Background(), conn); err != nil {
+		t.Fatal(err)
+	}
+	return conn
+}
+
+func TestRoundTrip(t *testing.T) {
+	conn := openDB(t)
+	o, err := models.CreateOrganization(context.Background(), conn, fmt.Sprintf("backup-%06d", rand.IntN(1e6)), "Backup test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		ctx := models.WithAllTenants(context.Background())
+		var tables []string
+		for _, tbl := range slices.Backward(backup.Tables) {
+			if tbl.Name != "organization" {
+				tables = append(tables, tbl.Name)
+			}
+		}
+		for _, tbl := range append(tables, "row_history", "email_outbox", "webhook_delivery") {
+			if _, err := conn.ExecContext(ctx, "DELETE FROM "+tbl+" WHERE tenant_id = $1", o.ID); err != nil {
+				t.Errorf("cleaning up %s: %v", tbl, err)
+			}
+		}
+		if _, err := conn.ExecContext(ctx, "DELETE FROM organization WHERE id = $1", o.ID); err != nil {
+			t.Errorf("cleaning up the organization: %v", err)
+		}
+	})
+	ctx := models.WithTenant(context.Background(), o.ID)
+
+	if err := models.CreateCountry(ctx, conn, &models.Country{CName: "Atlantis", Population: 1000}); err != nil {
+		t.Fatal(err)
+	}
+	user := &models.User{Email: "ana@example.org", Name: "Ana", Surname: "Diaz", CName: "Atlantis",
+		Phone: sql.NullString{String: "+34 600 123 456", Valid: true}}
+	if err := models.CreateUser(ctx, conn, user); err != nil {
+		t.Fatal(err)
+	}
+
+	var archive bytes.Buffer
+	m, err := backup.Backup(ctx, conn, &archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Tables) != len(backup.Tables) {
+		t.Fatalf("the manifest lists %d tables", len(m.Tables))
+	}
+
+	// Change, add and delete rows after the backup.
+	c, err := models.GetCountry(ctx, conn, "Atlantis")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Population = 2000
+	if err := models.UpdateCountry(ctx, conn, c); err != nil {
+		t.Fatal(err)
+	}
+	if err := models.CreateCountry(ctx, conn, &models.Country{CName: "Lemuria"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conn.ExecContext(ctx, "DELETE FROM users WHERE email = $1", user.Email); err != nil {
+		t.Fatal(err)
+	}
+
+	// Checking an archive changes nothing.
+	if _, err := backup.Restore(ctx, conn, bytes.NewReader(archive.Bytes()), true); err != nil {
+		t.Fatalf("checking: %v", err)
+	}
+	if c, err := models.GetCountry(ctx, conn, "Lemuria"); err != nil || c == nil {
+		t.Fatalf("checking the archive removed a country: %v", err)
+	}
+
+	if _, err := backup.Restore(ctx, conn, bytes.NewReader(archive.Bytes()), false); err != nil {
+		t.Fatal(err)
+	}
+
+	if c, err := models.GetCountry(ctx, conn, "Atlantis"); err != nil || c == nil || c.Population != 1000 {
+		t.Errorf("Atlantis after the restore: %+v, %v", c, err)
+	}
+	if c, err := models.GetCountry(ctx, conn, "Lemuria"); err != nil || c != nil {
+		t.Errorf("Lemuria after the restore: %+v, %v", c, err)
+	}
+	u, err := models.GetUser(ctx, conn, user.Email)
+	if err != nil || u == nil {
+		t.Fatalf("the user after the restore: %+v, %v", u, err)
+	}
+	if u.Phone != user.Phone || u.CName != "Atlantis" {
+		t.Errorf("restored %+v, want %+v", u, user)
+	}
+}
@@ -0,0 +1,269 @@
+package backup
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"myapp/models"
+	"slices"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// Restore replaces the contents of the application tables with those of
+// the archive read from r, in one transaction. Rows of the archive are
+// inserted or updated and other rows deleted, so the rows of other tables
+// that reference kept rows stay. The changes are recorded in the history
+// and sent to webhooks like any other, but nobody is emailed about the
+// records. Changed rows get a new version, so edits started before the
+// restore report a conflict.
+//
+// The archive must be of the database's schema version. The row counts
+// and checksums of the manifest are verified before anything is
+// committed; with check set, nothing is, and Restore only verifies.
+func Restore(ctx context.Context, db *sql.DB, r io.Reader, check bool) (*Manifest, error) {
+	tr := tar.NewReader(r)
+	m, err := readManifest(tr)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx = models.WithAllTenants(ctx)
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	version, err := schemaVersion(ctx, tx)
+	if err != nil {
+		return nil, err
+	}
+	if version != m.SchemaVersion {
+		return nil, fmt.Errorf("backup: the archive is of schema %s but the database is at %s", m.SchemaVersion, version)
+	}
+
+	for i, t := range Tables {
+		d := &m.Tables[i]
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil, fmt.Errorf("backup: archive ends before %s", d.File)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if hdr.Name != d.File {
+			return nil, fmt.Errorf("backup: found %s in the archive instead of %s", hdr.Name, d.File)
+		}
+		if err := loadTable(ctx, tx, t, d, tr); err != nil {
+			return nil, fmt.Errorf("%s: %w", t.Name, err)
+		}
+	}
+
+	// Parents are written before their children and deleted after them.
+	if _, err := tx.ExecContext(ctx, "ALTER TABLE record DISABLE TRIGGER record_email"); err != nil {
+		return nil, err
+	}
+	for i, t := range Tables {
+		if err := mergeTable(ctx, tx, t, m.Tables[i].Columns); err != nil {
+			return nil, fmt.Errorf("%s: %w", t.Name, err)
+		}
+	}
+	for _, t := range slices.Backward(Tables) {
+		if _, err := tx.ExecContext(ctx, "DELETE FROM "+pq.QuoteIdentifier(t.Name)+" t WHERE NOT EXISTS (SELECT 1 FROM "+
+			staging(t)+" s WHERE "+match("s", "t", t.Key)+")"); err != nil {
+			return nil, fmt.Errorf("%s: %w", t.Name, err)
+		}
+	}
+	if _, err := tx.ExecContext(ctx, "ALTER TABLE record ENABLE TRIGGER record_email"); err != nil {
+		return nil, err
+	}
+
+	for i, t := range Tables {
+		var n int64
+		if err := tx.QueryRowContext(ctx, "SELECT count(*) FROM "+pq.QuoteIdentifier(t.Name)).Scan(&n); err != nil {
+			return nil, err
+		}
+		if n != m.Tables[i].Rows {
+			return nil, fmt.Errorf("backup: %s has %d rows after the restore instead of %d", t.Name, n, m.Tables[i].Rows)
+		}
+		if t.Serial != "" {
+			if _, err := tx.ExecContext(ctx, "SELECT setval(pg_get_serial_sequence($1, $2), COALESCE(max("+
+				pq.QuoteIdentifier(t.Serial)+"), 0) + 1, false) FROM "+pq.QuoteIdentifier(t.Name), t.Name, t.Serial); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if check {
+		return m, nil
+	}
+	return m, tx.Commit()
+}
+
+// readManifest reads the manifest at the start of an archive and checks
+// that it lists the tables of this version of the application.
+func readManifest(tr *tar.Reader) (*Manifest, error) {
+	hdr, err := tr.Next()
+	if err != nil {
+		return nil, fmt.Errorf("backup: reading the archive: %w", err)
+	}
+	if hdr.Name != manifestName {
+		return nil, fmt.Errorf("backup: the archive starts with %s instead of %s", hdr.Name, manifestName)
+	}
+	var m Manifest
+	if err := json.NewDecoder(tr).Decode(&m); err != nil {
+		return nil, fmt.Errorf("backup: reading %s: %w", manifestName, err)
+	}
+	if m.Format != Format {
+		return nil, fmt.Errorf("backup: unsupported archive format %d", m.Format)
+	}
+	if len(m.Tables) != len(Tables) {
+		return nil, fmt.Errorf("backup: the archive has %d tables instead of %d", len(m.Tables), len(Tables))
+	}
+	for i, t := range Tables {
+		if m.Tables[i].Name != t.Name {
+			return nil, fmt.Errorf("backup: the archive has table %s where %s was expected", m.Tables[i].Name, t.Name)
+		}
+	}
+	return &m, nil
+}
+
+// staging names the temporary table the rows of t are loaded into.
+func staging(t Table) string {
+	return pq.QuoteIdentifier("restore_" + t.Name)
+}
+
+// loadTable copies the rows of a table from the archive into its staging
+// table and verifies them against the manifest.
+func loadTable(ctx context.Context, tx *sql.Tx, t Table, d *TableDump, r io.Reader) error {
+	if _, err := tx.ExecContext(ctx, "CREATE TEMP TABLE "+staging(t)+" (LIKE "+pq.QuoteIdentifier(t.Name)+") ON COMMIT DROP"); err != nil {
+		return err
+	}
+	stmt, err := tx.PrepareContext(ctx, pq.CopyIn("restore_"+t.Name, d.Columns...))
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return err
+	}
+	sum := sha256.New()
+	in := bufio.NewReader(io.TeeReader(gz, sum))
+	var n int64
+	args := make([]any, len(d.Columns))
+	for {
+		line, err := in.ReadBytes('\n')
+		if err == io.EOF && len(line) == 0 {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		n++
+		if err := decodeRow(line, d.Columns, args); err != nil {
+			return fmt.Errorf("row %d: %w", n, err)
+		}
+		if _, err := stmt.ExecContext(ctx, args...); err != nil {
+			return err
+		}
+	}
+	if _, err := stmt.ExecContext(ctx); err != nil {
+		return err
+	}
+
+	if n != d.Rows {
+		return fmt.Errorf("the archive has %d rows instead of %d", n, d.Rows)
+	}
+	if got := hex.EncodeToString(sum.Sum(nil)); got != d.SHA256 {
+		return errors.New("checksum mismatch, the archive is corrupt")
+	}
+	return nil
+}
+
+// decodeRow sets args to the columns of a JSON line, as COPY text values.
+func decodeRow(line []byte, columns []string, args []any) error {
+	dec := json.NewDecoder(bytes.NewReader(line))
+	dec.UseNumber()
+	var row map[string]any
+	if err := dec.Decode(&row); err != nil {
+		return err
+	}
+	for i, c := range columns {
+		switch v := row[c].(type) {
+		case nil:
+			args[i] = nil
+		case string:
+			args[i] = v
+		case json.Number:
+			args[i] = v.String()
+		case bool:
+			args[i] = v
+		default:
+			b, err := json.Marshal(v)
+			if err != nil {
+				return err
+			}
+			args[i] = string(b)
+		}
+	}
+	return nil
+}
+
+// mergeTable inserts the staged rows of t, and updates the rows that
+// differ from them.
+func mergeTable(ctx context.Context, tx *sql.Tx, t Table, columns []string) error {
+	var set, compare []string
+	for _, c := range columns {
+		q := pq.QuoteIdentifier(c)
+		switch {
+		case slices.Contains(t.Key, c):
+		case c == "version":
+			set = append(set, "version = t.version + 1")
+		default:
+			set = append(set, q+" = EXCLUDED."+q)
+			compare = append(compare, c)
+		}
+	}
+	query := "INSERT INTO " + pq.QuoteIdentifier(t.Name) + " AS t (" + quoteList(columns) + ") SELECT " + quoteList(columns) +
+		" FROM " + staging(t) + " ON CONFLICT (" + quoteList(t.Key) + ")"
+	if len(compare) == 0 {
+		query += " DO NOTHING"
+	} else {
+		query += " DO UPDATE SET " + strings.Join(set, ", ") + " WHERE (" + qualified("t", compare) + ") IS DISTINCT FROM (" +
+			qualified("EXCLUDED", compare) + ")"
+	}
+	_, err := tx.ExecContext(ctx, query)
+	return err
+}
+
+// qualified returns the columns of a table alias, joined with commas.
+func qualified(alias string, columns []string) string {
+	list := make([]string, len(columns))
+	for i, c := range columns {
+		list[i] = alias + "." + pq.QuoteIdentifier(c)
+	}
+	return strings.Join(list, ", ")
+}
+
+// match returns the condition that rows a and b have the same columns.
+func match(a, b string, columns []string) string {
+	conds := make([]string, len(columns))
+	for i, c := range columns {
+		q := pq.QuoteIdentifier(c)
+		conds[i] = a + "." + q + " = " + b + "." + q
+	}
+	return strings.Join(conds, " AND ")
+}
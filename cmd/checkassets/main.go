@@ -0,0 +1,23 @@
+// Command checkassets fails when a template references a static file that
+// does not exist, hard-codes an unfingerprinted /static/ URL, loads an
+// asset from another host, or uses a class no stylesheet defines. It runs
+// as part of `go generate`.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"myapp/web"
+	"os"
+)
+
+func main() {
+	templates := flag.String("templates", "templates", "template directory")
+	static := flag.String("static", "static", "static file directory")
+	flag.Parse()
+
+	if err := web.CheckReferences(os.DirFS(*templates), os.DirFS(*static)); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
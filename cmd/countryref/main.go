@@ -0,0 +1,94 @@
+// Command countryref applies the bundled ISO 3166 reference data to the
+// countries table:
+//
+//	go run ./cmd/countryref -backfill      # set ISO codes from country names
+//	go run ./cmd/countryref -seed          # also add every missing country
+//	go run ./cmd/countryref -merge USA,US -into "United States"
+//
+// It works on the countries of one organization, chosen with -org. It
+// connects to DATABASE_URL and applies pending migrations first.
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"myapp/db"
+	"myapp/models"
+	"os"
+	"strings"
+)
+
+func main() {
+	backfill := flag.Bool("backfill", false, "set the ISO codes of countries recognised by name")
+	seed := flag.Bool("seed", false, "add every ISO 3166 country that is missing, with population 0")
+	merge := flag.String("merge", "", "comma-separated countries to merge into -into")
+	into := flag.String("into", "", "country that -merge keeps")
+	orgSlug := flag.String("org", "default", "slug of the organization whose countries to change")
+	flag.Parse()
+	log.SetFlags(0)
+	log.SetPrefix("countryref: ")
+
+	if !*backfill && !*seed && *merge == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if (*merge == "") != (*into == "") {
+		log.Fatal("-merge and -into go together")
+	}
+
+	dbURL := os.Getenv("DATABASE_URL")
+	if dbURL == "" {
+		log.Fatal("DATABASE_URL is not set")
+	}
+	conn, err := db.NewPostgresDB(dbURL)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer conn.Close()
+
+	ctx := context.Background()
+	if err := db.Migrate(ctx, conn); err != nil {
+		log.Fatal(err)
+	}
+	org, err := models.GetOrganizationBySlug(ctx, conn, *orgSlug)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if org == nil {
+		log.Fatalf("no organization %q", *orgSlug)
+	}
+	ctx = models.WithTenant(ctx, org.ID)
+
+	if *merge != "" {
+		from := strings.Split(*merge, ",")
+		for i := range from {
+			from[i] = strings.TrimSpace(from[i])
+		}
+		res, err := models.MergeCountries(ctx, conn, *into, from)
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("merged %s into %s: %d users, %d discoveries, %d records moved, %d rows combined",
+			strings.Join(from, ", "), *into, res.Users, res.Discoveries, res.Records, res.Combined)
+	}
+
+	if *backfill || *seed {
+		n, unmatched, err := models.BackfillCountryCodes(ctx, conn)
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("set ISO codes of %d countries", n)
+		for _, name := range unmatched {
+			log.Printf("no ISO codes for %s", name)
+		}
+	}
+
+	if *seed {
+		n, err := models.SeedCountries(ctx, conn)
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("added %d countries", n)
+	}
+}
@@ -0,0 +1,442 @@
+package main
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"go/format"
+	"strings"
+	"text/template"
+)
+
+//go:embed templates/*.tmpl
+var templateFS embed.FS
+
+// The generator's own templates use [[ ]] so that the HTML scaffolds can
+// contain html/template actions verbatim.
+var tmpl = template.Must(template.New("").
+	Delims("[[", "]]").
+	Funcs(template.FuncMap{
+		"inputData": func(t *Table, c *Column, item string) any {
+			return struct {
+				Table  *Table
+				Column *Column
+				Item   string
+			}{t, c, item}
+		},
+	}).
+	ParseFS(templateFS, "templates/*.tmpl"))
+
+// GoType is the Go type of the struct field holding c.
+func (c *Column) GoType() string {
+	t, _ := goType(c)
+	return t
+}
+
+// Param is the Go parameter name used for c in model function signatures.
+func (c *Column) Param() string { return paramName(c.Name) }
+
+// IsInt reports whether a key column has to be parsed from the URL.
+func (c *Column) IsInt() bool { return c.GoType() == "int" }
+
+// FormFunc is the handlers.Form accessor that reads c from a request.
+func (c *Column) FormFunc() string {
+	switch c.GoType() {
+	case "int":
+		return "Int"
+	case "int64":
+		return "Int64"
+	case "sql.NullInt64":
+		return "NullInt64"
+	case "sql.NullString":
+		return "NullString"
+	case "time.Time":
+		return "Date"
+	case "bool":
+		return "Bool"
+	}
+	return "String"
+}
+
+// ZeroCheck is the Go condition that is true when a required field of item
+// was left empty, or "" when the type has no meaningful empty value.
+func (c *Column) ZeroCheck(item string) string {
+	switch c.GoType() {
+	case "string":
+		return fmt.Sprintf("%s.%s == \"\"", item, c.GoName)
+	case "time.Time":
+		return fmt.Sprintf("%s.%s.IsZero()", item, c.GoName)
+	}
+	return ""
+}
+
+// KeyArg is the expression passing key column c to a model function from
+// inside a generated handler closure.
+func (c *Column) KeyArg() string {
+	if c.IsInt() {
+		return c.Param()
+	}
+	return fmt.Sprintf("k[%q]", c.KeyName)
+}
+
+// KeyString formats key column c of item as a URL segment.
+func (c *Column) KeyString(item string) string {
+	if c.IsInt() {
+		return fmt.Sprintf("strconv.Itoa(%s.%s)", item, c.GoName)
+	}
+	return item + "." + c.GoName
+}
+
+// Lookup returns the referenced table for foreign key columns.
+func (c *Column) Lookup() *Table {
+	if c.Ref == nil {
+		return nil
+	}
+	return c.Ref.target
+}
+
+// Display renders the html/template expression that prints field c of dot
+// expression v, showing N/A for NULL values. Personal data is masked
+// unless the page is revealing it.
+func (c *Column) Display(v string) string {
+	field := v + c.GoName
+	if c.Mask != "" {
+		masked := fmt.Sprintf("{{ mask %q (print %s) }}", c.Mask, field)
+		switch c.GoType() {
+		case "sql.NullString":
+			masked = fmt.Sprintf("{{ if %s.Valid }}{{ mask %q %s.String }}{{ else }}N/A{{ end }}", field, c.Mask, field)
+		case "sql.NullInt64":
+			masked = fmt.Sprintf("{{ if %s.Valid }}{{ mask %q (print %s.Int64) }}{{ else }}N/A{{ end }}", field, c.Mask, field)
+		}
+		return "{{ if $.Reveal }}" + c.plain(field) + "{{ else }}" + masked + "{{ end }}"
+	}
+	return c.plain(field)
+}
+
+func (c *Column) plain(field string) string {
+	switch c.GoType() {
+	case "sql.NullString":
+		return fmt.Sprintf("{{ if %s.Valid }}{{ %s.String }}{{ else }}N/A{{ end }}", field, field)
+	case "sql.NullInt64":
+		return fmt.Sprintf("{{ if %s.Valid }}{{ %s.Int64 }}{{ else }}N/A{{ end }}", field, field)
+	case "time.Time":
+		return fmt.Sprintf("{{ %s.Format \"2006-01-02\" }}", field)
+	}
+	return "{{ " + field + " }}"
+}
+
+// InputValue renders the value attribute for field c of dot expression v.
+func (c *Column) InputValue(v string) string {
+	field := v + c.GoName
+	switch c.GoType() {
+	case "sql.NullString":
+		return fmt.Sprintf("{{ if %s.Valid }}{{ %s.String }}{{ end }}", field, field)
+	case "sql.NullInt64":
+		return fmt.Sprintf("{{ if %s.Valid }}{{ %s.Int64 }}{{ end }}", field, field)
+	case "time.Time":
+		return fmt.Sprintf("{{ %s.Format \"2006-01-02\" }}", field)
+	}
+	return "{{ " + field + " }}"
+}
+
+// InputType is the HTML input type used for c.
+func (c *Column) InputType() string {
+	switch {
+	case c.GoType() == "time.Time":
+		return "date"
+	case c.GoType() == "bool":
+		return "checkbox"
+	case strings.Contains(c.GoType(), "Int"), strings.HasPrefix(c.GoType(), "int"):
+		return "number"
+	case strings.Contains(c.Name, "email"):
+		return "email"
+	}
+	return "text"
+}
+
+// RefGoName is the Go field of the referenced column of a foreign key.
+func (c *Column) RefGoName() string {
+	target := c.Lookup()
+	if target == nil {
+		return ""
+	}
+	if rc := target.column(c.Ref.Column); rc != nil {
+		return rc.GoName
+	}
+	return goName(c.Ref.Column)
+}
+
+// KeyPath renders the html/template URL path segments for the key of dot
+// expression v, e.g. "{{ pathescape .Email }}/{{ .ID }}". Integer keys
+// need no escaping.
+func (t *Table) KeyPath(v string) string {
+	parts := make([]string, len(t.Keys))
+	for i, c := range t.Keys {
+		if c.IsInt() {
+			parts[i] = "{{ " + v + c.GoName + " }}"
+		} else {
+			parts[i] = "{{ pathescape " + v + c.GoName + " }}"
+		}
+	}
+	return strings.Join(parts, "/")
+}
+
+// KeyQuery renders the row key as a query string for template variable v,
+// the value of the row checkboxes used by bulk actions.
+func (t *Table) KeyQuery(v string) string {
+	parts := make([]string, len(t.Keys))
+	for i, c := range t.Keys {
+		parts[i] = c.KeyName + "={{ urlquery " + v + c.GoName + " }}"
+	}
+	return strings.Join(parts, "&amp;")
+}
+
+func (t *Table) names(cols []*Column) []string {
+	out := make([]string, len(cols))
+	for i, c := range cols {
+		out[i] = c.Name
+	}
+	return out
+}
+
+// SelectList is the comma-separated list of every column.
+func (t *Table) SelectList() string { return strings.Join(t.names(t.Columns), ", ") }
+
+// InsertList is the comma-separated list of Insertable columns.
+func (t *Table) InsertList() string { return strings.Join(t.names(t.Insertable()), ", ") }
+
+// Fields is every column except the row version.
+func (t *Table) Fields() []*Column {
+	var out []*Column
+	for _, c := range t.Columns {
+		if !c.Version {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// Insertable excludes serial columns assigned by the database and the row
+// version, which starts at 1.
+func (t *Table) Insertable() []*Column {
+	var out []*Column
+	for _, c := range t.Columns {
+		if !c.Serial && !c.Version {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// Settable is every column an update may change.
+func (t *Table) Settable() []*Column {
+	var out []*Column
+	for _, c := range t.Columns {
+		if (!c.PK || c.Editable) && !c.Serial && !c.Version {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// FixedKeys lists the key columns that are only set when a row is created.
+func (t *Table) FixedKeys() []*Column {
+	var out []*Column
+	for _, c := range t.Keys {
+		if !c.Editable && !c.Serial {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// EditableKeys reports whether updates may change the primary key, in which
+// case the model's update function takes the old key separately.
+func (t *Table) EditableKeys() bool {
+	for _, c := range t.Keys {
+		if c.Editable {
+			return true
+		}
+	}
+	return false
+}
+
+// HasUpdate reports whether the table has anything an update could change.
+func (t *Table) HasUpdate() bool { return len(t.Settable()) > 0 }
+
+// IntKeys lists key columns that must be parsed from the URL.
+func (t *Table) IntKeys() []*Column {
+	var out []*Column
+	for _, c := range t.Keys {
+		if c.IsInt() {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// Required lists the columns checked by the generated Validate hook.
+func (t *Table) Required() []*Column {
+	var out []*Column
+	for _, c := range t.Columns {
+		if c.NotNull && !c.Serial && c.ZeroCheck("x") != "" {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// Lookups lists the distinct tables referenced by foreign keys.
+func (t *Table) Lookups() []*Table {
+	var out []*Table
+	seen := make(map[*Table]bool)
+	for _, c := range t.Columns {
+		if ref := c.Lookup(); ref != nil && !seen[ref] && ref != t {
+			seen[ref] = true
+			out = append(out, ref)
+		}
+	}
+	return out
+}
+
+// Placeholders returns "$from, $from+1, ..." for n parameters.
+func (t *Table) Placeholders(from, n int) string {
+	ps := make([]string, n)
+	for i := range ps {
+		ps[i] = fmt.Sprintf("$%d", from+i)
+	}
+	return strings.Join(ps, ", ")
+}
+
+// Assignments renders "a=$from, b=$from+1" for cols.
+func (t *Table) Assignments(cols []*Column, from int, sep string) string {
+	parts := make([]string, len(cols))
+	for i, c := range cols {
+		parts[i] = fmt.Sprintf("%s=$%d", c.Name, from+i)
+	}
+	return strings.Join(parts, sep)
+}
+
+// KeyWhere renders the WHERE clause matching the primary key.
+func (t *Table) KeyWhere(from int) string { return t.Assignments(t.Keys, from, " AND ") }
+
+// KeyInTrash reports whether a new row may collide with the key of a row
+// in the trash, i.e. the table is soft-deleted and its key is not serial.
+func (t *Table) KeyInTrash() bool {
+	if !t.SoftDelete {
+		return false
+	}
+	for _, c := range t.Keys {
+		if c.Serial {
+			return false
+		}
+	}
+	return true
+}
+
+// Live renders the condition that hides soft-deleted rows from a query
+// filtered by key.
+func (t *Table) Live() string {
+	if t.SoftDelete {
+		return " AND deleted_at IS NULL"
+	}
+	return ""
+}
+
+// References lists the foreign keys of t.
+func (t *Table) References() []*Column {
+	var out []*Column
+	for _, c := range t.Columns {
+		if c.Ref != nil {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// KeyNames lists the primary key column names.
+func (t *Table) KeyNames() []string { return t.names(t.Keys) }
+
+// KeyParams renders the Go parameter list for the primary key.
+func (t *Table) KeyParams() string {
+	parts := make([]string, len(t.Keys))
+	for i, c := range t.Keys {
+		parts[i] = c.Param() + " " + c.GoType()
+	}
+	return strings.Join(parts, ", ")
+}
+
+// KeyParamNames renders the Go argument list for the primary key.
+func (t *Table) KeyParamNames() string {
+	parts := make([]string, len(t.Keys))
+	for i, c := range t.Keys {
+		parts[i] = c.Param()
+	}
+	return strings.Join(parts, ", ")
+}
+
+// KeyArgs renders the model call arguments for the key inside a handler.
+func (t *Table) KeyArgs() string {
+	parts := make([]string, len(t.Keys))
+	for i, c := range t.Keys {
+		parts[i] = c.KeyArg()
+	}
+	return strings.Join(parts, ", ")
+}
+
+// FieldRefs renders "&x.A, &x.B" or "x.A, x.B" for cols, as scan
+// destinations or query arguments. Encrypted columns are decrypted when
+// scanned and encrypted when written.
+func (t *Table) FieldRefs(prefix string, cols []*Column) string {
+	parts := make([]string, len(cols))
+	for i, c := range cols {
+		parts[i] = prefix + c.GoName
+		if c.Encrypted {
+			fn := "sealed"
+			if strings.HasPrefix(prefix, "&") {
+				fn = "opened"
+			}
+			parts[i] = fmt.Sprintf("%s(%q, %s)", fn, strings.ToLower(t.Name)+"."+c.Name, parts[i])
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+func (t *Table) NeedsTime() bool {
+	for _, c := range t.Columns {
+		if c.GoType() == "time.Time" {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *Table) NeedsStrconv() bool { return len(t.IntKeys()) > 0 }
+
+// Noun and NounPlural are the lower-case labels used in confirmation prompts.
+func (t *Table) Noun() string { return strings.ToLower(t.Label) }
+
+func (t *Table) NounPlural() string { return strings.ToLower(t.Plural) }
+
+// Add is exposed to templates for placeholder arithmetic.
+func (t *Table) Add(a, b int) int { return a + b }
+
+func render(name string, data any) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := tmpl.ExecuteTemplate(&buf, name, data); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func renderGo(name string, data any) ([]byte, error) {
+	src, err := render(name, data)
+	if err != nil {
+		return nil, err
+	}
+	out, err := format.Source(src)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w\n%s", name, err, src)
+	}
+	return out, nil
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the .golden files")
+
+// TestGolden renders testdata/schema.sql and compares every file with
+// testdata/<path>.golden. After a deliberate change to the templates,
+// check the diff of
+//
+//	go test ./cmd/gen -update
+func TestGolden(t *testing.T) {
+	f, err := os.Open("testdata/schema.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tables, err := ParseSchema(f)
+	f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := generate(tables, "models", "handlers")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tbl := range tables {
+		pages, err := scaffold(tbl)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for page, src := range pages {
+			files[filepath.Join("templates", tbl.Path, page)] = src
+		}
+	}
+
+	for path, got := range files {
+		golden := filepath.Join("testdata", path+".golden")
+		if *update {
+			if err := os.MkdirAll(filepath.Dir(golden), 0o755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(golden, got, 0o644); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		want, err := os.ReadFile(golden)
+		if err != nil {
+			t.Errorf("%s: %v", path, err)
+			continue
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("%s differs from %s:\n%s", path, golden, diff(string(want), string(got)))
+		}
+	}
+}
+
+// TestCommitted generates from db/schema.sql and compares the result with
+// the committed models/<file>.go, handlers/<file>.go, models/tables.go and
+// handlers/resources.go, like gen -check. Templates are only scaffolded
+// and then edited by hand, so each table must have its pages, and its
+// form must still send every field the generated handler binds.
+func TestCommitted(t *testing.T) {
+	root := filepath.Join("..", "..")
+	f, err := os.Open(filepath.Join(root, "db", "schema.sql"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tables, err := ParseSchema(f)
+	f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := generate(tables, filepath.Join(root, "models"), filepath.Join(root, "handlers"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for path, want := range files {
+		got, err := os.ReadFile(path)
+		if err != nil {
+			t.Errorf("%s: %v", path, err)
+			continue
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("%s is out of date; run go generate:\n%s", path, diff(string(want), string(got)))
+		}
+	}
+
+	fieldName := regexp.MustCompile(`name="([^"{]+)"`)
+	for _, tbl := range tables {
+		pages, err := scaffold(tbl)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for page, src := range pages {
+			path := filepath.Join(root, "templates", tbl.Path, page)
+			got, err := os.ReadFile(path)
+			if err != nil {
+				t.Errorf("%s: %v", path, err)
+				continue
+			}
+			for _, m := range fieldName.FindAllSubmatch(src, -1) {
+				if !bytes.Contains(got, m[0]) {
+					t.Errorf("%s has no field %s", path, m[1])
+				}
+			}
+		}
+	}
+}
+
+// diff shows the first line where got departs from want.
+func diff(want, got string) string {
+	w, g := strings.Split(want, "\n"), strings.Split(got, "\n")
+	for i := 0; i < len(w) || i < len(g); i++ {
+		var wl, gl string
+		if i < len(w) {
+			wl = w[i]
+		}
+		if i < len(g) {
+			gl = g[i]
+		}
+		if wl != gl {
+			return "line " + strconv.Itoa(i+1) + ":\n\twant: " + wl + "\n\tgot:  " + gl
+		}
+	}
+	return ""
+}
+
+func TestParseSchemaErrors(t *testing.T) {
+	for _, tc := range []struct {
+		name, schema, err string
+	}{
+		{"no annotation", "CREATE TABLE T (\n    id INT,\n    PRIMARY KEY (id)\n);\n", "no @resource annotation"},
+		{"no primary key", "-- @resource file=t\nCREATE TABLE T (\n    id INT\n);\n", "no primary key"},
+		{"half soft delete", "-- @resource file=t\nCREATE TABLE T (\n    id INT,\n    deleted_at TIMESTAMPTZ,\n    PRIMARY KEY (id)\n);\n", "soft delete needs both"},
+		{"nullable date", "-- @resource file=t\nCREATE TABLE T (\n    id INT,\n    at DATE,\n    PRIMARY KEY (id)\n);\n", "nullable dates"},
+		{"unknown mask", "-- @resource file=t\nCREATE TABLE T (\n    id INT,\n    v TEXT, -- @field mask=blur\n    PRIMARY KEY (id)\n);\n", "unknown mask"},
+		{"encrypted key", "-- @resource file=t\nCREATE TABLE T (\n    id TEXT, -- @field encrypted=INT\n    PRIMARY KEY (id)\n);\n", "can be encrypted"},
+		{"unknown reference", "-- @resource file=t\nCREATE TABLE T (\n    id INT REFERENCES U (id),\n    PRIMARY KEY (id)\n);\n", "unknown table U"},
+		{"not closed", "-- @resource file=t\nCREATE TABLE T (\n    id INT,\n", "not closed"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := ParseSchema(strings.NewReader(tc.schema))
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("got %v, want an error containing %q", err, tc.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,129 @@
+// Command gen generates the models, table metadata, CRUD handlers, route
+// registration and HTML scaffolds of every table described in db/schema.sql.
+//
+// Go files are regenerated on every run. Templates are only written for
+// tables that do not have a template directory yet, so they can be edited
+// by hand afterwards. With -check nothing is written; instead the command
+// fails if any generated Go file differs from the one on disk.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+func main() {
+	var (
+		schemaPath   = flag.String("schema", "db/schema.sql", "annotated DDL to read")
+		modelsDir    = flag.String("models", "models", "output directory for models")
+		handlersDir  = flag.String("handlers", "handlers", "output directory for handlers")
+		templatesDir = flag.String("templates", "templates", "output directory for HTML scaffolds")
+		check        = flag.Bool("check", false, "report stale generated files instead of writing them")
+	)
+	flag.Parse()
+	log.SetFlags(0)
+	log.SetPrefix("gen: ")
+
+	f, err := os.Open(*schemaPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	tables, err := ParseSchema(f)
+	f.Close()
+	if err != nil {
+		log.Fatalf("%s: %v", *schemaPath, err)
+	}
+
+	files, err := generate(tables, *modelsDir, *handlersDir)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if *check {
+		stale := 0
+		for path, want := range files {
+			got, err := os.ReadFile(path)
+			if err != nil || !bytes.Equal(got, want) {
+				fmt.Fprintf(os.Stderr, "%s is out of date\n", path)
+				stale++
+			}
+		}
+		if stale > 0 {
+			log.Fatalf("%d generated files differ from %s; run go generate", stale, *schemaPath)
+		}
+		return
+	}
+
+	for path, src := range files {
+		if err := os.WriteFile(path, src, 0o644); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	for _, t := range tables {
+		dir := filepath.Join(*templatesDir, t.Path)
+		if _, err := os.Stat(dir); err == nil {
+			continue
+		}
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			log.Fatal(err)
+		}
+		pages, err := scaffold(t)
+		if err != nil {
+			log.Fatal(err)
+		}
+		for page, src := range pages {
+			if err := os.WriteFile(filepath.Join(dir, page), src, 0o644); err != nil {
+				log.Fatal(err)
+			}
+		}
+		log.Printf("wrote templates for %s in %s", t.Name, dir)
+	}
+}
+
+// generate renders the Go files of tables by path.
+func generate(tables []*Table, modelsDir, handlersDir string) (map[string][]byte, error) {
+	files := make(map[string][]byte)
+	for _, t := range tables {
+		model, err := renderGo("model.go.tmpl", t)
+		if err != nil {
+			return nil, err
+		}
+		files[filepath.Join(modelsDir, t.File+".go")] = model
+
+		handler, err := renderGo("handler.go.tmpl", t)
+		if err != nil {
+			return nil, err
+		}
+		files[filepath.Join(handlersDir, t.File+".go")] = handler
+	}
+	resources, err := renderGo("resources.go.tmpl", tables)
+	if err != nil {
+		return nil, err
+	}
+	files[filepath.Join(handlersDir, "resources.go")] = resources
+
+	schema, err := renderGo("tables.go.tmpl", tables)
+	if err != nil {
+		return nil, err
+	}
+	files[filepath.Join(modelsDir, "tables.go")] = schema
+	return files, nil
+}
+
+// scaffold renders the HTML pages of t by file name.
+func scaffold(t *Table) (map[string][]byte, error) {
+	pages := make(map[string][]byte)
+	for _, page := range []string{"list", "view", "form"} {
+		src, err := render(page+".html.tmpl", t)
+		if err != nil {
+			return nil, err
+		}
+		pages[page+".html"] = src
+	}
+	return pages, nil
+}
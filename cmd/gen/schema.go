@@ -0,0 +1,379 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// Table is one CREATE TABLE statement together with its @resource
+// annotation.
+type Table struct {
+	Name    string // SQL table name
+	File    string // base name of the generated .go files
+	Path    string // URL segment and template directory
+	Label   string
+	Plural  string
+	Item    string // Go struct name and template key for one row
+	Items   string // template key for the list
+	Check   string // optional hand-written validation hook in handlers
+	Related string // optional hand-written view page hook in handlers
+	Verify  string // optional hand-written validation hook that queries the database
+	Columns []*Column
+	Keys    []*Column // primary key, in declaration order
+
+	// SoftDelete is set when the table has the deleted_at and deleted_by
+	// bookkeeping columns. They are left out of Columns: models hide
+	// deleted rows and Delete only marks rows as deleted.
+	SoftDelete bool
+	softCols   int
+
+	// Versioned is set when the table has a version column, which the
+	// models bump on every update and check for optimistic locking.
+	Versioned bool
+}
+
+// Column is one column definition together with its @field annotation.
+type Column struct {
+	Name     string // SQL column name
+	SQLType  string
+	GoName   string
+	Label    string
+	KeyName  string // path wildcard name when part of the primary key
+	NotNull  bool
+	PK       bool
+	Serial   bool
+	Editable bool // primary key column that may change on update
+	Version  bool // row version for optimistic locking
+	Ref      *Ref
+
+	// Encrypted columns hold personal data encrypted by the models, in a
+	// TEXT column; SQLType is then the type of the plaintext.
+	Encrypted bool
+	// Mask is how personal data is masked for display (see models.Mask),
+	// or "" if the column holds none.
+	Mask string
+}
+
+// Ref is a foreign key target.
+type Ref struct {
+	Table  string
+	Column string
+	target *Table
+}
+
+// tenantColumn holds the organization of a row. The database fills it in
+// and keeps organizations apart, so the generated code never sees it; it
+// is left out of Columns and of the keys.
+const tenantColumn = "tenant_id"
+
+var (
+	createRe = regexp.MustCompile(`(?i)^CREATE TABLE\s+(\w+)\s*\($`)
+	columnRe = regexp.MustCompile(`^(\w+)\s+(\w+(?:\s*\([\d,\s]+\))?)(.*)$`)
+	refRe    = regexp.MustCompile(`(?i)REFERENCES\s+(\w+)\s*\(\s*(?:tenant_id\s*,\s*)?(\w+)\s*\)`)
+	pkRe     = regexp.MustCompile(`(?i)^PRIMARY KEY\s*\(([^)]*)\)`)
+	fkRe     = regexp.MustCompile(`(?i)^FOREIGN KEY\s*\(\s*(?:tenant_id\s*,\s*)?(\w+)\s*\)\s*(REFERENCES.*)$`)
+	attrRe   = regexp.MustCompile(`(\w+)(?:=("[^"]*"|\S+))?`)
+)
+
+// ParseSchema reads the annotated DDL subset used by db/schema.sql: one
+// column or table constraint per line, annotations in trailing comments.
+func ParseSchema(r io.Reader) ([]*Table, error) {
+	var (
+		tables  []*Table
+		current *Table
+		pending map[string]string
+		lineNo  int
+	)
+
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		lineNo++
+		code, comment, _ := strings.Cut(sc.Text(), "--")
+		code = strings.TrimSpace(code)
+		comment = strings.TrimSpace(comment)
+
+		if current == nil {
+			if rest, ok := strings.CutPrefix(comment, "@resource"); ok {
+				pending = parseAttrs(rest)
+			}
+			if code == "" {
+				continue
+			}
+			m := createRe.FindStringSubmatch(code)
+			if m == nil {
+				return nil, fmt.Errorf("line %d: expected CREATE TABLE, got %q", lineNo, code)
+			}
+			if pending == nil {
+				return nil, fmt.Errorf("line %d: table %s has no @resource annotation", lineNo, m[1])
+			}
+			current = newTable(m[1], pending)
+			pending = nil
+			continue
+		}
+
+		if code == "" {
+			continue
+		}
+		if strings.HasPrefix(code, ")") {
+			if err := current.finish(); err != nil {
+				return nil, fmt.Errorf("line %d: %w", lineNo, err)
+			}
+			tables = append(tables, current)
+			current = nil
+			continue
+		}
+
+		code = strings.TrimSuffix(code, ",")
+		if err := current.addLine(code, comment); err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNo, err)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	if current != nil {
+		return nil, fmt.Errorf("table %s is not closed", current.Name)
+	}
+
+	byName := make(map[string]*Table, len(tables))
+	for _, t := range tables {
+		byName[strings.ToLower(t.Name)] = t
+	}
+	for _, t := range tables {
+		for _, c := range t.Columns {
+			if c.Ref == nil {
+				continue
+			}
+			c.Ref.target = byName[strings.ToLower(c.Ref.Table)]
+			if c.Ref.target == nil {
+				return nil, fmt.Errorf("%s.%s references unknown table %s", t.Name, c.Name, c.Ref.Table)
+			}
+		}
+	}
+	return tables, nil
+}
+
+func newTable(name string, attrs map[string]string) *Table {
+	t := &Table{
+		Name:    name,
+		File:    strings.ToLower(name),
+		Path:    strings.ToLower(name) + "s",
+		Label:   name,
+		Plural:  name + "s",
+		Item:    name,
+		Items:   name + "s",
+		Check:   attrs["check"],
+		Related: attrs["related"],
+		Verify:  attrs["verify"],
+	}
+	set := func(dst *string, key string) {
+		if v, ok := attrs[key]; ok {
+			*dst = v
+		}
+	}
+	set(&t.File, "file")
+	set(&t.Path, "path")
+	set(&t.Label, "label")
+	set(&t.Plural, "plural")
+	set(&t.Item, "item")
+	set(&t.Items, "items")
+	return t
+}
+
+func (t *Table) addLine(code, comment string) error {
+	if m := pkRe.FindStringSubmatch(code); m != nil {
+		for _, name := range strings.Split(m[1], ",") {
+			if name = strings.TrimSpace(name); name == tenantColumn {
+				continue
+			}
+			c := t.column(name)
+			if c == nil {
+				return fmt.Errorf("primary key column %q not declared", name)
+			}
+			c.PK, c.NotNull = true, true
+			t.Keys = append(t.Keys, c)
+		}
+		return nil
+	}
+	if m := fkRe.FindStringSubmatch(code); m != nil {
+		c := t.column(m[1])
+		if c == nil {
+			return fmt.Errorf("foreign key column %q not declared", m[1])
+		}
+		r := refRe.FindStringSubmatch(m[2])
+		c.Ref = &Ref{Table: r[1], Column: r[2]}
+		return nil
+	}
+
+	m := columnRe.FindStringSubmatch(code)
+	if m == nil {
+		return fmt.Errorf("cannot parse column %q", code)
+	}
+	if m[1] == "deleted_at" || m[1] == "deleted_by" {
+		t.softCols++
+		return nil
+	}
+	if m[1] == tenantColumn {
+		return nil
+	}
+	c := &Column{
+		Name:    m[1],
+		SQLType: strings.ToUpper(strings.Fields(m[2])[0]),
+		GoName:  goName(m[1]),
+		Label:   m[1],
+		NotNull: strings.Contains(strings.ToUpper(m[3]), "NOT NULL"),
+	}
+	if i := strings.IndexByte(c.SQLType, '('); i >= 0 {
+		c.SQLType = c.SQLType[:i]
+	}
+	c.Serial = c.SQLType == "SERIAL" || c.SQLType == "BIGSERIAL"
+	if strings.Contains(strings.ToUpper(m[3]), "PRIMARY KEY") {
+		c.PK, c.NotNull = true, true
+		t.Keys = append(t.Keys, c)
+	}
+	if r := refRe.FindStringSubmatch(m[3]); r != nil {
+		c.Ref = &Ref{Table: r[1], Column: r[2]}
+	}
+
+	if rest, ok := strings.CutPrefix(comment, "@field"); ok {
+		attrs := parseAttrs(rest)
+		if v, ok := attrs["go"]; ok {
+			c.GoName = v
+		}
+		if v, ok := attrs["label"]; ok {
+			c.Label = v
+		}
+		c.KeyName = attrs["key"]
+		_, c.Editable = attrs["editable"]
+		c.Mask = attrs["mask"]
+		if v, ok := attrs["encrypted"]; ok {
+			if c.SQLType != "TEXT" {
+				return fmt.Errorf("column %s: encrypted columns are stored as TEXT", c.Name)
+			}
+			c.Encrypted, c.SQLType = true, strings.ToUpper(v)
+			if c.Mask == "" {
+				c.Mask = "text"
+			}
+		}
+	}
+	switch c.Mask {
+	case "", "phone", "code", "number", "text":
+	default:
+		return fmt.Errorf("column %s: unknown mask %q", c.Name, c.Mask)
+	}
+	if c.KeyName == "" {
+		c.KeyName = c.Name
+	}
+
+	if c.Name == "version" {
+		if c.SQLType != "INT" && c.SQLType != "INTEGER" || !c.NotNull {
+			return fmt.Errorf("column version must be INT NOT NULL")
+		}
+		c.Version, c.GoName, t.Versioned = true, "Version", true
+	}
+
+	if _, err := goType(c); err != nil {
+		return err
+	}
+	t.Columns = append(t.Columns, c)
+	return nil
+}
+
+func (t *Table) column(name string) *Column {
+	for _, c := range t.Columns {
+		if c.Name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+func (t *Table) finish() error {
+	if len(t.Keys) == 0 {
+		return fmt.Errorf("table %s has no primary key", t.Name)
+	}
+	switch t.softCols {
+	case 0:
+	case 2:
+		t.SoftDelete = true
+	default:
+		return fmt.Errorf("table %s: soft delete needs both deleted_at and deleted_by", t.Name)
+	}
+	for _, c := range t.Columns {
+		if c.Editable && !c.PK {
+			return fmt.Errorf("%s.%s: only primary key columns can be marked editable", t.Name, c.Name)
+		}
+		if c.Encrypted && (c.PK || c.Ref != nil || c.NotNull) {
+			return fmt.Errorf("%s.%s: only nullable columns outside keys can be encrypted", t.Name, c.Name)
+		}
+	}
+	return nil
+}
+
+// parseAttrs parses `key=value key="quoted value" flag` lists.
+func parseAttrs(s string) map[string]string {
+	attrs := make(map[string]string)
+	for _, m := range attrRe.FindAllStringSubmatch(s, -1) {
+		attrs[m[1]] = strings.Trim(m[2], `"`)
+	}
+	return attrs
+}
+
+// goName converts snake_case to an exported Go identifier, keeping the
+// common ID initialism.
+func goName(s string) string {
+	var b strings.Builder
+	for _, part := range strings.Split(s, "_") {
+		if part == "id" {
+			b.WriteString("ID")
+			continue
+		}
+		if part != "" {
+			b.WriteString(strings.ToUpper(part[:1]) + part[1:])
+		}
+	}
+	return b.String()
+}
+
+// paramName converts snake_case to an unexported Go identifier.
+func paramName(s string) string {
+	n := goName(s)
+	if n == "ID" {
+		return "id"
+	}
+	return strings.ToLower(n[:1]) + n[1:]
+}
+
+func goType(c *Column) (string, error) {
+	switch c.SQLType {
+	case "VARCHAR", "TEXT", "CHAR":
+		if c.NotNull {
+			return "string", nil
+		}
+		return "sql.NullString", nil
+	case "INT", "INTEGER", "SMALLINT", "SERIAL":
+		if c.NotNull {
+			return "int", nil
+		}
+		return "sql.NullInt64", nil
+	case "BIGINT", "BIGSERIAL":
+		if c.NotNull {
+			return "int64", nil
+		}
+		return "sql.NullInt64", nil
+	case "BOOLEAN", "BOOL":
+		if c.NotNull {
+			return "bool", nil
+		}
+		return "", fmt.Errorf("column %s: nullable booleans are not supported", c.Name)
+	case "DATE", "TIMESTAMP", "TIMESTAMPTZ":
+		if c.NotNull {
+			return "time.Time", nil
+		}
+		return "", fmt.Errorf("column %s: nullable dates are not supported", c.Name)
+	}
+	return "", fmt.Errorf("column %s: unsupported type %s", c.Name, c.SQLType)
+}
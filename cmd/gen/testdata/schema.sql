@@ -0,0 +1,39 @@
+-- A small schema using every annotation cmd/gen supports, rendered by
+-- gen_test.go and compared with the .golden files next to it.
+
+-- @resource file=owner path=owners label=Owner plural=Owners item=Owner items=Owners check=checkOwner related=ownerRelated verify=verifyOwner
+CREATE TABLE Owner (
+    tenant_id INT NOT NULL DEFAULT current_tenant() REFERENCES organization (id),
+    email VARCHAR(60), -- @field label=Email editable
+    name VARCHAR(30) NOT NULL, -- @field label=Name
+    phone TEXT, -- @field label=Phone mask=phone encrypted=VARCHAR
+    born DATE NOT NULL, -- @field label="Date of Birth"
+    version INT NOT NULL DEFAULT 1,
+    deleted_at TIMESTAMPTZ,
+    deleted_by VARCHAR(60),
+    PRIMARY KEY (tenant_id, email)
+);
+
+-- @resource file=pet_kind path=pet_kinds label="Pet Kind" plural="Pet Kinds" item=PetKind items=PetKinds
+CREATE TABLE PetKind (
+    tenant_id INT NOT NULL DEFAULT current_tenant() REFERENCES organization (id),
+    id SERIAL, -- @field label=ID
+    description VARCHAR(140) NOT NULL, -- @field label=Description
+    PRIMARY KEY (tenant_id, id)
+);
+
+-- @resource file=pet path=pets label=Pet plural=Pets item=Pet items=Pets
+CREATE TABLE Pet (
+    tenant_id INT NOT NULL DEFAULT current_tenant() REFERENCES organization (id),
+    email VARCHAR(60) NOT NULL, -- @field label=Owner
+    pet_name VARCHAR(30), -- @field go=PetName label="Pet Name" key=name
+    kind INT NOT NULL, -- @field label=Kind
+    chip_code VARCHAR(20), -- @field label="Chip Code" mask=code
+    weight INT, -- @field label="Weight (g)"
+    version INT NOT NULL DEFAULT 1,
+    deleted_at TIMESTAMPTZ,
+    deleted_by VARCHAR(60),
+    PRIMARY KEY (tenant_id, email, pet_name),
+    FOREIGN KEY (tenant_id, email) REFERENCES Owner (tenant_id, email),
+    FOREIGN KEY (tenant_id, kind) REFERENCES PetKind (tenant_id, id)
+);
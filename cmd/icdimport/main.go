@@ -0,0 +1,70 @@
+// Command icdimport loads an official ICD tabular file into the local code
+// catalog used to validate disease codes, replacing the previous release
+// of the same system:
+//
+//	go run ./cmd/icdimport -system icd10 icd10cm_order_2025.txt
+//	go run ./cmd/icdimport -system icd11 LinearizationMiniOutput-MMS-en.txt
+//
+// It connects to DATABASE_URL and applies pending migrations first.
+package main
+
+import (
+	"context"
+	"flag"
+	"io"
+	"log"
+	"myapp/db"
+	"myapp/icd"
+	"myapp/models"
+	"os"
+)
+
+func main() {
+	system := flag.String("system", "", "icd10 (ICD-10-CM order file) or icd11 (ICD-11 MMS linearization)")
+	flag.Parse()
+	log.SetFlags(0)
+	log.SetPrefix("icdimport: ")
+
+	var read func(io.Reader) ([]models.ICDChapter, []models.ICDCode, error)
+	var name string
+	switch *system {
+	case "icd10":
+		read, name = icd.ReadICD10, models.ICD10
+	case "icd11":
+		read, name = icd.ReadICD11, models.ICD11
+	default:
+		log.Fatal("-system must be icd10 or icd11")
+	}
+	if flag.NArg() != 1 {
+		log.Fatal("usage: icdimport -system icd10|icd11 FILE")
+	}
+
+	f, err := os.Open(flag.Arg(0))
+	if err != nil {
+		log.Fatal(err)
+	}
+	chapters, codes, err := read(f)
+	f.Close()
+	if err != nil {
+		log.Fatalf("%s: %v", flag.Arg(0), err)
+	}
+
+	dbURL := os.Getenv("DATABASE_URL")
+	if dbURL == "" {
+		log.Fatal("DATABASE_URL is not set")
+	}
+	conn, err := db.NewPostgresDB(dbURL)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer conn.Close()
+
+	ctx := context.Background()
+	if err := db.Migrate(ctx, conn); err != nil {
+		log.Fatal(err)
+	}
+	if err := models.ImportICD(ctx, conn, name, chapters, codes); err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("imported %d %s codes in %d chapters", len(codes), name, len(chapters))
+}
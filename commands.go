@@ -0,0 +1,214 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"myapp/backup"
+	"myapp/models"
+	"myapp/seed"
+	"os"
+	"text/tabwriter"
+	"time"
+)
+
+// runCommand runs the subcommand named by args[0]:
+//
+//	myapp backup [FILE]          archive the tables to FILE, or a dated file
+//	myapp restore [-check] FILE  replace the tables with an archive
+//	myapp seed [flags]           fill an empty organization with fake data
+//	myapp orgs [add SLUG NAME]   list the organizations, or add one
+//	myapp keys rotate            encrypt personal data with the current key
+//
+// FILE may be - for standard output or input.
+func runCommand(ctx context.Context, dbConn *sql.DB, args []string) error {
+	switch args[0] {
+	case "orgs":
+		return runOrgs(ctx, dbConn, args[1:])
+	case "backup":
+		return runBackup(ctx, dbConn, args[1:])
+	case "restore":
+		return runRestore(ctx, dbConn, args[1:])
+	case "seed":
+		return runSeed(ctx, dbConn, args[1:])
+	case "keys":
+		return runKeys(ctx, dbConn, args[1:])
+	}
+	return fmt.Errorf("unknown command %q; the commands are backup, restore, seed, orgs and keys", args[0])
+}
+
+func runBackup(ctx context.Context, dbConn *sql.DB, args []string) error {
+	flags := flag.NewFlagSet("backup", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: myapp backup [FILE]")
+	}
+	flags.Parse(args)
+	if flags.NArg() > 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+	name := flags.Arg(0)
+	if name == "" {
+		name = "backup-" + time.Now().Format("20060102-150405") + ".tar"
+	}
+
+	out := os.Stdout
+	if name != "-" {
+		// A partial archive is removed, not left to look like a good one.
+		f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if err != nil {
+			return err
+		}
+		out = f
+	}
+	m, err := backup.Backup(ctx, dbConn, out)
+	if out != os.Stdout {
+		if cerr := out.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			os.Remove(name)
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	var rows int64
+	for _, t := range m.Tables {
+		rows += t.Rows
+	}
+	log.Printf("Backed up %d rows of %d tables at schema %s to %s", rows, len(m.Tables), m.SchemaVersion, name)
+	return nil
+}
+
+func runRestore(ctx context.Context, dbConn *sql.DB, args []string) error {
+	flags := flag.NewFlagSet("restore", flag.ExitOnError)
+	check := flags.Bool("check", false, "verify the archive against the database without changing it")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: myapp restore [-check] FILE")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+	name := flags.Arg(0)
+
+	var r io.Reader = os.Stdin
+	if name != "-" {
+		f, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+	m, err := backup.Restore(ctx, dbConn, r, *check)
+	if errors.Is(err, context.Canceled) {
+		return errors.New("interrupted; nothing was restored")
+	}
+	if err != nil {
+		return err
+	}
+
+	verb := "Restored"
+	if *check {
+		verb = "Verified"
+	}
+	for _, t := range m.Tables {
+		log.Printf("%s %s: %d rows", verb, t.Name, t.Rows)
+	}
+	log.Printf("%s the backup of %s", verb, m.CreatedAt.Local().Format("2006-01-02 15:04:05"))
+	return nil
+}
+
+func runSeed(ctx context.Context, dbConn *sql.DB, args []string) error {
+	flags := flag.NewFlagSet("seed", flag.ExitOnError)
+	cfg := seed.Config{}
+	flags.Uint64Var(&cfg.Seed, "seed", 1, "random seed; the same seed, sizes and date give the same data")
+	flags.IntVar(&cfg.Countries, "countries", 50, "number of countries, up to 249")
+	flags.IntVar(&cfg.Users, "users", 1000, "number of users, of which about 70% are patients, 5% doctors and 3% public servants")
+	today := flags.String("today", time.Now().Format(time.DateOnly), "date the discoveries lead up to, as YYYY-MM-DD")
+	slug := flags.String("org", "default", "slug of the organization to fill")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: myapp seed [flags]")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
+	var err error
+	if cfg.Today, err = time.Parse(time.DateOnly, *today); err != nil {
+		return fmt.Errorf("invalid -today: %w", err)
+	}
+
+	org, err := models.GetOrganizationBySlug(ctx, dbConn, *slug)
+	if err != nil {
+		return err
+	}
+	if org == nil {
+		return fmt.Errorf("no organization %q; add it with `myapp orgs add`", *slug)
+	}
+
+	start := time.Now()
+	counts, err := seed.Run(models.WithTenant(ctx, org.ID), dbConn, cfg)
+	if err != nil {
+		return err
+	}
+	var rows int
+	for _, c := range counts {
+		rows += c.Rows
+	}
+	log.Printf("Seeded %d rows for %s in %s", rows, org.Name, time.Since(start).Round(time.Millisecond))
+	return nil
+}
+
+func runOrgs(ctx context.Context, dbConn *sql.DB, args []string) error {
+	switch {
+	case len(args) == 0:
+		orgs, err := models.GetOrganizations(ctx, dbConn)
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tSLUG\tNAME\tCREATED")
+		for _, o := range orgs {
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", o.ID, o.Slug, o.Name, o.CreatedAt.Local().Format(time.DateOnly))
+		}
+		return w.Flush()
+	case len(args) == 3 && args[0] == "add":
+		o, err := models.CreateOrganization(ctx, dbConn, args[1], args[2])
+		if err != nil {
+			return err
+		}
+		log.Printf("Added organization %s (%s) with id %d", o.Name, o.Slug, o.ID)
+		return nil
+	}
+	fmt.Fprintln(os.Stderr, "usage: myapp orgs [add SLUG NAME]")
+	os.Exit(2)
+	return nil
+}
+
+func runKeys(ctx context.Context, dbConn *sql.DB, args []string) error {
+	if len(args) != 1 || args[0] != "rotate" {
+		fmt.Fprintln(os.Stderr, "usage: myapp keys rotate")
+		os.Exit(2)
+	}
+	if models.FieldKeys == nil {
+		return errors.New("FIELD_ENCRYPTION_KEYS is not set")
+	}
+
+	r, err := models.RotateFieldKeys(models.WithAllTenants(ctx), dbConn)
+	if r != nil {
+		log.Printf("Rewrote %d rows and %d history versions under key %s", r.Rows, r.Versions, models.FieldKeys.Current())
+	}
+	return err
+}
@@ -10,10 +10,11 @@ import (
 
 func NewPostgresDB(connStr string) (*sql.DB, error) {
 	log.Println("DEBUG: Opening database connection...")
-	db, err := sql.Open("postgres", connStr)
+	connector, err := newTenantConnector(connStr)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open connection: %w", err)
 	}
+	db := sql.OpenDB(connector)
 
 	log.Println("DEBUG: Pinging database...")
 
@@ -0,0 +1,110 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"log"
+	"myapp/models"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// Migrations bring an existing database up to date with schema.sql. Each
+// file in migrations/ runs once, in name order, inside a transaction, and
+// is recorded in schema_migrations.
+//
+//go:embed migrations/*.sql
+var migrations embed.FS
+
+// Migrate applies the migrations that have not run yet. They see the rows
+// of every organization. It then checks that they keep personal data out
+// of webhooks.
+func Migrate(ctx context.Context, db *sql.DB) error {
+	ctx = models.WithAllTenants(ctx)
+	_, err := db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version TEXT PRIMARY KEY,
+		applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+	)`)
+	if err != nil {
+		return fmt.Errorf("creating schema_migrations: %w", err)
+	}
+
+	names, err := fs.Glob(migrations, "migrations/*.sql")
+	if err != nil {
+		return err
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		version := strings.TrimSuffix(strings.TrimPrefix(name, "migrations/"), ".sql")
+		if err := apply(ctx, db, version, name); err != nil {
+			return fmt.Errorf("migration %s: %w", version, err)
+		}
+	}
+	return checkPersonalColumns(ctx, db)
+}
+
+func apply(ctx context.Context, db *sql.DB, version, name string) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Serialize concurrent instances starting at the same time.
+	if _, err := tx.ExecContext(ctx, "LOCK TABLE schema_migrations IN EXCLUSIVE MODE"); err != nil {
+		return err
+	}
+
+	var done bool
+	if err := tx.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM schema_migrations WHERE version=$1)", version).Scan(&done); err != nil {
+		return err
+	}
+	if done {
+		return nil
+	}
+
+	script, err := migrations.ReadFile(name)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, string(script)); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, "INSERT INTO schema_migrations (version) VALUES ($1)", version); err != nil {
+		return err
+	}
+
+	log.Printf("Applied migration %s", version)
+	return tx.Commit()
+}
+
+// checkPersonalColumns fails if personal_columns, which keeps personal
+// data out of webhook payloads (0014_webhook_personal_data.sql), does not
+// list the columns db/schema.sql masks: a new one needs a migration.
+func checkPersonalColumns(ctx context.Context, db *sql.DB) error {
+	for _, t := range models.Tables {
+		var want, got []string
+		for _, c := range t.Columns {
+			if c.Personal() {
+				want = append(want, c.Name)
+			}
+		}
+		table := strings.ToLower(t.Name)
+		if err := db.QueryRowContext(ctx, "SELECT personal_columns($1)", table).Scan(pq.Array(&got)); err != nil {
+			return err
+		}
+		slices.Sort(want)
+		slices.Sort(got)
+		if !slices.Equal(want, got) {
+			return fmt.Errorf("personal_columns(%q) is %v, but db/schema.sql masks %v", table, got, want)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,14 @@
+-- Soft delete: rows are marked instead of removed and purged after the
+-- retention period; see models/trash.go.
+
+ALTER TABLE Country ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ, ADD COLUMN IF NOT EXISTS deleted_by VARCHAR(60);
+ALTER TABLE Users ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ, ADD COLUMN IF NOT EXISTS deleted_by VARCHAR(60);
+ALTER TABLE DiseaseType ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ, ADD COLUMN IF NOT EXISTS deleted_by VARCHAR(60);
+ALTER TABLE Disease ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ, ADD COLUMN IF NOT EXISTS deleted_by VARCHAR(60);
+ALTER TABLE Discover ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ, ADD COLUMN IF NOT EXISTS deleted_by VARCHAR(60);
+ALTER TABLE Patients ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ, ADD COLUMN IF NOT EXISTS deleted_by VARCHAR(60);
+ALTER TABLE PublicServant ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ, ADD COLUMN IF NOT EXISTS deleted_by VARCHAR(60);
+ALTER TABLE Doctor ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ, ADD COLUMN IF NOT EXISTS deleted_by VARCHAR(60);
+ALTER TABLE Specialize ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ, ADD COLUMN IF NOT EXISTS deleted_by VARCHAR(60);
+ALTER TABLE PatientDisease ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ, ADD COLUMN IF NOT EXISTS deleted_by VARCHAR(60);
+ALTER TABLE Record ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ, ADD COLUMN IF NOT EXISTS deleted_by VARCHAR(60);
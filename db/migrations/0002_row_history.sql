@@ -0,0 +1,114 @@
+-- Row history: every version of every row is kept in row_history, keyed by
+-- table and primary key, with the interval during which it was current.
+-- The record_history trigger maintains it; its arguments are the table's
+-- primary key columns. See models/history.go.
+
+CREATE TABLE IF NOT EXISTS row_history (
+    id BIGSERIAL PRIMARY KEY,
+    table_name TEXT NOT NULL,
+    row_key JSONB NOT NULL,
+    data JSONB NOT NULL,
+    valid_from TIMESTAMPTZ NOT NULL,
+    valid_to TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS row_history_row_idx ON row_history (table_name, row_key, valid_from);
+CREATE INDEX IF NOT EXISTS row_history_period_idx ON row_history (table_name, valid_from, valid_to);
+
+CREATE OR REPLACE FUNCTION record_history() RETURNS trigger AS $$
+DECLARE
+    col TEXT;
+    old_key JSONB := '{}';
+    new_key JSONB := '{}';
+BEGIN
+    IF TG_OP = 'UPDATE' AND to_jsonb(OLD) = to_jsonb(NEW) THEN
+        RETURN NULL;
+    END IF;
+
+    IF TG_OP IN ('UPDATE', 'DELETE') THEN
+        FOREACH col IN ARRAY TG_ARGV LOOP
+            old_key := old_key || jsonb_build_object(col, to_jsonb(OLD) ->> col);
+        END LOOP;
+        UPDATE row_history SET valid_to = clock_timestamp()
+        WHERE table_name = TG_TABLE_NAME AND row_key = old_key AND valid_to IS NULL;
+    END IF;
+
+    IF TG_OP IN ('INSERT', 'UPDATE') THEN
+        FOREACH col IN ARRAY TG_ARGV LOOP
+            new_key := new_key || jsonb_build_object(col, to_jsonb(NEW) ->> col);
+        END LOOP;
+        UPDATE row_history SET valid_to = clock_timestamp()
+        WHERE table_name = TG_TABLE_NAME AND row_key = new_key AND valid_to IS NULL;
+        INSERT INTO row_history (table_name, row_key, data, valid_from)
+        VALUES (TG_TABLE_NAME, new_key, to_jsonb(NEW), clock_timestamp());
+    END IF;
+
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS country_history ON Country;
+CREATE TRIGGER country_history AFTER INSERT OR UPDATE OR DELETE ON Country
+    FOR EACH ROW EXECUTE FUNCTION record_history('cname');
+INSERT INTO row_history (table_name, row_key, data, valid_from)
+    SELECT 'country', jsonb_build_object('cname', cname::text), to_jsonb(t), now() FROM Country t;
+
+DROP TRIGGER IF EXISTS users_history ON Users;
+CREATE TRIGGER users_history AFTER INSERT OR UPDATE OR DELETE ON Users
+    FOR EACH ROW EXECUTE FUNCTION record_history('email');
+INSERT INTO row_history (table_name, row_key, data, valid_from)
+    SELECT 'users', jsonb_build_object('email', email::text), to_jsonb(t), now() FROM Users t;
+
+DROP TRIGGER IF EXISTS diseasetype_history ON DiseaseType;
+CREATE TRIGGER diseasetype_history AFTER INSERT OR UPDATE OR DELETE ON DiseaseType
+    FOR EACH ROW EXECUTE FUNCTION record_history('id');
+INSERT INTO row_history (table_name, row_key, data, valid_from)
+    SELECT 'diseasetype', jsonb_build_object('id', id::text), to_jsonb(t), now() FROM DiseaseType t;
+
+DROP TRIGGER IF EXISTS disease_history ON Disease;
+CREATE TRIGGER disease_history AFTER INSERT OR UPDATE OR DELETE ON Disease
+    FOR EACH ROW EXECUTE FUNCTION record_history('disease_code');
+INSERT INTO row_history (table_name, row_key, data, valid_from)
+    SELECT 'disease', jsonb_build_object('disease_code', disease_code::text), to_jsonb(t), now() FROM Disease t;
+
+DROP TRIGGER IF EXISTS discover_history ON Discover;
+CREATE TRIGGER discover_history AFTER INSERT OR UPDATE OR DELETE ON Discover
+    FOR EACH ROW EXECUTE FUNCTION record_history('cname', 'disease_code');
+INSERT INTO row_history (table_name, row_key, data, valid_from)
+    SELECT 'discover', jsonb_build_object('cname', cname::text, 'disease_code', disease_code::text), to_jsonb(t), now() FROM Discover t;
+
+DROP TRIGGER IF EXISTS patients_history ON Patients;
+CREATE TRIGGER patients_history AFTER INSERT OR UPDATE OR DELETE ON Patients
+    FOR EACH ROW EXECUTE FUNCTION record_history('email');
+INSERT INTO row_history (table_name, row_key, data, valid_from)
+    SELECT 'patients', jsonb_build_object('email', email::text), to_jsonb(t), now() FROM Patients t;
+
+DROP TRIGGER IF EXISTS publicservant_history ON PublicServant;
+CREATE TRIGGER publicservant_history AFTER INSERT OR UPDATE OR DELETE ON PublicServant
+    FOR EACH ROW EXECUTE FUNCTION record_history('email');
+INSERT INTO row_history (table_name, row_key, data, valid_from)
+    SELECT 'publicservant', jsonb_build_object('email', email::text), to_jsonb(t), now() FROM PublicServant t;
+
+DROP TRIGGER IF EXISTS doctor_history ON Doctor;
+CREATE TRIGGER doctor_history AFTER INSERT OR UPDATE OR DELETE ON Doctor
+    FOR EACH ROW EXECUTE FUNCTION record_history('email');
+INSERT INTO row_history (table_name, row_key, data, valid_from)
+    SELECT 'doctor', jsonb_build_object('email', email::text), to_jsonb(t), now() FROM Doctor t;
+
+DROP TRIGGER IF EXISTS specialize_history ON Specialize;
+CREATE TRIGGER specialize_history AFTER INSERT OR UPDATE OR DELETE ON Specialize
+    FOR EACH ROW EXECUTE FUNCTION record_history('id', 'email');
+INSERT INTO row_history (table_name, row_key, data, valid_from)
+    SELECT 'specialize', jsonb_build_object('id', id::text, 'email', email::text), to_jsonb(t), now() FROM Specialize t;
+
+DROP TRIGGER IF EXISTS patientdisease_history ON PatientDisease;
+CREATE TRIGGER patientdisease_history AFTER INSERT OR UPDATE OR DELETE ON PatientDisease
+    FOR EACH ROW EXECUTE FUNCTION record_history('email', 'disease_code');
+INSERT INTO row_history (table_name, row_key, data, valid_from)
+    SELECT 'patientdisease', jsonb_build_object('email', email::text, 'disease_code', disease_code::text), to_jsonb(t), now() FROM PatientDisease t;
+
+DROP TRIGGER IF EXISTS record_history ON Record;
+CREATE TRIGGER record_history AFTER INSERT OR UPDATE OR DELETE ON Record
+    FOR EACH ROW EXECUTE FUNCTION record_history('email', 'cname', 'disease_code');
+INSERT INTO row_history (table_name, row_key, data, valid_from)
+    SELECT 'record', jsonb_build_object('email', email::text, 'cname', cname::text, 'disease_code', disease_code::text), to_jsonb(t), now() FROM Record t;
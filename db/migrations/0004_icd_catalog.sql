@@ -0,0 +1,28 @@
+-- Local copy of the ICD-10 and ICD-11 code lists, loaded by cmd/icdimport.
+-- Chapters can be mapped to a disease type, which new diseases with a code
+-- from that chapter get by default.
+
+CREATE TABLE IF NOT EXISTS icd_chapter (
+    system VARCHAR(6) NOT NULL CHECK (system IN ('ICD-10', 'ICD-11')),
+    chapter VARCHAR(10) NOT NULL,
+    title TEXT NOT NULL,
+    disease_type_id INT REFERENCES DiseaseType (id),
+    PRIMARY KEY (system, chapter)
+);
+
+CREATE TABLE IF NOT EXISTS icd_code (
+    system VARCHAR(6) NOT NULL,
+    code VARCHAR(20) NOT NULL,
+    code_key VARCHAR(20) NOT NULL, -- upper case without dots, for lookups
+    title TEXT NOT NULL,
+    chapter VARCHAR(10) NOT NULL,
+    PRIMARY KEY (system, code),
+    FOREIGN KEY (system, chapter) REFERENCES icd_chapter (system, chapter)
+);
+
+CREATE INDEX IF NOT EXISTS icd_code_key_idx ON icd_code (code_key text_pattern_ops);
+
+-- Codes entered before the catalog existed are kept as custom codes.
+ALTER TABLE Disease ADD COLUMN IF NOT EXISTS custom BOOLEAN;
+UPDATE Disease SET custom = TRUE WHERE custom IS NULL;
+ALTER TABLE Disease ALTER COLUMN custom SET DEFAULT FALSE, ALTER COLUMN custom SET NOT NULL;
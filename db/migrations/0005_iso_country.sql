@@ -0,0 +1,17 @@
+-- ISO 3166-1 codes for countries, filled in by cmd/countryref, and the
+-- alternative names recorded when duplicate countries are merged.
+
+ALTER TABLE Country
+    ADD COLUMN IF NOT EXISTS iso_alpha2 CHAR(2),
+    ADD COLUMN IF NOT EXISTS iso_alpha3 CHAR(3),
+    ADD COLUMN IF NOT EXISTS iso_numeric CHAR(3);
+
+CREATE UNIQUE INDEX IF NOT EXISTS country_iso_alpha2_idx ON Country (iso_alpha2) WHERE deleted_at IS NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS country_iso_alpha3_idx ON Country (iso_alpha3) WHERE deleted_at IS NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS country_iso_numeric_idx ON Country (iso_numeric) WHERE deleted_at IS NULL;
+
+CREATE TABLE IF NOT EXISTS country_alias (
+    alias_key VARCHAR(50) PRIMARY KEY, -- iso3166.Key of the alias
+    alias VARCHAR(50) NOT NULL,
+    cname VARCHAR(50) NOT NULL REFERENCES Country (cname) ON UPDATE CASCADE ON DELETE CASCADE
+);
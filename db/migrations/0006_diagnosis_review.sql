@@ -0,0 +1,18 @@
+-- Diagnoses received over HL7 whose code matches no disease. They wait
+-- here until someone maps them to a disease or dismisses them on
+-- /hl7/review.
+
+CREATE TABLE IF NOT EXISTS diagnosis_review (
+    id SERIAL PRIMARY KEY,
+    received_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    source VARCHAR(200) NOT NULL, -- sending system and message control ID
+    email VARCHAR(60) NOT NULL REFERENCES Users (email) ON UPDATE CASCADE ON DELETE CASCADE,
+    code VARCHAR(50) NOT NULL,
+    coding_system VARCHAR(20) NOT NULL DEFAULT '',
+    description VARCHAR(200) NOT NULL DEFAULT '',
+    resolved_at TIMESTAMPTZ,
+    resolved_by VARCHAR(60),
+    disease_code VARCHAR(50) REFERENCES Disease (disease_code) -- NULL when dismissed
+);
+
+CREATE INDEX IF NOT EXISTS diagnosis_review_pending_idx ON diagnosis_review (received_at) WHERE resolved_at IS NULL;
@@ -0,0 +1,138 @@
+-- Outbound webhooks. The queue_webhooks trigger writes one
+-- webhook_delivery row per matching webhook in the transaction that
+-- changes the row, so an event is queued if and only if the change
+-- commits. A background dispatcher delivers them; see models/webhook.go.
+
+CREATE TABLE IF NOT EXISTS webhook (
+    id SERIAL PRIMARY KEY,
+    url TEXT NOT NULL,
+    secret TEXT NOT NULL,
+    entity TEXT NOT NULL, -- lower-case table name, e.g. discover
+    operations TEXT[] NOT NULL, -- any of create, update, delete
+    column_name TEXT, -- updates only count when this column changes
+    increase_only BOOLEAN NOT NULL DEFAULT FALSE, -- ... and its value rises
+    active BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS webhook_delivery (
+    id BIGSERIAL PRIMARY KEY,
+    webhook_id INT NOT NULL REFERENCES webhook (id) ON DELETE CASCADE,
+    event TEXT NOT NULL, -- entity.operation
+    payload JSONB NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    attempts INT NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    last_status INT,
+    last_error TEXT,
+    delivered_at TIMESTAMPTZ,
+    dead_at TIMESTAMPTZ -- gave up after too many attempts
+);
+
+CREATE INDEX IF NOT EXISTS webhook_delivery_due_idx ON webhook_delivery (next_attempt_at)
+    WHERE delivered_at IS NULL AND dead_at IS NULL;
+CREATE INDEX IF NOT EXISTS webhook_delivery_dead_idx ON webhook_delivery (dead_at) WHERE dead_at IS NOT NULL;
+
+-- Soft deletes and restores are reported as delete and create. Updates
+-- that only bump the version are not reported.
+CREATE OR REPLACE FUNCTION queue_webhooks() RETURNS trigger AS $$
+DECLARE
+    tbl TEXT := lower(TG_TABLE_NAME);
+    op TEXT;
+    old_row JSONB;
+    new_row JSONB;
+    data JSONB;
+BEGIN
+    IF TG_OP <> 'INSERT' THEN
+        old_row := to_jsonb(OLD) - 'version';
+    END IF;
+    IF TG_OP <> 'DELETE' THEN
+        new_row := to_jsonb(NEW) - 'version';
+    END IF;
+
+    IF TG_OP = 'INSERT' THEN
+        op := 'create';
+    ELSIF TG_OP = 'DELETE' THEN
+        -- Purging a row that is already in the trash was reported when it
+        -- was deleted.
+        IF old_row ->> 'deleted_at' IS NOT NULL THEN
+            RETURN NULL;
+        END IF;
+        op := 'delete';
+    ELSIF old_row = new_row THEN
+        RETURN NULL;
+    ELSIF old_row ->> 'deleted_at' IS NULL AND new_row ->> 'deleted_at' IS NOT NULL THEN
+        op := 'delete';
+    ELSIF old_row ->> 'deleted_at' IS NOT NULL AND new_row ->> 'deleted_at' IS NULL THEN
+        op := 'create';
+    ELSIF new_row ->> 'deleted_at' IS NOT NULL THEN
+        RETURN NULL;
+    ELSE
+        op := 'update';
+    END IF;
+
+    data := COALESCE(new_row, old_row) - 'deleted_at' - 'deleted_by';
+    INSERT INTO webhook_delivery (webhook_id, event, payload)
+    SELECT w.id, tbl || '.' || op, jsonb_build_object(
+        'event', tbl || '.' || op,
+        'entity', tbl,
+        'operation', op,
+        'occurred_at', clock_timestamp(),
+        'data', data,
+        'previous', CASE WHEN op = 'update' THEN old_row - 'deleted_at' - 'deleted_by' END)
+    FROM webhook w
+    WHERE w.active AND w.entity = tbl AND op = ANY (w.operations)
+        AND (op <> 'update' OR w.column_name IS NULL
+            OR (old_row -> w.column_name IS DISTINCT FROM new_row -> w.column_name
+                AND (NOT w.increase_only
+                    OR (jsonb_typeof(old_row -> w.column_name) = 'number'
+                        AND jsonb_typeof(new_row -> w.column_name) = 'number'
+                        AND (new_row ->> w.column_name)::numeric > (old_row ->> w.column_name)::numeric))));
+
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS country_webhooks ON Country;
+CREATE TRIGGER country_webhooks AFTER INSERT OR UPDATE OR DELETE ON Country
+    FOR EACH ROW EXECUTE FUNCTION queue_webhooks();
+
+DROP TRIGGER IF EXISTS users_webhooks ON Users;
+CREATE TRIGGER users_webhooks AFTER INSERT OR UPDATE OR DELETE ON Users
+    FOR EACH ROW EXECUTE FUNCTION queue_webhooks();
+
+DROP TRIGGER IF EXISTS diseasetype_webhooks ON DiseaseType;
+CREATE TRIGGER diseasetype_webhooks AFTER INSERT OR UPDATE OR DELETE ON DiseaseType
+    FOR EACH ROW EXECUTE FUNCTION queue_webhooks();
+
+DROP TRIGGER IF EXISTS disease_webhooks ON Disease;
+CREATE TRIGGER disease_webhooks AFTER INSERT OR UPDATE OR DELETE ON Disease
+    FOR EACH ROW EXECUTE FUNCTION queue_webhooks();
+
+DROP TRIGGER IF EXISTS discover_webhooks ON Discover;
+CREATE TRIGGER discover_webhooks AFTER INSERT OR UPDATE OR DELETE ON Discover
+    FOR EACH ROW EXECUTE FUNCTION queue_webhooks();
+
+DROP TRIGGER IF EXISTS patients_webhooks ON Patients;
+CREATE TRIGGER patients_webhooks AFTER INSERT OR UPDATE OR DELETE ON Patients
+    FOR EACH ROW EXECUTE FUNCTION queue_webhooks();
+
+DROP TRIGGER IF EXISTS publicservant_webhooks ON PublicServant;
+CREATE TRIGGER publicservant_webhooks AFTER INSERT OR UPDATE OR DELETE ON PublicServant
+    FOR EACH ROW EXECUTE FUNCTION queue_webhooks();
+
+DROP TRIGGER IF EXISTS doctor_webhooks ON Doctor;
+CREATE TRIGGER doctor_webhooks AFTER INSERT OR UPDATE OR DELETE ON Doctor
+    FOR EACH ROW EXECUTE FUNCTION queue_webhooks();
+
+DROP TRIGGER IF EXISTS specialize_webhooks ON Specialize;
+CREATE TRIGGER specialize_webhooks AFTER INSERT OR UPDATE OR DELETE ON Specialize
+    FOR EACH ROW EXECUTE FUNCTION queue_webhooks();
+
+DROP TRIGGER IF EXISTS patientdisease_webhooks ON PatientDisease;
+CREATE TRIGGER patientdisease_webhooks AFTER INSERT OR UPDATE OR DELETE ON PatientDisease
+    FOR EACH ROW EXECUTE FUNCTION queue_webhooks();
+
+DROP TRIGGER IF EXISTS record_webhooks ON Record;
+CREATE TRIGGER record_webhooks AFTER INSERT OR UPDATE OR DELETE ON Record
+    FOR EACH ROW EXECUTE FUNCTION queue_webhooks();
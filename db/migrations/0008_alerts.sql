@@ -0,0 +1,38 @@
+-- Outbreak alerts. Rules are evaluated periodically over Record and
+-- Discover; each subject (a country and disease) that meets a rule raises
+-- an alert, which stays until it is resolved. See package alert.
+
+CREATE TABLE IF NOT EXISTS alert_rule (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(100) NOT NULL,
+    kind TEXT NOT NULL CHECK (kind IN ('fatality_rate', 'new_discovery', 'patient_growth')),
+    disease_code VARCHAR(50), -- NULL for every disease
+    cname VARCHAR(50), -- NULL for every country
+    threshold NUMERIC NOT NULL DEFAULT 0, -- percent
+    min_patients INT NOT NULL DEFAULT 0,
+    window_days INT NOT NULL DEFAULT 7 CHECK (window_days > 0),
+    severity TEXT NOT NULL DEFAULT 'warning' CHECK (severity IN ('info', 'warning', 'critical')),
+    active BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS alert (
+    id BIGSERIAL PRIMARY KEY,
+    rule_id INT NOT NULL REFERENCES alert_rule (id) ON DELETE CASCADE,
+    cname VARCHAR(50) NOT NULL,
+    disease_code VARCHAR(50) NOT NULL,
+    message TEXT NOT NULL,
+    value NUMERIC, -- the measure that met the rule, e.g. the fatality rate
+    status TEXT NOT NULL DEFAULT 'open' CHECK (status IN ('open', 'acknowledged', 'resolved')),
+    raised_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    acknowledged_at TIMESTAMPTZ,
+    acknowledged_by VARCHAR(60),
+    resolved_at TIMESTAMPTZ,
+    resolved_by VARCHAR(60),
+    cleared_at TIMESTAMPTZ, -- when the rule stopped being met
+    notified_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS alert_subject_idx ON alert (rule_id, cname, disease_code, id);
+CREATE INDEX IF NOT EXISTS alert_unresolved_idx ON alert (raised_at) WHERE status <> 'resolved';
+CREATE INDEX IF NOT EXISTS alert_unnotified_idx ON alert (id) WHERE notified_at IS NULL;
@@ -0,0 +1,81 @@
+-- Email notifications. Emails wait in email_outbox until the mailer
+-- renders and sends them; see package mail. Each user chooses what to be
+-- told about in notification_preference; users without a row get the
+-- defaults.
+
+CREATE TABLE IF NOT EXISTS notification_preference (
+    email VARCHAR(60) PRIMARY KEY REFERENCES Users (email) ON UPDATE CASCADE ON DELETE CASCADE,
+    record_changes BOOLEAN NOT NULL DEFAULT TRUE, -- changes to the records the user reported
+    alerts TEXT NOT NULL DEFAULT 'none' CHECK (alerts IN ('none', 'country', 'all')) -- outbreak alerts, for the user's country or any
+);
+
+CREATE TABLE IF NOT EXISTS email_outbox (
+    id BIGSERIAL PRIMARY KEY,
+    recipient VARCHAR(60) NOT NULL,
+    template TEXT NOT NULL, -- e.g. record_changed
+    data JSONB NOT NULL, -- the template's data
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    attempts INT NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    last_error TEXT,
+    sent_at TIMESTAMPTZ,
+    dead_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS email_outbox_due_idx ON email_outbox (next_attempt_at)
+    WHERE sent_at IS NULL AND dead_at IS NULL;
+
+-- Tells the public servant who reported a record when it is created,
+-- changed, deleted or restored, unless they opted out. Operations are
+-- named as for webhooks.
+CREATE OR REPLACE FUNCTION queue_record_email() RETURNS trigger AS $$
+DECLARE
+    op TEXT;
+    old_row JSONB;
+    new_row JSONB;
+BEGIN
+    new_row := to_jsonb(NEW) - 'version';
+    IF TG_OP = 'UPDATE' THEN
+        old_row := to_jsonb(OLD) - 'version';
+    END IF;
+
+    IF TG_OP = 'INSERT' THEN
+        op := 'create';
+    ELSIF old_row = new_row OR (new_row ->> 'deleted_at' IS NOT NULL AND old_row ->> 'deleted_at' IS NOT NULL) THEN
+        RETURN NULL;
+    ELSIF new_row ->> 'deleted_at' IS NOT NULL THEN
+        op := 'delete';
+    ELSIF old_row ->> 'deleted_at' IS NOT NULL THEN
+        op := 'create';
+    ELSE
+        op := 'update';
+    END IF;
+
+    IF NOT EXISTS (SELECT 1 FROM notification_preference WHERE email = new_row ->> 'email' AND NOT record_changes) THEN
+        INSERT INTO email_outbox (recipient, template, data)
+        VALUES (new_row ->> 'email', 'record_changed', jsonb_build_object(
+            'operation', op,
+            'record', new_row - 'deleted_at' - 'deleted_by',
+            'previous', CASE WHEN op = 'update' THEN old_row - 'deleted_at' - 'deleted_by' END,
+            'deleted_by', new_row ->> 'deleted_by',
+            'changed_at', clock_timestamp()));
+    END IF;
+
+    -- A record that moved to another servant is no longer the old one's.
+    IF op = 'update' AND old_row ->> 'email' <> new_row ->> 'email'
+        AND NOT EXISTS (SELECT 1 FROM notification_preference WHERE email = old_row ->> 'email' AND NOT record_changes) THEN
+        INSERT INTO email_outbox (recipient, template, data)
+        VALUES (old_row ->> 'email', 'record_changed', jsonb_build_object(
+            'operation', 'reassign',
+            'record', new_row - 'deleted_at' - 'deleted_by',
+            'previous', old_row - 'deleted_at' - 'deleted_by',
+            'changed_at', clock_timestamp()));
+    END IF;
+
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS record_email ON Record;
+CREATE TRIGGER record_email AFTER INSERT OR UPDATE ON Record
+    FOR EACH ROW EXECUTE FUNCTION queue_record_email();
@@ -0,0 +1,36 @@
+-- Background jobs. A job is claimed by one worker at a time with
+-- FOR UPDATE SKIP LOCKED and leased until locked_until; a job whose
+-- worker died is claimed again once the lease runs out. Schedules add a
+-- job whenever their cron spec is due. See package job.
+
+CREATE TABLE IF NOT EXISTS job (
+    id BIGSERIAL PRIMARY KEY,
+    kind TEXT NOT NULL, -- names the handler, e.g. purge_trash
+    payload JSONB NOT NULL DEFAULT '{}',
+    status TEXT NOT NULL DEFAULT 'queued'
+        CHECK (status IN ('queued', 'running', 'succeeded', 'failed', 'cancelled')),
+    attempts INT NOT NULL DEFAULT 0,
+    max_attempts INT NOT NULL DEFAULT 5 CHECK (max_attempts > 0),
+    run_at TIMESTAMPTZ NOT NULL DEFAULT now(), -- not before
+    locked_by TEXT, -- the worker running it
+    locked_until TIMESTAMPTZ,
+    last_error TEXT,
+    schedule TEXT, -- the schedule that added it, if any
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    started_at TIMESTAMPTZ,
+    finished_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS job_due_idx ON job (run_at) WHERE status = 'queued';
+CREATE INDEX IF NOT EXISTS job_running_idx ON job (locked_until) WHERE status = 'running';
+CREATE INDEX IF NOT EXISTS job_created_idx ON job (created_at);
+
+CREATE TABLE IF NOT EXISTS job_schedule (
+    name TEXT PRIMARY KEY,
+    spec TEXT NOT NULL, -- cron, e.g. "0 3 * * *" or "@hourly"
+    kind TEXT NOT NULL,
+    payload JSONB NOT NULL DEFAULT '{}',
+    active BOOLEAN NOT NULL DEFAULT TRUE,
+    next_run_at TIMESTAMPTZ NOT NULL,
+    last_run_at TIMESTAMPTZ
+);
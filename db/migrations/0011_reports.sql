@@ -0,0 +1,31 @@
+-- Epidemiology reports. A schedule generates a report on its cron spec
+-- through a generate_report job; every report is kept with its HTML and
+-- PDF renderings. See package report.
+
+CREATE TABLE IF NOT EXISTS report_schedule (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(100) NOT NULL,
+    scope TEXT NOT NULL CHECK (scope IN ('country', 'disease')),
+    subject VARCHAR(50), -- the country or disease code; NULL for all
+    spec TEXT NOT NULL, -- cron, e.g. "0 6 * * mon"
+    period_days INT NOT NULL DEFAULT 7 CHECK (period_days > 0),
+    active BOOLEAN NOT NULL DEFAULT TRUE,
+    next_run_at TIMESTAMPTZ NOT NULL,
+    last_run_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS report (
+    id BIGSERIAL PRIMARY KEY,
+    schedule_id INT REFERENCES report_schedule (id) ON DELETE SET NULL,
+    title TEXT NOT NULL,
+    scope TEXT NOT NULL,
+    subject VARCHAR(50),
+    period_start TIMESTAMPTZ NOT NULL,
+    period_end TIMESTAMPTZ NOT NULL,
+    generated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    html TEXT NOT NULL,
+    pdf BYTEA NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS report_generated_idx ON report (generated_at);
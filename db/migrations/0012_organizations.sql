@@ -0,0 +1,304 @@
+-- Organizations: one deployment serves several health agencies whose data
+-- is kept apart. Every row of their data carries the organization's
+-- tenant_id, and row-level security only shows a session the rows of the
+-- organization in its app.tenant setting, or every row when it is 'all'
+-- (see db/tenant.go and models/tenant.go). Rows that exist already belong
+-- to the default organization.
+--
+-- Primary keys and the foreign keys between the application tables start
+-- with tenant_id, so two organizations can use the same country names,
+-- emails and disease codes, and no row can reference another
+-- organization's.
+
+CREATE TABLE IF NOT EXISTS organization (
+    id SERIAL PRIMARY KEY,
+    slug VARCHAR(40) NOT NULL UNIQUE CHECK (slug ~ '^[a-z0-9]([a-z0-9-]*[a-z0-9])?$'), -- its subdomain
+    name VARCHAR(100) NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+INSERT INTO organization (slug, name) VALUES ('default', 'Default') ON CONFLICT (slug) DO NOTHING;
+
+-- The organization of the session, NULL when it has none or sees all.
+CREATE OR REPLACE FUNCTION current_tenant() RETURNS INT AS $$
+    SELECT CASE WHEN s ~ '^[0-9]+$' THEN s::int END FROM current_setting('app.tenant', true) s
+$$ LANGUAGE sql STABLE;
+
+-- Whether the session does work for every organization.
+CREATE OR REPLACE FUNCTION all_tenants() RETURNS BOOLEAN AS $$
+    SELECT COALESCE(current_setting('app.tenant', true) = 'all', FALSE)
+$$ LANGUAGE sql STABLE;
+
+-- The chapter to disease type mappings of the ICD catalog point at an
+-- organization's disease types, so they move out of the shared catalog.
+CREATE TABLE IF NOT EXISTS icd_chapter_type (
+    system VARCHAR(6) NOT NULL,
+    chapter VARCHAR(10) NOT NULL,
+    disease_type_id INT NOT NULL,
+    FOREIGN KEY (system, chapter) REFERENCES icd_chapter (system, chapter) ON DELETE CASCADE
+);
+
+DO $$
+BEGIN
+    IF EXISTS (SELECT 1 FROM information_schema.columns WHERE table_name = 'icd_chapter' AND column_name = 'disease_type_id') THEN
+        INSERT INTO icd_chapter_type (system, chapter, disease_type_id)
+            SELECT system, chapter, disease_type_id FROM icd_chapter WHERE disease_type_id IS NOT NULL;
+        ALTER TABLE icd_chapter DROP COLUMN disease_type_id;
+    END IF;
+END $$;
+
+-- tenant_id on every table of organization data. Triggers are off while it
+-- is filled in, so the backfill is not recorded as a change of every row.
+DO $$
+DECLARE
+    t TEXT;
+    def INT := (SELECT id FROM organization WHERE slug = 'default');
+BEGIN
+    FOREACH t IN ARRAY ARRAY['country', 'users', 'diseasetype', 'disease', 'discover', 'patients', 'publicservant',
+        'doctor', 'specialize', 'patientdisease', 'record', 'row_history', 'country_alias', 'diagnosis_review',
+        'webhook', 'webhook_delivery', 'alert_rule', 'alert', 'notification_preference', 'email_outbox',
+        'report_schedule', 'report', 'icd_chapter_type']
+    LOOP
+        EXECUTE format('ALTER TABLE %I ADD COLUMN IF NOT EXISTS tenant_id INT REFERENCES organization (id)', t);
+        EXECUTE format('ALTER TABLE %I DISABLE TRIGGER USER', t);
+        EXECUTE format('UPDATE %I SET tenant_id = $1 WHERE tenant_id IS NULL', t) USING def;
+        EXECUTE format('ALTER TABLE %I ENABLE TRIGGER USER', t);
+        EXECUTE format('ALTER TABLE %I ALTER COLUMN tenant_id SET DEFAULT current_tenant(), ALTER COLUMN tenant_id SET NOT NULL', t);
+    END LOOP;
+END $$;
+
+-- Replace the keys of the application tables, and every foreign key that
+-- references them, with ones that include tenant_id.
+DO $$
+DECLARE
+    c RECORD;
+BEGIN
+    FOR c IN
+        SELECT conrelid::regclass AS tbl, conname FROM pg_constraint
+        WHERE contype = 'f' AND confrelid = ANY (ARRAY['country', 'users', 'diseasetype', 'disease', 'patients',
+            'publicservant', 'doctor']::regclass[])
+    LOOP
+        EXECUTE format('ALTER TABLE %s DROP CONSTRAINT %I', c.tbl, c.conname);
+    END LOOP;
+
+    FOR c IN
+        SELECT conrelid::regclass AS tbl, conname FROM pg_constraint
+        WHERE contype = 'p' AND conrelid = ANY (ARRAY['country', 'users', 'diseasetype', 'disease', 'discover',
+            'patients', 'publicservant', 'doctor', 'specialize', 'patientdisease', 'record', 'country_alias',
+            'notification_preference']::regclass[])
+    LOOP
+        EXECUTE format('ALTER TABLE %s DROP CONSTRAINT %I', c.tbl, c.conname);
+    END LOOP;
+END $$;
+
+ALTER TABLE Country ADD PRIMARY KEY (tenant_id, cname);
+ALTER TABLE Users ADD PRIMARY KEY (tenant_id, email),
+    ADD FOREIGN KEY (tenant_id, cname) REFERENCES Country (tenant_id, cname);
+ALTER TABLE DiseaseType ADD PRIMARY KEY (tenant_id, id);
+ALTER TABLE Disease ADD PRIMARY KEY (tenant_id, disease_code),
+    ADD FOREIGN KEY (tenant_id, id) REFERENCES DiseaseType (tenant_id, id);
+ALTER TABLE Discover ADD PRIMARY KEY (tenant_id, cname, disease_code),
+    ADD FOREIGN KEY (tenant_id, cname) REFERENCES Country (tenant_id, cname),
+    ADD FOREIGN KEY (tenant_id, disease_code) REFERENCES Disease (tenant_id, disease_code);
+ALTER TABLE Patients ADD PRIMARY KEY (tenant_id, email),
+    ADD FOREIGN KEY (tenant_id, email) REFERENCES Users (tenant_id, email);
+ALTER TABLE PublicServant ADD PRIMARY KEY (tenant_id, email),
+    ADD FOREIGN KEY (tenant_id, email) REFERENCES Users (tenant_id, email);
+ALTER TABLE Doctor ADD PRIMARY KEY (tenant_id, email),
+    ADD FOREIGN KEY (tenant_id, email) REFERENCES Users (tenant_id, email);
+ALTER TABLE Specialize ADD PRIMARY KEY (tenant_id, id, email),
+    ADD FOREIGN KEY (tenant_id, id) REFERENCES DiseaseType (tenant_id, id),
+    ADD FOREIGN KEY (tenant_id, email) REFERENCES Doctor (tenant_id, email);
+ALTER TABLE PatientDisease ADD PRIMARY KEY (tenant_id, email, disease_code),
+    ADD FOREIGN KEY (tenant_id, email) REFERENCES Patients (tenant_id, email),
+    ADD FOREIGN KEY (tenant_id, disease_code) REFERENCES Disease (tenant_id, disease_code);
+ALTER TABLE Record ADD PRIMARY KEY (tenant_id, email, cname, disease_code),
+    ADD FOREIGN KEY (tenant_id, email) REFERENCES PublicServant (tenant_id, email),
+    ADD FOREIGN KEY (tenant_id, cname) REFERENCES Country (tenant_id, cname),
+    ADD FOREIGN KEY (tenant_id, disease_code) REFERENCES Disease (tenant_id, disease_code);
+
+ALTER TABLE country_alias ADD PRIMARY KEY (tenant_id, alias_key),
+    ADD FOREIGN KEY (tenant_id, cname) REFERENCES Country (tenant_id, cname) ON UPDATE CASCADE ON DELETE CASCADE;
+ALTER TABLE diagnosis_review
+    ADD FOREIGN KEY (tenant_id, email) REFERENCES Users (tenant_id, email) ON UPDATE CASCADE ON DELETE CASCADE,
+    ADD FOREIGN KEY (tenant_id, disease_code) REFERENCES Disease (tenant_id, disease_code);
+ALTER TABLE notification_preference ADD PRIMARY KEY (tenant_id, email),
+    ADD FOREIGN KEY (tenant_id, email) REFERENCES Users (tenant_id, email) ON UPDATE CASCADE ON DELETE CASCADE;
+ALTER TABLE icd_chapter_type ADD PRIMARY KEY (tenant_id, system, chapter),
+    ADD FOREIGN KEY (tenant_id, disease_type_id) REFERENCES DiseaseType (tenant_id, id);
+
+DROP INDEX IF EXISTS country_iso_alpha2_idx;
+DROP INDEX IF EXISTS country_iso_alpha3_idx;
+DROP INDEX IF EXISTS country_iso_numeric_idx;
+CREATE UNIQUE INDEX country_iso_alpha2_idx ON Country (tenant_id, iso_alpha2) WHERE deleted_at IS NULL;
+CREATE UNIQUE INDEX country_iso_alpha3_idx ON Country (tenant_id, iso_alpha3) WHERE deleted_at IS NULL;
+CREATE UNIQUE INDEX country_iso_numeric_idx ON Country (tenant_id, iso_numeric) WHERE deleted_at IS NULL;
+
+-- Row-level security. FORCE applies the policies to the tables' owner too,
+-- which the application usually connects as. The condition also checks
+-- the rows written, so none can be given another organization's tenant_id.
+DO $$
+DECLARE
+    t TEXT;
+BEGIN
+    FOREACH t IN ARRAY ARRAY['country', 'users', 'diseasetype', 'disease', 'discover', 'patients', 'publicservant',
+        'doctor', 'specialize', 'patientdisease', 'record', 'row_history', 'country_alias', 'diagnosis_review',
+        'webhook', 'webhook_delivery', 'alert_rule', 'alert', 'notification_preference', 'email_outbox',
+        'report_schedule', 'report', 'icd_chapter_type']
+    LOOP
+        EXECUTE format('ALTER TABLE %I ENABLE ROW LEVEL SECURITY, FORCE ROW LEVEL SECURITY', t);
+        EXECUTE format('DROP POLICY IF EXISTS tenant_isolation ON %I', t);
+        EXECUTE format('CREATE POLICY tenant_isolation ON %I USING (tenant_id = current_tenant() OR all_tenants())', t);
+    END LOOP;
+END $$;
+
+-- The triggers write to tables of organization data, so they give the
+-- rows they write the tenant_id of the row that changed, and only match
+-- rows of its organization: background work sees every organization.
+
+CREATE OR REPLACE FUNCTION record_history() RETURNS trigger AS $$
+DECLARE
+    col TEXT;
+    old_key JSONB := '{}';
+    new_key JSONB := '{}';
+BEGIN
+    IF TG_OP = 'UPDATE' AND to_jsonb(OLD) = to_jsonb(NEW) THEN
+        RETURN NULL;
+    END IF;
+
+    IF TG_OP IN ('UPDATE', 'DELETE') THEN
+        FOREACH col IN ARRAY TG_ARGV LOOP
+            old_key := old_key || jsonb_build_object(col, to_jsonb(OLD) ->> col);
+        END LOOP;
+        UPDATE row_history SET valid_to = clock_timestamp()
+        WHERE tenant_id = OLD.tenant_id AND table_name = TG_TABLE_NAME AND row_key = old_key AND valid_to IS NULL;
+    END IF;
+
+    IF TG_OP IN ('INSERT', 'UPDATE') THEN
+        FOREACH col IN ARRAY TG_ARGV LOOP
+            new_key := new_key || jsonb_build_object(col, to_jsonb(NEW) ->> col);
+        END LOOP;
+        UPDATE row_history SET valid_to = clock_timestamp()
+        WHERE tenant_id = NEW.tenant_id AND table_name = TG_TABLE_NAME AND row_key = new_key AND valid_to IS NULL;
+        INSERT INTO row_history (tenant_id, table_name, row_key, data, valid_from)
+        VALUES (NEW.tenant_id, TG_TABLE_NAME, new_key, to_jsonb(NEW) - 'tenant_id', clock_timestamp());
+    END IF;
+
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE FUNCTION queue_webhooks() RETURNS trigger AS $$
+DECLARE
+    tbl TEXT := lower(TG_TABLE_NAME);
+    tenant INT;
+    op TEXT;
+    old_row JSONB;
+    new_row JSONB;
+    data JSONB;
+BEGIN
+    IF TG_OP <> 'INSERT' THEN
+        old_row := to_jsonb(OLD) - 'version' - 'tenant_id';
+        tenant := OLD.tenant_id;
+    END IF;
+    IF TG_OP <> 'DELETE' THEN
+        new_row := to_jsonb(NEW) - 'version' - 'tenant_id';
+        tenant := NEW.tenant_id;
+    END IF;
+
+    IF TG_OP = 'INSERT' THEN
+        op := 'create';
+    ELSIF TG_OP = 'DELETE' THEN
+        -- Purging a row that is already in the trash was reported when it
+        -- was deleted.
+        IF old_row ->> 'deleted_at' IS NOT NULL THEN
+            RETURN NULL;
+        END IF;
+        op := 'delete';
+    ELSIF old_row = new_row THEN
+        RETURN NULL;
+    ELSIF old_row ->> 'deleted_at' IS NULL AND new_row ->> 'deleted_at' IS NOT NULL THEN
+        op := 'delete';
+    ELSIF old_row ->> 'deleted_at' IS NOT NULL AND new_row ->> 'deleted_at' IS NULL THEN
+        op := 'create';
+    ELSIF new_row ->> 'deleted_at' IS NOT NULL THEN
+        RETURN NULL;
+    ELSE
+        op := 'update';
+    END IF;
+
+    data := COALESCE(new_row, old_row) - 'deleted_at' - 'deleted_by';
+    INSERT INTO webhook_delivery (tenant_id, webhook_id, event, payload)
+    SELECT tenant, w.id, tbl || '.' || op, jsonb_build_object(
+        'event', tbl || '.' || op,
+        'entity', tbl,
+        'operation', op,
+        'occurred_at', clock_timestamp(),
+        'data', data,
+        'previous', CASE WHEN op = 'update' THEN old_row - 'deleted_at' - 'deleted_by' END)
+    FROM webhook w
+    WHERE w.tenant_id = tenant AND w.active AND w.entity = tbl AND op = ANY (w.operations)
+        AND (op <> 'update' OR w.column_name IS NULL
+            OR (old_row -> w.column_name IS DISTINCT FROM new_row -> w.column_name
+                AND (NOT w.increase_only
+                    OR (jsonb_typeof(old_row -> w.column_name) = 'number'
+                        AND jsonb_typeof(new_row -> w.column_name) = 'number'
+                        AND (new_row ->> w.column_name)::numeric > (old_row ->> w.column_name)::numeric))));
+
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE FUNCTION queue_record_email() RETURNS trigger AS $$
+DECLARE
+    op TEXT;
+    old_row JSONB;
+    new_row JSONB;
+BEGIN
+    new_row := to_jsonb(NEW) - 'version' - 'tenant_id';
+    IF TG_OP = 'UPDATE' THEN
+        old_row := to_jsonb(OLD) - 'version' - 'tenant_id';
+    END IF;
+
+    IF TG_OP = 'INSERT' THEN
+        op := 'create';
+    ELSIF old_row = new_row OR (new_row ->> 'deleted_at' IS NOT NULL AND old_row ->> 'deleted_at' IS NOT NULL) THEN
+        RETURN NULL;
+    ELSIF new_row ->> 'deleted_at' IS NOT NULL THEN
+        op := 'delete';
+    ELSIF old_row ->> 'deleted_at' IS NOT NULL THEN
+        op := 'create';
+    ELSE
+        op := 'update';
+    END IF;
+
+    IF NOT EXISTS (SELECT 1 FROM notification_preference
+        WHERE tenant_id = NEW.tenant_id AND email = new_row ->> 'email' AND NOT record_changes) THEN
+        INSERT INTO email_outbox (tenant_id, recipient, template, data)
+        VALUES (NEW.tenant_id, new_row ->> 'email', 'record_changed', jsonb_build_object(
+            'operation', op,
+            'record', new_row - 'deleted_at' - 'deleted_by',
+            'previous', CASE WHEN op = 'update' THEN old_row - 'deleted_at' - 'deleted_by' END,
+            'deleted_by', new_row ->> 'deleted_by',
+            'changed_at', clock_timestamp()));
+    END IF;
+
+    -- A record that moved to another servant is no longer the old one's.
+    IF op = 'update' AND old_row ->> 'email' <> new_row ->> 'email'
+        AND NOT EXISTS (SELECT 1 FROM notification_preference
+            WHERE tenant_id = NEW.tenant_id AND email = old_row ->> 'email' AND NOT record_changes) THEN
+        INSERT INTO email_outbox (tenant_id, recipient, template, data)
+        VALUES (NEW.tenant_id, old_row ->> 'email', 'record_changed', jsonb_build_object(
+            'operation', 'reassign',
+            'record', new_row - 'deleted_at' - 'deleted_by',
+            'previous', old_row - 'deleted_at' - 'deleted_by',
+            'changed_at', clock_timestamp()));
+    END IF;
+
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+-- Reports are generated for the organization in their job's payload.
+UPDATE job SET payload = payload || jsonb_build_object('tenant_id', (SELECT id FROM organization WHERE slug = 'default'))
+WHERE kind = 'generate_report' AND NOT payload ? 'tenant_id';
@@ -0,0 +1,7 @@
+-- Personal data: Users.salary and Users.phone hold values encrypted by
+-- the models (package fieldcrypt), which are text. Values written before
+-- stay readable in plaintext until `myapp keys rotate` encrypts them.
+
+ALTER TABLE Users
+    ALTER COLUMN salary TYPE TEXT USING salary::text,
+    ALTER COLUMN phone TYPE TEXT;
@@ -0,0 +1,72 @@
+-- Webhook payloads leave out personal data, the columns with a mask= in
+-- db/schema.sql, and a change to nothing else is not reported. Other
+-- services are not given it, encrypted or not.
+
+CREATE OR REPLACE FUNCTION personal_columns(tbl TEXT) RETURNS TEXT[] AS $$
+    SELECT CASE tbl
+        WHEN 'users' THEN ARRAY['salary', 'phone']
+        WHEN 'patientdisease' THEN ARRAY['disease_code']
+        ELSE ARRAY[]::TEXT[]
+    END
+$$ LANGUAGE sql IMMUTABLE;
+
+CREATE OR REPLACE FUNCTION queue_webhooks() RETURNS trigger AS $$
+DECLARE
+    tbl TEXT := lower(TG_TABLE_NAME);
+    tenant INT;
+    op TEXT;
+    old_row JSONB;
+    new_row JSONB;
+    data JSONB;
+BEGIN
+    IF TG_OP <> 'INSERT' THEN
+        old_row := to_jsonb(OLD) - 'version' - 'tenant_id' - personal_columns(tbl);
+        tenant := OLD.tenant_id;
+    END IF;
+    IF TG_OP <> 'DELETE' THEN
+        new_row := to_jsonb(NEW) - 'version' - 'tenant_id' - personal_columns(tbl);
+        tenant := NEW.tenant_id;
+    END IF;
+
+    IF TG_OP = 'INSERT' THEN
+        op := 'create';
+    ELSIF TG_OP = 'DELETE' THEN
+        -- Purging a row that is already in the trash was reported when it
+        -- was deleted.
+        IF old_row ->> 'deleted_at' IS NOT NULL THEN
+            RETURN NULL;
+        END IF;
+        op := 'delete';
+    ELSIF old_row = new_row THEN
+        RETURN NULL;
+    ELSIF old_row ->> 'deleted_at' IS NULL AND new_row ->> 'deleted_at' IS NOT NULL THEN
+        op := 'delete';
+    ELSIF old_row ->> 'deleted_at' IS NOT NULL AND new_row ->> 'deleted_at' IS NULL THEN
+        op := 'create';
+    ELSIF new_row ->> 'deleted_at' IS NOT NULL THEN
+        RETURN NULL;
+    ELSE
+        op := 'update';
+    END IF;
+
+    data := COALESCE(new_row, old_row) - 'deleted_at' - 'deleted_by';
+    INSERT INTO webhook_delivery (tenant_id, webhook_id, event, payload)
+    SELECT tenant, w.id, tbl || '.' || op, jsonb_build_object(
+        'event', tbl || '.' || op,
+        'entity', tbl,
+        'operation', op,
+        'occurred_at', clock_timestamp(),
+        'data', data,
+        'previous', CASE WHEN op = 'update' THEN old_row - 'deleted_at' - 'deleted_by' END)
+    FROM webhook w
+    WHERE w.tenant_id = tenant AND w.active AND w.entity = tbl AND op = ANY (w.operations)
+        AND (op <> 'update' OR w.column_name IS NULL
+            OR (old_row -> w.column_name IS DISTINCT FROM new_row -> w.column_name
+                AND (NOT w.increase_only
+                    OR (jsonb_typeof(old_row -> w.column_name) = 'number'
+                        AND jsonb_typeof(new_row -> w.column_name) = 'number'
+                        AND (new_row ->> w.column_name)::numeric > (old_row ->> w.column_name)::numeric))));
+
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
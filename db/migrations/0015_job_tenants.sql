@@ -0,0 +1,22 @@
+-- Jobs belong to the organization that queued them, and only it sees them
+-- (see 0012_organizations.sql). Jobs queued by schedules or by the server,
+-- and the ones that existed before, have no organization: they are seen
+-- by background work and operators only, as their payloads and errors
+-- may concern any organization.
+--
+-- Schedules are shared by every organization: each may see them, but only
+-- work for every organization, such as an operator's, may change them or
+-- run them now.
+
+ALTER TABLE job ADD COLUMN IF NOT EXISTS tenant_id INT REFERENCES organization (id) DEFAULT current_tenant();
+CREATE INDEX IF NOT EXISTS job_tenant_idx ON job (tenant_id, created_at);
+
+ALTER TABLE job ENABLE ROW LEVEL SECURITY, FORCE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS tenant_isolation ON job;
+CREATE POLICY tenant_isolation ON job USING (tenant_id = current_tenant() OR all_tenants());
+
+ALTER TABLE job_schedule ENABLE ROW LEVEL SECURITY, FORCE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS shared_read ON job_schedule;
+CREATE POLICY shared_read ON job_schedule FOR SELECT USING (TRUE);
+DROP POLICY IF EXISTS all_tenants_write ON job_schedule;
+CREATE POLICY all_tenants_write ON job_schedule USING (all_tenants());
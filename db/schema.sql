@@ -0,0 +1,182 @@
+-- Application schema. This file is the input of cmd/gen: run `go generate`
+-- from the module root after editing it to refresh models/ and handlers/.
+--
+-- Annotations live in comments:
+--   -- @resource key=value ...   before CREATE TABLE, describes the resource
+--   -- @field key=value ...      after a column, describes its form field
+--
+-- @resource keys: file, path, label, plural, item, items, check, related, verify
+-- @field keys:    go, label, key (path wildcard name), editable, mask, encrypted
+--
+-- A table with deleted_at and deleted_by columns is soft-deleted: the
+-- generated models skip deleted rows and Delete* only marks them, together
+-- with every row that references them. Deleted rows are listed on /trash.
+--
+-- A version INT NOT NULL column enables optimistic locking: it starts at 1,
+-- every update increments it and fails with ErrConflict if the submitted
+-- version is no longer current.
+--
+-- A column with mask=phone|code|number|text holds personal data: pages
+-- show it masked and exports leave it out unless the user may and asks to
+-- see it. encrypted=TYPE also stores it encrypted in a TEXT column, the
+-- models reading and writing it as TYPE (see package fieldcrypt). Webhook
+-- payloads never carry it: personal_columns in the migrations lists these
+-- columns, and the server refuses to start while it is out of date.
+--
+-- Every table belongs to an organization: its tenant_id column is filled
+-- in from the session and hidden by the generated models, and its primary
+-- and foreign keys start with tenant_id. Row-level security keeps the
+-- organizations apart (see db/migrations/0012_organizations.sql).
+--
+-- Every table also needs a record_history trigger (see
+-- db/migrations/0002_row_history.sql) to get a history page and as_of
+-- queries, and a queue_webhooks trigger (see 0007_webhooks.sql) for its
+-- changes to reach webhooks.
+
+-- @resource file=country path=countries label=Country plural=Countries item=Country items=Countries check=checkCountry related=countryRelated verify=verifyCountry
+CREATE TABLE Country (
+    tenant_id INT NOT NULL DEFAULT current_tenant() REFERENCES organization (id),
+    cname VARCHAR(50), -- @field go=CName label="Country Name"
+    population BIGINT NOT NULL, -- @field label=Population
+    iso_alpha2 CHAR(2), -- @field go=ISOAlpha2 label="ISO Alpha-2"
+    iso_alpha3 CHAR(3), -- @field go=ISOAlpha3 label="ISO Alpha-3"
+    iso_numeric CHAR(3), -- @field go=ISONumeric label="ISO Numeric"
+    version INT NOT NULL DEFAULT 1,
+    deleted_at TIMESTAMPTZ,
+    deleted_by VARCHAR(60),
+    PRIMARY KEY (tenant_id, cname)
+);
+
+-- @resource file=users path=users label=User plural=Users item=User items=Users check=checkUser related=userRelated verify=verifyUser
+CREATE TABLE Users (
+    tenant_id INT NOT NULL DEFAULT current_tenant() REFERENCES organization (id),
+    email VARCHAR(60), -- @field label=Email
+    name VARCHAR(30) NOT NULL, -- @field label=Name
+    surname VARCHAR(40) NOT NULL, -- @field label=Surname
+    salary TEXT, -- @field label=Salary mask=number encrypted=INT
+    phone TEXT, -- @field label=Phone mask=phone encrypted=VARCHAR
+    cname VARCHAR(50) NOT NULL, -- @field go=CName label=Country
+    version INT NOT NULL DEFAULT 1,
+    deleted_at TIMESTAMPTZ,
+    deleted_by VARCHAR(60),
+    PRIMARY KEY (tenant_id, email),
+    FOREIGN KEY (tenant_id, cname) REFERENCES Country (tenant_id, cname)
+);
+
+-- @resource file=disease_types path=disease_types label="Disease Type" plural="Disease Types" item=DiseaseType items=DiseaseTypes
+CREATE TABLE DiseaseType (
+    tenant_id INT NOT NULL DEFAULT current_tenant() REFERENCES organization (id),
+    id SERIAL, -- @field label=ID
+    description VARCHAR(140) NOT NULL, -- @field label=Description
+    version INT NOT NULL DEFAULT 1,
+    deleted_at TIMESTAMPTZ,
+    deleted_by VARCHAR(60),
+    PRIMARY KEY (tenant_id, id)
+);
+
+-- @resource file=disease path=diseases label=Disease plural=Diseases item=Disease items=Diseases related=diseaseRelated verify=verifyDisease
+CREATE TABLE Disease (
+    tenant_id INT NOT NULL DEFAULT current_tenant() REFERENCES organization (id),
+    disease_code VARCHAR(50), -- @field label="Disease Code" key=code
+    pathogen VARCHAR(20) NOT NULL, -- @field label=Pathogen
+    description VARCHAR(140) NOT NULL, -- @field label=Description
+    id INT NOT NULL, -- @field label="Disease Type ID"
+    custom BOOLEAN NOT NULL DEFAULT FALSE, -- @field label="Custom Code"
+    version INT NOT NULL DEFAULT 1,
+    deleted_at TIMESTAMPTZ,
+    deleted_by VARCHAR(60),
+    PRIMARY KEY (tenant_id, disease_code),
+    FOREIGN KEY (tenant_id, id) REFERENCES DiseaseType (tenant_id, id)
+);
+
+-- @resource file=discover path=discovers label=Discovery plural=Discoveries item=Discover items=Discovers verify=verifyDiscover
+CREATE TABLE Discover (
+    tenant_id INT NOT NULL DEFAULT current_tenant() REFERENCES organization (id),
+    cname VARCHAR(50) NOT NULL, -- @field go=CName label="Country Name"
+    disease_code VARCHAR(50) NOT NULL, -- @field label="Disease Code" key=code
+    first_enc_date DATE NOT NULL, -- @field label="First Encounter Date"
+    version INT NOT NULL DEFAULT 1,
+    deleted_at TIMESTAMPTZ,
+    deleted_by VARCHAR(60),
+    PRIMARY KEY (tenant_id, cname, disease_code),
+    FOREIGN KEY (tenant_id, cname) REFERENCES Country (tenant_id, cname),
+    FOREIGN KEY (tenant_id, disease_code) REFERENCES Disease (tenant_id, disease_code)
+);
+
+-- @resource file=patient path=patients label=Patient plural=Patients item=Patient items=Patients verify=verifyPatient
+CREATE TABLE Patients (
+    tenant_id INT NOT NULL DEFAULT current_tenant() REFERENCES organization (id),
+    email VARCHAR(60), -- @field label=Email
+    version INT NOT NULL DEFAULT 1,
+    deleted_at TIMESTAMPTZ,
+    deleted_by VARCHAR(60),
+    PRIMARY KEY (tenant_id, email),
+    FOREIGN KEY (tenant_id, email) REFERENCES Users (tenant_id, email)
+);
+
+-- @resource file=public_servant path=public_servants label="Public Servant" plural="Public Servants" item=PublicServant items=PublicServants verify=verifyPublicServant
+CREATE TABLE PublicServant (
+    tenant_id INT NOT NULL DEFAULT current_tenant() REFERENCES organization (id),
+    email VARCHAR(60), -- @field label=Email
+    department VARCHAR(50), -- @field label=Department
+    version INT NOT NULL DEFAULT 1,
+    deleted_at TIMESTAMPTZ,
+    deleted_by VARCHAR(60),
+    PRIMARY KEY (tenant_id, email),
+    FOREIGN KEY (tenant_id, email) REFERENCES Users (tenant_id, email)
+);
+
+-- @resource file=doctor path=doctors label=Doctor plural=Doctors item=Doctor items=Doctors verify=verifyDoctor
+CREATE TABLE Doctor (
+    tenant_id INT NOT NULL DEFAULT current_tenant() REFERENCES organization (id),
+    email VARCHAR(60), -- @field label=Email
+    degree VARCHAR(20) NOT NULL, -- @field label=Degree
+    version INT NOT NULL DEFAULT 1,
+    deleted_at TIMESTAMPTZ,
+    deleted_by VARCHAR(60),
+    PRIMARY KEY (tenant_id, email),
+    FOREIGN KEY (tenant_id, email) REFERENCES Users (tenant_id, email)
+);
+
+-- @resource file=specialize path=specializes label=Specialization plural=Specializations item=Specialize items=Specializes verify=verifySpecialize
+CREATE TABLE Specialize (
+    tenant_id INT NOT NULL DEFAULT current_tenant() REFERENCES organization (id),
+    id INT NOT NULL, -- @field label="Disease Type ID" editable
+    email VARCHAR(60) NOT NULL, -- @field label="Doctor Email" editable
+    version INT NOT NULL DEFAULT 1,
+    deleted_at TIMESTAMPTZ,
+    deleted_by VARCHAR(60),
+    PRIMARY KEY (tenant_id, id, email),
+    FOREIGN KEY (tenant_id, id) REFERENCES DiseaseType (tenant_id, id),
+    FOREIGN KEY (tenant_id, email) REFERENCES Doctor (tenant_id, email)
+);
+
+-- @resource file=patient_disease path=patient_diseases label="Patient Disease" plural="Patient Diseases" item=PatientDisease items=PatientDiseases verify=verifyPatientDisease
+CREATE TABLE PatientDisease (
+    tenant_id INT NOT NULL DEFAULT current_tenant() REFERENCES organization (id),
+    email VARCHAR(60) NOT NULL, -- @field label="Patient Email"
+    disease_code VARCHAR(50) NOT NULL, -- @field label="Disease Code" key=code editable mask=code
+    version INT NOT NULL DEFAULT 1,
+    deleted_at TIMESTAMPTZ,
+    deleted_by VARCHAR(60),
+    PRIMARY KEY (tenant_id, email, disease_code),
+    FOREIGN KEY (tenant_id, email) REFERENCES Patients (tenant_id, email),
+    FOREIGN KEY (tenant_id, disease_code) REFERENCES Disease (tenant_id, disease_code)
+);
+
+-- @resource file=record path=records label=Record plural=Records item=Record items=Records check=checkRecord verify=verifyRecord
+CREATE TABLE Record (
+    tenant_id INT NOT NULL DEFAULT current_tenant() REFERENCES organization (id),
+    email VARCHAR(60) NOT NULL, -- @field label="Public Servant Email"
+    cname VARCHAR(50) NOT NULL, -- @field go=CName label="Country Name"
+    disease_code VARCHAR(50) NOT NULL, -- @field label="Disease Code" key=code
+    total_deaths INT NOT NULL, -- @field label="Total Deaths"
+    total_patients INT NOT NULL, -- @field label="Total Patients"
+    version INT NOT NULL DEFAULT 1,
+    deleted_at TIMESTAMPTZ,
+    deleted_by VARCHAR(60),
+    PRIMARY KEY (tenant_id, email, cname, disease_code),
+    FOREIGN KEY (tenant_id, email) REFERENCES PublicServant (tenant_id, email),
+    FOREIGN KEY (tenant_id, cname) REFERENCES Country (tenant_id, cname),
+    FOREIGN KEY (tenant_id, disease_code) REFERENCES Disease (tenant_id, disease_code)
+);
@@ -0,0 +1,193 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"myapp/models"
+
+	"github.com/lib/pq"
+)
+
+// The row-level security policies of migration 0012 show a session the
+// rows of the organization in its app.tenant setting. Connections are
+// opened through tenantConnector, which sets it to
+// models.TenantSetting(ctx) before each statement or transaction, so
+// every query is scoped to the organization of its context.
+
+// unknownTenant marks a connection whose app.tenant may have been undone
+// by a rollback.
+const unknownTenant = "\x00"
+
+type tenantConnector struct {
+	driver.Connector
+}
+
+// newTenantConnector returns a lib/pq connector for the data source name.
+func newTenantConnector(dsn string) (driver.Connector, error) {
+	c, err := pq.NewConnector(dsn)
+	if err != nil {
+		return nil, err
+	}
+	return tenantConnector{c}, nil
+}
+
+func (c tenantConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.Connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// A new session has no app.tenant, which is the same as "".
+	return &tenantConn{Conn: conn}, nil
+}
+
+// tenantConn is a lib/pq connection that remembers its app.tenant, so the
+// setting is only sent when the organization changes.
+type tenantConn struct {
+	driver.Conn
+	tenant string
+}
+
+func (c *tenantConn) use(ctx context.Context) error {
+	tenant := models.TenantSetting(ctx)
+	if tenant == c.tenant {
+		return nil
+	}
+	_, err := c.Conn.(driver.ExecerContext).ExecContext(ctx, "SELECT set_config('app.tenant', $1, false)",
+		[]driver.NamedValue{{Ordinal: 1, Value: tenant}})
+	if err != nil {
+		return fmt.Errorf("setting the organization: %w", err)
+	}
+	c.tenant = tenant
+	return nil
+}
+
+func (c *tenantConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	if err := c.use(ctx); err != nil {
+		return nil, err
+	}
+	return c.Conn.(driver.QueryerContext).QueryContext(ctx, query, args)
+}
+
+func (c *tenantConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	if err := c.use(ctx); err != nil {
+		return nil, err
+	}
+	return c.Conn.(driver.ExecerContext).ExecContext(ctx, query, args)
+}
+
+func (c *tenantConn) Prepare(query string) (driver.Stmt, error) {
+	return c.PrepareContext(context.Background(), query)
+}
+
+func (c *tenantConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	stmt, err := c.Conn.(driver.ConnPrepareContext).PrepareContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	return &tenantStmt{Stmt: stmt, conn: c}, nil
+}
+
+func (c *tenantConn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+// BeginTx sets the organization before the transaction starts, so it is
+// in place for the transaction's snapshot and every statement in it.
+func (c *tenantConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if err := c.use(ctx); err != nil {
+		return nil, err
+	}
+	tx, err := c.Conn.(driver.ConnBeginTx).BeginTx(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &tenantTx{Tx: tx, conn: c}, nil
+}
+
+func (c *tenantConn) Ping(ctx context.Context) error {
+	return c.Conn.(driver.Pinger).Ping(ctx)
+}
+
+func (c *tenantConn) ResetSession(ctx context.Context) error {
+	return c.Conn.(driver.SessionResetter).ResetSession(ctx)
+}
+
+func (c *tenantConn) IsValid() bool {
+	return c.Conn.(driver.Validator).IsValid()
+}
+
+// tenantTx forgets the connection's app.tenant when the transaction does
+// not commit, since a setting changed inside it is rolled back too.
+type tenantTx struct {
+	driver.Tx
+	conn *tenantConn
+}
+
+func (tx *tenantTx) Commit() error {
+	err := tx.Tx.Commit()
+	if err != nil {
+		tx.conn.tenant = unknownTenant
+	}
+	return err
+}
+
+func (tx *tenantTx) Rollback() error {
+	tx.conn.tenant = unknownTenant
+	return tx.Tx.Rollback()
+}
+
+// tenantStmt sets the organization before running a prepared statement.
+// Statements of COPY FROM STDIN only implement the methods without a
+// context.
+type tenantStmt struct {
+	driver.Stmt
+	conn *tenantConn
+}
+
+func (s *tenantStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	if err := s.conn.use(ctx); err != nil {
+		return nil, err
+	}
+	if stmt, ok := s.Stmt.(driver.StmtExecContext); ok {
+		return stmt.ExecContext(ctx, args)
+	}
+	return s.Stmt.Exec(values(args))
+}
+
+func (s *tenantStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	if err := s.conn.use(ctx); err != nil {
+		return nil, err
+	}
+	if stmt, ok := s.Stmt.(driver.StmtQueryContext); ok {
+		return stmt.QueryContext(ctx, args)
+	}
+	return s.Stmt.Query(values(args))
+}
+
+func values(args []driver.NamedValue) []driver.Value {
+	v := make([]driver.Value, len(args))
+	for i, a := range args {
+		v[i] = a.Value
+	}
+	return v
+}
+
+// CheckRowSecurity fails if the database role bypasses row-level security,
+// as superusers and roles with BYPASSRLS do: their queries would see every
+// organization's rows. This holds even while there is a single
+// organization, as another can be added at any time, by another process.
+func CheckRowSecurity(ctx context.Context, db *sql.DB) error {
+	var bypass bool
+	err := db.QueryRowContext(ctx, "SELECT rolsuper OR rolbypassrls FROM pg_roles WHERE rolname = current_user").Scan(&bypass)
+	if err != nil {
+		return err
+	}
+	if bypass {
+		return errors.New("the database role bypasses row-level security, so it would mix the data of the organizations;" +
+			" connect as a role without SUPERUSER or BYPASSRLS")
+	}
+	return nil
+}
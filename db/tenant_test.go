@@ -0,0 +1,415 @@
+package db_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"myapp/backup"
+	"myapp/db"
+	"myapp/models"
+	"os"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// These tests add two organizations with records and patient diseases
+// under the same keys, and check that the models of each only ever see
+// and change its own rows, and that row-level security stops SQL that
+// names the other organization's rows outright. They need a database:
+//
+//	DATABASE_URL=... go test ./db
+//
+// connecting as the role the application uses. The organizations and
+// their rows are removed afterwards.
+
+// The keys both organizations use.
+const (
+	country = "Checktenants"
+	servant = "servant@checktenants.example"
+	patient = "patient@checktenants.example"
+	disease = "ZZ1"
+	other   = "ZZ2" // a disease the patient's diagnosis moves to
+)
+
+// org is one of the two organizations and the totals of its record.
+type org struct {
+	*models.Organization
+	ctx    context.Context
+	deaths int
+}
+
+// openDB connects to DATABASE_URL and migrates it, or skips the test.
+func openDB(t *testing.T) *sql.DB {
+	t.Helper()
+	dbURL := os.Getenv("DATABASE_URL")
+	if dbURL == "" {
+		t.Skip("DATABASE_URL is not set")
+	}
+	conn, err := db.NewPostgresDB(dbURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	if err := db.Migrate(context.Background(), conn); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.CheckRowSecurity(context.Background(), conn); err != nil {
+		t.Skip(err)
+	}
+	return conn
+}
+
+// twoOrgs adds two filled organizations, removed when the test ends.
+func twoOrgs(t *testing.T, conn *sql.DB) (a, b *org) {
+	t.Helper()
+	ctx := context.Background()
+	suffix := fmt.Sprintf("%06d", rand.IntN(1e6))
+	var orgs []*org
+	t.Cleanup(func() { cleanup(t, conn, orgs) })
+	for i, deaths := range []int{10, 20} {
+		o, err := models.CreateOrganization(ctx, conn, fmt.Sprintf("check-%c-%s", 'a'+i, suffix), "Tenant check")
+		if err != nil {
+			t.Fatal(err)
+		}
+		orgs = append(orgs, &org{Organization: o, ctx: models.WithTenant(ctx, o.ID), deaths: deaths})
+	}
+	for _, o := range orgs {
+		if err := fill(conn, o); err != nil {
+			t.Fatalf("adding the rows of %s: %v", o.Slug, err)
+		}
+	}
+	return orgs[0], orgs[1]
+}
+
+func TestRecordIsolation(t *testing.T) {
+	conn := openDB(t)
+	a, b := twoOrgs(t, conn)
+
+	t.Run("each organization lists only its own", func(t *testing.T) {
+		for _, o := range []*org{a, b} {
+			records, err := models.GetAllRecords(o.ctx, conn)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(records) != 1 || records[0].TotalDeaths != o.deaths {
+				t.Errorf("%s sees %v", o.Slug, records)
+			}
+		}
+	})
+	t.Run("a shared key reads the organization's own row", func(t *testing.T) {
+		recordDeaths(t, conn, a, a.deaths)
+	})
+	t.Run("updating a shared key leaves the other organization's row", func(t *testing.T) {
+		x, err := models.GetRecord(a.ctx, conn, servant, country, disease)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if x == nil {
+			t.Fatal("not found")
+		}
+		x.TotalDeaths = 11
+		if err := models.UpdateRecord(a.ctx, conn, x); err != nil {
+			t.Fatal(err)
+		}
+		a.deaths = 11
+		recordDeaths(t, conn, a, 11)
+		recordDeaths(t, conn, b, b.deaths)
+	})
+	t.Run("a version only the other organization's row has is a conflict", func(t *testing.T) {
+		// a's record is at version 2 now and b's still at 1.
+		x := &models.Record{Email: servant, CName: country, DiseaseCode: disease, Version: 1}
+		if err := models.UpdateRecord(a.ctx, conn, x); !errors.Is(err, models.ErrConflict) {
+			t.Errorf("updating returned %v instead of a conflict", err)
+		}
+		recordDeaths(t, conn, b, b.deaths)
+	})
+	t.Run("deleting a shared key leaves the other organization's row", func(t *testing.T) {
+		if err := models.DeleteRecord(a.ctx, conn, servant, country, disease); err != nil {
+			t.Fatal(err)
+		}
+		if x, err := models.GetRecord(a.ctx, conn, servant, country, disease); err != nil || x != nil {
+			t.Errorf("the deleted record is still there: %v, %v", x, err)
+		}
+		recordDeaths(t, conn, b, b.deaths)
+	})
+	t.Run("SQL naming the other organization's rows sees and changes none", func(t *testing.T) {
+		rawSQL(t, conn, a, b, "Record", "total_deaths = 0")
+	})
+	t.Run("SQL cannot insert a row for the other organization", func(t *testing.T) {
+		_, err := conn.ExecContext(a.ctx, "INSERT INTO Record (tenant_id, email, cname, disease_code, total_deaths, total_patients)"+
+			" VALUES ($1, $2, $3, $4, 0, 0)", b.ID, servant, country, other)
+		wantDenied(t, err)
+	})
+	t.Run("without an organization no rows are visible", func(t *testing.T) {
+		noRows(t, conn, "Record")
+	})
+}
+
+func TestPatientDiseaseIsolation(t *testing.T) {
+	conn := openDB(t)
+	a, b := twoOrgs(t, conn)
+
+	t.Run("each organization lists only its own", func(t *testing.T) {
+		for _, o := range []*org{a, b} {
+			items, err := models.GetAllPatientDiseases(o.ctx, conn)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(items) != 1 || items[0].DiseaseCode != disease {
+				t.Errorf("%s sees %v", o.Slug, items)
+			}
+		}
+	})
+	t.Run("changing a shared key leaves the other organization's row", func(t *testing.T) {
+		x, err := models.GetPatientDisease(a.ctx, conn, patient, disease)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if x == nil {
+			t.Fatal("not found")
+		}
+		x.DiseaseCode = other
+		if err := models.UpdatePatientDisease(a.ctx, conn, patient, disease, x); err != nil {
+			t.Fatal(err)
+		}
+		patientDisease(t, conn, b, disease)
+	})
+	t.Run("a key only the other organization has is not found", func(t *testing.T) {
+		if x, err := models.GetPatientDisease(a.ctx, conn, patient, disease); err != nil || x != nil {
+			t.Fatalf("found %v, %v", x, err)
+		}
+		x := &models.PatientDisease{Email: patient, DiseaseCode: other, Version: 1}
+		if err := models.UpdatePatientDisease(a.ctx, conn, patient, disease, x); !errors.Is(err, models.ErrConflict) {
+			t.Errorf("updating it returned %v instead of a conflict", err)
+		}
+		if err := models.DeletePatientDisease(a.ctx, conn, patient, disease); err != nil {
+			t.Fatal(err)
+		}
+		patientDisease(t, conn, b, disease)
+	})
+	t.Run("SQL naming the other organization's rows sees and changes none", func(t *testing.T) {
+		rawSQL(t, conn, a, b, "PatientDisease", "deleted_at = now()")
+	})
+	t.Run("SQL cannot move a row to the other organization", func(t *testing.T) {
+		_, err := conn.ExecContext(a.ctx, "UPDATE PatientDisease SET tenant_id = $1", b.ID)
+		wantDenied(t, err)
+	})
+	t.Run("without an organization no rows are visible", func(t *testing.T) {
+		noRows(t, conn, "PatientDisease")
+	})
+}
+
+func TestJobIsolation(t *testing.T) {
+	conn := openDB(t)
+	a, b := twoOrgs(t, conn)
+	jobs := make(map[*org]int64)
+	for _, o := range []*org{a, b} {
+		j := &models.Job{Kind: "check", Payload: []byte(`{"org":"` + o.Slug + `"}`), RunAt: time.Now().Add(time.Hour)}
+		if err := models.EnqueueJob(o.ctx, conn, j); err != nil {
+			t.Fatal(err)
+		}
+		jobs[o] = j.ID
+	}
+
+	t.Run("each organization lists only its own", func(t *testing.T) {
+		for _, o := range []*org{a, b} {
+			items, err := models.GetJobs(o.ctx, conn, "", 100)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(items) != 1 || items[0].ID != jobs[o] {
+				t.Errorf("%s sees %d jobs", o.Slug, len(items))
+			}
+		}
+	})
+	t.Run("the other organization's job is not found", func(t *testing.T) {
+		if j, err := models.GetJob(a.ctx, conn, jobs[b]); err != nil || j != nil {
+			t.Errorf("found %v, %v", j, err)
+		}
+		if err := models.CancelJob(a.ctx, conn, jobs[b]); !errors.Is(err, models.ErrNoJob) {
+			t.Errorf("cancelling it returned %v instead of ErrNoJob", err)
+		}
+	})
+	t.Run("SQL naming the other organization's rows sees and changes none", func(t *testing.T) {
+		rawSQL(t, conn, a, b, "job", "status = 'cancelled'")
+	})
+	t.Run("schedules are read-only to an organization", func(t *testing.T) {
+		all := models.WithAllTenants(context.Background())
+		name := "check-" + a.Slug
+		if _, err := conn.ExecContext(all, "INSERT INTO job_schedule (name, spec, kind, payload, next_run_at) VALUES ($1, '@daily', 'check', '{}', now())", name); err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { conn.ExecContext(all, "DELETE FROM job_schedule WHERE name = $1", name) })
+
+		schedules, err := models.GetJobSchedules(a.ctx, conn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.ContainsFunc(schedules, func(s models.JobSchedule) bool { return s.Name == name }) {
+			t.Error("the schedule is not listed")
+		}
+		if err := models.SetJobScheduleActive(a.ctx, conn, name, false); !errors.Is(err, models.ErrNoJob) {
+			t.Errorf("pausing it returned %v instead of ErrNoJob", err)
+		}
+		if err := models.SetJobScheduleActive(all, conn, name, false); err != nil {
+			t.Errorf("pausing it for every organization: %v", err)
+		}
+	})
+	t.Run("without an organization no rows are visible", func(t *testing.T) {
+		noRows(t, conn, "job")
+	})
+}
+
+// fill adds the same keys to an organization: a country, a public servant
+// with a record, and a patient with a disease.
+func fill(conn *sql.DB, o *org) error {
+	ctx := o.ctx
+	if err := models.CreateCountry(ctx, conn, &models.Country{CName: country, Population: 1000}); err != nil {
+		return err
+	}
+	for _, email := range []string{servant, patient} {
+		if err := models.CreateUser(ctx, conn, &models.User{Email: email, Name: "Check", Surname: o.Slug, CName: country}); err != nil {
+			return err
+		}
+	}
+	// Nobody is emailed about the records.
+	if err := models.SetNotificationPreference(ctx, conn, &models.NotificationPreference{Email: servant, Alerts: "none"}); err != nil {
+		return err
+	}
+	if err := models.CreatePublicServant(ctx, conn, &models.PublicServant{Email: servant}); err != nil {
+		return err
+	}
+	if err := models.CreatePatient(ctx, conn, &models.Patient{Email: patient}); err != nil {
+		return err
+	}
+	if err := models.CreateDiseaseType(ctx, conn, &models.DiseaseType{Description: "Check"}); err != nil {
+		return err
+	}
+	types, err := models.GetAllDiseaseTypes(ctx, conn)
+	if err != nil {
+		return err
+	}
+	if len(types) != 1 {
+		return fmt.Errorf("%d disease types instead of 1", len(types))
+	}
+	for _, code := range []string{disease, other} {
+		d := &models.Disease{DiseaseCode: code, Pathogen: "none", Description: "Check", ID: types[0].ID, Custom: true}
+		if err := models.CreateDisease(ctx, conn, d); err != nil {
+			return err
+		}
+	}
+	r := &models.Record{Email: servant, CName: country, DiseaseCode: disease, TotalDeaths: o.deaths, TotalPatients: 100}
+	if err := models.CreateRecord(ctx, conn, r); err != nil {
+		return err
+	}
+	return models.CreatePatientDisease(ctx, conn, &models.PatientDisease{Email: patient, DiseaseCode: disease})
+}
+
+// recordDeaths checks the deaths of the organization's record.
+func recordDeaths(t *testing.T, conn *sql.DB, o *org, want int) {
+	t.Helper()
+	x, err := models.GetRecord(o.ctx, conn, servant, country, disease)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if x == nil {
+		t.Fatalf("the record of %s is gone", o.Slug)
+	}
+	if x.TotalDeaths != want {
+		t.Errorf("the record of %s has %d deaths instead of %d", o.Slug, x.TotalDeaths, want)
+	}
+}
+
+// patientDisease checks that the organization's patient still has code.
+func patientDisease(t *testing.T, conn *sql.DB, o *org, code string) {
+	t.Helper()
+	x, err := models.GetPatientDisease(o.ctx, conn, patient, code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if x == nil {
+		t.Errorf("the patient disease %s of %s is gone", code, o.Slug)
+	}
+}
+
+// rawSQL checks that a's session can neither count nor update the rows of
+// table that belong to b, selecting them by tenant_id.
+func rawSQL(t *testing.T, conn *sql.DB, a, b *org, table, set string) {
+	t.Helper()
+	var n int
+	if err := conn.QueryRowContext(a.ctx, "SELECT count(*) FROM "+table+" WHERE tenant_id = $1", b.ID).Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	if n != 0 {
+		t.Errorf("counted %d rows", n)
+	}
+	for verb, query := range map[string]string{
+		"updated": "UPDATE " + table + " SET " + set + " WHERE tenant_id = $1",
+		"deleted": "DELETE FROM " + table + " WHERE tenant_id = $1",
+	} {
+		res, err := conn.ExecContext(a.ctx, query, b.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n, _ := res.RowsAffected(); n != 0 {
+			t.Errorf("%s %d rows", verb, n)
+		}
+	}
+}
+
+// noRows checks that a context without an organization sees no rows.
+func noRows(t *testing.T, conn *sql.DB, table string) {
+	t.Helper()
+	var n int
+	if err := conn.QueryRowContext(context.Background(), "SELECT count(*) FROM "+table).Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	if n != 0 {
+		t.Errorf("%d rows of %s", n, table)
+	}
+}
+
+// wantDenied checks that err is a row-level security violation.
+func wantDenied(t *testing.T, err error) {
+	t.Helper()
+	var pqErr *pq.Error
+	switch {
+	case err == nil:
+		t.Error("the statement succeeded")
+	case !errors.As(err, &pqErr) || pqErr.Code != "42501":
+		t.Errorf("failed with %v instead of a row-level security violation", err)
+	}
+}
+
+// cleanup removes the organizations and every row of theirs.
+func cleanup(t *testing.T, conn *sql.DB, orgs []*org) {
+	if len(orgs) == 0 {
+		return
+	}
+	ids := make([]int64, len(orgs))
+	for i, o := range orgs {
+		ids[i] = int64(o.ID)
+	}
+	ctx := models.WithAllTenants(context.Background())
+	var tables []string
+	for _, tbl := range slices.Backward(backup.Tables) {
+		if tbl.Name != "organization" {
+			tables = append(tables, tbl.Name)
+		}
+	}
+	tables = append(tables, "notification_preference", "row_history", "email_outbox", "webhook_delivery", "job")
+	for _, tbl := range tables {
+		if _, err := conn.ExecContext(ctx, "DELETE FROM "+tbl+" WHERE tenant_id = ANY ($1)", pq.Array(ids)); err != nil {
+			t.Errorf("cleaning up %s: %v", tbl, err)
+			return
+		}
+	}
+	if _, err := conn.ExecContext(ctx, "DELETE FROM organization WHERE id = ANY ($1)", pq.Array(ids)); err != nil {
+		t.Errorf("cleaning up the organizations: %v", err)
+	}
+}
@@ -0,0 +1,294 @@
+package fhir
+
+import (
+	"encoding/json"
+	"myapp/models"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// A Resource is one of the resource types built by Export.
+type Resource interface {
+	// Ref is the relative reference of the resource, e.g. "Patient/123".
+	Ref() string
+}
+
+func (p *Patient) Ref() string       { return "Patient/" + p.ID }
+func (p *Practitioner) Ref() string  { return "Practitioner/" + p.ID }
+func (c *Condition) Ref() string     { return "Condition/" + c.ID }
+func (m *MeasureReport) Ref() string { return "MeasureReport/" + m.ID }
+
+// ResourceTypes lists the resource types served, in export order.
+var ResourceTypes = []string{"Patient", "Practitioner", "Condition", "MeasureReport"}
+
+// Source holds the rows the resources are built from.
+type Source struct {
+	Users           []models.User
+	Countries       []models.Country
+	Patients        []models.Patient
+	Doctors         []models.Doctor
+	Specializations []models.Specialize
+	DiseaseTypes    []models.DiseaseType
+	Diseases        []models.Disease
+	PatientDiseases []models.PatientDisease
+	Records         []models.Record
+	Discoveries     []models.Discover
+
+	// DiseaseSystems maps catalog codes to their ICD system; see
+	// models.DiseaseSystems.
+	DiseaseSystems map[string]string
+
+	// Now dates the measure reports.
+	Now time.Time
+}
+
+// Export builds resources from a Source.
+type Export struct {
+	src        *Source
+	users      map[string]*models.User
+	countries  map[string]*models.Country
+	types      map[int]*models.DiseaseType
+	diseases   map[string]*models.Disease
+	specs      map[string][]int
+	discovered map[[2]string]time.Time
+}
+
+func NewExport(src *Source) *Export {
+	e := &Export{
+		src:        src,
+		users:      make(map[string]*models.User),
+		countries:  make(map[string]*models.Country),
+		types:      make(map[int]*models.DiseaseType),
+		diseases:   make(map[string]*models.Disease),
+		specs:      make(map[string][]int),
+		discovered: make(map[[2]string]time.Time),
+	}
+	for i := range src.Users {
+		e.users[src.Users[i].Email] = &src.Users[i]
+	}
+	for i := range src.Countries {
+		e.countries[src.Countries[i].CName] = &src.Countries[i]
+	}
+	for i := range src.DiseaseTypes {
+		e.types[src.DiseaseTypes[i].ID] = &src.DiseaseTypes[i]
+	}
+	for i := range src.Diseases {
+		e.diseases[src.Diseases[i].DiseaseCode] = &src.Diseases[i]
+	}
+	for _, s := range src.Specializations {
+		e.specs[s.Email] = append(e.specs[s.Email], s.ID)
+	}
+	for _, d := range src.Discoveries {
+		e.discovered[[2]string{d.CName, d.DiseaseCode}] = d.FirstEncDate
+	}
+	return e
+}
+
+// Resources returns the resources of one type, or false if the type is not
+// served.
+func (e *Export) Resources(resourceType string) ([]Resource, bool) {
+	var out []Resource
+	switch resourceType {
+	case "Patient":
+		for _, p := range e.Patients() {
+			out = append(out, &p)
+		}
+	case "Practitioner":
+		for _, p := range e.Practitioners() {
+			out = append(out, &p)
+		}
+	case "Condition":
+		for _, c := range e.Conditions() {
+			out = append(out, &c)
+		}
+	case "MeasureReport":
+		for _, m := range e.MeasureReports() {
+			out = append(out, &m)
+		}
+	default:
+		return nil, false
+	}
+	return out, true
+}
+
+// All returns the resources of every type.
+func (e *Export) All() []Resource {
+	var out []Resource
+	for _, t := range ResourceTypes {
+		rs, _ := e.Resources(t)
+		out = append(out, rs...)
+	}
+	return out
+}
+
+func (e *Export) Patients() []Patient {
+	var out []Patient
+	for _, p := range e.src.Patients {
+		u := e.users[p.Email]
+		if u == nil {
+			continue
+		}
+		out = append(out, Patient{
+			ResourceType: "Patient",
+			ID:           ID("Patient", u.Email),
+			Identifier:   []Identifier{{System: SystemUser, Value: u.Email}},
+			Name:         e.name(u),
+			Telecom:      e.telecom(u),
+			Address:      []Address{{Country: e.countryCode(u.CName)}},
+		})
+	}
+	return out
+}
+
+func (e *Export) Practitioners() []Practitioner {
+	var out []Practitioner
+	for _, d := range e.src.Doctors {
+		u := e.users[d.Email]
+		if u == nil {
+			continue
+		}
+		quals := []Qualification{{Code: CodeableConcept{
+			Coding: []Coding{{System: SystemDegree, Code: d.Degree}},
+			Text:   d.Degree,
+		}}}
+		ids := e.specs[d.Email]
+		sort.Ints(ids)
+		for _, id := range ids {
+			c := Coding{System: SystemDiseaseType, Code: strconv.Itoa(id)}
+			if t := e.types[id]; t != nil {
+				c.Display = t.Description
+			}
+			quals = append(quals, Qualification{Code: CodeableConcept{Coding: []Coding{c}, Text: c.Display}})
+		}
+		out = append(out, Practitioner{
+			ResourceType:  "Practitioner",
+			ID:            ID("Practitioner", u.Email),
+			Identifier:    []Identifier{{System: SystemUser, Value: u.Email}},
+			Name:          e.name(u),
+			Telecom:       e.telecom(u),
+			Address:       []Address{{Country: e.countryCode(u.CName)}},
+			Qualification: quals,
+		})
+	}
+	return out
+}
+
+func (e *Export) Conditions() []Condition {
+	var out []Condition
+	for _, pd := range e.src.PatientDiseases {
+		out = append(out, Condition{
+			ResourceType: "Condition",
+			ID:           ID("Condition", pd.Email, pd.DiseaseCode),
+			ClinicalStatus: &CodeableConcept{
+				Coding: []Coding{{System: SystemClinical, Code: "active"}},
+			},
+			Code:    e.disease(pd.DiseaseCode),
+			Subject: e.userRef("Patient", pd.Email),
+		})
+	}
+	return out
+}
+
+func (e *Export) MeasureReports() []MeasureReport {
+	now := e.src.Now.UTC()
+	var out []MeasureReport
+	for _, rec := range e.src.Records {
+		period := Period{End: now.Format(time.DateOnly)}
+		if first, ok := e.discovered[[2]string{rec.CName, rec.DiseaseCode}]; ok {
+			period.Start = first.Format(time.DateOnly)
+		}
+		subject := &Reference{Display: rec.CName}
+		if c := e.countries[rec.CName]; c != nil && c.ISOAlpha2.Valid {
+			subject.Identifier = &Identifier{System: SystemISO3166, Value: c.ISOAlpha2.String}
+		}
+		reporter := e.userRef("", rec.Email)
+		patients, deaths := rec.TotalPatients, rec.TotalDeaths
+
+		out = append(out, MeasureReport{
+			ResourceType: "MeasureReport",
+			ID:           ID("MeasureReport", rec.Email, rec.CName, rec.DiseaseCode),
+			Status:       "complete",
+			Type:         "summary",
+			Measure:      MeasureBurden,
+			Subject:      subject,
+			Date:         now.Format(time.RFC3339),
+			Reporter:     &reporter,
+			Period:       period,
+			Group: []GroupEntry{{
+				Code: e.disease(rec.DiseaseCode),
+				Population: []Population{
+					{Code: &CodeableConcept{Coding: []Coding{{System: SystemMeasurePop, Code: "initial-population"}}, Text: "Patients"}, Count: &patients},
+					{Code: &CodeableConcept{Coding: []Coding{{System: SystemPopulation, Code: "deaths"}}, Text: "Deaths"}, Count: &deaths},
+				},
+			}},
+		})
+	}
+	return out
+}
+
+func (e *Export) name(u *models.User) []HumanName {
+	return []HumanName{{Use: "official", Family: u.Surname, Given: []string{u.Name}}}
+}
+
+func (e *Export) telecom(u *models.User) []ContactPoint {
+	t := []ContactPoint{{System: "email", Value: u.Email}}
+	if u.Phone.Valid {
+		t = append(t, ContactPoint{System: "phone", Value: u.Phone.String})
+	}
+	return t
+}
+
+// countryCode prefers the ISO alpha-2 code, which FHIR recommends for
+// Address.country, over the country name.
+func (e *Export) countryCode(cname string) string {
+	if c := e.countries[cname]; c != nil && c.ISOAlpha2.Valid {
+		return c.ISOAlpha2.String
+	}
+	return cname
+}
+
+// userRef refers to a user by email, and to its resource of type
+// resourceType too if that is not empty.
+func (e *Export) userRef(resourceType, email string) Reference {
+	ref := Reference{Identifier: &Identifier{System: SystemUser, Value: email}}
+	if resourceType != "" {
+		ref.Reference = resourceType + "/" + ID(resourceType, email)
+	}
+	if u := e.users[email]; u != nil {
+		ref.Display = u.Name + " " + u.Surname
+	}
+	return ref
+}
+
+func (e *Export) disease(code string) *CodeableConcept {
+	c := Coding{System: SystemDisease, Code: code}
+	switch e.src.DiseaseSystems[code] {
+	case models.ICD10:
+		c.System = SystemICD10
+	case models.ICD11:
+		c.System = SystemICD11
+	}
+	if d := e.diseases[code]; d != nil {
+		c.Display = d.Description
+	}
+	return &CodeableConcept{Coding: []Coding{c}, Text: c.Display}
+}
+
+// NewBundle wraps resources into a bundle of type typ, with full URLs
+// below base.
+func NewBundle(typ, base string, resources []Resource) (*Bundle, error) {
+	b := &Bundle{ResourceType: "Bundle", Type: typ, Entry: []Entry{}}
+	if typ == "searchset" {
+		total := len(resources)
+		b.Total = &total
+	}
+	for _, r := range resources {
+		raw, err := json.Marshal(r)
+		if err != nil {
+			return nil, err
+		}
+		b.Entry = append(b.Entry, Entry{FullURL: base + "/" + r.Ref(), Resource: raw})
+	}
+	return b, nil
+}
@@ -0,0 +1,211 @@
+package fhir
+
+import (
+	"database/sql"
+	"encoding/json"
+	"myapp/models"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// source is a small database: a patient with tuberculosis in Spain, a
+// doctor specialized in infectious diseases, and a report on Spain.
+func source() *Source {
+	return &Source{
+		Users: []models.User{
+			{Email: "maria.garcia@example.org", Name: "Maria", Surname: "Garcia",
+				Phone: sql.NullString{String: "+34 600 123 456", Valid: true}, CName: "Spain"},
+			{Email: "john.smith@example.org", Name: "John", Surname: "Smith", CName: "Atlantis"},
+		},
+		Countries: []models.Country{
+			{CName: "Spain", ISOAlpha2: sql.NullString{String: "ES", Valid: true}},
+			{CName: "Atlantis"},
+		},
+		Patients:        []models.Patient{{Email: "maria.garcia@example.org"}},
+		Doctors:         []models.Doctor{{Email: "john.smith@example.org", Degree: "MD"}},
+		Specializations: []models.Specialize{{Email: "john.smith@example.org", ID: 2}, {Email: "john.smith@example.org", ID: 1}},
+		DiseaseTypes:    []models.DiseaseType{{ID: 1, Description: "Infectious diseases"}, {ID: 2, Description: "Respiratory diseases"}},
+		Diseases: []models.Disease{
+			{DiseaseCode: "A15.0", Description: "Tuberculosis of lung"},
+			{DiseaseCode: "FLU-X", Description: "Local flu"},
+		},
+		PatientDiseases: []models.PatientDisease{{Email: "maria.garcia@example.org", DiseaseCode: "A15.0"}},
+		Records: []models.Record{
+			{Email: "john.smith@example.org", CName: "Spain", DiseaseCode: "A15.0", TotalPatients: 1240, TotalDeaths: 37},
+			{Email: "john.smith@example.org", CName: "Atlantis", DiseaseCode: "FLU-X", TotalPatients: 5, TotalDeaths: 0},
+		},
+		Discoveries:    []models.Discover{{CName: "Spain", DiseaseCode: "A15.0", FirstEncDate: time.Date(1990, 3, 1, 0, 0, 0, 0, time.UTC)}},
+		DiseaseSystems: map[string]string{"A15.0": models.ICD10},
+		Now:            time.Date(2024, 6, 30, 12, 0, 0, 0, time.UTC),
+	}
+}
+
+func TestExportPatients(t *testing.T) {
+	ps := NewExport(source()).Patients()
+	if len(ps) != 1 {
+		t.Fatalf("%d patients", len(ps))
+	}
+	p := ps[0]
+	want := Patient{
+		ResourceType: "Patient",
+		ID:           ID("Patient", "maria.garcia@example.org"),
+		Identifier:   []Identifier{{System: SystemUser, Value: "maria.garcia@example.org"}},
+		Name:         []HumanName{{Use: "official", Family: "Garcia", Given: []string{"Maria"}}},
+		Telecom:      []ContactPoint{{System: "email", Value: "maria.garcia@example.org"}, {System: "phone", Value: "+34 600 123 456"}},
+		Address:      []Address{{Country: "ES"}},
+	}
+	if !reflect.DeepEqual(p, want) {
+		t.Errorf("got\n%+v\nwant\n%+v", p, want)
+	}
+}
+
+func TestExportPractitioners(t *testing.T) {
+	ps := NewExport(source()).Practitioners()
+	if len(ps) != 1 {
+		t.Fatalf("%d practitioners", len(ps))
+	}
+	p := ps[0]
+	if len(p.Address) != 1 || p.Address[0].Country != "Atlantis" {
+		t.Errorf("a country without an ISO code is sent as %+v, want its name", p.Address)
+	}
+	if len(p.Telecom) != 1 {
+		t.Errorf("telecom %+v, want only the email", p.Telecom)
+	}
+	want := []Qualification{
+		{Code: CodeableConcept{Coding: []Coding{{System: SystemDegree, Code: "MD"}}, Text: "MD"}},
+		{Code: CodeableConcept{Coding: []Coding{{System: SystemDiseaseType, Code: "1", Display: "Infectious diseases"}}, Text: "Infectious diseases"}},
+		{Code: CodeableConcept{Coding: []Coding{{System: SystemDiseaseType, Code: "2", Display: "Respiratory diseases"}}, Text: "Respiratory diseases"}},
+	}
+	if !reflect.DeepEqual(p.Qualification, want) {
+		t.Errorf("qualifications\n%+v\nwant\n%+v", p.Qualification, want)
+	}
+}
+
+func TestExportConditions(t *testing.T) {
+	cs := NewExport(source()).Conditions()
+	if len(cs) != 1 {
+		t.Fatalf("%d conditions", len(cs))
+	}
+	c := cs[0]
+	if c.ID != ID("Condition", "maria.garcia@example.org", "A15.0") {
+		t.Errorf("id %s", c.ID)
+	}
+	if got := c.ClinicalStatus.Code(SystemClinical); got != "active" {
+		t.Errorf("clinical status %q", got)
+	}
+	wantCode := &CodeableConcept{Coding: []Coding{{System: SystemICD10, Code: "A15.0", Display: "Tuberculosis of lung"}}, Text: "Tuberculosis of lung"}
+	if !reflect.DeepEqual(c.Code, wantCode) {
+		t.Errorf("code %+v, want %+v", c.Code, wantCode)
+	}
+	wantSubject := Reference{
+		Reference:  "Patient/" + ID("Patient", "maria.garcia@example.org"),
+		Identifier: &Identifier{System: SystemUser, Value: "maria.garcia@example.org"},
+		Display:    "Maria Garcia",
+	}
+	if !reflect.DeepEqual(c.Subject, wantSubject) {
+		t.Errorf("subject %+v, want %+v", c.Subject, wantSubject)
+	}
+}
+
+func TestExportMeasureReports(t *testing.T) {
+	ms := NewExport(source()).MeasureReports()
+	if len(ms) != 2 {
+		t.Fatalf("%d reports", len(ms))
+	}
+
+	spain := ms[0]
+	if spain.Subject.Identifier == nil || spain.Subject.Identifier.Value != "ES" || spain.Subject.Display != "Spain" {
+		t.Errorf("subject %+v", spain.Subject)
+	}
+	if spain.Period != (Period{Start: "1990-03-01", End: "2024-06-30"}) {
+		t.Errorf("period %+v, want from the discovery to now", spain.Period)
+	}
+	if spain.Date != "2024-06-30T12:00:00Z" {
+		t.Errorf("date %s", spain.Date)
+	}
+	if spain.Reporter == nil || spain.Reporter.Reference != "" || spain.Reporter.Identifier.Value != "john.smith@example.org" {
+		t.Errorf("reporter %+v, want an identifier only", spain.Reporter)
+	}
+	g := spain.Group[0]
+	counts := make(map[string]int)
+	for _, p := range g.Population {
+		for _, c := range p.Code.Coding {
+			counts[c.Code] = *p.Count
+		}
+	}
+	if counts["initial-population"] != 1240 || counts["deaths"] != 37 {
+		t.Errorf("counts %v", counts)
+	}
+
+	atlantis := ms[1]
+	if atlantis.Subject.Identifier != nil || atlantis.Period.Start != "" {
+		t.Errorf("subject %+v and period %+v, want no ISO code nor start", atlantis.Subject, atlantis.Period)
+	}
+	if got := atlantis.Group[0].Code.Code(SystemDisease); got != "FLU-X" {
+		t.Errorf("a catalog code is sent as %+v", atlantis.Group[0].Code)
+	}
+}
+
+func TestExportResources(t *testing.T) {
+	e := NewExport(source())
+	if _, ok := e.Resources("Observation"); ok {
+		t.Error("Observation is served")
+	}
+	var types []string
+	for _, r := range e.All() {
+		raw, err := json.Marshal(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var head struct {
+			ResourceType string `json:"resourceType"`
+		}
+		json.Unmarshal(raw, &head)
+		types = append(types, head.ResourceType)
+	}
+	want := []string{"Patient", "Practitioner", "Condition", "MeasureReport", "MeasureReport"}
+	if !reflect.DeepEqual(types, want) {
+		t.Errorf("exported %v, want %v", types, want)
+	}
+}
+
+// An exported bundle reads back as the rows it was built from, countries
+// with an ISO code aside.
+func TestExportRoundTrip(t *testing.T) {
+	src := source()
+	b, err := NewBundle("collection", "https://example.org/fhir", NewExport(src).All())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(b.Entry) == 0 || b.Entry[0].FullURL != "https://example.org/fhir/Patient/"+ID("Patient", "maria.garcia@example.org") {
+		t.Fatalf("entries %+v", b.Entry)
+	}
+	raw, err := json.Marshal(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded Bundle
+	if err := json.Unmarshal(raw, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	imp, issues := Read(&decoded)
+	if len(issues) > 0 {
+		t.Fatalf("issues: %+v", issues)
+	}
+
+	maria, john := src.Users[0], src.Users[1]
+	maria.CName = "ES"
+	want := models.Exchange{
+		People: []models.ExchangePerson{
+			{User: maria, Patient: true},
+			{User: john, Doctor: &src.Doctors[0], Specializations: []int{1, 2}},
+		},
+		PatientDiseases: src.PatientDiseases,
+		Records:         []models.Record{src.Records[0], src.Records[1]},
+	}
+	want.Records[0].CName = "ES"
+	if !reflect.DeepEqual(imp.Exchange, want) {
+		t.Errorf("read back\n%+v\nwant\n%+v", imp.Exchange, want)
+	}
+}
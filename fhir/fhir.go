@@ -0,0 +1,197 @@
+// Package fhir maps the application's people, diagnoses and reports to
+// FHIR R4 JSON resources and back:
+//
+//	Users + Patients          Patient
+//	Users + Doctor/Specialize Practitioner with qualifications
+//	PatientDisease            Condition
+//	Record                    MeasureReport
+//
+// Only the elements this mapping uses are modelled; anything else in an
+// imported resource is ignored.
+package fhir
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+)
+
+// ContentType is the media type of FHIR JSON.
+const ContentType = "application/fhir+json"
+
+// Code systems and canonical URLs used by the mapping.
+const (
+	SystemUser        = "urn:myapp:users"
+	SystemDisease     = "urn:myapp:diseases"
+	SystemDiseaseType = "urn:myapp:disease-types"
+	SystemPopulation  = "urn:myapp:measure-population"
+	MeasureBurden     = "urn:myapp:measures:disease-burden"
+
+	SystemICD10      = "http://hl7.org/fhir/sid/icd-10-cm"
+	SystemICD11      = "http://id.who.int/icd/release/11/mms"
+	SystemISO3166    = "urn:iso:std:iso:3166"
+	SystemDegree     = "http://terminology.hl7.org/CodeSystem/v2-0360|2.7"
+	SystemClinical   = "http://terminology.hl7.org/CodeSystem/condition-clinical"
+	SystemMeasurePop = "http://terminology.hl7.org/CodeSystem/measure-population"
+)
+
+type Bundle struct {
+	ResourceType string  `json:"resourceType"`
+	ID           string  `json:"id,omitempty"`
+	Type         string  `json:"type"`
+	Timestamp    string  `json:"timestamp,omitempty"`
+	Total        *int    `json:"total,omitempty"`
+	Entry        []Entry `json:"entry,omitempty"`
+}
+
+type Entry struct {
+	FullURL  string          `json:"fullUrl,omitempty"`
+	Resource json.RawMessage `json:"resource,omitempty"`
+	Request  *EntryRequest   `json:"request,omitempty"`
+	Response *EntryResponse  `json:"response,omitempty"`
+}
+
+type EntryRequest struct {
+	Method string `json:"method"`
+	URL    string `json:"url"`
+}
+
+type EntryResponse struct {
+	Status   string `json:"status"`
+	Location string `json:"location,omitempty"`
+}
+
+type Patient struct {
+	ResourceType string         `json:"resourceType"`
+	ID           string         `json:"id,omitempty"`
+	Identifier   []Identifier   `json:"identifier,omitempty"`
+	Name         []HumanName    `json:"name,omitempty"`
+	Telecom      []ContactPoint `json:"telecom,omitempty"`
+	Address      []Address      `json:"address,omitempty"`
+}
+
+type Practitioner struct {
+	ResourceType  string          `json:"resourceType"`
+	ID            string          `json:"id,omitempty"`
+	Identifier    []Identifier    `json:"identifier,omitempty"`
+	Name          []HumanName     `json:"name,omitempty"`
+	Telecom       []ContactPoint  `json:"telecom,omitempty"`
+	Address       []Address       `json:"address,omitempty"`
+	Qualification []Qualification `json:"qualification,omitempty"`
+}
+
+type Qualification struct {
+	Code CodeableConcept `json:"code"`
+}
+
+type Condition struct {
+	ResourceType   string           `json:"resourceType"`
+	ID             string           `json:"id,omitempty"`
+	ClinicalStatus *CodeableConcept `json:"clinicalStatus,omitempty"`
+	Code           *CodeableConcept `json:"code,omitempty"`
+	Subject        Reference        `json:"subject"`
+}
+
+type MeasureReport struct {
+	ResourceType string       `json:"resourceType"`
+	ID           string       `json:"id,omitempty"`
+	Status       string       `json:"status"`
+	Type         string       `json:"type"`
+	Measure      string       `json:"measure"`
+	Subject      *Reference   `json:"subject,omitempty"`
+	Date         string       `json:"date,omitempty"`
+	Reporter     *Reference   `json:"reporter,omitempty"`
+	Period       Period       `json:"period"`
+	Group        []GroupEntry `json:"group,omitempty"`
+}
+
+type GroupEntry struct {
+	Code       *CodeableConcept `json:"code,omitempty"`
+	Population []Population     `json:"population,omitempty"`
+}
+
+type Population struct {
+	Code  *CodeableConcept `json:"code,omitempty"`
+	Count *int             `json:"count,omitempty"`
+}
+
+type Period struct {
+	Start string `json:"start,omitempty"`
+	End   string `json:"end,omitempty"`
+}
+
+type Identifier struct {
+	System string `json:"system,omitempty"`
+	Value  string `json:"value,omitempty"`
+}
+
+type HumanName struct {
+	Use    string   `json:"use,omitempty"`
+	Family string   `json:"family,omitempty"`
+	Given  []string `json:"given,omitempty"`
+}
+
+type ContactPoint struct {
+	System string `json:"system,omitempty"`
+	Value  string `json:"value,omitempty"`
+}
+
+type Address struct {
+	Country string `json:"country,omitempty"`
+}
+
+type CodeableConcept struct {
+	Coding []Coding `json:"coding,omitempty"`
+	Text   string   `json:"text,omitempty"`
+}
+
+type Coding struct {
+	System  string `json:"system,omitempty"`
+	Code    string `json:"code,omitempty"`
+	Display string `json:"display,omitempty"`
+}
+
+// Code returns the code of the first coding from system, or "".
+func (c *CodeableConcept) Code(system string) string {
+	if c == nil {
+		return ""
+	}
+	for _, cd := range c.Coding {
+		if cd.System == system {
+			return cd.Code
+		}
+	}
+	return ""
+}
+
+type Reference struct {
+	Reference  string      `json:"reference,omitempty"`
+	Identifier *Identifier `json:"identifier,omitempty"`
+	Display    string      `json:"display,omitempty"`
+}
+
+// OperationOutcome reports why a request failed, one issue per problem.
+type OperationOutcome struct {
+	ResourceType string  `json:"resourceType"`
+	Issue        []Issue `json:"issue"`
+}
+
+type Issue struct {
+	Severity    string   `json:"severity"`
+	Code        string   `json:"code"`
+	Diagnostics string   `json:"diagnostics,omitempty"`
+	Expression  []string `json:"expression,omitempty"`
+}
+
+// Outcome wraps issues into an OperationOutcome.
+func Outcome(issues ...Issue) *OperationOutcome {
+	return &OperationOutcome{ResourceType: "OperationOutcome", Issue: issues}
+}
+
+// ID derives the stable id of a resource from the primary key of the row
+// it is built from. Emails are not valid FHIR ids, so keys are hashed.
+func ID(resourceType string, key ...string) string {
+	sum := sha256.Sum256([]byte(resourceType + "\x00" + strings.Join(key, "\x00")))
+	return hex.EncodeToString(sum[:16])
+}
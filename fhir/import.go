@@ -0,0 +1,396 @@
+package fhir
+
+import (
+	"encoding/json"
+	"fmt"
+	"myapp/models"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Import is a bundle decoded into rows. The Entries slices hold, for each
+// row of the exchange, the index of the bundle entry it came from.
+type Import struct {
+	Exchange models.Exchange
+
+	PersonEntries         []int
+	PatientDiseaseEntries []int
+	RecordEntries         []int
+
+	entries int
+}
+
+// Entry returns the bundle entry of the row reported by an
+// models.ExchangeError.
+func (imp *Import) Entry(kind string, index int) int {
+	switch kind {
+	case models.ExchangePersonRow:
+		return imp.PersonEntries[index]
+	case models.ExchangePatientDiseaseRow:
+		return imp.PatientDiseaseEntries[index]
+	default:
+		return imp.RecordEntries[index]
+	}
+}
+
+// Locations returns the reference of the resource stored for each bundle
+// entry, as served by Export.
+func (imp *Import) Locations() []string {
+	loc := make([]string, imp.entries)
+	for i, p := range imp.Exchange.People {
+		if p.Doctor != nil {
+			loc[imp.PersonEntries[i]] = "Practitioner/" + ID("Practitioner", p.User.Email)
+		} else {
+			loc[imp.PersonEntries[i]] = "Patient/" + ID("Patient", p.User.Email)
+		}
+	}
+	for i, pd := range imp.Exchange.PatientDiseases {
+		loc[imp.PatientDiseaseEntries[i]] = "Condition/" + ID("Condition", pd.Email, pd.DiseaseCode)
+	}
+	for i, rec := range imp.Exchange.Records {
+		loc[imp.RecordEntries[i]] = "MeasureReport/" + ID("MeasureReport", rec.Email, rec.CName, rec.DiseaseCode)
+	}
+	return loc
+}
+
+// Invalid reports a problem with an element of a bundle entry; path is
+// relative to the entry's resource.
+func Invalid(entry int, path, format string, args ...any) Issue {
+	expr := fmt.Sprintf("Bundle.entry[%d].resource", entry)
+	if path != "" {
+		expr += "." + path
+	}
+	return Issue{Severity: "error", Code: "invalid", Diagnostics: fmt.Sprintf(format, args...), Expression: []string{expr}}
+}
+
+// Column sizes of the tables the resources are stored in.
+const (
+	maxEmail   = 60
+	maxName    = 30
+	maxSurname = 40
+	maxPhone   = 20
+	maxDegree  = 20
+)
+
+// Read checks a transaction or collection bundle and decodes its Patient,
+// Practitioner, Condition and MeasureReport entries. Country names and
+// disease codes are taken as sent; the caller resolves them against the
+// database. Any issue means nothing should be stored.
+func Read(b *Bundle) (*Import, []Issue) {
+	if b.ResourceType != "Bundle" {
+		return nil, []Issue{{Severity: "error", Code: "structure", Diagnostics: "expected a Bundle, got " + strconv.Quote(b.ResourceType)}}
+	}
+	switch b.Type {
+	case "transaction", "collection":
+	case "batch":
+		return nil, []Issue{{Severity: "error", Code: "not-supported", Diagnostics: "batch bundles are not supported, send a transaction", Expression: []string{"Bundle.type"}}}
+	default:
+		return nil, []Issue{{Severity: "error", Code: "value", Diagnostics: "bundle type must be transaction or collection", Expression: []string{"Bundle.type"}}}
+	}
+
+	r := &reader{
+		imp:      &Import{entries: len(b.Entry)},
+		patients: make(map[string]string),
+	}
+
+	// People go first so conditions can refer to patients of the same
+	// bundle by their fullUrl or id.
+	types := make([]string, len(b.Entry))
+	for i, e := range b.Entry {
+		var head struct {
+			ResourceType string `json:"resourceType"`
+		}
+		if err := json.Unmarshal(e.Resource, &head); err != nil || len(e.Resource) == 0 {
+			r.issues = append(r.issues, Invalid(i, "", "entry has no resource"))
+			continue
+		}
+		if req := e.Request; req != nil && req.Method != "POST" && req.Method != "PUT" {
+			r.issues = append(r.issues, Issue{Severity: "error", Code: "not-supported",
+				Diagnostics: "only POST and PUT entries can be imported", Expression: []string{fmt.Sprintf("Bundle.entry[%d].request.method", i)}})
+			continue
+		}
+		types[i] = head.ResourceType
+		switch head.ResourceType {
+		case "Patient":
+			r.patient(i, e)
+		case "Practitioner":
+			r.practitioner(i, e)
+		case "Condition", "MeasureReport":
+		default:
+			r.issues = append(r.issues, Issue{Severity: "error", Code: "not-supported",
+				Diagnostics: "cannot import " + head.ResourceType + " resources", Expression: []string{fmt.Sprintf("Bundle.entry[%d].resource", i)}})
+		}
+	}
+	for i, e := range b.Entry {
+		switch types[i] {
+		case "Condition":
+			r.condition(i, e)
+		case "MeasureReport":
+			r.measureReport(i, e)
+		}
+	}
+
+	if len(r.issues) > 0 {
+		return nil, r.issues
+	}
+	return r.imp, nil
+}
+
+type reader struct {
+	imp    *Import
+	issues []Issue
+
+	// patients maps the fullUrl and relative reference of each Patient
+	// entry to its email.
+	patients map[string]string
+}
+
+func (r *reader) fail(entry int, path, format string, args ...any) {
+	r.issues = append(r.issues, Invalid(entry, path, format, args...))
+}
+
+func (r *reader) decode(entry int, e Entry, v any) bool {
+	if err := json.Unmarshal(e.Resource, v); err != nil {
+		r.fail(entry, "", "%v", err)
+		return false
+	}
+	return true
+}
+
+func (r *reader) patient(entry int, e Entry) {
+	var p Patient
+	if !r.decode(entry, e, &p) {
+		return
+	}
+	u, ok := r.user(entry, p.Identifier, p.Name, p.Telecom, p.Address)
+	if !ok {
+		return
+	}
+
+	if e.FullURL != "" {
+		r.patients[e.FullURL] = u.Email
+	}
+	if p.ID != "" {
+		r.patients["Patient/"+p.ID] = u.Email
+	}
+	r.imp.Exchange.People = append(r.imp.Exchange.People, models.ExchangePerson{User: u, Patient: true})
+	r.imp.PersonEntries = append(r.imp.PersonEntries, entry)
+}
+
+func (r *reader) practitioner(entry int, e Entry) {
+	var p Practitioner
+	if !r.decode(entry, e, &p) {
+		return
+	}
+	u, ok := r.user(entry, p.Identifier, p.Name, p.Telecom, p.Address)
+	if !ok {
+		return
+	}
+
+	var degree string
+	specs := []int{}
+	for i, q := range p.Qualification {
+		if code := q.Code.Code(SystemDiseaseType); code != "" {
+			id, err := strconv.Atoi(code)
+			if err != nil {
+				r.fail(entry, fmt.Sprintf("qualification[%d].code", i), "disease type %q is not a number", code)
+				return
+			}
+			specs = append(specs, id)
+			continue
+		}
+		if degree != "" {
+			continue
+		}
+		if degree = q.Code.Code(SystemDegree); degree == "" {
+			degree = q.Code.Text
+		}
+		if degree == "" && len(q.Code.Coding) > 0 {
+			degree = q.Code.Coding[0].Code
+		}
+	}
+	if degree == "" {
+		r.fail(entry, "qualification", "a qualification with the practitioner's degree is required")
+		return
+	}
+	if !r.fits(entry, "qualification.code", "degree", degree, maxDegree) {
+		return
+	}
+
+	r.imp.Exchange.People = append(r.imp.Exchange.People, models.ExchangePerson{
+		User:            u,
+		Doctor:          &models.Doctor{Email: u.Email, Degree: degree},
+		Specializations: specs,
+	})
+	r.imp.PersonEntries = append(r.imp.PersonEntries, entry)
+}
+
+// user reads the elements Patient and Practitioner share into a user. The
+// email comes from an identifier of SystemUser or else an email contact.
+func (r *reader) user(entry int, ids []Identifier, names []HumanName, telecom []ContactPoint, addresses []Address) (models.User, bool) {
+	var u models.User
+	for _, id := range ids {
+		if id.System == SystemUser {
+			u.Email = strings.TrimSpace(id.Value)
+			break
+		}
+	}
+	for _, t := range telecom {
+		switch {
+		case t.System == "email" && u.Email == "":
+			u.Email = strings.TrimSpace(t.Value)
+		case t.System == "phone" && !u.Phone.Valid:
+			u.Phone.String, u.Phone.Valid = strings.TrimSpace(t.Value), true
+		}
+	}
+	if u.Email == "" {
+		r.fail(entry, "identifier", "an identifier with system %s or an email contact is required", SystemUser)
+		return u, false
+	}
+
+	if len(names) == 0 {
+		r.fail(entry, "name", "a name is required")
+		return u, false
+	}
+	name := names[0]
+	for _, n := range names {
+		if n.Use == "official" {
+			name = n
+			break
+		}
+	}
+	u.Surname = strings.TrimSpace(name.Family)
+	u.Name = strings.TrimSpace(strings.Join(name.Given, " "))
+	if u.Surname == "" || u.Name == "" {
+		r.fail(entry, "name", "the name needs a family and a given name")
+		return u, false
+	}
+
+	if len(addresses) == 0 || strings.TrimSpace(addresses[0].Country) == "" {
+		r.fail(entry, "address", "an address with a country is required")
+		return u, false
+	}
+	u.CName = strings.TrimSpace(addresses[0].Country)
+
+	ok := r.fits(entry, "identifier", "email", u.Email, maxEmail) &&
+		r.fits(entry, "name.given", "given name", u.Name, maxName) &&
+		r.fits(entry, "name.family", "family name", u.Surname, maxSurname) &&
+		(!u.Phone.Valid || r.fits(entry, "telecom", "phone", u.Phone.String, maxPhone))
+	return u, ok
+}
+
+func (r *reader) fits(entry int, path, what, value string, size int) bool {
+	if utf8.RuneCountInString(value) > size {
+		r.fail(entry, path, "%s is longer than %d characters", what, size)
+		return false
+	}
+	return true
+}
+
+func (r *reader) condition(entry int, e Entry) {
+	var c Condition
+	if !r.decode(entry, e, &c) {
+		return
+	}
+	if status := c.ClinicalStatus.Code(SystemClinical); status != "" && status != "active" && status != "recurrence" && status != "relapse" {
+		r.fail(entry, "clinicalStatus", "only active conditions can be imported, got %s", status)
+		return
+	}
+
+	email := r.subject(c.Subject)
+	if email == "" {
+		r.fail(entry, "subject", "subject must carry an identifier with system %s or refer to a Patient in the bundle", SystemUser)
+		return
+	}
+	code := diseaseCode(c.Code)
+	if code == "" {
+		r.fail(entry, "code", "code needs a coding from ICD-10-CM, ICD-11 or %s", SystemDisease)
+		return
+	}
+
+	r.imp.Exchange.PatientDiseases = append(r.imp.Exchange.PatientDiseases, models.PatientDisease{Email: email, DiseaseCode: code})
+	r.imp.PatientDiseaseEntries = append(r.imp.PatientDiseaseEntries, entry)
+}
+
+func (r *reader) subject(ref Reference) string {
+	if ref.Identifier != nil && ref.Identifier.System == SystemUser && ref.Identifier.Value != "" {
+		return strings.TrimSpace(ref.Identifier.Value)
+	}
+	return r.patients[ref.Reference]
+}
+
+func (r *reader) measureReport(entry int, e Entry) {
+	var m MeasureReport
+	if !r.decode(entry, e, &m) {
+		return
+	}
+	if m.Measure != MeasureBurden {
+		r.fail(entry, "measure", "only %s reports can be imported", MeasureBurden)
+		return
+	}
+	if m.Status != "complete" {
+		r.fail(entry, "status", "only complete reports can be imported")
+		return
+	}
+
+	var rec models.Record
+	if m.Reporter == nil || m.Reporter.Identifier == nil || m.Reporter.Identifier.System != SystemUser || m.Reporter.Identifier.Value == "" {
+		r.fail(entry, "reporter", "reporter must carry an identifier with system %s", SystemUser)
+		return
+	}
+	rec.Email = strings.TrimSpace(m.Reporter.Identifier.Value)
+
+	if s := m.Subject; s != nil {
+		if s.Identifier != nil && s.Identifier.System == SystemISO3166 {
+			rec.CName = strings.TrimSpace(s.Identifier.Value)
+		} else {
+			rec.CName = strings.TrimSpace(s.Display)
+		}
+	}
+	if rec.CName == "" {
+		r.fail(entry, "subject", "subject must name the country, by an ISO 3166 identifier or display")
+		return
+	}
+
+	if len(m.Group) != 1 {
+		r.fail(entry, "group", "a report needs exactly one group")
+		return
+	}
+	g := m.Group[0]
+	if rec.DiseaseCode = diseaseCode(g.Code); rec.DiseaseCode == "" {
+		r.fail(entry, "group[0].code", "code needs a coding from ICD-10-CM, ICD-11 or %s", SystemDisease)
+		return
+	}
+	var patients, deaths *int
+	for _, p := range g.Population {
+		switch {
+		case p.Code.Code(SystemMeasurePop) == "initial-population":
+			patients = p.Count
+		case p.Code.Code(SystemPopulation) == "deaths":
+			deaths = p.Count
+		}
+	}
+	if patients == nil || deaths == nil || *patients < 0 || *deaths < 0 {
+		r.fail(entry, "group[0].population", "the initial-population and deaths counts are required and cannot be negative")
+		return
+	}
+	rec.TotalPatients, rec.TotalDeaths = *patients, *deaths
+
+	r.imp.Exchange.Records = append(r.imp.Exchange.Records, rec)
+	r.imp.RecordEntries = append(r.imp.RecordEntries, entry)
+}
+
+// diseaseCode returns the first code from a disease code system.
+func diseaseCode(c *CodeableConcept) string {
+	if c == nil {
+		return ""
+	}
+	for _, cd := range c.Coding {
+		switch cd.System {
+		case SystemICD10, SystemICD11, SystemDisease:
+			return strings.TrimSpace(cd.Code)
+		}
+	}
+	return ""
+}
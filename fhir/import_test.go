@@ -0,0 +1,124 @@
+package fhir
+
+import (
+	"database/sql"
+	"encoding/json"
+	"myapp/models"
+	"os"
+	"reflect"
+	"testing"
+)
+
+// readSample decodes a bundle of samples/.
+func readSample(t *testing.T, name string) *Bundle {
+	t.Helper()
+	b, err := os.ReadFile("samples/" + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var bundle Bundle
+	if err := json.Unmarshal(b, &bundle); err != nil {
+		t.Fatal(err)
+	}
+	return &bundle
+}
+
+func TestReadTransaction(t *testing.T) {
+	imp, issues := Read(readSample(t, "transaction.json"))
+	if len(issues) > 0 {
+		t.Fatalf("issues: %+v", issues)
+	}
+
+	want := models.Exchange{
+		People: []models.ExchangePerson{
+			{
+				User: models.User{Email: "maria.garcia@example.org", Name: "Maria", Surname: "Garcia",
+					Phone: sql.NullString{String: "+34 600 123 456", Valid: true}, CName: "ES"},
+				Patient: true,
+			},
+			{
+				User:            models.User{Email: "john.smith@example.org", Name: "John", Surname: "Smith", CName: "United Kingdom"},
+				Doctor:          &models.Doctor{Email: "john.smith@example.org", Degree: "MD"},
+				Specializations: []int{1},
+			},
+		},
+		PatientDiseases: []models.PatientDisease{{Email: "maria.garcia@example.org", DiseaseCode: "A15.0"}},
+		Records: []models.Record{{Email: "ana.lopez@example.org", CName: "ES", DiseaseCode: "A15.0",
+			TotalPatients: 1240, TotalDeaths: 37}},
+	}
+	if !reflect.DeepEqual(imp.Exchange, want) {
+		t.Errorf("read\n%+v\nwant\n%+v", imp.Exchange, want)
+	}
+
+	for _, e := range []struct {
+		kind         string
+		index, entry int
+	}{
+		{models.ExchangePersonRow, 0, 0},
+		{models.ExchangePersonRow, 1, 1},
+		{models.ExchangePatientDiseaseRow, 0, 2},
+		{models.ExchangeRecordRow, 0, 3},
+	} {
+		if got := imp.Entry(e.kind, e.index); got != e.entry {
+			t.Errorf("%s %d came from entry %d, want %d", e.kind, e.index, got, e.entry)
+		}
+	}
+
+	wantLoc := []string{
+		"Patient/" + ID("Patient", "maria.garcia@example.org"),
+		"Practitioner/" + ID("Practitioner", "john.smith@example.org"),
+		"Condition/" + ID("Condition", "maria.garcia@example.org", "A15.0"),
+		"MeasureReport/" + ID("MeasureReport", "ana.lopez@example.org", "ES", "A15.0"),
+	}
+	if got := imp.Locations(); !reflect.DeepEqual(got, wantLoc) {
+		t.Errorf("locations %v, want %v", got, wantLoc)
+	}
+}
+
+func TestReadInvalid(t *testing.T) {
+	imp, issues := Read(readSample(t, "invalid.json"))
+	if imp != nil {
+		t.Errorf("read %+v from an invalid bundle", imp.Exchange)
+	}
+
+	// People and unsupported entries are checked first, then the
+	// conditions and reports that may refer to them.
+	want := []struct {
+		code, expr string
+	}{
+		{"invalid", "Bundle.entry[0].resource.identifier"},
+		{"not-supported", "Bundle.entry[3].resource"},
+		{"not-supported", "Bundle.entry[4].request.method"},
+		{"invalid", "Bundle.entry[1].resource.subject"},
+		{"invalid", "Bundle.entry[2].resource.group[0].population"},
+	}
+	if len(issues) != len(want) {
+		t.Fatalf("%d issues, want %d: %+v", len(issues), len(want), issues)
+	}
+	for i, w := range want {
+		is := issues[i]
+		if is.Severity != "error" || is.Code != w.code || len(is.Expression) != 1 || is.Expression[0] != w.expr {
+			t.Errorf("issue %d is %+v, want %s at %s", i, is, w.code, w.expr)
+		}
+	}
+}
+
+func TestReadBundleType(t *testing.T) {
+	for _, tc := range []struct {
+		resourceType, typ, code string
+	}{
+		{"Patient", "transaction", "structure"},
+		{"Bundle", "batch", "not-supported"},
+		{"Bundle", "searchset", "value"},
+	} {
+		imp, issues := Read(&Bundle{ResourceType: tc.resourceType, Type: tc.typ})
+		if imp != nil || len(issues) != 1 || issues[0].Code != tc.code {
+			t.Errorf("%s %s: read %v with issues %+v, want one %s issue", tc.resourceType, tc.typ, imp, issues, tc.code)
+		}
+	}
+	for _, typ := range []string{"transaction", "collection"} {
+		if _, issues := Read(&Bundle{ResourceType: "Bundle", Type: typ}); len(issues) > 0 {
+			t.Errorf("an empty %s has issues %+v", typ, issues)
+		}
+	}
+}
@@ -0,0 +1,219 @@
+// Package fieldcrypt encrypts single column values with envelope
+// encryption. Every value is encrypted with AES-256-GCM under its own
+// random data key, and the data key is stored alongside it, wrapped by a
+// master key from the configuration:
+//
+//	enc1:<master key ID>:<base64 of wrap nonce, wrapped data key, nonce, ciphertext>
+//
+// Rotating the master key only rewraps the data keys (Rewrap); the values
+// themselves are not encrypted again. Both the data and its wrapped key
+// are bound to the column, so a value copied to another column does not
+// open.
+package fieldcrypt
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const (
+	prefix  = "enc1:"
+	keySize = 32 // AES-256, for master and data keys
+)
+
+// Errors of Open and Rewrap.
+var (
+	ErrUnknownKey = errors.New("fieldcrypt: value is encrypted with an unknown master key")
+	ErrCorrupt    = errors.New("fieldcrypt: value is corrupt or belongs to another column")
+)
+
+var keyIDRe = regexp.MustCompile(`^[A-Za-z0-9_-]{1,32}$`)
+
+// Keyring holds the master keys. New values are encrypted with the current
+// one; the others are kept to open values written before a rotation.
+type Keyring struct {
+	current string
+	keys    map[string]cipher.AEAD
+}
+
+// ParseKeys parses a comma-separated list of master keys, each an ID and
+// a base64-encoded 32-byte key, current key first:
+//
+//	2025b:q83vEjRWeJq83vEjRWeJq83vEjRWeJq83vEjRWeJq80=,2024:...
+func ParseKeys(s string) (*Keyring, error) {
+	k := &Keyring{keys: make(map[string]cipher.AEAD)}
+	for _, entry := range strings.Split(s, ",") {
+		id, encoded, ok := strings.Cut(strings.TrimSpace(entry), ":")
+		if !ok || !keyIDRe.MatchString(id) {
+			return nil, fmt.Errorf("fieldcrypt: %q is not ID:base64-key", entry)
+		}
+		if _, dup := k.keys[id]; dup {
+			return nil, fmt.Errorf("fieldcrypt: key %s is listed twice", id)
+		}
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil || len(key) != keySize {
+			return nil, fmt.Errorf("fieldcrypt: key %s is not %d base64-encoded bytes", id, keySize)
+		}
+		if k.keys[id], err = newGCM(key); err != nil {
+			return nil, err
+		}
+		if k.current == "" {
+			k.current = id
+		}
+	}
+	return k, nil
+}
+
+// Current returns the ID of the master key new values are encrypted with.
+func (k *Keyring) Current() string {
+	return k.current
+}
+
+// CurrentPrefix is the prefix of every value sealed or rewrapped with the
+// current master key, for finding the values a rotation has yet to reach.
+func (k *Keyring) CurrentPrefix() string {
+	return prefix + k.current + ":"
+}
+
+// Sealed reports whether value was written by Seal.
+func Sealed(value string) bool {
+	return strings.HasPrefix(value, prefix)
+}
+
+// KeyID returns the master key a sealed value is wrapped with, or "" if
+// value is not sealed.
+func KeyID(value string) string {
+	rest, ok := strings.CutPrefix(value, prefix)
+	if !ok {
+		return ""
+	}
+	id, _, _ := strings.Cut(rest, ":")
+	return id
+}
+
+// Seal encrypts plaintext for column, e.g. "users.phone".
+func (k *Keyring) Seal(column, plaintext string) (string, error) {
+	dataKey := make([]byte, keySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return "", err
+	}
+	data, err := newGCM(dataKey)
+	if err != nil {
+		return "", err
+	}
+	wrapped, err := k.wrap(column, dataKey)
+	if err != nil {
+		return "", err
+	}
+	sealed, err := seal(data, []byte(column), []byte(plaintext))
+	if err != nil {
+		return "", err
+	}
+	return prefix + k.current + ":" + base64.RawURLEncoding.EncodeToString(append(wrapped, sealed...)), nil
+}
+
+// Open decrypts a value of column. A value that is not sealed, written
+// before its column was encrypted, is returned as it is.
+func (k *Keyring) Open(column, value string) (string, error) {
+	if !Sealed(value) {
+		return value, nil
+	}
+	dataKey, sealed, err := k.unwrap(column, value)
+	if err != nil {
+		return "", err
+	}
+	data, err := newGCM(dataKey)
+	if err != nil {
+		return "", err
+	}
+	plaintext, err := open(data, []byte(column), sealed)
+	if err != nil {
+		return "", ErrCorrupt
+	}
+	return string(plaintext), nil
+}
+
+// Rewrap returns value with its data key wrapped by the current master
+// key, or sealed if it was plaintext. Values already under the current
+// key are returned unchanged.
+func (k *Keyring) Rewrap(column, value string) (string, error) {
+	if !Sealed(value) {
+		return k.Seal(column, value)
+	}
+	if KeyID(value) == k.current {
+		return value, nil
+	}
+	dataKey, sealed, err := k.unwrap(column, value)
+	if err != nil {
+		return "", err
+	}
+	// Check the data opens before committing to it.
+	data, err := newGCM(dataKey)
+	if err != nil {
+		return "", err
+	}
+	if _, err := open(data, []byte(column), sealed); err != nil {
+		return "", ErrCorrupt
+	}
+	wrapped, err := k.wrap(column, dataKey)
+	if err != nil {
+		return "", err
+	}
+	return prefix + k.current + ":" + base64.RawURLEncoding.EncodeToString(append(wrapped, sealed...)), nil
+}
+
+// wrap encrypts a data key with the current master key.
+func (k *Keyring) wrap(column string, dataKey []byte) ([]byte, error) {
+	return seal(k.keys[k.current], []byte(k.current+":"+column), dataKey)
+}
+
+// unwrap returns the data key of a sealed value and the encrypted data.
+func (k *Keyring) unwrap(column, value string) (dataKey, sealed []byte, err error) {
+	id, encoded, _ := strings.Cut(strings.TrimPrefix(value, prefix), ":")
+	master, ok := k.keys[id]
+	if !ok {
+		return nil, nil, fmt.Errorf("%w %q", ErrUnknownKey, id)
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(encoded)
+	wrappedSize := master.NonceSize() + keySize + master.Overhead()
+	if err != nil || len(raw) < wrappedSize {
+		return nil, nil, ErrCorrupt
+	}
+	dataKey, err = open(master, []byte(id+":"+column), raw[:wrappedSize])
+	if err != nil {
+		return nil, nil, ErrCorrupt
+	}
+	return dataKey, raw[wrappedSize:], nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// seal encrypts under a random nonce and returns the nonce followed by the
+// ciphertext.
+func seal(aead cipher.AEAD, ad, plaintext []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, ad), nil
+}
+
+func open(aead cipher.AEAD, ad, sealed []byte) ([]byte, error) {
+	if len(sealed) < aead.NonceSize() {
+		return nil, ErrCorrupt
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	return aead.Open(nil, nonce, ciphertext, ad)
+}
@@ -0,0 +1,242 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"myapp/alert"
+	"myapp/models"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// AlertHandler manages the outbreak alert rules and the alerts they
+// raise. Unresolved alerts are also shown on the dashboard.
+type AlertHandler struct {
+	DB        *sql.DB
+	Templates TemplateSet
+	Engine    *alert.Engine
+}
+
+func NewAlertHandler(db *sql.DB, templates TemplateSet, engine *alert.Engine) *AlertHandler {
+	return &AlertHandler{
+		DB:        db,
+		Templates: templates,
+		Engine:    engine,
+	}
+}
+
+// recentAlerts is how many alerts the alerts page lists.
+const recentAlerts = 200
+
+// RegisterRoutes mounts the alert pages under /alerts.
+func (h *AlertHandler) RegisterRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("GET /alerts", h.List)
+	mux.HandleFunc("POST /alerts/evaluate", h.Evaluate)
+	mux.HandleFunc("POST /alerts/rules", h.CreateRule)
+	mux.HandleFunc("POST /alerts/rules/{id}/active", h.SetRuleActive)
+	mux.HandleFunc("POST /alerts/rules/{id}/delete", h.DeleteRule)
+	mux.HandleFunc("POST /alerts/{id}/{status}", h.SetStatus)
+}
+
+func (h *AlertHandler) List(w http.ResponseWriter, r *http.Request) {
+	h.render(w, r, http.StatusOK, nil, "", "")
+}
+
+// Evaluate evaluates the rules now rather than at the next interval.
+func (h *AlertHandler) Evaluate(w http.ResponseWriter, r *http.Request) {
+	raised, err := h.Engine.Evaluate(r.Context())
+	if err != nil {
+		h.render(w, r, http.StatusInternalServerError, nil, "Error evaluating rules: "+err.Error(), "")
+		return
+	}
+	if err := h.Engine.Notify(r.Context()); err != nil {
+		h.render(w, r, http.StatusOK, nil, "Error sending notifications: "+err.Error(), "")
+		return
+	}
+	h.render(w, r, http.StatusOK, nil, "", strconv.Itoa(len(raised))+" new alerts raised.")
+}
+
+// CreateRule adds a rule from the form on the alerts page.
+func (h *AlertHandler) CreateRule(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Error parsing form: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	f := r.PostForm
+
+	x := &models.AlertRule{
+		Name:     strings.TrimSpace(f.Get("name")),
+		Kind:     f.Get("kind"),
+		Severity: f.Get("severity"),
+		Active:   true,
+	}
+	if code := strings.TrimSpace(f.Get("disease_code")); code != "" {
+		x.DiseaseCode = sql.NullString{String: code, Valid: true}
+	}
+	if cname := strings.TrimSpace(f.Get("cname")); cname != "" {
+		if err := resolveCountry(r.Context(), h.DB, &cname); err != nil {
+			http.Error(w, "Error resolving country: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		x.CName = sql.NullString{String: cname, Valid: true}
+	}
+
+	problem := checkAlertRule(x)
+	var err error
+	if problem == "" {
+		if x.Threshold, err = strconv.ParseFloat(f.Get("threshold"), 64); err != nil || x.Threshold < 0 {
+			problem = "Threshold must be a number of percent, 0 or more."
+		}
+	}
+	if problem == "" {
+		if x.MinPatients, err = strconv.Atoi(f.Get("min_patients")); err != nil || x.MinPatients < 0 {
+			problem = "Minimum patients must be a whole number, 0 or more."
+		}
+	}
+	if problem == "" {
+		if x.WindowDays, err = strconv.Atoi(f.Get("window_days")); err != nil || x.WindowDays < 1 {
+			problem = "Window must be a whole number of days, 1 or more."
+		}
+	}
+	if problem != "" {
+		h.render(w, r, http.StatusBadRequest, f, problem, "")
+		return
+	}
+
+	if err := models.CreateAlertRule(r.Context(), h.DB, x); err != nil {
+		http.Error(w, "Error creating alert rule: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, "/alerts", http.StatusSeeOther)
+}
+
+// checkAlertRule returns what is wrong with the text fields of a new
+// rule, or "".
+func checkAlertRule(x *models.AlertRule) string {
+	switch {
+	case x.Name == "":
+		return "Name is required."
+	case len(x.Name) > 100:
+		return "Name must be at most 100 characters."
+	case !contains(models.AlertRuleKinds, x.Kind):
+		return "Choose what the rule looks for."
+	case !contains(models.AlertSeverities, x.Severity):
+		return "Choose a severity."
+	}
+	return ""
+}
+
+// SetRuleActive pauses or resumes a rule.
+func (h *AlertHandler) SetRuleActive(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid rule ID", http.StatusBadRequest)
+		return
+	}
+	active, _ := strconv.ParseBool(r.FormValue("active"))
+	h.done(w, r, models.SetAlertRuleActive(r.Context(), h.DB, id, active), "Error updating alert rule: ")
+}
+
+func (h *AlertHandler) DeleteRule(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid rule ID", http.StatusBadRequest)
+		return
+	}
+	h.done(w, r, models.DeleteAlertRule(r.Context(), h.DB, id), "Error deleting alert rule: ")
+}
+
+// SetStatus acknowledges or resolves an alert, then goes back to the
+// page the form was on.
+func (h *AlertHandler) SetStatus(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid alert ID", http.StatusBadRequest)
+		return
+	}
+	status := r.PathValue("status")
+	if status != models.AlertAcknowledged && status != models.AlertResolved {
+		http.NotFound(w, r)
+		return
+	}
+	h.done(w, r, models.SetAlertStatus(r.Context(), h.DB, id, status), "Error updating alert: ")
+}
+
+// done redirects to the page named by the form's back field, or the
+// alerts page, after a successful change, and reports err otherwise.
+func (h *AlertHandler) done(w http.ResponseWriter, r *http.Request, err error, msg string) {
+	switch {
+	case errors.Is(err, models.ErrNoAlert):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case err != nil:
+		http.Error(w, msg+err.Error(), http.StatusInternalServerError)
+	default:
+		back := r.FormValue("back")
+		if !strings.HasPrefix(back, "/") || strings.HasPrefix(back, "//") {
+			back = "/alerts"
+		}
+		http.Redirect(w, r, back, http.StatusSeeOther)
+	}
+}
+
+// ruleKinds describes each kind of rule for the form.
+var ruleKinds = []struct{ Value, Label string }{
+	{models.RuleFatalityRate, "Case fatality rate above threshold %"},
+	{models.RuleNewDiscovery, "Disease discovered in a country within the window"},
+	{models.RulePatientGrowth, "Patients grew by more than threshold % over the window"},
+}
+
+// render shows the rules, the rule form, filled in with form if it was
+// rejected, and the recent alerts.
+func (h *AlertHandler) render(w http.ResponseWriter, r *http.Request, status int, form url.Values, problem, notice string) {
+	rules, err := models.GetAlertRules(r.Context(), h.DB)
+	if err != nil {
+		http.Error(w, "Error fetching alert rules: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	alerts, err := models.GetRecentAlerts(r.Context(), h.DB, recentAlerts)
+	if err != nil {
+		http.Error(w, "Error fetching alerts: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	diseases, err := models.GetAllDiseases(r.Context(), h.DB)
+	if err != nil {
+		http.Error(w, "Error fetching diseases: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	countries, err := models.GetAllCountries(r.Context(), h.DB)
+	if err != nil {
+		http.Error(w, "Error fetching countries: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if form == nil {
+		form = url.Values{"severity": {"warning"}, "threshold": {"5"}, "min_patients": {"0"}, "window_days": {"7"}}
+	}
+
+	tmpl, err := h.Templates.Template("alerts/list")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	data := map[string]any{
+		"Title":      "Outbreak Alerts",
+		"Rules":      rules,
+		"Alerts":     alerts,
+		"Kinds":      ruleKinds,
+		"Severities": models.AlertSeverities,
+		"Diseases":   diseases,
+		"Countries":  countries,
+		"Form":       form,
+		"Problem":    problem,
+		"Notice":     notice,
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	if err := tmpl.Execute(w, data); err != nil {
+		http.Error(w, "Error rendering template: "+err.Error(), http.StatusInternalServerError)
+	}
+}
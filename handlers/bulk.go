@@ -0,0 +1,163 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"myapp/models"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// reassignColumn is a foreign key offered by the bulk reassign action.
+type reassignColumn struct {
+	Column string
+	Label  string
+	Table  string
+}
+
+// bulkRow is a models.RowOutcome prepared for the result page.
+type bulkRow struct {
+	models.RowOutcome
+	Label string
+	URL   string // set for rows that still exist after the action
+}
+
+func (res *Resource[T]) registerBulkRoutes(mux *http.ServeMux, base string) {
+	mux.HandleFunc("POST "+base+"/bulk", res.bulk)
+}
+
+// reassignColumns lists the foreign keys of the table, which the list page
+// offers as bulk reassign targets.
+func (res *Resource[T]) reassignColumns() []reassignColumn {
+	t := models.TableByName(res.Table)
+	if t == nil {
+		return nil
+	}
+	var out []reassignColumn
+	for _, ref := range t.References {
+		label := ref.Column
+		for _, c := range t.Columns {
+			if c.Name == ref.Column {
+				label = c.Label
+			}
+		}
+		out = append(out, reassignColumn{Column: ref.Column, Label: label, Table: ref.Table})
+	}
+	return out
+}
+
+// selectedKeys decodes the row checkboxes of a list page. Each value is
+// the row key as a query string, e.g. "email=a%40b.org&code=C01".
+func (res *Resource[T]) selectedKeys(values []string) ([][]string, error) {
+	keys := make([][]string, 0, len(values))
+	for _, v := range values {
+		q, err := url.ParseQuery(v)
+		if err != nil {
+			return nil, badRequest("Invalid row %q", v)
+		}
+		key := make([]string, len(res.Keys))
+		for i, name := range res.Keys {
+			if key[i] = q.Get(name); key[i] == "" {
+				return nil, badRequest("Invalid row %q", v)
+			}
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+func (res *Resource[T]) bulk(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Error parsing form: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	keys, err := res.selectedKeys(r.PostForm["row"])
+	if err != nil {
+		res.fail(w, err, "")
+		return
+	}
+	if len(keys) == 0 {
+		http.Error(w, "No rows selected", http.StatusBadRequest)
+		return
+	}
+
+	var result *models.BulkResult
+	action := r.PostForm.Get("action")
+	switch action {
+	case "delete":
+		result, err = models.BulkDelete(r.Context(), res.DB, res.Table, keys)
+	case "reassign":
+		column, value := r.PostForm.Get("column"), strings.TrimSpace(r.PostForm.Get("value"))
+		if value == "" {
+			http.Error(w, "Missing value to reassign to", http.StatusBadRequest)
+			return
+		}
+		result, err = models.BulkReassign(r.Context(), res.DB, res.Table, column, value, keys)
+	case "export":
+		var rows [][]string
+		result, rows, err = models.ExportRows(r.Context(), res.DB, res.Table, keys)
+		if err == nil && result.Committed {
+			res.writeCSV(w, r, rows)
+			return
+		}
+	default:
+		http.Error(w, "Unknown bulk action "+action, http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		res.fail(w, err, action+" "+res.nounPlural())
+		return
+	}
+
+	rows := make([]bulkRow, len(result.Rows))
+	for i, o := range result.Rows {
+		rows[i] = bulkRow{RowOutcome: o, Label: strings.Join(o.Key, " / ")}
+		if action != "delete" || !result.Committed {
+			rows[i].URL = res.itemPath(o.Key)
+		}
+	}
+
+	tmpl, err := res.Templates.Template("bulk/result")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	data := map[string]any{
+		"Title":     "Bulk " + strings.ToUpper(action[:1]) + action[1:] + " " + res.LabelPlural,
+		"Back":      "/" + res.Path,
+		"Committed": result.Committed,
+		"Failed":    result.Failed(),
+		"Rows":      rows,
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if !result.Committed {
+		w.WriteHeader(http.StatusConflict)
+	}
+	if err := tmpl.Execute(w, data); err != nil {
+		http.Error(w, "Error rendering template: "+err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// writeCSV sends exported rows as a download, with the column names as the
+// header line. Personal data is masked unless the request reveals it.
+func (res *Resource[T]) writeCSV(w http.ResponseWriter, r *http.Request, rows [][]string) {
+	t := models.TableByName(res.Table)
+	header := make([]string, len(t.Columns))
+	for i, c := range t.Columns {
+		header[i] = c.Name
+		if c.Personal() && !revealing(r.Context()) {
+			for _, row := range rows {
+				row[i] = models.Mask(c.Mask, row[i])
+			}
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+res.Path+`.csv"`)
+	cw := csv.NewWriter(w)
+	cw.Write(header)
+	cw.WriteAll(rows)
+}
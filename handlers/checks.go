@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"myapp/models"
+	"unicode/utf8"
+)
+
+// Validation hooks referenced by the check= annotations in db/schema.sql.
+// The generated handlers call them after their own required-field checks.
+
+func checkUser(u *models.User) error {
+	if u.Salary.Valid && u.Salary.Int64 < 0 {
+		return badRequest("Salary cannot be negative")
+	}
+	// The column is TEXT, to hold the encrypted value.
+	if utf8.RuneCountInString(u.Phone.String) > 20 {
+		return badRequest("Phone cannot be longer than 20 characters")
+	}
+	return nil
+}
+
+func checkCountry(c *models.Country) error {
+	if c.Population < 0 {
+		return badRequest("Population cannot be negative")
+	}
+	return nil
+}
+
+func checkRecord(rec *models.Record) error {
+	if rec.TotalDeaths < 0 || rec.TotalPatients < 0 {
+		return badRequest("Totals cannot be negative")
+	}
+	return nil
+}
+
+// Verify hooks of the tables whose foreign keys are all the hooks check:
+// the referenced rows must exist and not be in the trash.
+
+func verifyPatient(ctx context.Context, db *sql.DB, p *models.Patient) error {
+	return models.RequireParents(ctx, db, "Patients", map[string]any{"email": p.Email})
+}
+
+func verifyDoctor(ctx context.Context, db *sql.DB, d *models.Doctor) error {
+	return models.RequireParents(ctx, db, "Doctor", map[string]any{"email": d.Email})
+}
+
+func verifyPublicServant(ctx context.Context, db *sql.DB, ps *models.PublicServant) error {
+	return models.RequireParents(ctx, db, "PublicServant", map[string]any{"email": ps.Email})
+}
+
+func verifySpecialize(ctx context.Context, db *sql.DB, sp *models.Specialize) error {
+	return models.RequireParents(ctx, db, "Specialize", map[string]any{"id": sp.ID, "email": sp.Email})
+}
+
+func verifyPatientDisease(ctx context.Context, db *sql.DB, pd *models.PatientDisease) error {
+	return models.RequireParents(ctx, db, "PatientDisease", map[string]any{"email": pd.Email, "disease_code": pd.DiseaseCode})
+}
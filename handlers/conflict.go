@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// conflictField is one form field on the conflict page.
+type conflictField struct {
+	Name    string
+	Label   string
+	Yours   string
+	Current string
+	Differs bool
+	Fixed   bool // key column, shown but not submitted
+}
+
+// conflict answers an edit that lost the race against another update. It
+// shows the submitted values next to the stored ones and a form, prefilled
+// with the submitted values, that retries against the current version.
+func (res *Resource[T]) conflict(w http.ResponseWriter, r *http.Request, k Key, submitted url.Values) {
+	current, err := res.Get(r.Context(), res.DB, k)
+	if err != nil {
+		res.fail(w, err, "fetching "+res.noun())
+		return
+	}
+	if current == nil {
+		notFound(w, r, res.Templates)
+		return
+	}
+
+	stored := formValues(current)
+	bools := boolFields(current)
+	form := newForm(submitted, res.Fields, false)
+	var fields []conflictField
+	personal := res.personalFields(r.Context())
+	for _, f := range res.Fields {
+		if personal[f.Name] {
+			continue
+		}
+		cf := conflictField{
+			Name:    f.Name,
+			Label:   f.Label,
+			Current: stored[f.Name],
+			Fixed:   f.Fixed,
+		}
+		switch {
+		case f.Fixed:
+			cf.Yours = cf.Current
+		case bools[f.Name]:
+			// A checkbox submits "on", its value or nothing; compare
+			// what it means.
+			cf.Yours = strconv.FormatBool(form.Bool(f.Name))
+		default:
+			cf.Yours = submitted.Get(f.Name)
+		}
+		cf.Differs = cf.Yours != cf.Current
+		fields = append(fields, cf)
+	}
+
+	tmpl, err := res.Templates.Template("errors/conflict")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	data := map[string]any{
+		"Title":   "Edit Conflict",
+		"Label":   res.Label,
+		"Action":  r.URL.RequestURI(),
+		"Back":    "/" + res.Path,
+		"Version": stored["version"],
+		"Fields":  fields,
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusConflict)
+	if err := tmpl.Execute(w, data); err != nil {
+		http.Error(w, "Error rendering template: "+err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// formValues formats the fields of a model struct the way the forms submit
+// them, keyed by JSON name.
+func formValues(item any) map[string]string {
+	v := reflect.Indirect(reflect.ValueOf(item))
+	t := v.Type()
+	out := make(map[string]string, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if name == "" || name == "-" {
+			continue
+		}
+		out[name] = formValue(v.Field(i).Interface())
+	}
+	return out
+}
+
+// boolFields returns the JSON names of the bool fields of a model struct.
+func boolFields(item any) map[string]bool {
+	t := reflect.Indirect(reflect.ValueOf(item)).Type()
+	out := make(map[string]bool)
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if name != "" && name != "-" && t.Field(i).Type.Kind() == reflect.Bool {
+			out[name] = true
+		}
+	}
+	return out
+}
+
+func formValue(x any) string {
+	switch x := x.(type) {
+	case string:
+		return x
+	case int:
+		return strconv.Itoa(x)
+	case int64:
+		return strconv.FormatInt(x, 10)
+	case bool:
+		return strconv.FormatBool(x)
+	case time.Time:
+		return x.Format("2006-01-02")
+	case sql.NullString:
+		if x.Valid {
+			return x.String
+		}
+	case sql.NullInt64:
+		if x.Valid {
+			return strconv.FormatInt(x.Int64, 10)
+		}
+	case sql.NullTime:
+		if x.Valid {
+			return x.Time.Format("2006-01-02")
+		}
+	}
+	return ""
+}
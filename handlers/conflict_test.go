@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"myapp/models"
+	"net/http"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestConflictCheckbox(t *testing.T) {
+	stored := models.Disease{DiseaseCode: "FLU-X", Pathogen: "virus", Description: "Local flu", ID: 1, Version: 2}
+	res := NewDiseaseHandler(nil, templates(t))
+	res.Get = func(context.Context, *sql.DB, Key) (*models.Disease, error) {
+		d := stored
+		return &d, nil
+	}
+	res.Update = func(context.Context, *sql.DB, Key, *models.Disease) error { return models.ErrConflict }
+	res.Verify = nil
+
+	// The rows the conflict page marks as differing, by label.
+	differing := regexp.MustCompile(`<tr class="table-warning">\s*<td>([^<]*)</td>`)
+	for _, tc := range []struct {
+		name   string
+		custom bool   // stored
+		form   string // submitted
+		want   []string
+	}{
+		{"checked, stored true", true, "custom=on", nil},
+		{"checked with its value, stored true", true, "custom=true", nil},
+		{"unchecked, stored false", false, "", nil},
+		{"checked, stored false", false, "custom=on", []string{"Custom Code"}},
+		{"unchecked, stored true", true, "", []string{"Custom Code"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			stored.Custom = tc.custom
+			form := "version=1&pathogen=virus&description=Local+flu&id=1&" + tc.form
+			w := serve(res, "POST", "/diseases/FLU-X/edit", strings.NewReader(form))
+			if w.Code != http.StatusConflict {
+				t.Fatalf("status %d: %s", w.Code, w.Body)
+			}
+			var got []string
+			for _, m := range differing.FindAllStringSubmatch(w.Body.String(), -1) {
+				got = append(got, m[1])
+			}
+			if strings.Join(got, ",") != strings.Join(tc.want, ",") {
+				t.Errorf("differing fields %q, want %q", got, tc.want)
+			}
+			if !strings.Contains(w.Body.String(), `name="version" value="2"`) {
+				t.Error("the form does not retry against the stored version")
+			}
+		})
+	}
+}
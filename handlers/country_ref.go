@@ -0,0 +1,165 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"myapp/iso3166"
+	"myapp/models"
+	"net/http"
+	"strings"
+)
+
+// CountryMergeHandler combines duplicate countries, such as "USA" and
+// "United States", into one.
+type CountryMergeHandler struct {
+	DB        *sql.DB
+	Templates TemplateSet
+}
+
+func NewCountryMergeHandler(db *sql.DB, templates TemplateSet) *CountryMergeHandler {
+	return &CountryMergeHandler{
+		DB:        db,
+		Templates: templates,
+	}
+}
+
+// RegisterRoutes mounts the merge tool at /countries/merge.
+func (h *CountryMergeHandler) RegisterRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("GET /countries/merge", h.Form)
+	mux.HandleFunc("POST /countries/merge", h.Merge)
+}
+
+func (h *CountryMergeHandler) Form(w http.ResponseWriter, r *http.Request) {
+	h.render(w, r, http.StatusOK, nil, "")
+}
+
+func (h *CountryMergeHandler) Merge(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Error parsing form: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	into, from := r.PostForm.Get("into"), r.PostForm["from"]
+	if into == "" || len(from) == 0 {
+		h.render(w, r, http.StatusBadRequest, nil, "Choose the country to keep and at least one country to merge into it.")
+		return
+	}
+
+	result, err := models.MergeCountries(r.Context(), h.DB, into, from)
+	switch {
+	case errors.Is(err, models.ErrMergeTarget), errors.Is(err, models.ErrMissingParent):
+		h.render(w, r, http.StatusBadRequest, nil, err.Error())
+		return
+	case err != nil:
+		http.Error(w, "Error merging countries: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	h.render(w, r, http.StatusOK, map[string]any{
+		"Into":   into,
+		"From":   from,
+		"Result": result,
+	}, "")
+}
+
+func (h *CountryMergeHandler) render(w http.ResponseWriter, r *http.Request, status int, merged map[string]any, problem string) {
+	countries, err := models.GetAllCountries(r.Context(), h.DB)
+	if err != nil {
+		http.Error(w, "Error fetching countries: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	duplicates, err := models.DuplicateCountries(r.Context(), h.DB)
+	if err != nil {
+		http.Error(w, "Error finding duplicate countries: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	tmpl, err := h.Templates.Template("countries/merge")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	data := map[string]any{
+		"Title":      "Merge Countries",
+		"Countries":  countries,
+		"Duplicates": duplicates,
+		"Merged":     merged,
+		"Problem":    problem,
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	if err := tmpl.Execute(w, data); err != nil {
+		http.Error(w, "Error rendering template: "+err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// verifyCountry fills in the ISO 3166 codes of a country, spells a new
+// country the way the reference list does ("USA" becomes "United States")
+// and rejects a country that already exists under another name.
+func verifyCountry(ctx context.Context, db *sql.DB, c *models.Country) error {
+	if err := models.CountryCodes(c); err != nil {
+		return badRequest("%s", err.Error())
+	}
+
+	existing, err := models.ResolveCountry(ctx, db, c.CName)
+	if err != nil {
+		return err
+	}
+	if !strings.EqualFold(existing, c.CName) {
+		return badRequest("%s is already recorded as %s", c.CName, existing)
+	}
+	if !c.ISOAlpha2.Valid {
+		return nil
+	}
+
+	other, err := models.CountryByISO(ctx, db, c.ISOAlpha2.String)
+	if err != nil {
+		return err
+	}
+	if other != "" && other != c.CName {
+		return badRequest("%s is already recorded as %s", c.ISOAlpha2.String, other)
+	}
+	if iso, ok := iso3166.Lookup(c.CName); other == "" && ok && iso.Alpha2 == c.ISOAlpha2.String {
+		c.CName = iso.Name
+	}
+	return nil
+}
+
+// The verify hooks of the tables referencing Country map the country name
+// to an existing country, so "USA" is stored as "United States", and
+// refuse the row unless that country and its other parents are live.
+
+func verifyUser(ctx context.Context, db *sql.DB, u *models.User) error {
+	if err := resolveCountry(ctx, db, &u.CName); err != nil {
+		return err
+	}
+	return models.RequireParents(ctx, db, "Users", map[string]any{"cname": u.CName})
+}
+
+func verifyDiscover(ctx context.Context, db *sql.DB, d *models.Discover) error {
+	if err := resolveCountry(ctx, db, &d.CName); err != nil {
+		return err
+	}
+	return models.RequireParents(ctx, db, "Discover", map[string]any{"cname": d.CName, "disease_code": d.DiseaseCode})
+}
+
+func verifyRecord(ctx context.Context, db *sql.DB, rec *models.Record) error {
+	if err := resolveCountry(ctx, db, &rec.CName); err != nil {
+		return err
+	}
+	return models.RequireParents(ctx, db, "Record", map[string]any{"email": rec.Email, "cname": rec.CName, "disease_code": rec.DiseaseCode})
+}
+
+// resolveCountry maps *cname to the name of a live country it refers to,
+// leaving it unchanged if there is none.
+func resolveCountry(ctx context.Context, db *sql.DB, cname *string) error {
+	name, err := models.ResolveCountry(ctx, db, *cname)
+	if err != nil {
+		return err
+	}
+	*cname = name
+	return nil
+}
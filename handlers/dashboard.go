@@ -1,31 +1,48 @@
 package handlers
 
 import (
-    "html/template"
+    "database/sql"
+    "myapp/models"
     "net/http"
 )
 
 type DashboardHandler struct {
-    Templates map[string]*template.Template
+    DB        *sql.DB
+    Templates TemplateSet
 }
 
-func NewDashboardHandler(templates map[string]*template.Template) *DashboardHandler {
+func NewDashboardHandler(db *sql.DB, templates TemplateSet) *DashboardHandler {
     return &DashboardHandler{
+        DB:        db,
         Templates: templates,
     }
 }
 
+// RegisterRoutes mounts the dashboard on the site root.
+func (h *DashboardHandler) RegisterRoutes(mux *http.ServeMux) {
+    mux.HandleFunc("GET /{$}", h.Dashboard)
+}
+
+// Dashboard shows the outbreak alerts nobody has resolved yet.
 func (h *DashboardHandler) Dashboard(w http.ResponseWriter, r *http.Request) {
-    tmpl, ok := h.Templates["dashboard"]
-    if !ok {
-        http.Error(w, "Template not found", http.StatusInternalServerError)
+    alerts, err := models.GetUnresolvedAlerts(r.Context(), h.DB)
+    if err != nil {
+        http.Error(w, "Error fetching alerts: "+err.Error(), http.StatusInternalServerError)
+        return
+    }
+
+    tmpl, err := h.Templates.Template("dashboard")
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusInternalServerError)
         return
     }
 
     data := struct {
-        Title string
+        Title  string
+        Alerts []models.Alert
     }{
-        Title: "Dashboard",
+        Title:  "Dashboard",
+        Alerts: alerts,
     }
 
     if err := tmpl.Execute(w, data); err != nil {
@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"myapp/models"
+	"net/http"
+	"strconv"
+)
+
+// EmailHandler shows the email outbox. Sending is done by package mail.
+type EmailHandler struct {
+	DB        *sql.DB
+	Templates TemplateSet
+}
+
+func NewEmailHandler(db *sql.DB, templates TemplateSet) *EmailHandler {
+	return &EmailHandler{
+		DB:        db,
+		Templates: templates,
+	}
+}
+
+// RegisterRoutes mounts the outbox under /emails.
+func (h *EmailHandler) RegisterRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("GET /emails", h.List)
+	mux.HandleFunc("POST /emails/{id}/retry", h.Retry)
+}
+
+// List shows the emails waiting to be sent and the last 50 sent.
+func (h *EmailHandler) List(w http.ResponseWriter, r *http.Request) {
+	emails, err := models.GetOutboxEmails(r.Context(), h.DB, 50)
+	if err != nil {
+		http.Error(w, "Error fetching emails: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	tmpl, err := h.Templates.Template("emails/list")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	data := map[string]any{
+		"Title":  "Emails",
+		"Emails": emails,
+	}
+	if err := tmpl.Execute(w, data); err != nil {
+		http.Error(w, "Error rendering template: "+err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// Retry queues an email that was given up on again.
+func (h *EmailHandler) Retry(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid email ID", http.StatusBadRequest)
+		return
+	}
+
+	err = models.RetryEmail(r.Context(), h.DB, id)
+	switch {
+	case errors.Is(err, models.ErrNoEmail):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case err != nil:
+		http.Error(w, "Error retrying email: "+err.Error(), http.StatusInternalServerError)
+	default:
+		http.Redirect(w, r, "/emails", http.StatusSeeOther)
+	}
+}
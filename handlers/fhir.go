@@ -0,0 +1,291 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"myapp/fhir"
+	"myapp/models"
+	"net/http"
+	"time"
+)
+
+// FHIRHandler serves people, diagnoses and reports as FHIR R4 resources
+// and imports them from transaction bundles; see package fhir for the
+// mapping.
+type FHIRHandler struct {
+	DB *sql.DB
+}
+
+func NewFHIRHandler(db *sql.DB) *FHIRHandler {
+	return &FHIRHandler{DB: db}
+}
+
+// maxBundleSize bounds the body of an import request.
+const maxBundleSize = 32 << 20
+
+// RegisterRoutes mounts the FHIR base under /fhir.
+func (h *FHIRHandler) RegisterRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("GET /fhir", h.Export)
+	mux.HandleFunc("POST /fhir", h.Import)
+	mux.HandleFunc("GET /fhir/{type}", h.Search)
+	mux.HandleFunc("GET /fhir/{type}/{id}", h.Read)
+}
+
+// Export answers with a collection bundle of every resource.
+func (h *FHIRHandler) Export(w http.ResponseWriter, r *http.Request) {
+	e, err := h.export(r.Context())
+	if err != nil {
+		writeOutcome(w, http.StatusInternalServerError, "exception", "Error exporting resources: "+err.Error())
+		return
+	}
+	h.writeBundle(w, r, "collection", e.All())
+}
+
+// Search lists every resource of one type as a searchset bundle.
+func (h *FHIRHandler) Search(w http.ResponseWriter, r *http.Request) {
+	e, err := h.export(r.Context())
+	if err != nil {
+		writeOutcome(w, http.StatusInternalServerError, "exception", "Error exporting resources: "+err.Error())
+		return
+	}
+	resources, ok := e.Resources(r.PathValue("type"))
+	if !ok {
+		writeOutcome(w, http.StatusNotFound, "not-supported", "Unknown resource type "+r.PathValue("type"))
+		return
+	}
+	h.writeBundle(w, r, "searchset", resources)
+}
+
+func (h *FHIRHandler) Read(w http.ResponseWriter, r *http.Request) {
+	e, err := h.export(r.Context())
+	if err != nil {
+		writeOutcome(w, http.StatusInternalServerError, "exception", "Error exporting resources: "+err.Error())
+		return
+	}
+	resources, ok := e.Resources(r.PathValue("type"))
+	if !ok {
+		writeOutcome(w, http.StatusNotFound, "not-supported", "Unknown resource type "+r.PathValue("type"))
+		return
+	}
+	ref := r.PathValue("type") + "/" + r.PathValue("id")
+	for _, res := range resources {
+		if res.Ref() == ref {
+			writeFHIR(w, http.StatusOK, res)
+			return
+		}
+	}
+	writeOutcome(w, http.StatusNotFound, "not-found", ref+" not found")
+}
+
+// Import stores the resources of a transaction or collection bundle, all
+// of them or, if any is invalid, none.
+func (h *FHIRHandler) Import(w http.ResponseWriter, r *http.Request) {
+	var b fhir.Bundle
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBundleSize)).Decode(&b); err != nil {
+		writeOutcome(w, http.StatusBadRequest, "structure", "Invalid JSON body: "+err.Error())
+		return
+	}
+
+	imp, issues := fhir.Read(&b)
+	if len(issues) > 0 {
+		writeFHIR(w, http.StatusBadRequest, fhir.Outcome(issues...))
+		return
+	}
+	issues, err := h.resolve(r.Context(), imp)
+	if err != nil {
+		writeOutcome(w, http.StatusInternalServerError, "exception", "Error checking bundle: "+err.Error())
+		return
+	}
+	if len(issues) > 0 {
+		writeFHIR(w, http.StatusUnprocessableEntity, fhir.Outcome(issues...))
+		return
+	}
+
+	err = models.UpsertExchange(r.Context(), h.DB, &imp.Exchange)
+	var xe *models.ExchangeError
+	if errors.As(err, &xe) && errors.Is(xe.Err, models.ErrMissingParent) {
+		writeFHIR(w, http.StatusUnprocessableEntity, fhir.Outcome(fhir.Invalid(imp.Entry(xe.Kind, xe.Index), "", "Cannot store %s: %v", xe.Kind, xe.Err)))
+		return
+	}
+	if errors.As(err, &xe) {
+		issue := fhir.Invalid(imp.Entry(xe.Kind, xe.Index), "", "Error storing %s: %v", xe.Kind, xe.Err)
+		issue.Code = "exception"
+		writeFHIR(w, http.StatusInternalServerError, fhir.Outcome(issue))
+		return
+	}
+	if err != nil {
+		writeOutcome(w, http.StatusInternalServerError, "exception", "Error storing bundle: "+err.Error())
+		return
+	}
+
+	resp := &fhir.Bundle{ResourceType: "Bundle", Type: b.Type + "-response", Timestamp: time.Now().UTC().Format(time.RFC3339)}
+	if b.Type == "collection" {
+		resp.Type = "transaction-response"
+	}
+	for _, loc := range imp.Locations() {
+		resp.Entry = append(resp.Entry, fhir.Entry{Response: &fhir.EntryResponse{Status: "200 OK", Location: loc}})
+	}
+	writeFHIR(w, http.StatusOK, resp)
+}
+
+// resolve maps the country names and disease codes of an import to
+// existing rows, like the forms do, and checks that every referenced
+// patient, public servant and disease type exists.
+func (h *FHIRHandler) resolve(ctx context.Context, imp *fhir.Import) ([]fhir.Issue, error) {
+	diseases, err := models.GetAllDiseases(ctx, h.DB)
+	if err != nil {
+		return nil, err
+	}
+	codes := make(map[string]string)
+	for _, d := range diseases {
+		codes[models.ICDKey(d.DiseaseCode)] = d.DiseaseCode
+	}
+	types, err := models.GetAllDiseaseTypes(ctx, h.DB)
+	if err != nil {
+		return nil, err
+	}
+	typeIDs := make(map[int]bool)
+	for _, t := range types {
+		typeIDs[t.ID] = true
+	}
+	patients, err := models.GetAllPatients(ctx, h.DB)
+	if err != nil {
+		return nil, err
+	}
+	isPatient := make(map[string]bool)
+	for _, p := range patients {
+		isPatient[p.Email] = true
+	}
+	servants, err := models.GetAllPublicServants(ctx, h.DB)
+	if err != nil {
+		return nil, err
+	}
+	isServant := make(map[string]bool)
+	for _, s := range servants {
+		isServant[s.Email] = true
+	}
+
+	country := func(name *string) (bool, error) {
+		if err := resolveCountry(ctx, h.DB, name); err != nil {
+			return false, err
+		}
+		c, err := models.GetCountry(ctx, h.DB, *name)
+		return c != nil, err
+	}
+
+	var issues []fhir.Issue
+	x := &imp.Exchange
+	for i := range x.People {
+		p := &x.People[i]
+		entry := imp.PersonEntries[i]
+		sent := p.User.CName
+		ok, err := country(&p.User.CName)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			issues = append(issues, fhir.Invalid(entry, "address[0].country", "unknown country %q", sent))
+		}
+		for _, id := range p.Specializations {
+			if !typeIDs[id] {
+				issues = append(issues, fhir.Invalid(entry, "qualification", "unknown disease type %d", id))
+			}
+		}
+		if p.Patient {
+			isPatient[p.User.Email] = true
+		}
+	}
+	disease := func(entry int, path string, code *string) {
+		if canonical, ok := codes[models.ICDKey(*code)]; ok {
+			*code = canonical
+			return
+		}
+		issues = append(issues, fhir.Invalid(entry, path, "unknown disease %q", *code))
+	}
+	for i := range x.PatientDiseases {
+		pd := &x.PatientDiseases[i]
+		entry := imp.PatientDiseaseEntries[i]
+		if !isPatient[pd.Email] {
+			issues = append(issues, fhir.Invalid(entry, "subject", "%s is not a patient", pd.Email))
+		}
+		disease(entry, "code", &pd.DiseaseCode)
+	}
+	for i := range x.Records {
+		rec := &x.Records[i]
+		entry := imp.RecordEntries[i]
+		if !isServant[rec.Email] {
+			issues = append(issues, fhir.Invalid(entry, "reporter", "%s is not a public servant", rec.Email))
+		}
+		sent := rec.CName
+		ok, err := country(&rec.CName)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			issues = append(issues, fhir.Invalid(entry, "subject", "unknown country %q", sent))
+		}
+		disease(entry, "group[0].code", &rec.DiseaseCode)
+	}
+	return issues, nil
+}
+
+func (h *FHIRHandler) export(ctx context.Context) (*fhir.Export, error) {
+	src := &fhir.Source{Now: time.Now()}
+	var err error
+	load := func(what string, fn func() error) {
+		if err == nil {
+			if err = fn(); err != nil {
+				err = fmt.Errorf("%s: %w", what, err)
+			}
+		}
+	}
+	load("users", func() (err error) { src.Users, err = models.GetAllUsers(ctx, h.DB); return })
+	load("countries", func() (err error) { src.Countries, err = models.GetAllCountries(ctx, h.DB); return })
+	load("patients", func() (err error) { src.Patients, err = models.GetAllPatients(ctx, h.DB); return })
+	load("doctors", func() (err error) { src.Doctors, err = models.GetAllDoctors(ctx, h.DB); return })
+	load("specializations", func() (err error) { src.Specializations, err = models.GetAllSpecializes(ctx, h.DB); return })
+	load("disease types", func() (err error) { src.DiseaseTypes, err = models.GetAllDiseaseTypes(ctx, h.DB); return })
+	load("diseases", func() (err error) { src.Diseases, err = models.GetAllDiseases(ctx, h.DB); return })
+	load("disease systems", func() (err error) { src.DiseaseSystems, err = models.DiseaseSystems(ctx, h.DB); return })
+	load("patient diseases", func() (err error) { src.PatientDiseases, err = models.GetAllPatientDiseases(ctx, h.DB); return })
+	load("records", func() (err error) { src.Records, err = models.GetAllRecords(ctx, h.DB); return })
+	load("discoveries", func() (err error) { src.Discoveries, err = models.GetAllDiscovers(ctx, h.DB); return })
+	if err != nil {
+		return nil, err
+	}
+	// Personal data is left out unless the request reveals it.
+	if !revealing(ctx) {
+		for i := range src.Users {
+			src.Users[i].Phone = sql.NullString{}
+		}
+		src.PatientDiseases = nil
+	}
+	return fhir.NewExport(src), nil
+}
+
+func (h *FHIRHandler) writeBundle(w http.ResponseWriter, r *http.Request, typ string, resources []fhir.Resource) {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	b, err := fhir.NewBundle(typ, scheme+"://"+r.Host+"/fhir", resources)
+	if err != nil {
+		writeOutcome(w, http.StatusInternalServerError, "exception", "Error encoding bundle: "+err.Error())
+		return
+	}
+	b.Timestamp = time.Now().UTC().Format(time.RFC3339)
+	writeFHIR(w, http.StatusOK, b)
+}
+
+func writeFHIR(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", fhir.ContentType)
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeOutcome(w http.ResponseWriter, code int, issueCode, msg string) {
+	writeFHIR(w, code, fhir.Outcome(fhir.Issue{Severity: "error", Code: issueCode, Diagnostics: msg}))
+}
@@ -0,0 +1,153 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Field declares a form input of a resource.
+type Field struct {
+	Name     string // form input name, e.g. "disease_code"
+	Label    string // shown in validation messages, e.g. "Disease Code"
+	Required bool
+	Fixed    bool // key set on create only, not editable afterwards
+}
+
+// Form reads typed values out of a submitted form, collecting a message for
+// every missing required field or unparsable value.
+type Form struct {
+	Creating bool
+
+	values url.Values
+	fields map[string]Field
+	errs   []string
+}
+
+func newForm(values url.Values, fields []Field, creating bool) *Form {
+	f := &Form{
+		Creating: creating,
+		values:   values,
+		fields:   make(map[string]Field, len(fields)),
+	}
+	for _, field := range fields {
+		f.fields[field.Name] = field
+	}
+	return f
+}
+
+// raw returns the trimmed value of name, recording an error if the field is
+// required and empty.
+func (f *Form) raw(name string) string {
+	v := strings.TrimSpace(f.values.Get(name))
+	if v == "" && f.fields[name].Required {
+		f.errs = append(f.errs, f.label(name)+" is required")
+	}
+	return v
+}
+
+func (f *Form) label(name string) string {
+	if field, ok := f.fields[name]; ok && field.Label != "" {
+		return field.Label
+	}
+	return name
+}
+
+func (f *Form) invalid(name string) {
+	f.errs = append(f.errs, "Invalid "+strings.ToLower(f.label(name)))
+}
+
+// Has reports whether the form has a field called name at all, even
+// empty. Pages that hide personal data leave its fields out, and binding
+// then keeps the stored values.
+func (f *Form) Has(name string) bool {
+	_, ok := f.values[name]
+	return ok
+}
+
+func (f *Form) String(name string) string {
+	return f.raw(name)
+}
+
+func (f *Form) Int(name string) int {
+	v := f.raw(name)
+	if v == "" {
+		return 0
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		f.invalid(name)
+	}
+	return n
+}
+
+func (f *Form) Int64(name string) int64 {
+	v := f.raw(name)
+	if v == "" {
+		return 0
+	}
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		f.invalid(name)
+	}
+	return n
+}
+
+func (f *Form) NullInt64(name string) sql.NullInt64 {
+	v := f.raw(name)
+	if v == "" {
+		return sql.NullInt64{}
+	}
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		f.invalid(name)
+		return sql.NullInt64{}
+	}
+	return sql.NullInt64{Int64: n, Valid: true}
+}
+
+func (f *Form) NullString(name string) sql.NullString {
+	v := f.raw(name)
+	if v == "" {
+		return sql.NullString{}
+	}
+	return sql.NullString{String: v, Valid: true}
+}
+
+// Bool reads a checkbox, which browsers leave out of the form when it is
+// not checked, so it is never reported as missing.
+func (f *Form) Bool(name string) bool {
+	v := strings.TrimSpace(f.values.Get(name))
+	if v == "" {
+		return false
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil && v != "on" {
+		f.invalid(name)
+	}
+	return b || v == "on"
+}
+
+// Date parses a YYYY-MM-DD value as produced by <input type="date">.
+func (f *Form) Date(name string) time.Time {
+	v := f.raw(name)
+	if v == "" {
+		return time.Time{}
+	}
+	t, err := time.Parse("2006-01-02", v)
+	if err != nil {
+		f.errs = append(f.errs, "Invalid date format for "+strings.ToLower(f.label(name))+". Use YYYY-MM-DD.")
+	}
+	return t
+}
+
+// Err returns every collected problem as a single bad-request error.
+func (f *Form) Err() error {
+	if len(f.errs) == 0 {
+		return nil
+	}
+	return &httpError{Code: http.StatusBadRequest, Msg: strings.Join(f.errs, "\n")}
+}
@@ -0,0 +1,173 @@
+package handlers
+
+import (
+	"errors"
+	"myapp/models"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// historyVersion is a models.Version prepared for the history page.
+type historyVersion struct {
+	models.Version
+	Current bool
+	Fields  []models.Change // every column, shown for the first version
+}
+
+func (res *Resource[T]) registerHistoryRoutes(mux *http.ServeMux, item, apiItem string) {
+	mux.HandleFunc("GET "+item+"/history", res.history)
+	mux.HandleFunc("POST "+item+"/history/{version}/revert", res.revert)
+	mux.HandleFunc("GET "+apiItem+"/history", res.apiHistory)
+}
+
+// keyValues returns the row key from the path in column order.
+func (res *Resource[T]) keyValues(r *http.Request) ([]string, error) {
+	k, err := res.key(r)
+	if err != nil {
+		return nil, err
+	}
+	values := make([]string, len(res.Keys))
+	for i, name := range res.Keys {
+		values[i] = k[name]
+	}
+	return values, nil
+}
+
+func (res *Resource[T]) itemPath(key []string) string {
+	parts := []string{"", res.Path}
+	for _, v := range key {
+		parts = append(parts, url.PathEscape(v))
+	}
+	return strings.Join(parts, "/")
+}
+
+func (res *Resource[T]) history(w http.ResponseWriter, r *http.Request) {
+	key, err := res.keyValues(r)
+	if err != nil {
+		res.fail(w, err, "fetching history")
+		return
+	}
+
+	versions, err := models.GetHistory(r.Context(), res.DB, res.Table, key)
+	if err != nil {
+		res.fail(w, err, "fetching history")
+		return
+	}
+	if len(versions) == 0 {
+		notFound(w, r, res.Templates)
+		return
+	}
+	maskHistory(r.Context(), res.Table, versions)
+
+	table := models.TableByName(res.Table)
+	rows := make([]historyVersion, len(versions))
+	for i, v := range versions {
+		rows[i] = historyVersion{Version: v, Current: v.ValidTo == nil}
+		if i == len(versions)-1 {
+			for _, c := range table.Columns {
+				rows[i].Fields = append(rows[i].Fields, models.Change{Column: c.Name, Label: c.Label, New: v.Data[c.Name]})
+			}
+		}
+	}
+
+	canRevert := false
+	for _, c := range table.Columns {
+		if !contains(table.Keys, c.Name) {
+			canRevert = true
+		}
+	}
+
+	tmpl, err := res.Templates.Template("history/view")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	data := map[string]any{
+		"Title":     res.Label + " History: " + strings.Join(key, " / "),
+		"Label":     res.Label,
+		"ItemURL":   res.itemPath(key),
+		"Versions":  rows,
+		"CanRevert": canRevert,
+	}
+	if err := tmpl.Execute(w, data); err != nil {
+		http.Error(w, "Error rendering template: "+err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func (res *Resource[T]) revert(w http.ResponseWriter, r *http.Request) {
+	key, err := res.keyValues(r)
+	if err != nil {
+		res.fail(w, err, "reverting "+res.noun())
+		return
+	}
+	version, err := strconv.ParseInt(r.PathValue("version"), 10, 64)
+	if err != nil {
+		res.fail(w, badRequest("Invalid version"), "")
+		return
+	}
+
+	err = models.RevertToVersion(r.Context(), res.DB, res.Table, key, version)
+	if errors.Is(err, models.ErrNoVersion) {
+		http.Error(w, "Cannot revert: the version does not exist or the "+res.noun()+" is deleted", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		res.fail(w, err, "reverting "+res.noun())
+		return
+	}
+
+	http.Redirect(w, r, res.itemPath(key)+"/history", http.StatusSeeOther)
+}
+
+func (res *Resource[T]) apiHistory(w http.ResponseWriter, r *http.Request) {
+	key, err := res.keyValues(r)
+	if err != nil {
+		res.failJSON(w, err, "")
+		return
+	}
+
+	versions, err := models.GetHistory(r.Context(), res.DB, res.Table, key)
+	if err != nil {
+		res.failJSON(w, err, "fetching history")
+		return
+	}
+	if versions == nil {
+		versions = []models.Version{}
+	}
+	maskHistory(r.Context(), res.Table, versions)
+	writeJSON(w, http.StatusOK, versions)
+}
+
+// apiAsOf answers GET /api/<path>?as_of=... with the rows as they were at
+// that time. A bare date means the end of that day, UTC.
+func (res *Resource[T]) apiAsOf(w http.ResponseWriter, r *http.Request, asOf string) {
+	at, err := time.Parse(time.RFC3339, asOf)
+	if err != nil {
+		day, derr := time.Parse("2006-01-02", asOf)
+		if derr != nil {
+			res.failJSON(w, badRequest("Invalid as_of %q: use YYYY-MM-DD or RFC 3339", asOf), "")
+			return
+		}
+		at = day.Add(24*time.Hour - time.Nanosecond)
+	}
+
+	rows, err := models.GetAsOf(r.Context(), res.DB, res.Table, at)
+	if err != nil {
+		res.failJSON(w, err, "fetching "+res.nounPlural())
+		return
+	}
+	res.writeRedacted(w, r, http.StatusOK, rows)
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,359 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"myapp/hl7"
+	"myapp/models"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// HL7Handler ingests HL7 v2 ADT and ORU messages: PID becomes a user with
+// the patient role and every DG1 a patient disease. Diagnoses with an
+// unknown code are queued on /hl7/review. Messages arrive over MLLP, see
+// ServeHL7, or by HTTP upload.
+type HL7Handler struct {
+	DB        *sql.DB
+	Templates TemplateSet
+}
+
+func NewHL7Handler(db *sql.DB, templates TemplateSet) *HL7Handler {
+	return &HL7Handler{
+		DB:        db,
+		Templates: templates,
+	}
+}
+
+// hl7Events are the trigger events accepted per message type. ADT events
+// register, admit or update a patient; ORU^R01 carries results, whose
+// PID and DG1 segments are used.
+var hl7Events = map[string][]string{
+	"ADT": {"A01", "A04", "A05", "A08", "A28", "A31"},
+	"ORU": {"R01"},
+}
+
+// hl7ContentType is the media type of pipe-delimited HL7 v2.
+const hl7ContentType = "x-application/hl7-v2+er7"
+
+// RegisterRoutes mounts the upload endpoint and the review page under
+// /hl7.
+func (h *HL7Handler) RegisterRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("POST /hl7", h.Receive)
+	mux.HandleFunc("GET /hl7/review", h.Review)
+	mux.HandleFunc("POST /hl7/upload", h.Upload)
+	mux.HandleFunc("POST /hl7/review/{id}", h.Resolve)
+}
+
+// ServeHL7 processes one message received over MLLP.
+func (h *HL7Handler) ServeHL7(ctx context.Context, msg []byte) []byte {
+	return h.process(ctx, msg).Bytes()
+}
+
+// Receive processes the messages in the request body, one or several as
+// in a batch file, and answers with their acknowledgements.
+func (h *HL7Handler) Receive(w http.ResponseWriter, r *http.Request) {
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, hl7.MaxFrameSize))
+	if err != nil {
+		http.Error(w, "Error reading message: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	msgs := hl7.Split(data)
+	if len(msgs) == 0 {
+		http.Error(w, "No HL7 message in request body", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", hl7ContentType)
+	for _, msg := range msgs {
+		w.Write(h.process(r.Context(), msg).Bytes())
+	}
+}
+
+// hl7Result is one processed message on the review page.
+type hl7Result struct {
+	ControlID string
+	Code      string
+	Text      string
+	Errors    []string
+}
+
+// Upload processes an uploaded file or pasted messages and shows the
+// review page with the outcome of each.
+func (h *HL7Handler) Upload(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseMultipartForm(hl7.MaxFrameSize); err != nil && !errors.Is(err, http.ErrNotMultipart) {
+		http.Error(w, "Error parsing form: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	data := []byte(r.FormValue("message"))
+	if file, _, err := r.FormFile("file"); err == nil {
+		defer file.Close()
+		if data, err = io.ReadAll(file); err != nil {
+			http.Error(w, "Error reading file: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	var results []hl7Result
+	for _, raw := range hl7.Split(data) {
+		ack := h.process(r.Context(), raw)
+		res := hl7Result{ControlID: ack.Get("MSA-2"), Code: ack.Get("MSA-1"), Text: ack.Get("MSA-3")}
+		for _, seg := range ack.All("ERR") {
+			res.Errors = append(res.Errors, ack.Field(seg, "8"))
+		}
+		results = append(results, res)
+	}
+	if results == nil {
+		h.render(w, r, http.StatusBadRequest, nil, "No HL7 message found. Messages start with an MSH segment.")
+		return
+	}
+	h.render(w, r, http.StatusOK, results, "")
+}
+
+// Review lists the diagnoses waiting for a disease.
+func (h *HL7Handler) Review(w http.ResponseWriter, r *http.Request) {
+	h.render(w, r, http.StatusOK, nil, "")
+}
+
+// Resolve adds the chosen disease to the patient of a queued diagnosis, or
+// dismisses it when the form's action is "dismiss".
+func (h *HL7Handler) Resolve(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid review ID", http.StatusBadRequest)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Error parsing form: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	code := strings.TrimSpace(r.PostForm.Get("disease_code"))
+	if r.PostForm.Get("action") == "dismiss" {
+		code = ""
+	} else if code == "" {
+		h.render(w, r, http.StatusBadRequest, nil, "Choose the disease to record.")
+		return
+	}
+
+	err = models.ResolveDiagnosisReview(r.Context(), h.DB, id, code)
+	switch {
+	case errors.Is(err, models.ErrReviewed), errors.Is(err, models.ErrMissingParent):
+		h.render(w, r, http.StatusConflict, nil, err.Error())
+		return
+	case err != nil:
+		http.Error(w, "Error resolving diagnosis: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	back := "/hl7/review"
+	if revealing(r.Context()) {
+		back += "?reveal=1"
+	}
+	http.Redirect(w, r, back, http.StatusSeeOther)
+}
+
+func (h *HL7Handler) render(w http.ResponseWriter, r *http.Request, status int, results []hl7Result, problem string) {
+	reviews, err := models.GetDiagnosisReviews(r.Context(), h.DB)
+	if err != nil {
+		http.Error(w, "Error fetching diagnoses to review: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	diseases, err := models.GetAllDiseases(r.Context(), h.DB)
+	if err != nil {
+		http.Error(w, "Error fetching diseases: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	tmpl, err := h.Templates.Template("hl7/review")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	data := withReveal(r.Context(), map[string]any{
+		"Title":    "HL7 Diagnoses to Review",
+		"Reviews":  reviews,
+		"Diseases": diseases,
+		"Results":  results,
+		"Problem":  problem,
+	})
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	if err := tmpl.Execute(w, data); err != nil {
+		http.Error(w, "Error rendering template: "+err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// process ingests one message and returns its acknowledgement: AA when
+// stored, AR for messages this handler does not take, AE otherwise.
+func (h *HL7Handler) process(ctx context.Context, data []byte) *hl7.Message {
+	msg, err := hl7.Parse(data)
+	if err != nil {
+		return hl7.Ack(nil, hl7.Reject, err.Error())
+	}
+
+	typ, event := msg.Type()
+	events, ok := hl7Events[typ]
+	if !ok {
+		return hl7.Ack(msg, hl7.Reject, "Unsupported message type",
+			&hl7.Error{Code: hl7.ErrUnsupportedMessage, Location: "MSH-9", Text: typ + " messages are not accepted"})
+	}
+	if !contains(events, event) {
+		return hl7.Ack(msg, hl7.Reject, "Unsupported event",
+			&hl7.Error{Code: hl7.ErrUnsupportedEvent, Location: "MSH-9", Text: typ + "^" + event + " messages are not accepted"})
+	}
+
+	person, diagnoses, err := h.read(ctx, msg)
+	var he *hl7.Error
+	if errors.As(err, &he) {
+		return hl7.Ack(msg, hl7.Fail, "Message rejected", he)
+	}
+	if err != nil {
+		return hl7.Ack(msg, hl7.Fail, "Internal error", &hl7.Error{Code: hl7.ErrInternal, Text: err.Error()})
+	}
+
+	source := fmt.Sprintf("%s %s^%s %s", msg.Get("MSH-3"), typ, event, msg.ControlID())
+	result, err := models.IngestPatient(ctx, h.DB, person, diagnoses, truncate(source, 200))
+	if err != nil {
+		return hl7.Ack(msg, hl7.Fail, "Internal error", &hl7.Error{Code: hl7.ErrInternal, Text: err.Error()})
+	}
+
+	text := fmt.Sprintf("Patient %s: %d diagnoses recorded", person.User.Email, len(result.Linked))
+	if n := len(result.Queued); n > 0 {
+		text += fmt.Sprintf(", %d queued for review", n)
+	}
+	return hl7.Ack(msg, hl7.Accept, text)
+}
+
+// read maps the PID and DG1 segments of msg. Fields a message leaves out
+// keep the values of an existing user; a new user needs them all.
+func (h *HL7Handler) read(ctx context.Context, msg *hl7.Message) (*models.ExchangePerson, []models.Diagnosis, error) {
+	pid, ok := msg.Segment("PID")
+	if !ok {
+		return nil, nil, &hl7.Error{Code: hl7.ErrRequiredField, Location: "PID", Text: "PID segment is required"}
+	}
+
+	// PID-13 holds phone numbers and, in component 4, the email address.
+	// The number is in component 1 in older versions, 12 in newer ones.
+	var email, phone string
+	emails := msg.Repetitions(pid, "13.4")
+	formatted, unformatted := msg.Repetitions(pid, "13.1"), msg.Repetitions(pid, "13.12")
+	for i := range emails {
+		switch {
+		case emails[i] != "":
+			if email == "" {
+				email = emails[i]
+			}
+		case phone == "" && formatted[i] != "":
+			phone = formatted[i]
+		case phone == "":
+			phone = unformatted[i]
+		}
+	}
+	if email == "" {
+		// Some senders put the email among the patient identifiers.
+		for _, id := range msg.Repetitions(pid, "3") {
+			if strings.Contains(id, "@") {
+				email = id
+				break
+			}
+		}
+	}
+	email = strings.TrimSpace(email)
+	if email == "" {
+		return nil, nil, &hl7.Error{Code: hl7.ErrRequiredField, Location: "PID-13", Text: "the patient's email address (PID-13.4) is required"}
+	}
+
+	existing, err := models.GetUser(ctx, h.DB, email)
+	if err != nil {
+		return nil, nil, err
+	}
+	u := models.User{Email: email}
+	if existing != nil {
+		u = *existing
+	}
+
+	if family := strings.TrimSpace(msg.Field(pid, "5.1")); family != "" {
+		u.Surname = family
+	}
+	if given := strings.TrimSpace(msg.Field(pid, "5.2")); given != "" {
+		u.Name = given
+	}
+	if u.Surname == "" || u.Name == "" {
+		return nil, nil, &hl7.Error{Code: hl7.ErrRequiredField, Location: "PID-5", Text: "the patient's family and given name are required"}
+	}
+	if phone = strings.TrimSpace(phone); phone != "" {
+		u.Phone = sql.NullString{String: phone, Valid: true}
+	}
+
+	if country := strings.TrimSpace(msg.Field(pid, "11.6")); country != "" {
+		cname := country
+		if err := resolveCountry(ctx, h.DB, &cname); err != nil {
+			return nil, nil, err
+		}
+		c, err := models.GetCountry(ctx, h.DB, cname)
+		if err != nil {
+			return nil, nil, err
+		}
+		if c == nil {
+			return nil, nil, &hl7.Error{Code: hl7.ErrTableValue, Location: "PID-11.6", Text: "unknown country " + strconv.Quote(country)}
+		}
+		u.CName = cname
+	}
+	if u.CName == "" {
+		return nil, nil, &hl7.Error{Code: hl7.ErrRequiredField, Location: "PID-11.6", Text: "the country of a new patient is required"}
+	}
+
+	for _, f := range []struct {
+		location, value string
+		size            int
+	}{
+		{"PID-13.4", u.Email, 60},
+		{"PID-5.2", u.Name, 30},
+		{"PID-5.1", u.Surname, 40},
+		{"PID-13.1", u.Phone.String, 20},
+	} {
+		if utf8.RuneCountInString(f.value) > f.size {
+			return nil, nil, &hl7.Error{Code: hl7.ErrDataType, Location: f.location, Text: fmt.Sprintf("longer than %d characters", f.size)}
+		}
+	}
+
+	var diagnoses []models.Diagnosis
+	for i, dg1 := range msg.All("DG1") {
+		d := models.Diagnosis{
+			Code:        strings.TrimSpace(msg.Field(dg1, "3.1")),
+			Description: strings.TrimSpace(msg.Field(dg1, "3.2")),
+			System:      strings.TrimSpace(msg.Field(dg1, "3.3")),
+		}
+		if d.Description == "" {
+			d.Description = strings.TrimSpace(msg.Field(dg1, "4"))
+		}
+		location := fmt.Sprintf("DG1(%d)-3", i+1)
+		if d.Code == "" {
+			return nil, nil, &hl7.Error{Code: hl7.ErrRequiredField, Location: location, Text: "diagnosis code is required"}
+		}
+		if utf8.RuneCountInString(d.Code) > 50 {
+			return nil, nil, &hl7.Error{Code: hl7.ErrDataType, Location: location, Text: "diagnosis code is longer than 50 characters"}
+		}
+		d.System = truncate(d.System, 20)
+		d.Description = truncate(d.Description, 200)
+		diagnoses = append(diagnoses, d)
+	}
+
+	return &models.ExchangePerson{User: u, Patient: true}, diagnoses, nil
+}
+
+// truncate cuts s to at most n characters.
+func truncate(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n])
+}
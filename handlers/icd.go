@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"myapp/models"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// ICDHandler shows the ICD catalog chapters with their disease type
+// mapping, and serves code search for the disease form.
+type ICDHandler struct {
+	DB        *sql.DB
+	Templates TemplateSet
+}
+
+func NewICDHandler(db *sql.DB, templates TemplateSet) *ICDHandler {
+	return &ICDHandler{
+		DB:        db,
+		Templates: templates,
+	}
+}
+
+// RegisterRoutes mounts the catalog page under /icd and search under
+// /api/icd.
+func (h *ICDHandler) RegisterRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("GET /icd", h.Chapters)
+	mux.HandleFunc("POST /icd/chapters", h.MapChapter)
+	mux.HandleFunc("GET /api/icd", h.Search)
+}
+
+func (h *ICDHandler) Chapters(w http.ResponseWriter, r *http.Request) {
+	chapters, err := models.GetICDChapters(r.Context(), h.DB)
+	if err != nil {
+		http.Error(w, "Error fetching ICD chapters: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	types, err := models.GetAllDiseaseTypes(r.Context(), h.DB)
+	if err != nil {
+		http.Error(w, "Error fetching disease types: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	tmpl, err := h.Templates.Template("icd/chapters")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	data := map[string]any{
+		"Title":        "ICD Catalog",
+		"Chapters":     chapters,
+		"DiseaseTypes": types,
+	}
+	if err := tmpl.Execute(w, data); err != nil {
+		http.Error(w, "Error rendering template: "+err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// MapChapter sets the disease type of a chapter; an empty
+// disease_type_id removes the mapping.
+func (h *ICDHandler) MapChapter(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Error parsing form: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var typeID sql.NullInt64
+	if v := r.PostForm.Get("disease_type_id"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid disease type", http.StatusBadRequest)
+			return
+		}
+		typeID = sql.NullInt64{Int64: n, Valid: true}
+	}
+
+	err := models.SetChapterType(r.Context(), h.DB, r.PostForm.Get("system"), r.PostForm.Get("chapter"), typeID)
+	if err != nil {
+		http.Error(w, "Error mapping chapter: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/icd", http.StatusSeeOther)
+}
+
+// Search answers the disease code autocomplete: GET /api/icd?q=chol.
+func (h *ICDHandler) Search(w http.ResponseWriter, r *http.Request) {
+	q := strings.TrimSpace(r.URL.Query().Get("q"))
+	if q == "" {
+		writeJSON(w, http.StatusOK, []models.ICDCode{})
+		return
+	}
+
+	codes, err := models.SearchICD(r.Context(), h.DB, q, 20)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Error searching ICD codes: " + err.Error()})
+		return
+	}
+	if codes == nil {
+		codes = []models.ICDCode{}
+	}
+	writeJSON(w, http.StatusOK, codes)
+}
+
+// verifyDisease requires a disease code from the ICD catalog unless the
+// disease is marked custom, and a live disease type.
+func verifyDisease(ctx context.Context, db *sql.DB, d *models.Disease) error {
+	if !d.Custom {
+		if err := lookupDisease(ctx, db, d); err != nil {
+			return err
+		}
+	}
+	return models.RequireParents(ctx, db, "Disease", map[string]any{"id": d.ID})
+}
+
+// lookupDisease stores a catalog code in its official spelling, and gives
+// a disease without a type the one mapped to the code's chapter.
+func lookupDisease(ctx context.Context, db *sql.DB, d *models.Disease) error {
+	matches, err := models.LookupICD(ctx, db, d.DiseaseCode)
+	if err != nil {
+		return err
+	}
+	if len(matches) == 0 {
+		return badRequest("Disease code %s is not in the ICD-10 or ICD-11 catalog; mark it as a custom code to use it anyway", d.DiseaseCode)
+	}
+
+	m := matches[0]
+	d.DiseaseCode = m.Code
+	if d.ID == 0 && m.DiseaseTypeID.Valid {
+		d.ID = int(m.DiseaseTypeID.Int64)
+	}
+	return nil
+}
@@ -0,0 +1,181 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"myapp/models"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// JobHandler shows the background job queue and its schedules. Jobs are
+// run by package job. An organization sees the jobs it queued and the
+// schedules; operators see every job and may pause or run schedules.
+type JobHandler struct {
+	DB        *sql.DB
+	Templates TemplateSet
+
+	// Wake, if set, is called after queuing a job so it starts right away.
+	Wake func()
+}
+
+func NewJobHandler(db *sql.DB, templates TemplateSet, wake func()) *JobHandler {
+	return &JobHandler{
+		DB:        db,
+		Templates: templates,
+		Wake:      wake,
+	}
+}
+
+// RegisterRoutes mounts the job pages under /jobs.
+func (h *JobHandler) RegisterRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("GET /jobs", h.List)
+	mux.HandleFunc("POST /jobs/{id}/retry", h.Retry)
+	mux.HandleFunc("POST /jobs/{id}/cancel", h.Cancel)
+	mux.HandleFunc("POST /jobs/schedules/{name}/active", h.SetScheduleActive)
+	mux.HandleFunc("POST /jobs/schedules/{name}/run", h.RunSchedule)
+}
+
+// List shows the schedules, the number of jobs in each status and the
+// last 100 jobs, optionally of one status.
+func (h *JobHandler) List(w http.ResponseWriter, r *http.Request) {
+	status := r.URL.Query().Get("status")
+	if status != "" && !contains(models.JobStatuses, status) {
+		http.Error(w, "Invalid status: "+status, http.StatusBadRequest)
+		return
+	}
+
+	ctx := scope(r)
+	jobs, err := models.GetJobs(ctx, h.DB, status, 100)
+	if err != nil {
+		http.Error(w, "Error fetching jobs: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	counts, err := models.JobCounts(ctx, h.DB)
+	if err != nil {
+		http.Error(w, "Error fetching job counts: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	schedules, err := models.GetJobSchedules(ctx, h.DB)
+	if err != nil {
+		http.Error(w, "Error fetching job schedules: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	type statusCount struct {
+		Status string
+		Count  int
+	}
+	statuses := make([]statusCount, len(models.JobStatuses))
+	for i, s := range models.JobStatuses {
+		statuses[i] = statusCount{s, counts[s]}
+	}
+
+	tmpl, err := h.Templates.Template("jobs/list")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	data := map[string]any{
+		"Title":     "Jobs",
+		"Status":    status,
+		"Statuses":  statuses,
+		"Jobs":      jobs,
+		"Schedules": schedules,
+		"Operator":  isOperator(ctx),
+	}
+	if err := tmpl.Execute(w, data); err != nil {
+		http.Error(w, "Error rendering template: "+err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// Retry queues a failed or cancelled job again.
+func (h *JobHandler) Retry(w http.ResponseWriter, r *http.Request) {
+	id, ok := jobID(w, r)
+	if !ok {
+		return
+	}
+	err := models.RetryJob(scope(r), h.DB, id)
+	if err == nil && h.Wake != nil {
+		h.Wake()
+	}
+	h.done(w, r, err, "Error retrying job: ")
+}
+
+// Cancel cancels a queued or running job.
+func (h *JobHandler) Cancel(w http.ResponseWriter, r *http.Request) {
+	id, ok := jobID(w, r)
+	if !ok {
+		return
+	}
+	h.done(w, r, models.CancelJob(scope(r), h.DB, id), "Error cancelling job: ")
+}
+
+// SetScheduleActive pauses or resumes a schedule.
+func (h *JobHandler) SetScheduleActive(w http.ResponseWriter, r *http.Request) {
+	if !operatorOnly(w, r) {
+		return
+	}
+	active := r.FormValue("active") == "true"
+	h.done(w, r, models.SetJobScheduleActive(scope(r), h.DB, r.PathValue("name"), active), "Error updating schedule: ")
+}
+
+// RunSchedule queues a job of a schedule now.
+func (h *JobHandler) RunSchedule(w http.ResponseWriter, r *http.Request) {
+	if !operatorOnly(w, r) {
+		return
+	}
+	_, err := models.RunJobSchedule(scope(r), h.DB, r.PathValue("name"))
+	if err == nil && h.Wake != nil {
+		h.Wake()
+	}
+	h.done(w, r, err, "Error queuing job: ")
+}
+
+// scope returns the context to query jobs with: that of the request's
+// organization, or every organization's for an operator.
+func scope(r *http.Request) context.Context {
+	if isOperator(r.Context()) {
+		return models.WithAllTenants(r.Context())
+	}
+	return r.Context()
+}
+
+// operatorOnly refuses the request unless its user is an operator, as
+// schedules queue jobs for the whole deployment.
+func operatorOnly(w http.ResponseWriter, r *http.Request) bool {
+	if !isOperator(r.Context()) {
+		http.Error(w, "Only operators can change schedules", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+func jobID(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid job ID", http.StatusBadRequest)
+		return 0, false
+	}
+	return id, true
+}
+
+// done redirects back to the job list, keeping its status filter, after a
+// successful change, and reports err otherwise.
+func (h *JobHandler) done(w http.ResponseWriter, r *http.Request, err error, msg string) {
+	switch {
+	case errors.Is(err, models.ErrNoJob):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case err != nil:
+		http.Error(w, msg+err.Error(), http.StatusInternalServerError)
+	default:
+		back := "/jobs"
+		if status := r.FormValue("status"); contains(models.JobStatuses, status) {
+			back += "?status=" + url.QueryEscape(status)
+		}
+		http.Redirect(w, r, back, http.StatusSeeOther)
+	}
+}
@@ -0,0 +1,290 @@
+package handlers
+
+import (
+	"database/sql"
+	"myapp/models"
+	"net/http"
+	"net/url"
+)
+
+// PersonHandler manages a user together with its patient, doctor and
+// public servant roles: creating them in one form, adding and removing
+// roles from a profile page, and deleting a person with everything that
+// depends on it.
+type PersonHandler struct {
+	DB        *sql.DB
+	Templates TemplateSet
+
+	// users supplies the user form fields, binding and validation.
+	users *Resource[models.User]
+}
+
+func NewPersonHandler(db *sql.DB, templates TemplateSet) *PersonHandler {
+	return &PersonHandler{
+		DB:        db,
+		Templates: templates,
+		users:     NewUserHandler(db, templates),
+	}
+}
+
+// RegisterRoutes mounts the person screens under /people.
+func (h *PersonHandler) RegisterRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("GET /people/create", h.newForm)
+	mux.HandleFunc("POST /people/create", h.create)
+	mux.HandleFunc("GET /people/{email}", h.profile)
+	mux.HandleFunc("POST /people/{email}/roles", h.addRoles)
+	mux.HandleFunc("POST /people/{email}/notifications", h.setNotifications)
+	mux.HandleFunc("POST /people/{email}/roles/{role}/delete", h.removeRole)
+	mux.HandleFunc("GET /people/{email}/delete", h.confirmDelete)
+	mux.HandleFunc("POST /people/{email}/delete", h.delete)
+}
+
+func (h *PersonHandler) newForm(w http.ResponseWriter, r *http.Request) {
+	data := map[string]any{
+		"Title": "Create Person",
+		"User":  &models.User{},
+	}
+
+	for _, l := range h.users.Lookups {
+		rows, err := l.Load(r.Context(), h.DB)
+		if err != nil {
+			http.Error(w, "Error loading "+l.Name+": "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		data[l.Name] = rows
+	}
+
+	h.render(w, "people/form", data)
+}
+
+func (h *PersonHandler) create(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Error parsing form: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var u models.User
+	if err := h.users.bind(r.Context(), r.PostForm, &u, true); err != nil {
+		h.users.fail(w, err, "creating person")
+		return
+	}
+	roles, err := bindRoles(r.PostForm)
+	if err != nil {
+		h.users.fail(w, err, "creating person")
+		return
+	}
+
+	if err := models.CreatePerson(r.Context(), h.DB, &u, roles); err != nil {
+		h.users.fail(w, err, "creating person")
+		return
+	}
+
+	http.Redirect(w, r, profileURL(u.Email), http.StatusSeeOther)
+}
+
+func (h *PersonHandler) profile(w http.ResponseWriter, r *http.Request) {
+	u, ok := h.users.load(w, r)
+	if !ok {
+		return
+	}
+
+	roles, err := models.GetRoles(r.Context(), h.DB, u.Email)
+	if err != nil {
+		h.users.fail(w, err, "fetching roles")
+		return
+	}
+	notifications, err := models.GetNotificationPreference(r.Context(), h.DB, u.Email)
+	if err != nil {
+		h.users.fail(w, err, "fetching notification preferences")
+		return
+	}
+	h.render(w, "people/profile", withReveal(r.Context(), map[string]any{
+		"Title":         u.Name + " " + u.Surname,
+		"User":          u,
+		"Roles":         roles,
+		"Notifications": notifications,
+	}))
+}
+
+// setNotifications stores what the person is emailed about.
+func (h *PersonHandler) setNotifications(w http.ResponseWriter, r *http.Request) {
+	u, ok := h.users.load(w, r)
+	if !ok {
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Error parsing form: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	p := &models.NotificationPreference{
+		Email:         u.Email,
+		RecordChanges: r.PostForm.Get("record_changes") != "",
+		Alerts:        r.PostForm.Get("alerts"),
+	}
+	switch p.Alerts {
+	case models.AlertEmailsNone, models.AlertEmailsCountry, models.AlertEmailsAll:
+	default:
+		http.Error(w, "Invalid alerts preference: "+p.Alerts, http.StatusBadRequest)
+		return
+	}
+
+	if err := models.SetNotificationPreference(r.Context(), h.DB, p); err != nil {
+		h.users.fail(w, err, "saving notification preferences")
+		return
+	}
+
+	http.Redirect(w, r, profileURL(u.Email), http.StatusSeeOther)
+}
+
+func (h *PersonHandler) addRoles(w http.ResponseWriter, r *http.Request) {
+	u, ok := h.users.load(w, r)
+	if !ok {
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Error parsing form: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	roles, err := bindRoles(r.PostForm)
+	if err != nil {
+		h.users.fail(w, err, "adding role")
+		return
+	}
+
+	if err := models.AddRoles(r.Context(), h.DB, u.Email, roles); err != nil {
+		h.users.fail(w, err, "adding role")
+		return
+	}
+
+	http.Redirect(w, r, profileURL(u.Email), http.StatusSeeOther)
+}
+
+// removeRole deletes a role right away when nothing depends on it, and
+// otherwise asks for confirmation listing the rows that will go with it.
+func (h *PersonHandler) removeRole(w http.ResponseWriter, r *http.Request) {
+	role := r.PathValue("role")
+	if roleLabels[role] == "" {
+		notFound(w, r, h.Templates)
+		return
+	}
+
+	u, ok := h.users.load(w, r)
+	if !ok {
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Error parsing form: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if r.PostForm.Get("confirm") == "" {
+		deps, err := models.GetDependents(r.Context(), h.DB, u.Email, role)
+		if err != nil {
+			h.users.fail(w, err, "fetching dependent rows")
+			return
+		}
+		if !deps.Empty() {
+			h.render(w, "people/delete", map[string]any{
+				"Title":      "Remove " + roleLabels[role] + " Role",
+				"User":       u,
+				"Role":       roleLabels[role],
+				"Action":     profileURL(u.Email) + "/roles/" + role + "/delete",
+				"Dependents": deps,
+			})
+			return
+		}
+	}
+
+	if err := models.RemoveRole(r.Context(), h.DB, u.Email, role); err != nil {
+		h.users.fail(w, err, "removing role")
+		return
+	}
+
+	http.Redirect(w, r, profileURL(u.Email), http.StatusSeeOther)
+}
+
+func (h *PersonHandler) confirmDelete(w http.ResponseWriter, r *http.Request) {
+	u, ok := h.users.load(w, r)
+	if !ok {
+		return
+	}
+
+	roles, err := models.GetRoles(r.Context(), h.DB, u.Email)
+	if err != nil {
+		h.users.fail(w, err, "fetching roles")
+		return
+	}
+	deps, err := models.GetDependents(r.Context(), h.DB, u.Email, "")
+	if err != nil {
+		h.users.fail(w, err, "fetching dependent rows")
+		return
+	}
+
+	h.render(w, "people/delete", withReveal(r.Context(), map[string]any{
+		"Title":      "Delete " + u.Name + " " + u.Surname,
+		"User":       u,
+		"Roles":      roles,
+		"Action":     profileURL(u.Email) + "/delete",
+		"Dependents": deps,
+	}))
+}
+
+func (h *PersonHandler) delete(w http.ResponseWriter, r *http.Request) {
+	u, ok := h.users.load(w, r)
+	if !ok {
+		return
+	}
+
+	if err := models.DeletePerson(r.Context(), h.DB, u.Email); err != nil {
+		h.users.fail(w, err, "deleting person")
+		return
+	}
+
+	http.Redirect(w, r, "/users", http.StatusSeeOther)
+}
+
+func (h *PersonHandler) render(w http.ResponseWriter, name string, data any) {
+	tmpl, err := h.Templates.Template(name)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := tmpl.Execute(w, data); err != nil {
+		http.Error(w, "Error rendering template: "+err.Error(), http.StatusInternalServerError)
+	}
+}
+
+var roleLabels = map[string]string{
+	models.RolePatient:       "Patient",
+	models.RoleDoctor:        "Doctor",
+	models.RolePublicServant: "Public Servant",
+}
+
+// bindRoles reads the role checkboxes and their detail fields. A doctor
+// needs a degree; a public servant's department is optional.
+func bindRoles(values url.Values) (*models.Roles, error) {
+	doctor := values.Get(models.RoleDoctor) != ""
+	f := newForm(values, []Field{
+		{Name: "degree", Label: "Degree", Required: doctor},
+		{Name: "department", Label: "Department"},
+	}, true)
+
+	roles := &models.Roles{Patient: values.Get(models.RolePatient) != ""}
+	if doctor {
+		roles.Doctor = &models.Doctor{Degree: f.String("degree")}
+	}
+	if values.Get(models.RolePublicServant) != "" {
+		roles.PublicServant = &models.PublicServant{Department: f.NullString("department")}
+	}
+	return roles, f.Err()
+}
+
+func profileURL(email string) string {
+	return "/people/" + url.PathEscape(email)
+}
@@ -0,0 +1,177 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"myapp/models"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// Personal data, the columns of db/schema.sql with a mask, is shown masked
+// and left out of API responses and exports. Users listed in the Router's
+// PersonalDataReaders, as named by a trusted proxy, may see it by adding
+// reveal=1 to the query; every such request is logged, without the values.
+
+type personalKey struct{}
+
+type personalAccess struct {
+	reader bool // the user may reveal personal data
+	reveal bool // and this request does
+}
+
+// withPersonalAccess records in r's context what it may see of the
+// personal data.
+func (rt *Router) withPersonalAccess(r *http.Request) *http.Request {
+	user := proxyHeader(r, "X-Forwarded-User")
+	a := personalAccess{reader: user != "" && rt.PersonalDataReaders[user]}
+	if a.reader {
+		a.reveal, _ = strconv.ParseBool(r.URL.Query().Get("reveal"))
+	}
+	if a.reveal {
+		log.Printf("%s revealed personal data: %s %s", user, r.Method, r.URL.Path)
+	}
+	return r.WithContext(context.WithValue(r.Context(), personalKey{}, a))
+}
+
+// canReveal reports whether the user of ctx may reveal personal data.
+func canReveal(ctx context.Context) bool {
+	a, _ := ctx.Value(personalKey{}).(personalAccess)
+	return a.reader
+}
+
+// revealing reports whether personal data is shown in full for ctx.
+func revealing(ctx context.Context) bool {
+	a, _ := ctx.Value(personalKey{}).(personalAccess)
+	return a.reveal
+}
+
+// withReveal adds what templates need to mask personal data and to offer
+// revealing it to page data.
+func withReveal(ctx context.Context, data map[string]any) map[string]any {
+	data["Reveal"] = revealing(ctx)
+	data["CanReveal"] = canReveal(ctx)
+	return data
+}
+
+// redact returns v, rows or a row of table, as JSON with the personal
+// columns set to null, unless ctx reveals them.
+func redact(ctx context.Context, table string, v any) (any, error) {
+	t := models.TableByName(table)
+	if t == nil || revealing(ctx) || !t.Personal() {
+		return v, nil
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var decoded any
+	if err := json.Unmarshal(b, &decoded); err != nil {
+		return nil, err
+	}
+	rows, ok := decoded.([]any)
+	if !ok {
+		rows = []any{decoded}
+	}
+	for _, row := range rows {
+		if m, ok := row.(map[string]any); ok {
+			t.RedactRow(m)
+		}
+	}
+	return decoded, nil
+}
+
+// keepPersonal drops the personal columns of table from a JSON object
+// about to be decoded onto a stored row, so that a client that cannot see
+// them does not overwrite them with the nulls it was sent.
+func keepPersonal(ctx context.Context, table string, body json.RawMessage) (json.RawMessage, error) {
+	t := models.TableByName(table)
+	if t == nil || revealing(ctx) || !t.Personal() {
+		return body, nil
+	}
+	var m map[string]json.RawMessage
+	if err := json.Unmarshal(body, &m); err != nil {
+		return nil, err
+	}
+	for _, c := range t.Columns {
+		if c.Personal() {
+			delete(m, c.Name)
+		}
+	}
+	return json.Marshal(m)
+}
+
+// keepPersonalValues drops the personal fields from a submitted edit form
+// unless ctx reveals them, as keepPersonal does for JSON, so that binding
+// keeps the stored values even if a client that cannot see them sends
+// some.
+func (res *Resource[T]) keepPersonalValues(ctx context.Context, values url.Values) url.Values {
+	personal := res.personalFields(ctx)
+	if len(personal) == 0 {
+		return values
+	}
+	kept := make(url.Values, len(values))
+	for name, v := range values {
+		if !personal[name] {
+			kept[name] = v
+		}
+	}
+	return kept
+}
+
+// maskHistory masks the personal columns of the versions of table unless
+// ctx reveals them. Key columns are left as they are, being in the URL.
+func maskHistory(ctx context.Context, table string, versions []models.Version) {
+	t := models.TableByName(table)
+	if t == nil || revealing(ctx) {
+		return
+	}
+	hidden := make(map[string]string)
+	for _, c := range t.Columns {
+		if c.Personal() && !contains(t.Keys, c.Name) {
+			hidden[c.Name] = c.Mask
+		}
+	}
+	if len(hidden) == 0 {
+		return
+	}
+	mask := func(kind string, v any) any {
+		if v == nil {
+			return nil
+		}
+		return models.Mask(kind, fmt.Sprint(v))
+	}
+	for i := range versions {
+		v := &versions[i]
+		for name, kind := range hidden {
+			if _, ok := v.Data[name]; ok {
+				v.Data[name] = mask(kind, v.Data[name])
+			}
+		}
+		for j := range v.Changes {
+			c := &v.Changes[j]
+			if kind, ok := hidden[c.Column]; ok {
+				c.Old, c.New = mask(kind, c.Old), mask(kind, c.New)
+			}
+		}
+	}
+}
+
+// personalFields returns the form fields of the resource's non-key
+// personal columns, which pages leave out unless ctx reveals them.
+func (res *Resource[T]) personalFields(ctx context.Context) map[string]bool {
+	t := models.TableByName(res.Table)
+	if t == nil || revealing(ctx) {
+		return nil
+	}
+	fields := make(map[string]bool)
+	for _, c := range t.Columns {
+		if c.Personal() && !contains(t.Keys, c.Name) {
+			fields[c.Name] = true
+		}
+	}
+	return fields
+}
@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// TrustedProxies are the addresses of the authenticating proxy. The
+// headers it sets about the user's session, such as
+// X-Forwarded-Organization, are only believed on requests coming from
+// them; any client can send them too.
+type TrustedProxies []netip.Prefix
+
+// ParseTrustedProxies parses a comma-separated list of addresses and
+// networks, e.g. "10.0.0.0/8,192.168.1.5".
+func ParseTrustedProxies(s string) (TrustedProxies, error) {
+	var ps TrustedProxies
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if !strings.Contains(entry, "/") {
+			addr, err := netip.ParseAddr(entry)
+			if err != nil {
+				return nil, fmt.Errorf("invalid proxy address %q", entry)
+			}
+			ps = append(ps, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+		p, err := netip.ParsePrefix(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy network %q", entry)
+		}
+		ps = append(ps, p.Masked())
+	}
+	return ps, nil
+}
+
+// Contains reports whether remoteAddr, as in http.Request, is a proxy.
+func (ps TrustedProxies) Contains(remoteAddr string) bool {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, p := range ps {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+type proxyKey struct{}
+
+// withProxy records in r's context whether r came through a trusted proxy.
+func (rt *Router) withProxy(r *http.Request) *http.Request {
+	trusted := rt.Proxies.Contains(r.RemoteAddr)
+	return r.WithContext(context.WithValue(r.Context(), proxyKey{}, trusted))
+}
+
+// fromProxy reports whether r came through a trusted proxy.
+func fromProxy(r *http.Request) bool {
+	trusted, _ := r.Context().Value(proxyKey{}).(bool)
+	return trusted
+}
+
+// proxyHeader returns a header set by the authenticating proxy, or "" if
+// r did not come through it.
+func proxyHeader(r *http.Request, name string) string {
+	if !fromProxy(r) {
+		return ""
+	}
+	return r.Header.Get(name)
+}
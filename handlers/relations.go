@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"myapp/models"
+)
+
+// Related hooks load the rows linked to an item for its view page. They
+// are wired to resources through the related= annotation in db/schema.sql.
+
+func countryRelated(ctx context.Context, db *sql.DB, c *models.Country) (map[string]any, error) {
+	users, err := models.GetUsersByCountry(ctx, db, c.CName)
+	if err != nil {
+		return nil, err
+	}
+	discoveries, err := models.GetDiscoveriesByCountry(ctx, db, c.CName)
+	if err != nil {
+		return nil, err
+	}
+	records, err := models.GetRecordsByCountry(ctx, db, c.CName)
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]any{
+		"Users":       users,
+		"Discoveries": discoveries,
+		"Records":     records,
+	}, nil
+}
+
+func diseaseRelated(ctx context.Context, db *sql.DB, d *models.Disease) (map[string]any, error) {
+	diseaseType, err := models.GetDiseaseType(ctx, db, d.ID)
+	if err != nil {
+		return nil, err
+	}
+	// Who has a disease is personal data.
+	var patients []models.User
+	if revealing(ctx) {
+		if patients, err = models.GetPatientsByDisease(ctx, db, d.DiseaseCode); err != nil {
+			return nil, err
+		}
+	}
+	discoveries, err := models.GetDiscoveriesByDisease(ctx, db, d.DiseaseCode)
+	if err != nil {
+		return nil, err
+	}
+	doctors, err := models.GetDoctorsBySpecialization(ctx, db, d.ID)
+	if err != nil {
+		return nil, err
+	}
+	icd, err := models.LookupICD(ctx, db, d.DiseaseCode)
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]any{
+		"ICD":         icd,
+		"DiseaseType": diseaseType,
+		"Patients":    patients,
+		"Discoveries": discoveries,
+		"Doctors":     doctors,
+	}, nil
+}
+
+// userRelated loads the roles of a user. A role's entry is nil when the
+// user does not have it, so templates can test it with {{ with }}.
+func userRelated(ctx context.Context, db *sql.DB, u *models.User) (map[string]any, error) {
+	data := map[string]any{}
+
+	patient, err := models.GetPatient(ctx, db, u.Email)
+	if err != nil {
+		return nil, err
+	}
+	if patient != nil {
+		// A patient's diseases are personal data.
+		var diseases []models.Disease
+		if revealing(ctx) {
+			if diseases, err = models.GetDiseasesByPatient(ctx, db, u.Email); err != nil {
+				return nil, err
+			}
+		}
+		data["Patient"] = map[string]any{"Diseases": diseases}
+	}
+
+	doctor, err := models.GetDoctor(ctx, db, u.Email)
+	if err != nil {
+		return nil, err
+	}
+	if doctor != nil {
+		specializations, err := models.GetSpecializationsByDoctor(ctx, db, u.Email)
+		if err != nil {
+			return nil, err
+		}
+		data["Doctor"] = map[string]any{"Degree": doctor.Degree, "Specializations": specializations}
+	}
+
+	servant, err := models.GetPublicServant(ctx, db, u.Email)
+	if err != nil {
+		return nil, err
+	}
+	if servant != nil {
+		records, err := models.GetRecordsByServant(ctx, db, u.Email)
+		if err != nil {
+			return nil, err
+		}
+		data["PublicServant"] = map[string]any{"Department": servant.Department, "Records": records}
+	}
+
+	return data, nil
+}
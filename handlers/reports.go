@@ -0,0 +1,320 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"myapp/job"
+	"myapp/models"
+	"myapp/report"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ReportHandler manages the report schedules and the archive of
+// generated reports. Reports are generated by jobs (see package report).
+type ReportHandler struct {
+	DB        *sql.DB
+	Templates TemplateSet
+	Wake      func() // wakes the job runner so a report starts at once
+}
+
+func NewReportHandler(db *sql.DB, templates TemplateSet, wake func()) *ReportHandler {
+	return &ReportHandler{
+		DB:        db,
+		Templates: templates,
+		Wake:      wake,
+	}
+}
+
+// archivedReports is how many reports the reports page lists.
+const archivedReports = 50
+
+// RegisterRoutes mounts the report pages under /reports.
+func (h *ReportHandler) RegisterRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("GET /reports", h.List)
+	mux.HandleFunc("POST /reports/generate", h.Generate)
+	mux.HandleFunc("POST /reports/schedules", h.CreateSchedule)
+	mux.HandleFunc("POST /reports/schedules/{id}/active", h.SetScheduleActive)
+	mux.HandleFunc("POST /reports/schedules/{id}/delete", h.DeleteSchedule)
+	mux.HandleFunc("GET /reports/{id}/html", h.HTML)
+	mux.HandleFunc("GET /reports/{id}/pdf", h.PDF)
+	mux.HandleFunc("POST /reports/{id}/delete", h.Delete)
+}
+
+func (h *ReportHandler) List(w http.ResponseWriter, r *http.Request) {
+	h.render(w, r, http.StatusOK, nil, "", "")
+}
+
+// Generate queues a report of the period up to now.
+func (h *ReportHandler) Generate(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Error parsing form: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	f := r.PostForm
+
+	tenant, _ := models.Tenant(r.Context())
+	req := report.Request{TenantID: tenant, Scope: f.Get("scope"), End: time.Now()}
+	problem := h.readSubject(r, f, &req.Scope, &req.Subject)
+	if problem == "" {
+		problem = readPeriod(f, &req.PeriodDays)
+	}
+	if problem != "" {
+		h.render(w, r, http.StatusBadRequest, nil, problem, "")
+		return
+	}
+
+	if _, err := report.Generate.Enqueue(r.Context(), h.DB, req); err != nil {
+		http.Error(w, "Error queuing report: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	h.Wake()
+	h.render(w, r, http.StatusOK, nil, "", "The report is being generated; reload the page in a moment to see it in the archive.")
+}
+
+// CreateSchedule adds a schedule from the form on the reports page.
+func (h *ReportHandler) CreateSchedule(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Error parsing form: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	f := r.PostForm
+
+	x := &models.ReportSchedule{
+		Name:   strings.TrimSpace(f.Get("name")),
+		Scope:  f.Get("scope"),
+		Spec:   strings.TrimSpace(f.Get("spec")),
+		Active: true,
+	}
+	var subject string
+	var problem string
+	switch {
+	case x.Name == "":
+		problem = "Name is required."
+	case len(x.Name) > 100:
+		problem = "Name must be at most 100 characters."
+	default:
+		problem = h.readSubject(r, f, &x.Scope, &subject)
+	}
+	if problem == "" {
+		problem = readPeriod(f, &x.PeriodDays)
+	}
+	if problem == "" {
+		next, err := job.NextRun(x.Spec, time.Now())
+		if err != nil {
+			problem = "Schedule: " + err.Error()
+		}
+		x.NextRunAt = next
+	}
+	if problem != "" {
+		h.render(w, r, http.StatusBadRequest, f, problem, "")
+		return
+	}
+	if subject != "" {
+		x.Subject = sql.NullString{String: subject, Valid: true}
+	}
+
+	if err := models.CreateReportSchedule(r.Context(), h.DB, x); err != nil {
+		http.Error(w, "Error creating report schedule: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, "/reports", http.StatusSeeOther)
+}
+
+// readSubject checks the scope and reads the country or disease of a
+// report from f into subject, which is left empty for all of them. It
+// returns what is wrong with them, or "".
+func (h *ReportHandler) readSubject(r *http.Request, f url.Values, scope, subject *string) string {
+	switch *scope {
+	case models.ReportCountry:
+		cname := strings.TrimSpace(f.Get("cname"))
+		if cname == "" {
+			return ""
+		}
+		if err := resolveCountry(r.Context(), h.DB, &cname); err != nil {
+			return "Error resolving country: " + err.Error()
+		}
+		c, err := models.GetCountry(r.Context(), h.DB, cname)
+		if err != nil {
+			return "Error fetching country: " + err.Error()
+		}
+		if c == nil {
+			return "There is no country " + cname + "."
+		}
+		*subject = c.CName
+	case models.ReportDisease:
+		code := strings.TrimSpace(f.Get("disease_code"))
+		if code == "" {
+			return ""
+		}
+		d, err := models.GetDisease(r.Context(), h.DB, code)
+		if err != nil {
+			return "Error fetching disease: " + err.Error()
+		}
+		if d == nil {
+			return "There is no disease " + code + "."
+		}
+		*subject = d.DiseaseCode
+	default:
+		return "Choose whether the report is by country or by disease."
+	}
+	return ""
+}
+
+// readPeriod reads the number of days a report covers from f.
+func readPeriod(f url.Values, days *int) string {
+	n, err := strconv.Atoi(f.Get("period_days"))
+	if err != nil || n < 1 || n > 3660 {
+		return "Period must be a whole number of days, from 1 to 3660."
+	}
+	*days = n
+	return ""
+}
+
+// SetScheduleActive pauses or resumes a schedule. A resumed schedule
+// runs at its next time from now, skipping the runs it missed.
+func (h *ReportHandler) SetScheduleActive(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid schedule ID", http.StatusBadRequest)
+		return
+	}
+	active, _ := strconv.ParseBool(r.FormValue("active"))
+	next, err := job.NextRun(r.FormValue("spec"), time.Now())
+	if err != nil {
+		// Only used when resuming; the spec was checked when the
+		// schedule was created.
+		next = time.Now()
+	}
+	h.done(w, r, models.SetReportScheduleActive(r.Context(), h.DB, id, active, next), "Error updating report schedule: ")
+}
+
+func (h *ReportHandler) DeleteSchedule(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid schedule ID", http.StatusBadRequest)
+		return
+	}
+	h.done(w, r, models.DeleteReportSchedule(r.Context(), h.DB, id), "Error deleting report schedule: ")
+}
+
+// HTML shows an archived report. Reports are standalone pages, served
+// with a policy that allows nothing but their inline styles.
+func (h *ReportHandler) HTML(w http.ResponseWriter, r *http.Request) {
+	x := h.get(w, r)
+	if x == nil {
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'")
+	w.Write([]byte(x.HTML))
+}
+
+// PDF downloads an archived report.
+func (h *ReportHandler) PDF(w http.ResponseWriter, r *http.Request) {
+	x := h.get(w, r)
+	if x == nil {
+		return
+	}
+	name := "report-" + strconv.FormatInt(x.ID, 10) + "-" + x.PeriodEnd.Format("2006-01-02") + ".pdf"
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+name+`"`)
+	w.Header().Set("Content-Length", strconv.Itoa(len(x.PDF)))
+	w.Write(x.PDF)
+}
+
+// get returns the report named by the path, or writes an error and
+// returns nil.
+func (h *ReportHandler) get(w http.ResponseWriter, r *http.Request) *models.Report {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid report ID", http.StatusBadRequest)
+		return nil
+	}
+	x, err := models.GetReport(r.Context(), h.DB, id)
+	if errors.Is(err, models.ErrNoReport) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return nil
+	}
+	if err != nil {
+		http.Error(w, "Error fetching report: "+err.Error(), http.StatusInternalServerError)
+		return nil
+	}
+	return x
+}
+
+func (h *ReportHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid report ID", http.StatusBadRequest)
+		return
+	}
+	h.done(w, r, models.DeleteReport(r.Context(), h.DB, id), "Error deleting report: ")
+}
+
+// done redirects to the reports page after a successful change, and
+// reports err otherwise.
+func (h *ReportHandler) done(w http.ResponseWriter, r *http.Request, err error, msg string) {
+	switch {
+	case errors.Is(err, models.ErrNoReport):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case err != nil:
+		http.Error(w, msg+err.Error(), http.StatusInternalServerError)
+	default:
+		http.Redirect(w, r, "/reports", http.StatusSeeOther)
+	}
+}
+
+// render shows the schedules, the schedule form, filled in with form if
+// it was rejected, the form to generate a report now and the archive.
+func (h *ReportHandler) render(w http.ResponseWriter, r *http.Request, status int, form url.Values, problem, notice string) {
+	schedules, err := models.GetReportSchedules(r.Context(), h.DB)
+	if err != nil {
+		http.Error(w, "Error fetching report schedules: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	reports, err := models.GetReports(r.Context(), h.DB, archivedReports)
+	if err != nil {
+		http.Error(w, "Error fetching reports: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	diseases, err := models.GetAllDiseases(r.Context(), h.DB)
+	if err != nil {
+		http.Error(w, "Error fetching diseases: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	countries, err := models.GetAllCountries(r.Context(), h.DB)
+	if err != nil {
+		http.Error(w, "Error fetching countries: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if form == nil {
+		form = url.Values{"scope": {models.ReportCountry}, "spec": {"0 6 * * mon"}, "period_days": {"7"}}
+	}
+
+	tmpl, err := h.Templates.Template("reports/list")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	data := map[string]any{
+		"Title":     "Reports",
+		"Schedules": schedules,
+		"Reports":   reports,
+		"Diseases":  diseases,
+		"Countries": countries,
+		"Form":      form,
+		"Problem":   problem,
+		"Notice":    notice,
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	if err := tmpl.Execute(w, data); err != nil {
+		http.Error(w, "Error rendering template: "+err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,551 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"myapp/models"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Resource is a generic CRUD handler for one entity. An entity declares its
+// key fields, form fields, related lookups and model functions, and gets
+// HTML routes under /<Path> and JSON routes under /api/<Path>.
+type Resource[T any] struct {
+	DB        *sql.DB
+	Templates TemplateSet
+	Table     string // SQL table name, used for row history
+
+	Path        string // URL segment and template directory, e.g. "records"
+	Label       string // human-readable singular, e.g. "Record"
+	LabelPlural string // human-readable plural, e.g. "Records"
+	Item        string // template data key for a single row, e.g. "Record"
+	Items       string // template data key for the list, e.g. "Records"
+
+	Keys    []string // path wildcards identifying a row, in URL order
+	Fields  []Field  // form fields, used for labels and required checks
+	Lookups []Lookup // related data loaded for the create and edit forms
+
+	List   func(ctx context.Context, db *sql.DB) ([]T, error)
+	Get    func(ctx context.Context, db *sql.DB, k Key) (*T, error)
+	Create func(ctx context.Context, db *sql.DB, item *T) error
+	Update func(ctx context.Context, db *sql.DB, k Key, item *T) error // nil when nothing is editable
+	Delete func(ctx context.Context, db *sql.DB, k Key) error
+
+	// KeyOf returns the key values of item in the order of Keys.
+	KeyOf func(item *T) []string
+	// Bind copies submitted form values onto item. Key fields are only
+	// editable when f.Creating is set.
+	Bind func(f *Form, item *T)
+	// Validate is an optional hook run before every create and update.
+	Validate func(item *T) error
+	// Verify is an optional hook run after Validate for checks that need
+	// the database. It may also fill in or normalize fields of item.
+	Verify func(ctx context.Context, db *sql.DB, item *T) error
+	// Related optionally loads rows linked to item for its view page; the
+	// returned entries are added to the template data.
+	Related func(ctx context.Context, db *sql.DB, item *T) (map[string]any, error)
+}
+
+// Key holds the path parameters that identify a single row.
+type Key map[string]string
+
+// Int parses the named key as an integer.
+func (k Key) Int(name string) (int, error) {
+	n, err := strconv.Atoi(k[name])
+	if err != nil {
+		return 0, badRequest("Invalid %s", name)
+	}
+	return n, nil
+}
+
+// Lookup loads related rows for a form, such as the diseases offered in a
+// dropdown. Name is the template data key.
+type Lookup struct {
+	Name string
+	Load func(ctx context.Context, db *sql.DB) (any, error)
+}
+
+func lookup[E any](name string, load func(context.Context, *sql.DB) ([]E, error)) Lookup {
+	return Lookup{
+		Name: name,
+		Load: func(ctx context.Context, db *sql.DB) (any, error) {
+			return load(ctx, db)
+		},
+	}
+}
+
+// httpError carries a status code for errors raised by resource hooks.
+type httpError struct {
+	Code int
+	Msg  string
+}
+
+func (e *httpError) Error() string { return e.Msg }
+
+func badRequest(format string, args ...any) error {
+	return &httpError{Code: http.StatusBadRequest, Msg: fmt.Sprintf(format, args...)}
+}
+
+// RegisterRoutes mounts the HTML and JSON CRUD routes for the resource.
+func (res *Resource[T]) RegisterRoutes(mux *http.ServeMux) {
+	base := "/" + res.Path
+	item := base + "/" + res.keyPattern()
+
+	mux.HandleFunc("GET "+base, res.list)
+	mux.HandleFunc("GET "+base+"/create", res.newForm)
+	mux.HandleFunc("POST "+base+"/create", res.create)
+	mux.HandleFunc("GET "+item, res.view)
+	if res.Update != nil {
+		mux.HandleFunc("GET "+item+"/edit", res.editForm)
+		mux.HandleFunc("POST "+item+"/edit", res.update)
+	}
+	mux.HandleFunc("POST "+item+"/delete", res.delete)
+
+	api := "/api" + base
+	apiItem := "/api" + item
+	mux.HandleFunc("GET "+api, res.apiList)
+	mux.HandleFunc("POST "+api, res.apiCreate)
+	mux.HandleFunc("GET "+apiItem, res.apiGet)
+	if res.Update != nil {
+		mux.HandleFunc("PUT "+apiItem, res.apiUpdate)
+	}
+	mux.HandleFunc("DELETE "+apiItem, res.apiDelete)
+
+	if res.Table != "" {
+		res.registerHistoryRoutes(mux, item, apiItem)
+		res.registerBulkRoutes(mux, base)
+	}
+}
+
+func (res *Resource[T]) keyPattern() string {
+	parts := make([]string, len(res.Keys))
+	for i, k := range res.Keys {
+		parts[i] = "{" + k + "}"
+	}
+	return strings.Join(parts, "/")
+}
+
+// URL returns the view path of item, escaping each key segment.
+func (res *Resource[T]) URL(item *T) string {
+	parts := []string{"", res.Path}
+	for _, v := range res.KeyOf(item) {
+		parts = append(parts, url.PathEscape(v))
+	}
+	return strings.Join(parts, "/")
+}
+
+func (res *Resource[T]) key(r *http.Request) (Key, error) {
+	k := make(Key, len(res.Keys))
+	for _, name := range res.Keys {
+		v := r.PathValue(name)
+		if v == "" {
+			return nil, badRequest("Missing %s", name)
+		}
+		k[name] = v
+	}
+	return k, nil
+}
+
+func (res *Resource[T]) noun() string       { return strings.ToLower(res.Label) }
+func (res *Resource[T]) nounPlural() string { return strings.ToLower(res.LabelPlural) }
+
+func (res *Resource[T]) list(w http.ResponseWriter, r *http.Request) {
+	items, err := res.List(r.Context(), res.DB)
+	if err != nil {
+		res.fail(w, err, "fetching "+res.nounPlural())
+		return
+	}
+
+	res.render(w, "list", withReveal(r.Context(), map[string]any{
+		"Title":    res.LabelPlural,
+		res.Items:  items,
+		"Reassign": res.reassignColumns(),
+	}))
+}
+
+func (res *Resource[T]) view(w http.ResponseWriter, r *http.Request) {
+	item, ok := res.load(w, r)
+	if !ok {
+		return
+	}
+
+	data := map[string]any{
+		"Title":  "View " + res.Label,
+		res.Item: item,
+	}
+	if res.Related != nil {
+		related, err := res.Related(r.Context(), res.DB, item)
+		if err != nil {
+			res.fail(w, err, "fetching related data")
+			return
+		}
+		for name, rows := range related {
+			data[name] = rows
+		}
+	}
+
+	res.render(w, "view", withReveal(r.Context(), data))
+}
+
+func (res *Resource[T]) newForm(w http.ResponseWriter, r *http.Request) {
+	res.renderForm(w, r, "Create "+res.Label, new(T))
+}
+
+func (res *Resource[T]) editForm(w http.ResponseWriter, r *http.Request) {
+	item, ok := res.load(w, r)
+	if !ok {
+		return
+	}
+	res.renderForm(w, r, "Edit "+res.Label, item)
+}
+
+func (res *Resource[T]) create(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Error parsing form: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	item := new(T)
+	if err := res.bind(r.Context(), r.PostForm, item, true); err != nil {
+		res.fail(w, err, "creating "+res.noun())
+		return
+	}
+
+	if err := res.Create(r.Context(), res.DB, item); err != nil {
+		res.fail(w, err, "creating "+res.noun())
+		return
+	}
+
+	http.Redirect(w, r, "/"+res.Path, http.StatusSeeOther)
+}
+
+func (res *Resource[T]) update(w http.ResponseWriter, r *http.Request) {
+	k, err := res.key(r)
+	if err != nil {
+		res.fail(w, err, "updating "+res.noun())
+		return
+	}
+
+	item, ok := res.load(w, r)
+	if !ok {
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Error parsing form: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := res.bind(r.Context(), r.PostForm, item, false); err != nil {
+		res.fail(w, err, "updating "+res.noun())
+		return
+	}
+
+	err = res.Update(r.Context(), res.DB, k, item)
+	if errors.Is(err, models.ErrConflict) {
+		res.conflict(w, r, k, r.PostForm)
+		return
+	}
+	if err != nil {
+		res.fail(w, err, "updating "+res.noun())
+		return
+	}
+
+	http.Redirect(w, r, "/"+res.Path, http.StatusSeeOther)
+}
+
+func (res *Resource[T]) delete(w http.ResponseWriter, r *http.Request) {
+	k, err := res.key(r)
+	if err != nil {
+		res.fail(w, err, "deleting "+res.noun())
+		return
+	}
+
+	if err := res.Delete(r.Context(), res.DB, k); err != nil {
+		res.fail(w, err, "deleting "+res.noun())
+		return
+	}
+
+	http.Redirect(w, r, "/"+res.Path, http.StatusSeeOther)
+}
+
+// load fetches the row named by the request path, writing the error or
+// not-found response itself when it returns false.
+func (res *Resource[T]) load(w http.ResponseWriter, r *http.Request) (*T, bool) {
+	k, err := res.key(r)
+	if err != nil {
+		res.fail(w, err, "fetching "+res.noun())
+		return nil, false
+	}
+
+	item, err := res.Get(r.Context(), res.DB, k)
+	if err != nil {
+		res.fail(w, err, "fetching "+res.noun())
+		return nil, false
+	}
+	if item == nil {
+		notFound(w, r, res.Templates)
+		return nil, false
+	}
+	return item, true
+}
+
+func (res *Resource[T]) bind(ctx context.Context, values url.Values, item *T, creating bool) error {
+	if !creating {
+		values = res.keepPersonalValues(ctx, values)
+	}
+	f := newForm(values, res.Fields, creating)
+	res.Bind(f, item)
+	if err := f.Err(); err != nil {
+		return err
+	}
+	return res.validate(ctx, item)
+}
+
+func (res *Resource[T]) validate(ctx context.Context, item *T) error {
+	if res.Validate != nil {
+		if err := res.Validate(item); err != nil {
+			var he *httpError
+			if errors.As(err, &he) {
+				return err
+			}
+			return badRequest("%s", err.Error())
+		}
+	}
+	if res.Verify != nil {
+		return res.Verify(ctx, res.DB, item)
+	}
+	return nil
+}
+
+func (res *Resource[T]) renderForm(w http.ResponseWriter, r *http.Request, title string, item *T) {
+	data := map[string]any{
+		"Title":  title,
+		res.Item: item,
+	}
+
+	for _, l := range res.Lookups {
+		rows, err := l.Load(r.Context(), res.DB)
+		if err != nil {
+			http.Error(w, "Error loading "+l.Name+": "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		data[l.Name] = rows
+	}
+
+	res.render(w, "form", withReveal(r.Context(), data))
+}
+
+func (res *Resource[T]) render(w http.ResponseWriter, page string, data any) {
+	name := res.Path + "/" + page
+	tmpl, err := res.Templates.Template(name)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := tmpl.Execute(w, data); err != nil {
+		http.Error(w, "Error rendering template: "+err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// fail reports err as a plain-text response. Errors raised by hooks keep
+// their status code; anything else is treated as a server error.
+func (res *Resource[T]) fail(w http.ResponseWriter, err error, action string) {
+	var he *httpError
+	if errors.As(err, &he) {
+		http.Error(w, he.Msg, he.Code)
+		return
+	}
+	if errors.Is(err, models.ErrInTrash) {
+		http.Error(w, "Error "+action+": "+err.Error(), http.StatusConflict)
+		return
+	}
+	if errors.Is(err, models.ErrMissingParent) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	http.Error(w, "Error "+action+": "+err.Error(), http.StatusInternalServerError)
+}
+
+func (res *Resource[T]) apiList(w http.ResponseWriter, r *http.Request) {
+	if asOf := r.URL.Query().Get("as_of"); asOf != "" && res.Table != "" {
+		res.apiAsOf(w, r, asOf)
+		return
+	}
+
+	items, err := res.List(r.Context(), res.DB)
+	if err != nil {
+		res.failJSON(w, err, "fetching "+res.nounPlural())
+		return
+	}
+	if items == nil {
+		items = []T{}
+	}
+	res.writeRedacted(w, r, http.StatusOK, items)
+}
+
+func (res *Resource[T]) apiGet(w http.ResponseWriter, r *http.Request) {
+	item, ok := res.loadJSON(w, r)
+	if !ok {
+		return
+	}
+	res.writeRedacted(w, r, http.StatusOK, item)
+}
+
+func (res *Resource[T]) apiCreate(w http.ResponseWriter, r *http.Request) {
+	item := new(T)
+	if err := json.NewDecoder(r.Body).Decode(item); err != nil {
+		res.failJSON(w, badRequest("Invalid JSON body: %v", err), "")
+		return
+	}
+
+	if err := res.validate(r.Context(), item); err != nil {
+		res.failJSON(w, err, "")
+		return
+	}
+
+	if err := res.Create(r.Context(), res.DB, item); err != nil {
+		res.failJSON(w, err, "creating "+res.noun())
+		return
+	}
+
+	w.Header().Set("Location", "/api"+res.URL(item))
+	res.writeRedacted(w, r, http.StatusCreated, item)
+}
+
+func (res *Resource[T]) apiUpdate(w http.ResponseWriter, r *http.Request) {
+	k, err := res.key(r)
+	if err != nil {
+		res.failJSON(w, err, "")
+		return
+	}
+
+	item, ok := res.loadJSON(w, r)
+	if !ok {
+		return
+	}
+
+	// Decoding onto the stored row leaves omitted fields unchanged, and
+	// personal data is only changed by requests that reveal it.
+	var body json.RawMessage
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		res.failJSON(w, badRequest("Invalid JSON body: %v", err), "")
+		return
+	}
+	body, err = keepPersonal(r.Context(), res.Table, body)
+	if err == nil {
+		err = json.Unmarshal(body, item)
+	}
+	if err != nil {
+		res.failJSON(w, badRequest("Invalid JSON body: %v", err), "")
+		return
+	}
+
+	if err := res.validate(r.Context(), item); err != nil {
+		res.failJSON(w, err, "")
+		return
+	}
+
+	err = res.Update(r.Context(), res.DB, k, item)
+	if errors.Is(err, models.ErrConflict) {
+		// Answer with the stored row so the client can merge and retry.
+		current, err := res.Get(r.Context(), res.DB, k)
+		if err != nil {
+			res.failJSON(w, err, "fetching "+res.noun())
+			return
+		}
+		if current == nil {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": res.Label + " not found"})
+			return
+		}
+		redacted, err := redact(r.Context(), res.Table, current)
+		if err != nil {
+			res.failJSON(w, err, "fetching "+res.noun())
+			return
+		}
+		writeJSON(w, http.StatusConflict, map[string]any{
+			"error":   models.ErrConflict.Error(),
+			"current": redacted,
+		})
+		return
+	}
+	if err != nil {
+		res.failJSON(w, err, "updating "+res.noun())
+		return
+	}
+	res.writeRedacted(w, r, http.StatusOK, item)
+}
+
+func (res *Resource[T]) apiDelete(w http.ResponseWriter, r *http.Request) {
+	k, err := res.key(r)
+	if err != nil {
+		res.failJSON(w, err, "")
+		return
+	}
+
+	if err := res.Delete(r.Context(), res.DB, k); err != nil {
+		res.failJSON(w, err, "deleting "+res.noun())
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (res *Resource[T]) loadJSON(w http.ResponseWriter, r *http.Request) (*T, bool) {
+	k, err := res.key(r)
+	if err != nil {
+		res.failJSON(w, err, "")
+		return nil, false
+	}
+
+	item, err := res.Get(r.Context(), res.DB, k)
+	if err != nil {
+		res.failJSON(w, err, "fetching "+res.noun())
+		return nil, false
+	}
+	if item == nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": res.Label + " not found"})
+		return nil, false
+	}
+	return item, true
+}
+
+func (res *Resource[T]) failJSON(w http.ResponseWriter, err error, action string) {
+	var he *httpError
+	if errors.As(err, &he) {
+		writeJSON(w, he.Code, map[string]string{"error": he.Msg})
+		return
+	}
+	if errors.Is(err, models.ErrInTrash) {
+		writeJSON(w, http.StatusConflict, map[string]string{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, models.ErrMissingParent) {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Error " + action + ": " + err.Error()})
+}
+
+// writeRedacted writes rows of the resource's table, or one row, as JSON
+// without their personal data unless the request reveals it.
+func (res *Resource[T]) writeRedacted(w http.ResponseWriter, r *http.Request, code int, v any) {
+	v, err := redact(r.Context(), res.Table, v)
+	if err != nil {
+		res.failJSON(w, err, "encoding the response")
+		return
+	}
+	writeJSON(w, code, v)
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
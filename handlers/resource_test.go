@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"io"
+	"myapp/models"
+	"myapp/web"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+// templates loads the pages of templates/ with the functions main.go
+// gives them.
+func templates(t *testing.T) TemplateSet {
+	t.Helper()
+	static, err := web.NewStatic(os.DirFS("../static"), "/static/", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	funcs := static.Funcs()
+	funcs["mask"] = models.Mask
+	funcs["pathescape"] = web.PathEscape
+	ts, err := web.NewTemplates(os.DirFS("../templates"), funcs, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ts
+}
+
+// serve answers a request with the routes of res.
+func serve[T any](res *Resource[T], method, target string, body io.Reader) *httptest.ResponseRecorder {
+	mux := http.NewServeMux()
+	res.RegisterRoutes(mux)
+	r := httptest.NewRequest(method, target, body)
+	if body != nil {
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, r)
+	return w
+}
+
+func TestEditPatientDisease(t *testing.T) {
+	res := NewPatientDiseaseHandler(nil, templates(t))
+	res.Get = func(ctx context.Context, db *sql.DB, k Key) (*models.PatientDisease, error) {
+		return &models.PatientDisease{Email: k["email"], DiseaseCode: k["code"], Version: 3}, nil
+	}
+	res.Lookups = []Lookup{
+		lookup("Patients", func(context.Context, *sql.DB) ([]models.Patient, error) {
+			return []models.Patient{{Email: "maria@example.org"}}, nil
+		}),
+		lookup("Diseases", func(context.Context, *sql.DB) ([]models.Disease, error) {
+			return []models.Disease{{DiseaseCode: "A15.0"}, {DiseaseCode: "U07.1"}}, nil
+		}),
+	}
+
+	w := serve(res, "GET", "/patient_diseases/maria@example.org/U07.1/edit", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+	body := w.Body.String()
+	for _, want := range []string{
+		`<input type="hidden" name="version" value="3">`,
+		`<option value="U07.1" selected>`,
+		`<option value="A15.0" >`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("the page has no %s:\n%s", want, body)
+		}
+	}
+}
+
+func TestEditKeepsPersonalData(t *testing.T) {
+	stored := models.User{Email: "ana@example.org", Name: "Ana", Surname: "Diaz", CName: "Spain", Version: 1,
+		Salary: sql.NullInt64{Int64: 1000, Valid: true}, Phone: sql.NullString{String: "+34 600 123 456", Valid: true}}
+	for _, tc := range []struct {
+		name   string
+		reveal bool
+		want   models.User
+	}{
+		{"without revealing", false, stored},
+		{"revealing", true, models.User{Email: stored.Email, Name: "Ana", Surname: "Diaz", CName: "Spain", Version: 1,
+			Salary: sql.NullInt64{Int64: 1, Valid: true}}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var saved *models.User
+			res := NewUserHandler(nil, templates(t))
+			res.Get = func(context.Context, *sql.DB, Key) (*models.User, error) {
+				u := stored
+				return &u, nil
+			}
+			res.Update = func(_ context.Context, _ *sql.DB, _ Key, u *models.User) error {
+				saved = u
+				return nil
+			}
+			res.Verify = nil
+
+			proxies, err := ParseTrustedProxies("10.0.0.0/8")
+			if err != nil {
+				t.Fatal(err)
+			}
+			rt := &Router{mux: http.NewServeMux(), Proxies: proxies, PersonalDataReaders: map[string]bool{"reader": tc.reveal}}
+			rt.Register(res)
+			r := httptest.NewRequest("POST", "/users/ana@example.org/edit?reveal=1",
+				strings.NewReader("version=1&name=Ana&surname=Diaz&cname=Spain&salary=1&phone="))
+			r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			r.Header.Set("X-Forwarded-User", "reader")
+			r.RemoteAddr = "10.0.0.1:1234"
+			w := httptest.NewRecorder()
+			rt.ServeHTTP(w, r)
+			if w.Code != http.StatusSeeOther {
+				t.Fatalf("status %d: %s", w.Code, w.Body)
+			}
+			if saved == nil || *saved != tc.want {
+				t.Errorf("saved %+v, want %+v", saved, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,156 @@
+package handlers
+
+import (
+	"context"
+	"html/template"
+	"myapp/models"
+	"net"
+	"net/http"
+)
+
+// TemplateSet looks up page templates by key, e.g. "records/list".
+type TemplateSet interface {
+	Template(name string) (*template.Template, error)
+}
+
+// RouteRegistrar is implemented by every handler that exposes HTTP routes.
+type RouteRegistrar interface {
+	RegisterRoutes(mux *http.ServeMux)
+}
+
+// Router dispatches requests with method-aware ServeMux patterns. Unknown
+// methods on a known path get the mux's 405 response with an Allow header,
+// and unknown paths get the shared not-found page. With Tenants set, every
+// request runs for its organization, and one that has none is refused.
+// Only requests from Proxies may choose their organization. The users
+// named in PersonalDataReaders, by their X-Forwarded-User, may reveal
+// personal data, and those named in Operators run the deployment: they see
+// every organization's jobs and change the schedules.
+type Router struct {
+	mux                 *http.ServeMux
+	Templates           TemplateSet
+	Tenants             *Tenants
+	Proxies             TrustedProxies
+	PersonalDataReaders map[string]bool
+	Operators           map[string]bool
+}
+
+func NewRouter(templates TemplateSet) *Router {
+	return &Router{
+		mux:       http.NewServeMux(),
+		Templates: templates,
+	}
+}
+
+// Handle registers a handler for a ServeMux pattern such as "GET /static/".
+func (rt *Router) Handle(pattern string, handler http.Handler) {
+	rt.mux.Handle(pattern, handler)
+}
+
+// Register mounts the routes of each registrar.
+func (rt *Router) Register(registrars ...RouteRegistrar) {
+	for _, reg := range registrars {
+		reg.RegisterRoutes(rt.mux)
+	}
+}
+
+func (rt *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	r = rt.withProxy(r)
+	r = r.WithContext(models.WithActor(r.Context(), requestActor(r)))
+	r = rt.withPersonalAccess(r)
+	r = rt.withOperator(r)
+	if rt.Tenants != nil {
+		org, err := rt.Tenants.Resolve(r)
+		if err != nil {
+			http.Error(w, "Error finding the organization: "+err.Error(), tenantStatus(err))
+			return
+		}
+		r = r.WithContext(models.WithTenant(r.Context(), org.ID))
+	}
+
+	if _, pattern := rt.mux.Handler(r); pattern == "" {
+		// No route matched: let the mux answer (405 with Allow, redirects)
+		// but replace its plain-text 404 with the rendered page.
+		rt.mux.ServeHTTP(&notFoundWriter{ResponseWriter: w, r: r, templates: rt.Templates}, r)
+		return
+	}
+	rt.mux.ServeHTTP(w, r)
+}
+
+// requestActor names who is making a request, for audit columns such as
+// deleted_by. The application has no login of its own, so this is the user
+// asserted by a trusted authenticating proxy, or else the client address.
+func requestActor(r *http.Request) string {
+	if user := proxyHeader(r, "X-Forwarded-User"); user != "" {
+		return user
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+type operatorKey struct{}
+
+// withOperator records in r's context whether its user is an operator.
+func (rt *Router) withOperator(r *http.Request) *http.Request {
+	user := proxyHeader(r, "X-Forwarded-User")
+	return r.WithContext(context.WithValue(r.Context(), operatorKey{}, user != "" && rt.Operators[user]))
+}
+
+// isOperator reports whether the user of ctx is an operator.
+func isOperator(ctx context.Context) bool {
+	op, _ := ctx.Value(operatorKey{}).(bool)
+	return op
+}
+
+// notFoundWriter intercepts a 404 status and renders the not-found page in
+// place of whatever body the wrapped handler would have written.
+type notFoundWriter struct {
+	http.ResponseWriter
+	r         *http.Request
+	templates TemplateSet
+	handled   bool
+}
+
+func (nw *notFoundWriter) WriteHeader(code int) {
+	if code == http.StatusNotFound && !nw.handled {
+		nw.handled = true
+		nw.Header().Del("X-Content-Type-Options")
+		notFound(nw.ResponseWriter, nw.r, nw.templates)
+		return
+	}
+	nw.ResponseWriter.WriteHeader(code)
+}
+
+func (nw *notFoundWriter) Write(b []byte) (int, error) {
+	if nw.handled {
+		return len(b), nil
+	}
+	return nw.ResponseWriter.Write(b)
+}
+
+// notFound renders the shared 404 page, falling back to a plain-text
+// response if the template is missing.
+func notFound(w http.ResponseWriter, r *http.Request, templates TemplateSet) {
+	tmpl, err := templates.Template("errors/not_found")
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	data := struct {
+		Title string
+		Path  string
+	}{
+		Title: "Page Not Found",
+		Path:  r.URL.Path,
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusNotFound)
+	if err := tmpl.Execute(w, data); err != nil {
+		http.Error(w, "Error rendering template: "+err.Error(), http.StatusInternalServerError)
+	}
+}
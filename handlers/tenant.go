@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"errors"
+	"myapp/models"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// Errors of Tenants.Resolve.
+var (
+	ErrUnknownOrganization  = errors.New("unknown organization")
+	ErrNoOrganization       = errors.New("the request names no organization")
+	ErrOrganizationMismatch = errors.New("the session's organization is not the one of this address")
+)
+
+// Tenants finds the organization a request is for: the one of the user's
+// session, asserted by the authenticating proxy in the
+// X-Forwarded-Organization header, or else the subdomain of Domain the
+// request was sent to, or else Default. A session may only be used on its
+// own organization's subdomain. Requests that did not come through a
+// trusted proxy are always for Default, since their client could name any
+// organization.
+type Tenants struct {
+	DB      *sql.DB
+	Domain  string // e.g. health.example.org, so that who.health.example.org is organization "who"
+	Default string // slug for requests that name no organization; "" refuses them
+
+	mu   sync.Mutex
+	orgs map[string]*models.Organization // by slug; organizations are never removed
+}
+
+func NewTenants(db *sql.DB, domain, def string) *Tenants {
+	return &Tenants{DB: db, Domain: strings.ToLower(strings.TrimPrefix(domain, ".")), Default: def}
+}
+
+// Resolve returns the organization of r.
+func (ts *Tenants) Resolve(r *http.Request) (*models.Organization, error) {
+	session := strings.ToLower(strings.TrimSpace(proxyHeader(r, "X-Forwarded-Organization")))
+	sub := ""
+	if fromProxy(r) {
+		sub = ts.subdomain(r.Host)
+	}
+	if session != "" && sub != "" && session != sub {
+		return nil, ErrOrganizationMismatch
+	}
+	slug := cmp.Or(session, sub, ts.Default)
+	if slug == "" {
+		return nil, ErrNoOrganization
+	}
+	return ts.lookup(r.Context(), slug)
+}
+
+// subdomain returns the organization slug in host, or "" if host is not a
+// subdomain of Domain.
+func (ts *Tenants) subdomain(host string) string {
+	if ts.Domain == "" {
+		return ""
+	}
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	sub, ok := strings.CutSuffix(strings.ToLower(host), "."+ts.Domain)
+	if !ok || strings.Contains(sub, ".") {
+		return ""
+	}
+	return sub
+}
+
+func (ts *Tenants) lookup(ctx context.Context, slug string) (*models.Organization, error) {
+	ts.mu.Lock()
+	org := ts.orgs[slug]
+	ts.mu.Unlock()
+	if org != nil {
+		return org, nil
+	}
+
+	org, err := models.GetOrganizationBySlug(ctx, ts.DB, slug)
+	if err != nil {
+		return nil, err
+	}
+	if org == nil {
+		return nil, ErrUnknownOrganization
+	}
+	ts.mu.Lock()
+	if ts.orgs == nil {
+		ts.orgs = make(map[string]*models.Organization)
+	}
+	ts.orgs[slug] = org
+	ts.mu.Unlock()
+	return org, nil
+}
+
+// tenantStatus is the response status for an error of Resolve.
+func tenantStatus(err error) int {
+	switch {
+	case errors.Is(err, ErrOrganizationMismatch):
+		return http.StatusForbidden
+	case errors.Is(err, ErrUnknownOrganization):
+		return http.StatusNotFound
+	case errors.Is(err, ErrNoOrganization):
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"myapp/models"
+	"net/http"
+	"strings"
+)
+
+// TrashHandler lists soft-deleted rows and restores them.
+type TrashHandler struct {
+	DB        *sql.DB
+	Templates TemplateSet
+}
+
+func NewTrashHandler(db *sql.DB, templates TemplateSet) *TrashHandler {
+	return &TrashHandler{
+		DB:        db,
+		Templates: templates,
+	}
+}
+
+// RegisterRoutes mounts the trash under /trash.
+func (h *TrashHandler) RegisterRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("GET /trash", h.List)
+	mux.HandleFunc("POST /trash/restore", h.Restore)
+}
+
+// trashRow is a TrashItem prepared for the template.
+type trashRow struct {
+	models.TrashItem
+	Label string // key values joined for display
+}
+
+func (h *TrashHandler) List(w http.ResponseWriter, r *http.Request) {
+	items, err := models.GetTrash(r.Context(), h.DB)
+	if err != nil {
+		http.Error(w, "Error fetching trash: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	rows := make([]trashRow, len(items))
+	for i, item := range items {
+		rows[i] = trashRow{
+			TrashItem: item,
+			Label:     strings.Join(item.Key, " / "),
+		}
+	}
+
+	tmpl, err := h.Templates.Template("trash/list")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	data := struct {
+		Title string
+		Items []trashRow
+	}{
+		Title: "Trash",
+		Items: rows,
+	}
+
+	if err := tmpl.Execute(w, data); err != nil {
+		http.Error(w, "Error rendering template: "+err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func (h *TrashHandler) Restore(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Error parsing form: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err := models.Restore(r.Context(), h.DB, r.PostForm.Get("table"), r.PostForm["key"])
+	var blocked *models.RestoreBlockedError
+	switch {
+	case errors.Is(err, models.ErrNotInTrash):
+		http.Error(w, "Nothing to restore: "+err.Error(), http.StatusNotFound)
+		return
+	case errors.As(err, &blocked):
+		http.Error(w, "Cannot restore: "+err.Error(), http.StatusConflict)
+		return
+	case err != nil:
+		http.Error(w, "Error restoring: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/trash", http.StatusSeeOther)
+}
@@ -0,0 +1,281 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"myapp/models"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// WebhookHandler registers webhooks and shows the deliveries that could
+// not be made. Delivery itself is done by package webhook.
+type WebhookHandler struct {
+	DB        *sql.DB
+	Templates TemplateSet
+}
+
+func NewWebhookHandler(db *sql.DB, templates TemplateSet) *WebhookHandler {
+	return &WebhookHandler{
+		DB:        db,
+		Templates: templates,
+	}
+}
+
+// RegisterRoutes mounts the webhook pages under /webhooks.
+func (h *WebhookHandler) RegisterRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("GET /webhooks", h.List)
+	mux.HandleFunc("POST /webhooks", h.Create)
+	mux.HandleFunc("POST /webhooks/{id}/active", h.SetActive)
+	mux.HandleFunc("POST /webhooks/{id}/ping", h.Ping)
+	mux.HandleFunc("POST /webhooks/{id}/delete", h.Delete)
+	mux.HandleFunc("GET /webhooks/dead", h.Dead)
+	mux.HandleFunc("POST /webhooks/dead/{id}/retry", h.Retry)
+	mux.HandleFunc("POST /webhooks/dead/{id}/discard", h.Discard)
+}
+
+// webhookRow is a Webhook prepared for the template.
+type webhookRow struct {
+	models.Webhook
+	Label  string // label of the table
+	Queued int    // deliveries still to be attempted
+}
+
+func (h *WebhookHandler) List(w http.ResponseWriter, r *http.Request) {
+	h.render(w, r, http.StatusOK, nil, "")
+}
+
+// Create registers a webhook. A secret is generated unless one is given.
+func (h *WebhookHandler) Create(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Error parsing form: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	f := r.PostForm
+
+	x := &models.Webhook{
+		URL:          strings.TrimSpace(f.Get("url")),
+		Secret:       strings.TrimSpace(f.Get("secret")),
+		Entity:       f.Get("entity"),
+		Operations:   f["operations"],
+		IncreaseOnly: f.Get("increase_only") != "",
+		Active:       true,
+	}
+	if column := strings.TrimSpace(f.Get("column")); column != "" {
+		x.Column = sql.NullString{String: column, Valid: true}
+	}
+
+	if problem := checkWebhook(x); problem != "" {
+		h.render(w, r, http.StatusBadRequest, f, problem)
+		return
+	}
+	if x.Secret == "" {
+		key := make([]byte, 24)
+		rand.Read(key)
+		x.Secret = hex.EncodeToString(key)
+	}
+
+	if err := models.CreateWebhook(r.Context(), h.DB, x); err != nil {
+		http.Error(w, "Error creating webhook: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, "/webhooks", http.StatusSeeOther)
+}
+
+// checkWebhook returns what is wrong with a new webhook, or "".
+func checkWebhook(x *models.Webhook) string {
+	u, err := url.Parse(x.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "URL must be an absolute http or https URL."
+	}
+	table := webhookTable(x.Entity)
+	if table == nil {
+		return "Choose the table to watch."
+	}
+	if len(x.Operations) == 0 {
+		return "Choose at least one operation."
+	}
+	for _, op := range x.Operations {
+		if !contains(models.WebhookOperations, op) {
+			return "Unknown operation " + strconv.Quote(op) + "."
+		}
+	}
+	if !x.Column.Valid {
+		if x.IncreaseOnly {
+			return "Name the column whose increases count."
+		}
+		return ""
+	}
+	for _, c := range table.Columns {
+		if c.Name == x.Column.String && c.Personal() {
+			return c.Label + " is personal data, which webhooks are not told about."
+		}
+		if c.Name == x.Column.String {
+			return ""
+		}
+	}
+	return table.Label + " has no column " + strconv.Quote(x.Column.String) + "."
+}
+
+// webhookTable returns the table a webhook entity names.
+func webhookTable(entity string) *models.TableInfo {
+	for _, t := range models.Tables {
+		if strings.ToLower(t.Name) == entity {
+			return t
+		}
+	}
+	return nil
+}
+
+// SetActive pauses or resumes a webhook.
+func (h *WebhookHandler) SetActive(w http.ResponseWriter, r *http.Request) {
+	id, ok := webhookID(w, r)
+	if !ok {
+		return
+	}
+	active, _ := strconv.ParseBool(r.FormValue("active"))
+	h.done(w, r, models.SetWebhookActive(r.Context(), h.DB, id, active), "/webhooks", "Error updating webhook: ")
+}
+
+// Ping queues a test event for a webhook.
+func (h *WebhookHandler) Ping(w http.ResponseWriter, r *http.Request) {
+	id, ok := webhookID(w, r)
+	if !ok {
+		return
+	}
+	h.done(w, r, models.PingWebhook(r.Context(), h.DB, id), "/webhooks", "Error queuing ping: ")
+}
+
+func (h *WebhookHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	id, ok := webhookID(w, r)
+	if !ok {
+		return
+	}
+	h.done(w, r, models.DeleteWebhook(r.Context(), h.DB, id), "/webhooks", "Error deleting webhook: ")
+}
+
+// Dead lists the deliveries given up on after too many failed attempts.
+func (h *WebhookHandler) Dead(w http.ResponseWriter, r *http.Request) {
+	items, err := models.GetDeadWebhookDeliveries(r.Context(), h.DB)
+	if err != nil {
+		http.Error(w, "Error fetching dead deliveries: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	tmpl, err := h.Templates.Template("webhooks/dead")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	data := map[string]any{
+		"Title": "Dead Webhook Deliveries",
+		"Items": items,
+	}
+
+	if err := tmpl.Execute(w, data); err != nil {
+		http.Error(w, "Error rendering template: "+err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// Retry queues a dead delivery again.
+func (h *WebhookHandler) Retry(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid delivery ID", http.StatusBadRequest)
+		return
+	}
+	h.done(w, r, models.RetryWebhookDelivery(r.Context(), h.DB, id), "/webhooks/dead", "Error retrying delivery: ")
+}
+
+func (h *WebhookHandler) Discard(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid delivery ID", http.StatusBadRequest)
+		return
+	}
+	h.done(w, r, models.DiscardWebhookDelivery(r.Context(), h.DB, id), "/webhooks/dead", "Error discarding delivery: ")
+}
+
+func webhookID(w http.ResponseWriter, r *http.Request) (int, bool) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid webhook ID", http.StatusBadRequest)
+		return 0, false
+	}
+	return id, true
+}
+
+// done redirects to back after a successful change, and reports err
+// otherwise.
+func (h *WebhookHandler) done(w http.ResponseWriter, r *http.Request, err error, back, msg string) {
+	switch {
+	case errors.Is(err, models.ErrNoWebhook):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case err != nil:
+		http.Error(w, msg+err.Error(), http.StatusInternalServerError)
+	default:
+		http.Redirect(w, r, back, http.StatusSeeOther)
+	}
+}
+
+// render shows the webhooks and the registration form, filled in with
+// form if it was rejected.
+func (h *WebhookHandler) render(w http.ResponseWriter, r *http.Request, status int, form url.Values, problem string) {
+	hooks, err := models.GetWebhooks(r.Context(), h.DB)
+	if err != nil {
+		http.Error(w, "Error fetching webhooks: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	queued, err := models.WebhookQueue(r.Context(), h.DB)
+	if err != nil {
+		http.Error(w, "Error fetching webhook queue: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	rows := make([]webhookRow, len(hooks))
+	for i, x := range hooks {
+		rows[i] = webhookRow{Webhook: x, Label: x.Entity, Queued: queued[x.ID]}
+		if t := webhookTable(x.Entity); t != nil {
+			rows[i].Label = t.Label
+		}
+	}
+	type entity struct{ Value, Label string }
+	entities := make([]entity, len(models.Tables))
+	for i, t := range models.Tables {
+		entities[i] = entity{strings.ToLower(t.Name), t.Label}
+	}
+	if form == nil {
+		form = url.Values{"operations": models.WebhookOperations}
+	}
+	checked := make(map[string]bool)
+	for _, op := range form["operations"] {
+		checked[op] = true
+	}
+
+	tmpl, err := h.Templates.Template("webhooks/list")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	data := map[string]any{
+		"Title":      "Webhooks",
+		"Webhooks":   rows,
+		"Entities":   entities,
+		"Operations": models.WebhookOperations,
+		"Form":       form,
+		"Checked":    checked,
+		"Problem":    problem,
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	if err := tmpl.Execute(w, data); err != nil {
+		http.Error(w, "Error rendering template: "+err.Error(), http.StatusInternalServerError)
+	}
+}
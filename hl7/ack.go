@@ -0,0 +1,97 @@
+package hl7
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Acknowledgment codes of MSA-1.
+const (
+	Accept = "AA" // processed
+	Fail   = "AE" // processing failed, the sender may retry
+	Reject = "AR" // not acceptable, retrying will not help
+)
+
+// Error is one problem reported in an ERR segment of an acknowledgement.
+type Error struct {
+	// Code is from HL7 table 0357, e.g. 101 for a missing required field.
+	Code int
+	// Location is the element in error, e.g. "PID-11".
+	Location string
+	Text     string
+}
+
+func (e *Error) Error() string {
+	if e.Location != "" {
+		return e.Location + ": " + e.Text
+	}
+	return e.Text
+}
+
+// Error codes of HL7 table 0357 used by this package's users.
+const (
+	ErrRequiredField      = 101
+	ErrDataType           = 102
+	ErrTableValue         = 103
+	ErrUnsupportedMessage = 200
+	ErrUnsupportedEvent   = 201
+	ErrInternal           = 207
+)
+
+var errorNames = map[int]string{
+	ErrRequiredField:      "Required field missing",
+	ErrDataType:           "Data type error",
+	ErrTableValue:         "Table value not found",
+	ErrUnsupportedMessage: "Unsupported message type",
+	ErrUnsupportedEvent:   "Unsupported event code",
+	ErrInternal:           "Application internal error",
+}
+
+// Ack builds the acknowledgement of m: an ACK message with MSA-1 set to
+// code and one ERR segment per error. m may be nil if the received data
+// could not be parsed at all.
+func Ack(m *Message, code, text string, errs ...*Error) *Message {
+	if m == nil {
+		m = &Message{Delims: DefaultDelimiters}
+	}
+	d := m.Delims
+	now := time.Now()
+
+	msh := make([]string, 13)
+	msh[0], msh[1] = "MSH", string(d.Field)
+	msh[2] = string([]byte{d.Component, d.Repetition, d.Escape, d.Subcomponent})
+	if orig, ok := m.Segment("MSH"); ok {
+		// Sender and receiver swap places.
+		at := func(i int) string {
+			if i < len(orig.Fields) {
+				return orig.Fields[i]
+			}
+			return ""
+		}
+		msh[3], msh[4], msh[5], msh[6] = at(5), at(6), at(3), at(4)
+		msh[11], msh[12] = at(11), at(12)
+	}
+	if msh[11] == "" {
+		msh[11] = "P"
+	}
+	if msh[12] == "" {
+		msh[12] = "2.5"
+	}
+	msh[7] = now.Format("20060102150405")
+	_, event := m.Type()
+	msh[9] = "ACK" + string(d.Component) + event + string(d.Component) + "ACK"
+	msh[10] = now.Format("20060102150405") + fmt.Sprintf("%06d", now.Nanosecond()/1000)
+
+	ack := &Message{Delims: d, Segments: []Segment{
+		{Fields: msh},
+		{Fields: []string{"MSA", code, d.Encode(m.ControlID()), d.Encode(text)}},
+	}}
+	for _, e := range errs {
+		severity := "E"
+		errCode := strconv.Itoa(e.Code) + string(d.Component) + d.Encode(errorNames[e.Code]) + string(d.Component) + "HL70357"
+		location := d.Encode(e.Location)
+		ack.Segments = append(ack.Segments, Segment{Fields: []string{"ERR", "", location, errCode, severity, "", "", "", d.Encode(e.Text)}})
+	}
+	return ack
+}
@@ -0,0 +1,77 @@
+package hl7
+
+import "testing"
+
+func TestAck(t *testing.T) {
+	m, err := Parse([]byte("MSH|^~\\&|ADMIT|CLINIC_A|MYAPP|HQ|20240612083000||ADT^A01^ADT_A01|MSG00001|P|2.5\rPID|1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		name, code, text string
+		errs             []*Error
+		wantErr          []string // ERR-2, ERR-3.1, ERR-8 of each error
+	}{
+		{name: "accept", code: Accept},
+		{name: "fail", code: Fail, text: "database down", errs: []*Error{{Code: ErrInternal, Text: "timeout"}},
+			wantErr: []string{"", "207", "timeout"}},
+		{name: "reject", code: Reject, text: "bad|message", errs: []*Error{
+			{Code: ErrRequiredField, Location: "PID-3", Text: "no patient ID"},
+			{Code: ErrTableValue, Location: "PID-8", Text: "sex X^Y"},
+		}, wantErr: []string{"PID-3", "101", "no patient ID", "PID-8", "103", "sex X^Y"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			// An acknowledgement is sent encoded, so check it after a
+			// round trip.
+			ack, err := Parse(Ack(m, tc.code, tc.text, tc.errs...).Bytes())
+			if err != nil {
+				t.Fatal(err)
+			}
+			for location, want := range map[string]string{
+				"MSH-3":   "MYAPP",
+				"MSH-4":   "HQ",
+				"MSH-5":   "ADMIT",
+				"MSH-6":   "CLINIC_A",
+				"MSH-9.1": "ACK",
+				"MSH-9.2": "A01",
+				"MSH-11":  "P",
+				"MSH-12":  "2.5",
+				"MSA-1":   tc.code,
+				"MSA-2":   "MSG00001",
+				"MSA-3":   tc.text,
+			} {
+				if got := ack.Get(location); got != want {
+					t.Errorf("%s = %q, want %q", location, got, want)
+				}
+			}
+			var got []string
+			for _, s := range ack.All("ERR") {
+				got = append(got, ack.Field(s, "2"), ack.Field(s, "3.1"), ack.Field(s, "8"))
+			}
+			if len(got) != len(tc.wantErr) {
+				t.Fatalf("ERR segments %q, want %q", got, tc.wantErr)
+			}
+			for i := range got {
+				if got[i] != tc.wantErr[i] {
+					t.Errorf("ERR segments %q, want %q", got, tc.wantErr)
+					break
+				}
+			}
+		})
+	}
+}
+
+func TestAckUnparsed(t *testing.T) {
+	ack, err := Parse(Ack(nil, Reject, "not HL7").Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ack.Delims != DefaultDelimiters {
+		t.Errorf("delimiters %+v", ack.Delims)
+	}
+	for location, want := range map[string]string{"MSH-9.1": "ACK", "MSH-11": "P", "MSH-12": "2.5", "MSA-1": Reject, "MSA-2": ""} {
+		if got := ack.Get(location); got != want {
+			t.Errorf("%s = %q, want %q", location, got, want)
+		}
+	}
+}
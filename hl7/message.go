@@ -0,0 +1,290 @@
+// Package hl7 parses and builds HL7 version 2 messages in the usual
+// pipe-delimited encoding, and frames them for MLLP, the minimal lower
+// layer protocol HL7 v2 is exchanged over TCP with.
+package hl7
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Delimiters are the separators declared in MSH-1 and MSH-2.
+type Delimiters struct {
+	Field, Component, Repetition, Escape, Subcomponent byte
+}
+
+// DefaultDelimiters are the ones nearly every system uses: |^~\&.
+var DefaultDelimiters = Delimiters{'|', '^', '~', '\\', '&'}
+
+// Message is a parsed message: its segments in order, each a list of
+// fields. Field values are kept encoded; Get splits and unescapes them.
+type Message struct {
+	Delims   Delimiters
+	Segments []Segment
+}
+
+// Segment is one segment. Fields[0] is the segment name; for MSH,
+// Fields[1] is the field separator itself so field numbers match the
+// standard's (MSH-9 is Fields[9]).
+type Segment struct {
+	Fields []string
+}
+
+// Name returns the segment ID, e.g. "PID".
+func (s Segment) Name() string {
+	if len(s.Fields) == 0 {
+		return ""
+	}
+	return s.Fields[0]
+}
+
+// ErrNoHeader is returned for data that does not start with an MSH segment.
+var ErrNoHeader = errors.New("hl7: message does not start with an MSH segment")
+
+// Parse parses one message. Segments may be separated by CR, LF or CRLF.
+func Parse(data []byte) (*Message, error) {
+	data = bytes.TrimSpace(data)
+	if len(data) < 8 || !bytes.HasPrefix(data, []byte("MSH")) {
+		return nil, ErrNoHeader
+	}
+	m := &Message{Delims: Delimiters{
+		Field:        data[3],
+		Component:    data[4],
+		Repetition:   data[5],
+		Escape:       data[6],
+		Subcomponent: data[7],
+	}}
+
+	for _, line := range splitSegments(data) {
+		fields := strings.Split(line, string(m.Delims.Field))
+		if fields[0] == "MSH" {
+			// MSH-1 is the separator between "MSH" and MSH-2.
+			fields = append([]string{"MSH", string(m.Delims.Field)}, fields[1:]...)
+		}
+		if len(fields[0]) != 3 {
+			return nil, fmt.Errorf("hl7: bad segment %q", truncate(line, 20))
+		}
+		m.Segments = append(m.Segments, Segment{Fields: fields})
+	}
+	return m, nil
+}
+
+// Split cuts data holding several messages, e.g. an uploaded file, into
+// single messages. Batch and file header and trailer segments (FHS, BHS,
+// BTS, FTS) are dropped.
+func Split(data []byte) [][]byte {
+	var msgs [][]byte
+	var cur []string
+	flush := func() {
+		if len(cur) > 0 {
+			msgs = append(msgs, []byte(strings.Join(cur, "\r")))
+			cur = nil
+		}
+	}
+	for _, line := range splitSegments(data) {
+		switch {
+		case strings.HasPrefix(line, "FHS"), strings.HasPrefix(line, "BHS"),
+			strings.HasPrefix(line, "BTS"), strings.HasPrefix(line, "FTS"):
+			flush()
+		case strings.HasPrefix(line, "MSH"):
+			flush()
+			cur = append(cur, line)
+		default:
+			cur = append(cur, line)
+		}
+	}
+	flush()
+	return msgs
+}
+
+func splitSegments(data []byte) []string {
+	s := strings.ReplaceAll(string(data), "\r\n", "\r")
+	s = strings.ReplaceAll(s, "\n", "\r")
+	var lines []string
+	for _, line := range strings.Split(s, "\r") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// All returns the segments named name.
+func (m *Message) All(name string) []Segment {
+	var out []Segment
+	for _, s := range m.Segments {
+		if s.Name() == name {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// Segment returns the first segment named name.
+func (m *Message) Segment(name string) (Segment, bool) {
+	for _, s := range m.Segments {
+		if s.Name() == name {
+			return s, true
+		}
+	}
+	return Segment{}, false
+}
+
+// Get returns a value of the first segment named like the location, see
+// Field, or "".
+func (m *Message) Get(location string) string {
+	name, rest, _ := strings.Cut(location, "-")
+	s, ok := m.Segment(name)
+	if !ok {
+		return ""
+	}
+	return m.Field(s, rest)
+}
+
+// Field returns a value of s at a location like "5", "5.2" or "5.2.1"
+// (field, component, subcomponent), from the first repetition of the
+// field, unescaped. Missing values are "".
+func (m *Message) Field(s Segment, location string) string {
+	reps := m.Repetitions(s, location)
+	if len(reps) == 0 {
+		return ""
+	}
+	return reps[0]
+}
+
+// Repetitions returns the value at location from every repetition of the
+// field, unescaped.
+func (m *Message) Repetitions(s Segment, location string) []string {
+	parts := strings.Split(location, ".")
+	n, err := strconv.Atoi(strings.TrimPrefix(parts[0], s.Name()+"-"))
+	if err != nil || n < 1 || n >= len(s.Fields) {
+		return nil
+	}
+	field := s.Fields[n]
+	if s.Name() == "MSH" && n <= 2 {
+		return []string{field}
+	}
+
+	// Component and subcomponent default to the first, so asking for a
+	// whole field gives its value when it has no components.
+	comp, sub := 1, 1
+	if len(parts) > 1 {
+		if comp, err = strconv.Atoi(parts[1]); err != nil || comp < 1 {
+			return nil
+		}
+	}
+	if len(parts) > 2 {
+		if sub, err = strconv.Atoi(parts[2]); err != nil || sub < 1 {
+			return nil
+		}
+	}
+
+	var out []string
+	for _, rep := range strings.Split(field, string(m.Delims.Repetition)) {
+		out = append(out, m.unescape(nth(nth(rep, m.Delims.Component, comp), m.Delims.Subcomponent, sub)))
+	}
+	return out
+}
+
+// nth returns the n-th (from 1) piece of s split at sep, or "".
+func nth(s string, sep byte, n int) string {
+	pieces := strings.Split(s, string(sep))
+	if n > len(pieces) {
+		return ""
+	}
+	return pieces[n-1]
+}
+
+// unescape decodes the escape sequences for the delimiters themselves;
+// formatting and hex escapes are dropped.
+func (m *Message) unescape(v string) string {
+	esc := string(m.Delims.Escape)
+	if !strings.Contains(v, esc) {
+		return v
+	}
+	var b strings.Builder
+	for {
+		i := strings.Index(v, esc)
+		if i < 0 {
+			b.WriteString(v)
+			return b.String()
+		}
+		b.WriteString(v[:i])
+		v = v[i+1:]
+		j := strings.Index(v, esc)
+		if j < 0 {
+			b.WriteString(esc + v)
+			return b.String()
+		}
+		switch v[:j] {
+		case "F":
+			b.WriteByte(m.Delims.Field)
+		case "S":
+			b.WriteByte(m.Delims.Component)
+		case "R":
+			b.WriteByte(m.Delims.Repetition)
+		case "E":
+			b.WriteByte(m.Delims.Escape)
+		case "T":
+			b.WriteByte(m.Delims.Subcomponent)
+		}
+		v = v[j+1:]
+	}
+}
+
+// Encode escapes the delimiters in a plain value.
+func (d Delimiters) Encode(v string) string {
+	var b strings.Builder
+	for i := 0; i < len(v); i++ {
+		switch v[i] {
+		case d.Escape:
+			b.WriteString(string(d.Escape) + "E" + string(d.Escape))
+		case d.Field:
+			b.WriteString(string(d.Escape) + "F" + string(d.Escape))
+		case d.Component:
+			b.WriteString(string(d.Escape) + "S" + string(d.Escape))
+		case d.Repetition:
+			b.WriteString(string(d.Escape) + "R" + string(d.Escape))
+		case d.Subcomponent:
+			b.WriteString(string(d.Escape) + "T" + string(d.Escape))
+		default:
+			b.WriteByte(v[i])
+		}
+	}
+	return b.String()
+}
+
+// Bytes encodes the message with CR segment terminators.
+func (m *Message) Bytes() []byte {
+	var b bytes.Buffer
+	for _, s := range m.Segments {
+		fields := s.Fields
+		if s.Name() == "MSH" && len(fields) > 1 {
+			fields = append([]string{"MSH"}, fields[2:]...)
+		}
+		b.WriteString(strings.Join(fields, string(m.Delims.Field)))
+		b.WriteByte('\r')
+	}
+	return b.Bytes()
+}
+
+// Type returns the message type and trigger event from MSH-9, e.g. "ADT"
+// and "A01".
+func (m *Message) Type() (string, string) {
+	return m.Get("MSH-9.1"), m.Get("MSH-9.2")
+}
+
+// ControlID returns MSH-10, which the acknowledgement refers to.
+func (m *Message) ControlID() string {
+	return m.Get("MSH-10")
+}
+
+func truncate(s string, n int) string {
+	if len(s) > n {
+		return s[:n] + "..."
+	}
+	return s
+}
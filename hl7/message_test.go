@@ -0,0 +1,131 @@
+package hl7
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	sample, err := os.ReadFile("samples/adt_a01.hl7")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		name, data, location, want string
+	}{
+		{"sample type", string(sample), "MSH-9.1", "ADT"},
+		{"sample event", string(sample), "MSH-9.2", "A01"},
+		{"sample control ID", string(sample), "MSH-10", "MSG00001"},
+		{"field separator", string(sample), "MSH-1", "|"},
+		{"encoding characters", string(sample), "MSH-2", `^~\&`},
+		{"component", string(sample), "PID-5.2", "Maria"},
+		{"first repetition", string(sample), "PID-13.4", "maria.garcia@example.org"},
+		{"first of several segments", string(sample), "DG1-3.1", "A15.0"},
+		{"missing field", string(sample), "PID-99", ""},
+		{"missing segment", string(sample), "OBX-5", ""},
+		{"LF separated", "MSH|^~\\&|A|B\nPID|1||X^Y", "PID-3.2", "Y"},
+		{"CRLF separated", "MSH|^~\\&|A|B\r\nPID|1||X^Y\r\n", "PID-3.1", "X"},
+		{"subcomponent", "MSH|^~\\&|A|B\rPID|1||X^Y&Z", "PID-3.2.2", "Z"},
+		{"other delimiters", "MSH#:*!@#A#B\rPID#1##X:Y", "PID-3.2", "Y"},
+		{"escaped field separator", `MSH|^~\&|A|B` + "\r" + `PID|1||a\F\b`, "PID-3", "a|b"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			m, err := Parse([]byte(tc.data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := m.Get(tc.location); got != tc.want {
+				t.Errorf("%s = %q, want %q", tc.location, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, data := range []string{"", "PID|1", "MSH|", "MSH|^~\\&|A\rPIDX|1"} {
+		if m, err := Parse([]byte(data)); err == nil {
+			t.Errorf("Parse(%q) = %+v, want an error", data, m)
+		}
+	}
+}
+
+func TestRepetitions(t *testing.T) {
+	m, err := Parse([]byte("MSH|^~\\&|A|B\rPID|1||X^1~Y^2~Z"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, _ := m.Segment("PID")
+	if got, want := m.Repetitions(s, "3.2"), []string{"1", "2", ""}; !reflect.DeepEqual(got, want) {
+		t.Errorf("PID-3.2 repetitions = %q, want %q", got, want)
+	}
+}
+
+func TestSplit(t *testing.T) {
+	for _, tc := range []struct {
+		name, data string
+		want       []string
+	}{
+		{"one", "MSH|^~\\&|A\rPID|1", []string{"MSH|^~\\&|A\rPID|1"}},
+		{"two", "MSH|^~\\&|A\rPID|1\nMSH|^~\\&|B\r\nPID|2\r\n", []string{"MSH|^~\\&|A\rPID|1", "MSH|^~\\&|B\rPID|2"}},
+		{"batch", "FHS|^~\\&\rBHS|^~\\&\rMSH|^~\\&|A\rPID|1\rBTS|1\rFTS|1", []string{"MSH|^~\\&|A\rPID|1"}},
+		{"blank lines", "\n\nMSH|^~\\&|A\n\n\nPID|1\n\n", []string{"MSH|^~\\&|A\rPID|1"}},
+		{"empty", "", nil},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var got []string
+			for _, msg := range Split([]byte(tc.data)) {
+				got = append(got, string(msg))
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("Split = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestEscape(t *testing.T) {
+	m := &Message{Delims: DefaultDelimiters}
+	for _, tc := range []struct {
+		plain, encoded string
+	}{
+		{"plain", "plain"},
+		{"a|b", `a\F\b`},
+		{"a^b", `a\S\b`},
+		{"a~b", `a\R\b`},
+		{`a\b`, `a\E\b`},
+		{"a&b", `a\T\b`},
+		{`|^~\&`, `\F\\S\\R\\E\\T\`},
+	} {
+		if got := DefaultDelimiters.Encode(tc.plain); got != tc.encoded {
+			t.Errorf("Encode(%q) = %q, want %q", tc.plain, got, tc.encoded)
+		}
+		if got := m.unescape(tc.encoded); got != tc.plain {
+			t.Errorf("unescape(%q) = %q, want %q", tc.encoded, got, tc.plain)
+		}
+	}
+
+	// Formatting and hex escapes are dropped, and an unterminated escape
+	// is kept as it is.
+	for encoded, want := range map[string]string{
+		`bold \H\text\N\`: "bold text",
+		`\X0D\end`:        "end",
+		`open \F`:         `open \F`,
+	} {
+		if got := m.unescape(encoded); got != want {
+			t.Errorf("unescape(%q) = %q, want %q", encoded, got, want)
+		}
+	}
+}
+
+func TestBytes(t *testing.T) {
+	data := "MSH|^~\\&|A|B\rPID|1||X^Y"
+	m, err := Parse([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(m.Bytes()); got != data+"\r" {
+		t.Errorf("Bytes = %q", strings.ReplaceAll(got, "\r", `\r`))
+	}
+}
@@ -0,0 +1,201 @@
+package hl7
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"sync"
+	"time"
+)
+
+// MLLP frame bytes: <VT> message <FS><CR>.
+const (
+	startBlock = 0x0b
+	endBlock   = 0x1c
+	trailer    = 0x0d
+)
+
+// MaxFrameSize bounds a received message.
+const MaxFrameSize = 16 << 20
+
+// ErrFrameTooLarge is returned by ReadFrame for messages over MaxFrameSize.
+var ErrFrameTooLarge = errors.New("hl7: MLLP frame too large")
+
+// ReadFrame reads the next MLLP framed message, skipping anything before
+// its start block.
+func ReadFrame(r *bufio.Reader) ([]byte, error) {
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		if b == startBlock {
+			break
+		}
+	}
+	var msg []byte
+	for {
+		b, err := r.ReadByte()
+		if err == io.EOF {
+			return nil, io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return nil, err
+		}
+		if b == endBlock {
+			// The trailing CR is required but some senders omit it, so
+			// it is only taken if it has arrived: waiting for it would
+			// hold the acknowledgement the sender is waiting for. A CR
+			// arriving later is skipped before the next start block.
+			if r.Buffered() > 0 {
+				if next, _ := r.Peek(1); next[0] == trailer {
+					r.ReadByte()
+				}
+			}
+			return msg, nil
+		}
+		if len(msg) >= MaxFrameSize {
+			return nil, ErrFrameTooLarge
+		}
+		msg = append(msg, b)
+	}
+}
+
+// WriteFrame writes msg as one MLLP frame.
+func WriteFrame(w io.Writer, msg []byte) error {
+	frame := make([]byte, 0, len(msg)+3)
+	frame = append(frame, startBlock)
+	frame = append(frame, msg...)
+	frame = append(frame, endBlock, trailer)
+	_, err := w.Write(frame)
+	return err
+}
+
+// A Handler processes one received message and returns the encoded
+// acknowledgement to send back.
+type Handler interface {
+	ServeHL7(ctx context.Context, msg []byte) []byte
+}
+
+// HandlerFunc adapts a function to Handler.
+type HandlerFunc func(ctx context.Context, msg []byte) []byte
+
+func (f HandlerFunc) ServeHL7(ctx context.Context, msg []byte) []byte { return f(ctx, msg) }
+
+// Server accepts MLLP connections and answers every message with the
+// acknowledgement returned by Handler, one message at a time per
+// connection.
+type Server struct {
+	Addr    string
+	Handler Handler
+
+	// IdleTimeout closes connections that send nothing for this long; zero
+	// means no timeout.
+	IdleTimeout time.Duration
+
+	mu       sync.Mutex
+	listener net.Listener
+	conns    map[net.Conn]struct{}
+	closed   bool
+	wg       sync.WaitGroup
+}
+
+// ErrServerClosed is returned by Serve after Close.
+var ErrServerClosed = errors.New("hl7: server closed")
+
+func (s *Server) ListenAndServe() error {
+	l, err := net.Listen("tcp", s.Addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(l)
+}
+
+// Serve accepts connections on l until Close is called.
+func (s *Server) Serve(l net.Listener) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		l.Close()
+		return ErrServerClosed
+	}
+	s.listener = l
+	s.conns = make(map[net.Conn]struct{})
+	s.mu.Unlock()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			s.mu.Unlock()
+			if closed {
+				return ErrServerClosed
+			}
+			var ne net.Error
+			if errors.As(err, &ne) && ne.Timeout() {
+				time.Sleep(100 * time.Millisecond)
+				continue
+			}
+			return err
+		}
+
+		s.mu.Lock()
+		s.conns[conn] = struct{}{}
+		s.wg.Add(1)
+		s.mu.Unlock()
+		go s.serveConn(conn)
+	}
+}
+
+func (s *Server) serveConn(conn net.Conn) {
+	defer func() {
+		conn.Close()
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+		s.wg.Done()
+	}()
+
+	r := bufio.NewReader(conn)
+	for {
+		if s.IdleTimeout > 0 {
+			conn.SetReadDeadline(time.Now().Add(s.IdleTimeout))
+		}
+		msg, err := ReadFrame(r)
+		if err != nil {
+			var ne net.Error
+			if err != io.EOF && !errors.Is(err, net.ErrClosed) && !(errors.As(err, &ne) && ne.Timeout()) {
+				log.Printf("MLLP %s: %v", conn.RemoteAddr(), err)
+			}
+			return
+		}
+		ack := s.Handler.ServeHL7(context.Background(), msg)
+		if err := WriteFrame(conn, ack); err != nil {
+			log.Printf("MLLP %s: %v", conn.RemoteAddr(), err)
+			return
+		}
+	}
+}
+
+// Close stops accepting connections, closes the open ones and waits for
+// the messages being processed to be acknowledged.
+func (s *Server) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	var err error
+	if s.listener != nil {
+		err = s.listener.Close()
+	}
+	for conn := range s.conns {
+		// Unblock the idle reads; a message being processed is still
+		// acknowledged before its connection closes.
+		conn.SetReadDeadline(time.Now())
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+	return err
+}
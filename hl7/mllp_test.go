@@ -0,0 +1,89 @@
+package hl7
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadFrame(t *testing.T) {
+	for _, tc := range []struct {
+		name, data string
+		want       []string
+		err        error // after the frames
+	}{
+		{"one", "\x0bMSH|A\x1c\r", []string{"MSH|A"}, io.EOF},
+		{"two", "\x0bMSH|A\x1c\r\x0bMSH|B\x1c\r", []string{"MSH|A", "MSH|B"}, io.EOF},
+		{"without the CR", "\x0bMSH|A\x1c\x0bMSH|B\x1c", []string{"MSH|A", "MSH|B"}, io.EOF},
+		{"noise before the start", "junk\r\n\x0bMSH|A\x1c\r", []string{"MSH|A"}, io.EOF},
+		{"segments", "\x0bMSH|A\rPID|1\r\x1c\r", []string{"MSH|A\rPID|1\r"}, io.EOF},
+		{"cut short", "\x0bMSH|A\x1c\r\x0bMSH|B", []string{"MSH|A"}, io.ErrUnexpectedEOF},
+		{"empty", "", nil, io.EOF},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r := bufio.NewReader(strings.NewReader(tc.data))
+			var got []string
+			var err error
+			for {
+				var msg []byte
+				if msg, err = ReadFrame(r); err != nil {
+					break
+				}
+				got = append(got, string(msg))
+			}
+			if strings.Join(got, "\n") != strings.Join(tc.want, "\n") {
+				t.Errorf("read %q, want %q", got, tc.want)
+			}
+			if err != tc.err {
+				t.Errorf("ended with %v, want %v", err, tc.err)
+			}
+		})
+	}
+}
+
+// A sender that omits the CR waits for the acknowledgement before sending
+// anything else, so the frame must be returned without waiting for more.
+func TestReadFrameWithoutCR(t *testing.T) {
+	pr, pw := io.Pipe()
+	defer pw.Close()
+	go pw.Write([]byte("\x0bMSH|A\x1c"))
+
+	done := make(chan string, 1)
+	go func() {
+		msg, _ := ReadFrame(bufio.NewReader(pr))
+		done <- string(msg)
+	}()
+	select {
+	case msg := <-done:
+		if msg != "MSH|A" {
+			t.Errorf("read %q", msg)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("ReadFrame waited for the CR")
+	}
+}
+
+func TestReadFrameTooLarge(t *testing.T) {
+	data := append([]byte{startBlock}, bytes.Repeat([]byte("x"), MaxFrameSize+1)...)
+	if _, err := ReadFrame(bufio.NewReader(bytes.NewReader(data))); !errors.Is(err, ErrFrameTooLarge) {
+		t.Errorf("got %v, want ErrFrameTooLarge", err)
+	}
+}
+
+func TestWriteFrame(t *testing.T) {
+	var b bytes.Buffer
+	if err := WriteFrame(&b, []byte("MSH|A")); err != nil {
+		t.Fatal(err)
+	}
+	msg, err := ReadFrame(bufio.NewReader(&b))
+	if err != nil || string(msg) != "MSH|A" {
+		t.Errorf("read back %q, %v", msg, err)
+	}
+	if b.Len() != 0 {
+		t.Errorf("%d bytes left after the frame", b.Len())
+	}
+}
@@ -0,0 +1,108 @@
+// Package icd reads the official ICD-10-CM and ICD-11 MMS tabular files
+// into catalog rows for models.ImportICD.
+package icd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"myapp/models"
+	"strings"
+)
+
+// icd10Chapters are the ICD-10-CM chapters with the first and last
+// three-character category of each.
+var icd10Chapters = []struct {
+	Chapter, First, Last, Title string
+}{
+	{"I", "A00", "B99", "Certain infectious and parasitic diseases"},
+	{"II", "C00", "D49", "Neoplasms"},
+	{"III", "D50", "D89", "Diseases of the blood and blood-forming organs and certain disorders involving the immune mechanism"},
+	{"IV", "E00", "E89", "Endocrine, nutritional and metabolic diseases"},
+	{"V", "F01", "F99", "Mental, Behavioral and Neurodevelopmental disorders"},
+	{"VI", "G00", "G99", "Diseases of the nervous system"},
+	{"VII", "H00", "H59", "Diseases of the eye and adnexa"},
+	{"VIII", "H60", "H95", "Diseases of the ear and mastoid process"},
+	{"IX", "I00", "I99", "Diseases of the circulatory system"},
+	{"X", "J00", "J99", "Diseases of the respiratory system"},
+	{"XI", "K00", "K95", "Diseases of the digestive system"},
+	{"XII", "L00", "L99", "Diseases of the skin and subcutaneous tissue"},
+	{"XIII", "M00", "M99", "Diseases of the musculoskeletal system and connective tissue"},
+	{"XIV", "N00", "N99", "Diseases of the genitourinary system"},
+	{"XV", "O00", "O9A", "Pregnancy, childbirth and the puerperium"},
+	{"XVI", "P00", "P96", "Certain conditions originating in the perinatal period"},
+	{"XVII", "Q00", "Q99", "Congenital malformations, deformations and chromosomal abnormalities"},
+	{"XVIII", "R00", "R99", "Symptoms, signs and abnormal clinical and laboratory findings, not elsewhere classified"},
+	{"XIX", "S00", "T88", "Injury, poisoning and certain other consequences of external causes"},
+	{"XX", "V00", "Y99", "External causes of morbidity"},
+	{"XXI", "Z00", "Z99", "Factors influencing health status and contact with health services"},
+	{"XXII", "U00", "U85", "Codes for special purposes"},
+}
+
+func icd10Chapter(code string) (string, bool) {
+	if len(code) < 3 {
+		return "", false
+	}
+	category := code[:3]
+	for _, ch := range icd10Chapters {
+		if category >= ch.First && category <= ch.Last {
+			return ch.Chapter, true
+		}
+	}
+	return "", false
+}
+
+// ReadICD10 parses the ICD-10-CM order file (icd10cm_order_<year>.txt), a
+// fixed-width file with one code per line:
+//
+//	00001 A00     0 Cholera                                                      Cholera
+//
+// The columns are the order number, the code without its dot, a flag that
+// is 1 for billable codes, the short title and the long title. Codes are
+// returned in dotted form, e.g. A00.0.
+func ReadICD10(r io.Reader) ([]models.ICDChapter, []models.ICDCode, error) {
+	var codes []models.ICDCode
+	used := make(map[string]bool)
+
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimRight(sc.Text(), "\r")
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		if len(line) < 17 {
+			return nil, nil, fmt.Errorf("line %d: too short for the order file format", n)
+		}
+
+		raw := strings.TrimSpace(line[6:13])
+		title := ""
+		if len(line) > 77 {
+			title = strings.TrimSpace(line[77:])
+		} else {
+			title = strings.TrimSpace(line[16:])
+		}
+		chapter, ok := icd10Chapter(raw)
+		if !ok || title == "" {
+			return nil, nil, fmt.Errorf("line %d: invalid code %q", n, raw)
+		}
+
+		code := raw
+		if len(code) > 3 {
+			code = code[:3] + "." + code[3:]
+		}
+		codes = append(codes, models.ICDCode{Code: code, Title: title, Chapter: chapter})
+		used[chapter] = true
+	}
+	if err := sc.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	var chapters []models.ICDChapter
+	for _, ch := range icd10Chapters {
+		if used[ch.Chapter] {
+			chapters = append(chapters, models.ICDChapter{Chapter: ch.Chapter, Title: ch.Title})
+		}
+	}
+	return chapters, codes, nil
+}
@@ -0,0 +1,68 @@
+package icd
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"myapp/models"
+	"strings"
+)
+
+// ReadICD11 parses the tab-separated ICD-11 MMS linearization published by
+// the WHO (LinearizationMiniOutput-MMS-en.txt). The header row names the
+// columns; Code, Title, ClassKind and ChapterNo are used. Chapter rows give
+// the chapter titles and every row with a code becomes a catalog entry.
+// Titles lose the leading dashes that show their depth.
+func ReadICD11(r io.Reader) ([]models.ICDChapter, []models.ICDCode, error) {
+	cr := csv.NewReader(r)
+	cr.Comma = '\t'
+	cr.LazyQuotes = true
+	cr.FieldsPerRecord = -1
+
+	header, err := cr.Read()
+	if err != nil {
+		return nil, nil, fmt.Errorf("reading header: %w", err)
+	}
+	col := make(map[string]int)
+	for i, name := range header {
+		col[strings.TrimSpace(strings.TrimPrefix(name, "\ufeff"))] = i
+	}
+	for _, name := range []string{"Code", "Title", "ClassKind", "ChapterNo"} {
+		if _, ok := col[name]; !ok {
+			return nil, nil, fmt.Errorf("missing column %s", name)
+		}
+	}
+	get := func(rec []string, name string) string {
+		if i := col[name]; i < len(rec) {
+			return strings.TrimSpace(rec[i])
+		}
+		return ""
+	}
+
+	var chapters []models.ICDChapter
+	var codes []models.ICDCode
+	for {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+
+		title := strings.TrimSpace(strings.TrimLeft(get(rec, "Title"), "- "))
+		chapter := get(rec, "ChapterNo")
+		if get(rec, "ClassKind") == "chapter" {
+			chapters = append(chapters, models.ICDChapter{Chapter: chapter, Title: title})
+			continue
+		}
+		if code := get(rec, "Code"); code != "" {
+			if chapter == "" {
+				line, _ := cr.FieldPos(0)
+				return nil, nil, fmt.Errorf("line %d: code %s has no chapter", line, code)
+			}
+			codes = append(codes, models.ICDCode{Code: code, Title: title, Chapter: chapter})
+		}
+	}
+	return chapters, codes, nil
+}
@@ -0,0 +1,100 @@
+// Package iso3166 bundles the ISO 3166-1 country list with its alpha-2,
+// alpha-3 and numeric codes, plus common alternative names, so free-text
+// country names can be matched to a single country.
+package iso3166
+
+import (
+	_ "embed"
+	"encoding/csv"
+	"strings"
+	"unicode"
+)
+
+// Country is one entry of ISO 3166-1. Name is the common English short
+// name, e.g. "United States".
+type Country struct {
+	Alpha2  string
+	Alpha3  string
+	Numeric string
+	Name    string
+}
+
+var (
+	//go:embed countries.csv
+	countriesCSV string
+	//go:embed aliases.csv
+	aliasesCSV string
+
+	countries []Country
+	byKey     = make(map[string]int) // name and alias keys
+	byCode    = make(map[string]int) // upper-case alpha-2, alpha-3 and numeric codes
+)
+
+func init() {
+	for _, rec := range readCSV(countriesCSV) {
+		c := Country{Alpha2: rec[0], Alpha3: rec[1], Numeric: rec[2], Name: rec[3]}
+		i := len(countries)
+		countries = append(countries, c)
+		byKey[Key(c.Name)] = i
+		byCode[c.Alpha2], byCode[c.Alpha3], byCode[c.Numeric] = i, i, i
+	}
+	for _, rec := range readCSV(aliasesCSV) {
+		i, ok := byCode[rec[1]]
+		if !ok {
+			panic("iso3166: alias " + rec[0] + " names unknown code " + rec[1])
+		}
+		byKey[Key(rec[0])] = i
+	}
+}
+
+// readCSV parses an embedded data file, skipping the header line.
+func readCSV(data string) [][]string {
+	recs, err := csv.NewReader(strings.NewReader(data)).ReadAll()
+	if err != nil {
+		panic("iso3166: " + err.Error())
+	}
+	return recs[1:]
+}
+
+// All returns every country, ordered by alpha-2 code.
+func All() []Country {
+	return append([]Country(nil), countries...)
+}
+
+// Lookup finds the country named s, which may be its name, a known
+// alternative name or one of its codes. Case, accents, punctuation and a
+// leading "The" are ignored.
+func Lookup(s string) (Country, bool) {
+	if i, ok := byKey[Key(s)]; ok {
+		return countries[i], true
+	}
+	if i, ok := byCode[strings.ToUpper(strings.TrimSpace(s))]; ok {
+		return countries[i], true
+	}
+	return Country{}, false
+}
+
+var accents = strings.NewReplacer(
+	"à", "a", "á", "a", "â", "a", "ã", "a", "ä", "a", "å", "a",
+	"ç", "c",
+	"è", "e", "é", "e", "ê", "e", "ë", "e",
+	"ì", "i", "í", "i", "î", "i", "ï", "i",
+	"ñ", "n",
+	"ò", "o", "ó", "o", "ô", "o", "õ", "o", "ö", "o",
+	"ù", "u", "ú", "u", "û", "u", "ü", "u",
+	"ý", "y", "ÿ", "y",
+)
+
+// Key reduces a country name to the form used for matching, e.g.
+// "The Côte d'Ivoire" and "cote divoire" both become "cotedivoire".
+func Key(name string) string {
+	name = accents.Replace(strings.ToLower(strings.TrimSpace(name)))
+	name = strings.TrimPrefix(name, "the ")
+	var b strings.Builder
+	for _, r := range name {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,193 @@
+package job
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Cron is a parsed cron spec: five fields, minute, hour, day of month,
+// month and day of week, each "*", a value, a range "a-b" or a list of
+// them, optionally with a step, as in "*/15" or "1-5/2". Months and days
+// of the week can be given by their English abbreviation, and Sunday is
+// 0 or 7. As in Vixie cron, when both days are restricted a time matching
+// either matches. The specs @yearly, @monthly, @weekly, @daily, @hourly
+// and "@every <duration>" are also accepted.
+type Cron struct {
+	minute, hour, dom, month, dow uint64
+	domStar, dowStar              bool
+
+	every time.Duration
+}
+
+var cronShorthands = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+var (
+	monthNames = map[string]int{"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12}
+	dayNames = map[string]int{"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6}
+)
+
+// ParseCron parses a cron spec.
+func ParseCron(spec string) (*Cron, error) {
+	spec = strings.TrimSpace(spec)
+	if d, ok := strings.CutPrefix(spec, "@every "); ok {
+		every, err := time.ParseDuration(strings.TrimSpace(d))
+		if err != nil || every < time.Second {
+			return nil, fmt.Errorf("cron %q: @every needs a duration of at least 1s", spec)
+		}
+		return &Cron{every: every}, nil
+	}
+	if s, ok := cronShorthands[strings.ToLower(spec)]; ok {
+		spec = s
+	}
+
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("cron %q: want 5 fields, got %d", spec, len(fields))
+	}
+	c := &Cron{}
+	var err error
+	if c.minute, _, err = parseCronField(fields[0], 0, 59, nil); err != nil {
+		return nil, fmt.Errorf("cron %q: minute: %w", spec, err)
+	}
+	if c.hour, _, err = parseCronField(fields[1], 0, 23, nil); err != nil {
+		return nil, fmt.Errorf("cron %q: hour: %w", spec, err)
+	}
+	if c.dom, c.domStar, err = parseCronField(fields[2], 1, 31, nil); err != nil {
+		return nil, fmt.Errorf("cron %q: day of month: %w", spec, err)
+	}
+	if c.month, _, err = parseCronField(fields[3], 1, 12, monthNames); err != nil {
+		return nil, fmt.Errorf("cron %q: month: %w", spec, err)
+	}
+	if c.dow, c.dowStar, err = parseCronField(fields[4], 0, 7, dayNames); err != nil {
+		return nil, fmt.Errorf("cron %q: day of week: %w", spec, err)
+	}
+	if c.dow&(1<<7) != 0 {
+		c.dow |= 1 // 7 is Sunday too
+	}
+	return c, nil
+}
+
+// parseCronField returns the values of a field as a bit set, and whether
+// it is an unstepped "*".
+func parseCronField(s string, min, max int, names map[string]int) (bits uint64, star bool, err error) {
+	value := func(v string) (int, error) {
+		if n, ok := names[strings.ToLower(v)]; ok {
+			return n, nil
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return 0, fmt.Errorf("bad value %q", v)
+		}
+		if n < min || n > max {
+			return 0, fmt.Errorf("%d is not within %d-%d", n, min, max)
+		}
+		return n, nil
+	}
+
+	for _, part := range strings.Split(s, ",") {
+		rng, stepStr, stepped := strings.Cut(part, "/")
+		step := 1
+		if stepped {
+			if step, err = strconv.Atoi(stepStr); err != nil || step < 1 {
+				return 0, false, fmt.Errorf("bad step %q", stepStr)
+			}
+		}
+
+		var lo, hi int
+		switch {
+		case rng == "*":
+			lo, hi = min, max
+			star = star || !stepped
+		case strings.Contains(rng, "-"):
+			a, b, _ := strings.Cut(rng, "-")
+			if lo, err = value(a); err != nil {
+				return 0, false, err
+			}
+			if hi, err = value(b); err != nil {
+				return 0, false, err
+			}
+			if lo > hi {
+				return 0, false, fmt.Errorf("bad range %q", rng)
+			}
+		default:
+			if lo, err = value(rng); err != nil {
+				return 0, false, err
+			}
+			hi = lo
+			if stepped {
+				hi = max // "5/15" is "5-max/15"
+			}
+		}
+		for i := lo; i <= hi; i += step {
+			bits |= 1 << uint(i)
+		}
+	}
+	return bits, star, nil
+}
+
+// Next returns the first time after t that matches, in t's location, or
+// the zero time if there is none within five years (e.g. "0 0 30 2 *").
+func (c *Cron) Next(t time.Time) time.Time {
+	if c.every > 0 {
+		return t.Add(c.every).Truncate(time.Second)
+	}
+
+	loc := t.Location()
+	t = t.Truncate(time.Minute).Add(time.Minute).In(loc)
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		var next time.Time
+		switch {
+		case c.month&(1<<uint(t.Month())) == 0:
+			next = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+		case !c.dayMatches(t):
+			next = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+		case c.hour&(1<<uint(t.Hour())) == 0:
+			next = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc)
+		case c.minute&(1<<uint(t.Minute())) == 0:
+			next = t.Add(time.Minute)
+		default:
+			return t
+		}
+		if !next.After(t) {
+			// A clock change skipped the time asked for, and it was
+			// normalized to one before it.
+			next = t.Add(time.Hour)
+		}
+		t = next
+	}
+	return time.Time{}
+}
+
+// NextRun returns the first time after after that matches spec, or one far in
+// the future if there is none, so a schedule stored with it never runs.
+func NextRun(spec string, after time.Time) (time.Time, error) {
+	c, err := ParseCron(spec)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if next := c.Next(after); !next.IsZero() {
+		return next, nil
+	}
+	return time.Date(9999, 1, 1, 0, 0, 0, 0, time.UTC), nil
+}
+
+func (c *Cron) dayMatches(t time.Time) bool {
+	dom := c.dom&(1<<uint(t.Day())) != 0
+	dow := c.dow&(1<<uint(t.Weekday())) != 0
+	if c.domStar || c.dowStar {
+		return dom && dow
+	}
+	return dom || dow
+}
@@ -0,0 +1,103 @@
+// Package job runs long tasks in the background from a queue kept in
+// Postgres, so HTTP handlers can hand them off and return. Jobs are
+// claimed with FOR UPDATE SKIP LOCKED, so any number of runners can share
+// the queue; a failed job is retried with backoff, and schedules add jobs
+// on cron specs.
+//
+// A kind of job is registered with its handler and enqueued by name:
+//
+//	var Export = job.Kind[ExportRequest]("export")
+//
+//	Export.Handle(runner, func(ctx context.Context, req ExportRequest) error { ... })
+//	Export.Enqueue(ctx, db, ExportRequest{...})
+package job
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"myapp/models"
+	"time"
+)
+
+// Handler runs one attempt of a job. An error fails the attempt, which is
+// retried unless the error is Permanent or it was the last one. ctx is
+// done when the job is cancelled or the runner stops waiting for it on
+// shutdown; the job is then run again later, so handlers should be safe
+// to repeat.
+type Handler interface {
+	Run(ctx context.Context, j *models.Job) error
+}
+
+// HandlerFunc adapts a function to a Handler.
+type HandlerFunc func(ctx context.Context, j *models.Job) error
+
+func (f HandlerFunc) Run(ctx context.Context, j *models.Job) error {
+	return f(ctx, j)
+}
+
+// Func returns a handler decoding the payload into a T for fn.
+func Func[T any](fn func(ctx context.Context, payload T) error) Handler {
+	return HandlerFunc(func(ctx context.Context, j *models.Job) error {
+		var payload T
+		if err := json.Unmarshal(j.Payload, &payload); err != nil {
+			return Permanent(fmt.Errorf("decoding payload: %w", err))
+		}
+		return fn(ctx, payload)
+	})
+}
+
+// Kind names a kind of job whose payload is a T, so that the code
+// enqueuing it and its handler agree on the payload.
+type Kind[T any] string
+
+// Handle registers fn to run the jobs of kind k on r.
+func (k Kind[T]) Handle(r *Runner, fn func(ctx context.Context, payload T) error) {
+	r.Handle(string(k), Func(fn))
+}
+
+// Enqueue queues a job of kind k to run as soon as possible.
+func (k Kind[T]) Enqueue(ctx context.Context, db *sql.DB, payload T) (*models.Job, error) {
+	return Enqueue(ctx, db, string(k), payload, time.Time{})
+}
+
+// EnqueueAt queues a job of kind k to run at or after at.
+func (k Kind[T]) EnqueueAt(ctx context.Context, db *sql.DB, payload T, at time.Time) (*models.Job, error) {
+	return Enqueue(ctx, db, string(k), payload, at)
+}
+
+// Enqueue queues a job of kind with payload, encoded as JSON, to run at
+// or after at, or as soon as possible if at is zero.
+func Enqueue(ctx context.Context, db *sql.DB, kind string, payload any, at time.Time) (*models.Job, error) {
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	j := &models.Job{Kind: kind, Payload: b, RunAt: at}
+	if err := models.EnqueueJob(ctx, db, j); err != nil {
+		return nil, err
+	}
+	return j, nil
+}
+
+type permanentError struct{ err error }
+
+func (e permanentError) Error() string { return e.err.Error() }
+func (e permanentError) Unwrap() error { return e.err }
+
+// Permanent marks err as one that retrying will not fix, such as a bad
+// payload, so the job fails right away.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return permanentError{err}
+}
+
+// IsPermanent reports whether err was marked with Permanent.
+func IsPermanent(err error) bool {
+	var p permanentError
+	return errors.As(err, &p)
+}
@@ -0,0 +1,267 @@
+package job
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"myapp/models"
+	"os"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Runner runs the queued jobs of the kinds it has handlers for on a pool
+// of workers, and queues the jobs of its schedules.
+type Runner struct {
+	DB *sql.DB
+	ID string // names the runner in locked_by
+
+	Workers      int           // jobs run at once
+	Interval     time.Duration // between polls when idle
+	Lease        time.Duration // a running job is leased this long, and extended every third of it
+	Backoff      func(attempt int) time.Duration
+	DrainTimeout time.Duration // how long Run waits for running jobs once stopped
+	Retention    time.Duration // finished jobs are kept this long
+
+	handlers  map[string]Handler
+	schedules []models.JobSchedule
+	wake      chan struct{}
+}
+
+// NewRunner returns a runner with four workers, polling every two
+// seconds, retrying after 30 seconds and twice as long each time, and
+// waiting up to 30 seconds for running jobs on shutdown.
+func NewRunner(db *sql.DB) *Runner {
+	host, _ := os.Hostname()
+	return &Runner{
+		DB:           db,
+		ID:           fmt.Sprintf("%s:%d", host, os.Getpid()),
+		Workers:      4,
+		Interval:     2 * time.Second,
+		Lease:        time.Minute,
+		Backoff:      Exponential(30*time.Second, time.Hour),
+		DrainTimeout: 30 * time.Second,
+		Retention:    7 * 24 * time.Hour,
+		handlers:     make(map[string]Handler),
+		wake:         make(chan struct{}, 1),
+	}
+}
+
+// Exponential returns a backoff of base after the first attempt, doubling
+// each time up to max.
+func Exponential(base, max time.Duration) func(attempt int) time.Duration {
+	return func(attempt int) time.Duration {
+		d := base
+		for i := 1; i < attempt && d < max; i++ {
+			d *= 2
+		}
+		return min(d, max)
+	}
+}
+
+// Handle registers the handler of a kind of job. It must be called before
+// Run.
+func (r *Runner) Handle(kind string, h Handler) {
+	r.handlers[kind] = h
+}
+
+// Kinds returns the kinds of job r has handlers for.
+func (r *Runner) Kinds() []string {
+	kinds := make([]string, 0, len(r.handlers))
+	for kind := range r.handlers {
+		kinds = append(kinds, kind)
+	}
+	return kinds
+}
+
+// Schedule queues a job of kind with payload whenever the cron spec is
+// due. Schedules are stored by name when Run starts, replacing those no
+// longer defined. It must be called before Run.
+func (r *Runner) Schedule(name, spec, kind string, payload any) error {
+	next, err := NextRun(spec, time.Now())
+	if err != nil {
+		return err
+	}
+	if r.handlers[kind] == nil {
+		return fmt.Errorf("schedule %q: no handler for job kind %q", name, kind)
+	}
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	r.schedules = append(r.schedules, models.JobSchedule{Name: name, Spec: spec, Kind: kind, Payload: b, NextRunAt: next})
+	return nil
+}
+
+// next returns the run after the given time of a stored schedule.
+func (r *Runner) next(s *models.JobSchedule, after time.Time) (time.Time, error) {
+	return NextRun(s.Spec, after)
+}
+
+// Run runs jobs until ctx is done. It then stops claiming jobs and waits
+// up to DrainTimeout for the running ones before cancelling them, so
+// that they are run again later, and returns once they have stopped.
+func (r *Runner) Run(ctx context.Context) {
+	if err := models.SaveJobSchedules(ctx, r.DB, r.schedules); err != nil && ctx.Err() == nil {
+		log.Printf("Error saving job schedules: %v", err)
+	}
+
+	// Jobs get their own context so that they outlive ctx while draining;
+	// it keeps the values of ctx, such as the organization.
+	jobCtx, cancelJobs := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancelJobs()
+	var wg sync.WaitGroup
+	busy := make(chan struct{}, r.Workers)
+	kinds := r.Kinds()
+
+	var purged time.Time
+	for ctx.Err() == nil {
+		if time.Since(purged) > time.Hour {
+			if _, err := models.PurgeJobs(ctx, r.DB, time.Now().Add(-r.Retention)); err != nil && ctx.Err() == nil {
+				log.Printf("Error purging jobs: %v", err)
+			}
+			purged = time.Now()
+		}
+		if _, err := models.QueueScheduledJobs(ctx, r.DB, r.next); err != nil && ctx.Err() == nil {
+			log.Printf("Error queuing scheduled jobs: %v", err)
+		}
+
+		free := r.Workers - len(busy)
+		var jobs []models.Job
+		if free > 0 {
+			var err error
+			jobs, err = models.ClaimJobs(ctx, r.DB, kinds, r.ID, free, r.Lease)
+			if err != nil && ctx.Err() == nil {
+				log.Printf("Error claiming jobs: %v", err)
+			}
+		}
+		for _, j := range jobs {
+			busy <- struct{}{}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				r.run(jobCtx, &j)
+				<-busy
+				r.Wake()
+			}()
+		}
+		if free > 0 && len(jobs) == free {
+			continue // there may be more
+		}
+
+		select {
+		case <-ctx.Done():
+		case <-r.wake:
+		case <-time.After(r.Interval):
+		}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(r.DrainTimeout):
+		log.Printf("Cancelling %d running jobs", len(busy))
+		cancelJobs()
+		<-done
+	}
+}
+
+// Wake makes Run poll for jobs now, e.g. after queuing one.
+func (r *Runner) Wake() {
+	select {
+	case r.wake <- struct{}{}:
+	default:
+	}
+}
+
+// run runs one attempt of a job, extending its lease meanwhile, and
+// records the outcome. base is cancelled when the runner stops waiting
+// for jobs on shutdown.
+func (r *Runner) run(base context.Context, j *models.Job) {
+	// The outcome is recorded even while shutting down.
+	record := func(f func(ctx context.Context) error) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := f(ctx); err != nil && !errors.Is(err, models.ErrNoJob) {
+			log.Printf("Error recording the outcome of job %d: %v", j.ID, err)
+		}
+	}
+
+	if j.Attempts > j.MaxAttempts {
+		// Its workers kept dying.
+		record(func(ctx context.Context) error {
+			return models.FailJob(ctx, r.DB, j.ID, r.ID, "lease expired on the last attempt", time.Time{})
+		})
+		return
+	}
+
+	ctx, cancel := context.WithCancel(base)
+	defer cancel()
+	lost := make(chan struct{})
+	stop := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-stop:
+				return
+			case <-time.After(r.Lease / 3):
+			}
+			err := models.ExtendJobLease(ctx, r.DB, j.ID, r.ID, r.Lease)
+			if errors.Is(err, models.ErrNoJob) {
+				close(lost)
+				cancel()
+				return
+			}
+			if err != nil && ctx.Err() == nil {
+				log.Printf("Error extending the lease of job %d: %v", j.ID, err)
+			}
+		}
+	}()
+
+	err := runHandler(ctx, r.handlers[j.Kind], j)
+	close(stop)
+
+	select {
+	case <-lost:
+		log.Printf("Job %d (%s) was cancelled or taken over", j.ID, j.Kind)
+		return
+	default:
+	}
+	switch {
+	case err == nil:
+		record(func(ctx context.Context) error { return models.FinishJob(ctx, r.DB, j.ID, r.ID) })
+	case base.Err() != nil:
+		log.Printf("Job %d (%s) stopped for shutdown", j.ID, j.Kind)
+		record(func(ctx context.Context) error { return models.ReleaseJob(ctx, r.DB, j.ID, r.ID) })
+	default:
+		var next time.Time
+		if j.Attempts < j.MaxAttempts && !IsPermanent(err) {
+			next = time.Now().Add(r.Backoff(j.Attempts))
+		}
+		msg := err.Error()
+		if len(msg) > 2000 {
+			msg = strings.ToValidUTF8(msg[:2000], "")
+		}
+		log.Printf("Job %d (%s) attempt %d failed: %v", j.ID, j.Kind, j.Attempts, err)
+		record(func(ctx context.Context) error { return models.FailJob(ctx, r.DB, j.ID, r.ID, msg, next) })
+	}
+}
+
+// runHandler runs h, turning a panic into an error.
+func runHandler(ctx context.Context, h Handler, j *models.Job) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("panic: %v\n%s", p, debug.Stack())
+		}
+	}()
+	return h.Run(ctx, j)
+}
@@ -0,0 +1,148 @@
+package mail
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"myapp/alert"
+	"myapp/models"
+	"strings"
+	"time"
+)
+
+// Mailer sends the emails in the outbox. Several mailers can share a
+// database: each claims its own emails.
+type Mailer struct {
+	DB        *sql.DB
+	Sender    Sender
+	Templates *Templates
+	From      string
+	BaseURL   string // of the web app, for links in emails
+
+	Interval    time.Duration // between polls when nothing is due
+	Batch       int           // emails claimed at a time
+	MaxAttempts int           // failures before an email is given up on
+	Retention   time.Duration // sent emails are kept this long
+}
+
+// NewMailer returns a mailer with the default settings: up to 8 attempts
+// over about four hours, and a month of sent emails kept.
+func NewMailer(db *sql.DB, sender Sender, templates *Templates, from string) *Mailer {
+	return &Mailer{
+		DB:          db,
+		Sender:      sender,
+		Templates:   templates,
+		From:        from,
+		Interval:    10 * time.Second,
+		Batch:       20,
+		MaxAttempts: 8,
+		Retention:   30 * 24 * time.Hour,
+	}
+}
+
+// backoff returns the wait after the n-th failed attempt: 2 minutes,
+// doubling each time.
+func backoff(n int) time.Duration {
+	return 2 * time.Minute << min(n-1, 10)
+}
+
+// Run sends until ctx is done, and purges old emails hourly.
+func (m *Mailer) Run(ctx context.Context) {
+	var purged time.Time
+	for {
+		if time.Since(purged) > time.Hour {
+			if _, err := models.PurgeSentEmails(ctx, m.DB, time.Now().Add(-m.Retention)); err != nil && ctx.Err() == nil {
+				log.Printf("Error purging sent emails: %v", err)
+			}
+			purged = time.Now()
+		}
+		n, err := m.SendDue(ctx)
+		if err != nil && ctx.Err() == nil {
+			log.Printf("Error sending emails: %v", err)
+		}
+		if n == m.Batch {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(m.Interval):
+		}
+	}
+}
+
+// SendDue claims one batch of due emails and sends them one by one,
+// returning how many were claimed.
+func (m *Mailer) SendDue(ctx context.Context) (int, error) {
+	emails, err := models.ClaimEmails(ctx, m.DB, m.Batch, time.Duration(m.Batch)*time.Minute)
+	if err != nil {
+		return 0, err
+	}
+	for i := range emails {
+		if err := m.send(ctx, &emails[i]); err != nil {
+			return len(emails), err
+		}
+	}
+	return len(emails), nil
+}
+
+// send renders and sends one email and records the outcome. An email
+// that cannot be rendered is given up on right away.
+func (m *Mailer) send(ctx context.Context, x *models.OutboxEmail) error {
+	msg, err := m.Templates.Render(x.Template, x.Data, TemplateData{Recipient: x.Recipient, BaseURL: m.BaseURL})
+	if err != nil {
+		return models.MarkEmailFailed(ctx, m.DB, x.ID, "rendering: "+err.Error(), time.Time{})
+	}
+	msg.From = m.From
+
+	err = m.Sender.Send(ctx, msg)
+	if ctx.Err() != nil {
+		return nil // shutting down: sent again when the lease ends
+	}
+	if err == nil {
+		return models.MarkEmailSent(ctx, m.DB, x.ID)
+	}
+
+	var next time.Time
+	if n := x.Attempts + 1; n < m.MaxAttempts {
+		next = time.Now().Add(backoff(n))
+	}
+	msgErr := err.Error()
+	if len(msgErr) > 500 {
+		msgErr = strings.ToValidUTF8(msgErr[:500], "")
+	}
+	return models.MarkEmailFailed(ctx, m.DB, x.ID, msgErr, next)
+}
+
+// AlertNotifier emails outbreak alerts to the users who asked for them,
+// by adding them to the outbox.
+type AlertNotifier struct {
+	DB *sql.DB
+}
+
+var _ alert.Notifier = AlertNotifier{}
+
+func (n AlertNotifier) Notify(ctx context.Context, alerts []models.Alert) error {
+	for i := range alerts {
+		a := &alerts[i]
+		data := map[string]any{
+			"id":           a.ID,
+			"rule":         a.RuleName,
+			"severity":     a.Severity,
+			"country":      a.CName,
+			"disease_code": a.DiseaseCode,
+			"message":      a.Message,
+			"raised_at":    a.RaisedAt.Format("2006-01-02 15:04 MST"),
+		}
+		if _, err := models.QueueAlertEmails(ctx, n.DB, a, "alert", data); err != nil {
+			// The earlier alerts were queued; don't queue them twice.
+			ne := &alert.NotifyError{Err: fmt.Errorf("queuing emails for alert %d: %w", a.ID, err)}
+			for _, b := range alerts[i:] {
+				ne.Failed = append(ne.Failed, b.ID)
+			}
+			return ne
+		}
+	}
+	return nil
+}
@@ -0,0 +1,194 @@
+package mail_test
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math/rand/v2"
+	"myapp/db"
+	"myapp/mail"
+	"myapp/mail/smtptest"
+	"myapp/models"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// The outbox tests need a database:
+//
+//	DATABASE_URL=... go test ./mail
+//
+// They work in a throwaway organization, which is removed afterwards, so
+// that they only see emails of their own.
+
+// openOrg connects to DATABASE_URL, or skips the test, and returns the
+// context of a new organization.
+func openOrg(t *testing.T) (*sql.DB, context.Context) {
+	t.Helper()
+	dbURL := os.Getenv("DATABASE_URL")
+	if dbURL == "" {
+		t.Skip("DATABASE_URL is not set")
+	}
+	conn, err := db.NewPostgresDB(dbURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	ctx := context.Background()
+	if err := db.Migrate(ctx, conn); err != nil {
+		t.Fatal(err)
+	}
+	o, err := models.CreateOrganization(ctx, conn, fmt.Sprintf("mail-%06d", rand.IntN(1e6)), "Mail test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		ctx := models.WithAllTenants(context.Background())
+		for _, q := range []string{"DELETE FROM email_outbox WHERE tenant_id = $1", "DELETE FROM organization WHERE id = $1"} {
+			if _, err := conn.ExecContext(ctx, q, o.ID); err != nil {
+				t.Errorf("cleaning up: %v", err)
+			}
+		}
+	})
+	return conn, models.WithTenant(ctx, o.ID)
+}
+
+// newMailer returns a mailer sending to a new test server.
+func newMailer(t *testing.T, conn *sql.DB) (*mail.Mailer, *smtptest.Server) {
+	t.Helper()
+	srv := smtptest.NewServer()
+	t.Cleanup(srv.Close)
+	m := mail.NewMailer(conn, &mail.SMTPSender{Config: srv.Config("app@example.org")}, loadTemplates(t), "app@example.org")
+	m.BaseURL = "https://health.example.org"
+	return m, srv
+}
+
+// outbox returns the only email of the organization of ctx.
+func outbox(t *testing.T, ctx context.Context, conn *sql.DB) models.OutboxEmail {
+	t.Helper()
+	emails, err := models.GetOutboxEmails(ctx, conn, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(emails) != 1 {
+		t.Fatalf("%d emails in the outbox", len(emails))
+	}
+	return emails[0]
+}
+
+// sendDue has m send due emails once, returning how many it claimed.
+func sendDue(t *testing.T, ctx context.Context, m *mail.Mailer) int {
+	t.Helper()
+	n, err := m.SendDue(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+// queueAlert adds an alert email for ana@example.org to the outbox.
+func queueAlert(t *testing.T, ctx context.Context, conn *sql.DB) {
+	t.Helper()
+	data := map[string]any{"rule": "Deaths up", "severity": "warning", "country": "Spain", "disease_code": "A15.0", "message": "Deaths rose", "raised_at": "now"}
+	if err := models.QueueEmail(ctx, conn, "ana@example.org", "alert", data); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMailerSends(t *testing.T) {
+	conn, ctx := openOrg(t)
+	m, srv := newMailer(t, conn)
+	queueAlert(t, ctx, conn)
+
+	if n := sendDue(t, ctx, m); n != 1 {
+		t.Fatalf("claimed %d emails", n)
+	}
+	msgs := srv.Messages()
+	if len(msgs) != 1 || msgs[0].From != "app@example.org" || len(msgs[0].To) != 1 || msgs[0].To[0] != "ana@example.org" {
+		t.Fatalf("received %+v", msgs)
+	}
+	header, body := parts(t, msgs[0])
+	if header["Subject"] != "[warning] Deaths up: A15.0 in Spain" || !strings.Contains(body["text/plain"], "https://health.example.org/") {
+		t.Errorf("received %v\n%v", header, body)
+	}
+	if x := outbox(t, ctx, conn); !x.SentAt.Valid || x.Attempts != 1 {
+		t.Errorf("outbox %+v, want sent after one attempt", x)
+	}
+	if n := sendDue(t, ctx, m); n != 0 {
+		t.Errorf("claimed %d emails after sending", n)
+	}
+}
+
+func TestMailerRetries(t *testing.T) {
+	conn, ctx := openOrg(t)
+	m, srv := newMailer(t, conn)
+	m.MaxAttempts = 2
+	var accepting atomic.Bool
+	srv.Reject = func(string) string {
+		if !accepting.Load() {
+			return "451 try again later"
+		}
+		return ""
+	}
+	queueAlert(t, ctx, conn)
+
+	start := time.Now()
+	if n := sendDue(t, ctx, m); n != 1 {
+		t.Fatalf("claimed %d emails", n)
+	}
+	x := outbox(t, ctx, conn)
+	if x.Attempts != 1 || x.DeadAt.Valid || !strings.Contains(x.LastError.String, "451") {
+		t.Fatalf("outbox %+v, want a failed attempt to retry", x)
+	}
+	if wait := x.NextAttemptAt.Sub(start); wait < time.Minute || wait > 3*time.Minute {
+		t.Errorf("retried after %v, want 2 minutes", wait)
+	}
+	if n := sendDue(t, ctx, m); n != 0 {
+		t.Fatalf("claimed %d emails before the retry is due", n)
+	}
+
+	// Make the retry due, and fail it too: that was the last attempt.
+	if _, err := conn.ExecContext(ctx, "UPDATE email_outbox SET next_attempt_at = now() WHERE id = $1", x.ID); err != nil {
+		t.Fatal(err)
+	}
+	if n := sendDue(t, ctx, m); n != 1 {
+		t.Fatalf("claimed %d emails for the retry", n)
+	}
+	if x = outbox(t, ctx, conn); x.Attempts != 2 || !x.DeadAt.Valid {
+		t.Fatalf("outbox %+v, want given up on", x)
+	}
+	if n := sendDue(t, ctx, m); n != 0 {
+		t.Fatalf("claimed %d emails given up on", n)
+	}
+
+	accepting.Store(true)
+	if err := models.RetryEmail(ctx, conn, x.ID); err != nil {
+		t.Fatal(err)
+	}
+	if n := sendDue(t, ctx, m); n != 1 {
+		t.Fatalf("claimed %d emails after retrying", n)
+	}
+	if x = outbox(t, ctx, conn); !x.SentAt.Valid || len(srv.Messages()) != 1 {
+		t.Errorf("outbox %+v and %d messages, want sent", x, len(srv.Messages()))
+	}
+}
+
+func TestMailerGivesUpOnRenderErrors(t *testing.T) {
+	conn, ctx := openOrg(t)
+	m, srv := newMailer(t, conn)
+	if err := models.QueueEmail(ctx, conn, "ana@example.org", "missing", map[string]any{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := sendDue(t, ctx, m); n != 1 {
+		t.Fatalf("claimed %d emails", n)
+	}
+	if x := outbox(t, ctx, conn); !x.DeadAt.Valid || !strings.HasPrefix(x.LastError.String, "rendering: ") {
+		t.Errorf("outbox %+v, want given up on", x)
+	}
+	if len(srv.Messages()) != 0 {
+		t.Error("sent an email that could not be rendered")
+	}
+}
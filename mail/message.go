@@ -0,0 +1,81 @@
+// Package mail sends the email notifications queued in email_outbox over
+// SMTP. Emails are rendered from the templates in mail/templates when
+// they are sent, so an outbox row only holds the template name and its
+// data.
+package mail
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/textproto"
+	"strings"
+	"time"
+)
+
+// Message is an email with a plain text and an HTML body.
+type Message struct {
+	From    string
+	To      []string
+	Subject string
+	Text    string
+	HTML    string
+}
+
+// Bytes encodes m as a MIME multipart/alternative message.
+func (m *Message) Bytes() ([]byte, error) {
+	var b bytes.Buffer
+	w := multipart.NewWriter(&b)
+
+	domain := "localhost"
+	if _, d, ok := strings.Cut(m.From, "@"); ok {
+		domain = strings.Trim(d, "> ")
+	}
+	id := make([]byte, 12)
+	rand.Read(id)
+
+	header := []struct{ key, value string }{
+		{"From", m.From},
+		{"To", strings.Join(m.To, ", ")},
+		{"Subject", mime.QEncoding.Encode("utf-8", m.Subject)},
+		{"Date", time.Now().Format(time.RFC1123Z)},
+		{"Message-ID", "<" + hex.EncodeToString(id) + "@" + domain + ">"},
+		{"MIME-Version", "1.0"},
+		{"Content-Type", "multipart/alternative; boundary=" + w.Boundary()},
+	}
+	for _, h := range header {
+		if strings.ContainsAny(h.value, "\r\n") {
+			return nil, fmt.Errorf("mail: line break in %s header", h.key)
+		}
+		fmt.Fprintf(&b, "%s: %s\r\n", h.key, h.value)
+	}
+	b.WriteString("\r\n")
+
+	for _, part := range []struct{ typ, body string }{
+		{"text/plain; charset=utf-8", m.Text},
+		{"text/html; charset=utf-8", m.HTML},
+	} {
+		pw, err := w.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.typ},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		qp := quotedprintable.NewWriter(pw)
+		if _, err := qp.Write([]byte(part.body)); err != nil {
+			return nil, err
+		}
+		if err := qp.Close(); err != nil {
+			return nil, err
+		}
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
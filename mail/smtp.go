@@ -0,0 +1,160 @@
+package mail
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/smtp"
+	"os"
+	"strings"
+	"time"
+)
+
+// Sender delivers a message.
+type Sender interface {
+	Send(ctx context.Context, m *Message) error
+}
+
+// TLS modes of an SMTP connection.
+const (
+	TLSStartTLS = "starttls" // upgrade a plain connection; the server must support it
+	TLSImplicit = "tls"      // connect over TLS, usually to port 465
+	TLSNone     = "none"     // only for local test servers
+)
+
+// Config is where and how to send email.
+type Config struct {
+	Host     string
+	Port     string
+	Username string // no authentication if empty
+	Password string
+	From     string
+	TLS      string
+	Timeout  time.Duration
+
+	// TLSConfig overrides the TLS settings, e.g. to trust a test server.
+	TLSConfig *tls.Config
+}
+
+// ConfigFromEnv reads the configuration from SMTP_HOST, SMTP_PORT
+// (default 587), SMTP_USERNAME, SMTP_PASSWORD, SMTP_FROM and SMTP_TLS
+// (default starttls). It returns nil when SMTP_HOST is not set.
+func ConfigFromEnv() (*Config, error) {
+	c := &Config{
+		Host:     os.Getenv("SMTP_HOST"),
+		Port:     os.Getenv("SMTP_PORT"),
+		Username: os.Getenv("SMTP_USERNAME"),
+		Password: os.Getenv("SMTP_PASSWORD"),
+		From:     os.Getenv("SMTP_FROM"),
+		TLS:      strings.ToLower(os.Getenv("SMTP_TLS")),
+		Timeout:  30 * time.Second,
+	}
+	if c.Host == "" {
+		return nil, nil
+	}
+	if c.Port == "" {
+		c.Port = "587"
+	}
+	if c.TLS == "" {
+		c.TLS = TLSStartTLS
+	}
+	if c.TLS != TLSStartTLS && c.TLS != TLSImplicit && c.TLS != TLSNone {
+		return nil, fmt.Errorf("SMTP_TLS must be %s, %s or %s", TLSStartTLS, TLSImplicit, TLSNone)
+	}
+	if c.From == "" {
+		return nil, errors.New("SMTP_FROM is required with SMTP_HOST")
+	}
+	return c, nil
+}
+
+// SMTPSender sends each message over a new SMTP connection.
+type SMTPSender struct {
+	Config
+}
+
+func (s *SMTPSender) Send(ctx context.Context, m *Message) error {
+	body, err := m.Bytes()
+	if err != nil {
+		return err
+	}
+
+	addr := net.JoinHostPort(s.Host, s.Port)
+	dialer := &net.Dialer{Timeout: s.Timeout}
+	tlsConfig := s.TLSConfig
+	if tlsConfig == nil {
+		tlsConfig = &tls.Config{ServerName: s.Host}
+	}
+
+	var conn net.Conn
+	if s.TLS == TLSImplicit {
+		conn, err = (&tls.Dialer{NetDialer: dialer, Config: tlsConfig}).DialContext(ctx, "tcp", addr)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return err
+	}
+	if s.Timeout > 0 {
+		conn.SetDeadline(time.Now().Add(s.Timeout))
+	}
+	c, err := smtp.NewClient(conn, s.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+
+	if s.TLS == TLSStartTLS {
+		if ok, _ := c.Extension("STARTTLS"); !ok {
+			return errors.New("mail: server does not support STARTTLS")
+		}
+		if err := c.StartTLS(tlsConfig); err != nil {
+			return err
+		}
+	}
+	if s.Username != "" {
+		if err := c.Auth(smtp.PlainAuth("", s.Username, s.Password, s.Host)); err != nil {
+			return err
+		}
+	}
+	if err := c.Mail(address(m.From)); err != nil {
+		return err
+	}
+	for _, to := range m.To {
+		if err := c.Rcpt(address(to)); err != nil {
+			return err
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(body); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+// address returns the bare address of "Name <address>".
+func address(s string) string {
+	if i := strings.LastIndex(s, "<"); i >= 0 {
+		return strings.TrimSuffix(s[i+1:], ">")
+	}
+	return s
+}
+
+// LogSender logs messages instead of sending them, for running without an
+// SMTP server. Only the subject and the number of recipients are logged:
+// the addresses and the body may hold personal data.
+type LogSender struct{}
+
+func (LogSender) Send(ctx context.Context, m *Message) error {
+	log.Printf("Email to %d recipients: %s", len(m.To), m.Subject)
+	return nil
+}
@@ -0,0 +1,162 @@
+package mail_test
+
+import (
+	"context"
+	"io"
+	"log"
+	"mime"
+	"mime/multipart"
+	"myapp/mail"
+	"myapp/mail/smtptest"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// parts returns the headers and decoded parts of a received message.
+func parts(t *testing.T, m smtptest.Message) (header map[string]string, body map[string]string) {
+	t.Helper()
+	msg, err := m.Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	header = make(map[string]string)
+	dec := new(mime.WordDecoder)
+	for _, key := range []string{"From", "To", "Subject", "Message-Id"} {
+		if header[key], err = dec.DecodeHeader(msg.Header.Get(key)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body = make(map[string]string)
+	r := multipart.NewReader(msg.Body, params["boundary"])
+	for {
+		p, err := r.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := io.ReadAll(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		typ, _, _ := mime.ParseMediaType(p.Header.Get("Content-Type"))
+		body[typ] = string(b)
+	}
+	return header, body
+}
+
+func TestSMTPSend(t *testing.T) {
+	srv := smtptest.NewServer()
+	defer srv.Close()
+	sender := &mail.SMTPSender{Config: srv.Config("app@example.org")}
+
+	m := &mail.Message{
+		From:    "Health <app@example.org>",
+		To:      []string{"ana@example.org", "ben@example.org"},
+		Subject: "Alerte : grippe à Paris",
+		Text:    "Cases rose.\n.\nA line of its own above.\n",
+		HTML:    "<p>Cases <em>rose</em>, by " + strings.Repeat("very ", 30) + "much.</p>",
+	}
+	if err := sender.Send(context.Background(), m); err != nil {
+		t.Fatal(err)
+	}
+
+	msgs := srv.Messages()
+	if len(msgs) != 1 {
+		t.Fatalf("%d messages", len(msgs))
+	}
+	got := msgs[0]
+	if got.From != "app@example.org" || !reflect.DeepEqual(got.To, m.To) {
+		t.Errorf("envelope from %s to %v", got.From, got.To)
+	}
+	if got.Username != "" {
+		t.Errorf("authenticated as %q without a username", got.Username)
+	}
+	header, body := parts(t, got)
+	if header["From"] != m.From || header["To"] != "ana@example.org, ben@example.org" || header["Subject"] != m.Subject {
+		t.Errorf("headers %v", header)
+	}
+	if !strings.HasSuffix(header["Message-Id"], "@example.org>") {
+		t.Errorf("Message-ID %s", header["Message-Id"])
+	}
+	// Quoted-printable text has CRLF line endings.
+	if strings.ReplaceAll(body["text/plain"], "\r\n", "\n") != m.Text || body["text/html"] != m.HTML {
+		t.Errorf("body %q", body)
+	}
+}
+
+func TestSMTPSendAuth(t *testing.T) {
+	srv := smtptest.NewServer()
+	defer srv.Close()
+	cfg := srv.Config("app@example.org")
+	cfg.Username, cfg.Password = "app", "secret"
+	sender := &mail.SMTPSender{Config: cfg}
+
+	if err := sender.Send(context.Background(), &mail.Message{From: cfg.From, To: []string{"ana@example.org"}, Subject: "Hi"}); err != nil {
+		t.Fatal(err)
+	}
+	if msgs := srv.Messages(); len(msgs) != 1 || msgs[0].Username != "app" {
+		t.Errorf("received %+v, want one message from user app", msgs)
+	}
+}
+
+func TestSMTPSendErrors(t *testing.T) {
+	srv := smtptest.NewServer()
+	defer srv.Close()
+	srv.Reject = func(to string) string {
+		if to == "gone@example.org" {
+			return "550 no such user"
+		}
+		return ""
+	}
+	m := func(to ...string) *mail.Message {
+		return &mail.Message{From: "app@example.org", To: to, Subject: "Hi", Text: "Hi"}
+	}
+
+	for _, tc := range []struct {
+		name   string
+		tls    string
+		msg    *mail.Message
+		errHas string
+	}{
+		{"rejected recipient", mail.TLSNone, m("ana@example.org", "gone@example.org"), "550"},
+		{"no STARTTLS", mail.TLSStartTLS, m("ana@example.org"), "STARTTLS"},
+		{"line break in a header", mail.TLSNone, m("ana@example.org\r\nBcc: eve@example.org"), "line break"},
+	} {
+		cfg := srv.Config("app@example.org")
+		cfg.TLS = tc.tls
+		err := (&mail.SMTPSender{Config: cfg}).Send(context.Background(), tc.msg)
+		if err == nil || !strings.Contains(err.Error(), tc.errHas) {
+			t.Errorf("%s: got %v, want an error about %s", tc.name, err, tc.errHas)
+		}
+	}
+	if msgs := srv.Messages(); len(msgs) != 0 {
+		t.Errorf("received %d messages", len(msgs))
+	}
+}
+
+func TestLogSender(t *testing.T) {
+	var out strings.Builder
+	log.SetOutput(&out)
+	defer log.SetOutput(os.Stderr)
+
+	msg := &mail.Message{To: []string{"ana@example.org", "luis@example.org"}, Subject: "Outbreak alert", Text: "Maria Garcia has A15.0"}
+	if err := (mail.LogSender{}).Send(context.Background(), msg); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "2 recipients: Outbreak alert") {
+		t.Errorf("logged %q", out.String())
+	}
+	for _, private := range []string{"ana@example.org", "Maria Garcia"} {
+		if strings.Contains(out.String(), private) {
+			t.Errorf("logged %q", private)
+		}
+	}
+}
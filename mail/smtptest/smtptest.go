@@ -0,0 +1,219 @@
+// Package smtptest provides an in-process SMTP server that keeps the
+// messages it receives, for testing code that sends email, the way
+// net/http/httptest does for HTTP:
+//
+//	srv := smtptest.NewServer()
+//	defer srv.Close()
+//	sender := &mail.SMTPSender{Config: srv.Config("app@example.org")}
+//	...
+//	msgs := srv.Messages()
+//
+// It speaks enough SMTP for net/smtp: EHLO, AUTH PLAIN, MAIL, RCPT, DATA,
+// RSET, NOOP and QUIT. It does not offer STARTTLS, so clients must use
+// mail.TLSNone.
+package smtptest
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"myapp/mail"
+	"net"
+	netmail "net/mail"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Message is a received message.
+type Message struct {
+	From     string
+	To       []string
+	Username string // from AUTH, if any
+	Data     []byte
+}
+
+// Parse parses the received data as an RFC 5322 message.
+func (m *Message) Parse() (*netmail.Message, error) {
+	return netmail.ReadMessage(bytes.NewReader(m.Data))
+}
+
+// Server is a running test SMTP server.
+type Server struct {
+	Addr string // host:port
+
+	// Reject, if set, is called for every recipient and can refuse it
+	// with an SMTP error such as "550 no such user".
+	Reject func(to string) string
+
+	ln       net.Listener
+	mu       sync.Mutex
+	messages []Message
+	conns    map[net.Conn]bool
+	wg       sync.WaitGroup
+}
+
+// NewServer starts a server on a free loopback port.
+func NewServer() *Server {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic(fmt.Sprintf("smtptest: failed to listen: %v", err))
+	}
+	s := &Server{Addr: ln.Addr().String(), ln: ln, conns: make(map[net.Conn]bool)}
+	s.wg.Add(1)
+	go s.serve()
+	return s
+}
+
+// Config returns a mail configuration sending to s from from.
+func (s *Server) Config(from string) mail.Config {
+	host, port, _ := net.SplitHostPort(s.Addr)
+	return mail.Config{Host: host, Port: port, From: from, TLS: mail.TLSNone, Timeout: 5 * time.Second}
+}
+
+// Messages returns the messages received so far.
+func (s *Server) Messages() []Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Message(nil), s.messages...)
+}
+
+// Close stops the server, dropping open sessions.
+func (s *Server) Close() {
+	s.ln.Close()
+	s.mu.Lock()
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		s.conns[conn] = true
+		s.mu.Unlock()
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.session(conn)
+			s.mu.Lock()
+			delete(s.conns, conn)
+			s.mu.Unlock()
+		}()
+	}
+}
+
+func (s *Server) session(conn net.Conn) {
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(time.Minute))
+	r := bufio.NewReader(conn)
+	reply := func(format string, args ...any) {
+		fmt.Fprintf(conn, format+"\r\n", args...)
+	}
+
+	reply("220 smtptest ready")
+	var msg Message
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		verb, arg, _ := strings.Cut(line, " ")
+
+		switch strings.ToUpper(verb) {
+		case "EHLO":
+			reply("250-smtptest")
+			reply("250-AUTH PLAIN")
+			reply("250 8BITMIME")
+		case "HELO":
+			reply("250 smtptest")
+		case "AUTH":
+			mech, resp, _ := strings.Cut(arg, " ")
+			if !strings.EqualFold(mech, "PLAIN") {
+				reply("504 unsupported mechanism")
+				continue
+			}
+			b, err := base64.StdEncoding.DecodeString(resp)
+			parts := strings.Split(string(b), "\x00")
+			if err != nil || len(parts) != 3 {
+				reply("501 malformed credentials")
+				continue
+			}
+			msg.Username = parts[1]
+			reply("235 authenticated")
+		case "MAIL":
+			msg.From = pathArg(arg, "FROM:")
+			msg.To = nil
+			reply("250 ok")
+		case "RCPT":
+			to := pathArg(arg, "TO:")
+			if s.Reject != nil {
+				if code := s.Reject(to); code != "" {
+					reply("%s", code)
+					continue
+				}
+			}
+			msg.To = append(msg.To, to)
+			reply("250 ok")
+		case "DATA":
+			if len(msg.To) == 0 {
+				reply("503 no recipients")
+				continue
+			}
+			reply("354 end data with <CR><LF>.<CR><LF>")
+			data, err := readData(r)
+			if err != nil {
+				return
+			}
+			msg.Data = data
+			s.mu.Lock()
+			s.messages = append(s.messages, msg)
+			s.mu.Unlock()
+			msg = Message{Username: msg.Username}
+			reply("250 queued")
+		case "RSET":
+			msg = Message{Username: msg.Username}
+			reply("250 ok")
+		case "NOOP":
+			reply("250 ok")
+		case "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("502 command not implemented")
+		}
+	}
+}
+
+// pathArg returns the address of "FROM:<a@b> SIZE=1".
+func pathArg(arg, prefix string) string {
+	if len(arg) < len(prefix) || !strings.EqualFold(arg[:len(prefix)], prefix) {
+		return ""
+	}
+	path, _, _ := strings.Cut(strings.TrimSpace(arg[len(prefix):]), " ")
+	return strings.Trim(path, "<>")
+}
+
+// readData reads a DATA section up to the lone dot, undoing dot-stuffing.
+func readData(r *bufio.Reader) ([]byte, error) {
+	var b bytes.Buffer
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		if line == ".\r\n" || line == ".\n" {
+			return b.Bytes(), nil
+		}
+		b.WriteString(strings.TrimPrefix(line, "."))
+	}
+}
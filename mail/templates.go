@@ -0,0 +1,87 @@
+package mail
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"fmt"
+	htmltemplate "html/template"
+	"strings"
+	texttemplate "text/template"
+)
+
+//go:embed templates
+var templateFS embed.FS
+
+// Templates renders emails. Each file in mail/templates defines a
+// "subject", a "text" and an "html" template; the first two are executed
+// as text/template and the last as html/template, so the plain parts are
+// not HTML-escaped.
+type Templates struct {
+	text map[string]*texttemplate.Template
+	html map[string]*htmltemplate.Template
+}
+
+// TemplateData is what an email template is executed with.
+type TemplateData struct {
+	Recipient string
+	BaseURL   string         // of the web app, for links
+	Data      map[string]any // from the outbox row
+}
+
+// LoadTemplates parses the embedded templates.
+func LoadTemplates() (*Templates, error) {
+	t := &Templates{
+		text: make(map[string]*texttemplate.Template),
+		html: make(map[string]*htmltemplate.Template),
+	}
+	entries, err := templateFS.ReadDir("templates")
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		name, ok := strings.CutSuffix(e.Name(), ".html")
+		if !ok {
+			continue
+		}
+		path := "templates/" + e.Name()
+		if t.text[name], err = texttemplate.New(name).Option("missingkey=zero").ParseFS(templateFS, path); err != nil {
+			return nil, err
+		}
+		if t.html[name], err = htmltemplate.New(name).Option("missingkey=zero").ParseFS(templateFS, path); err != nil {
+			return nil, err
+		}
+	}
+	return t, nil
+}
+
+// Render builds the message of template name for one recipient. data is
+// the JSON stored in the outbox.
+func (t *Templates) Render(name string, data json.RawMessage, d TemplateData) (*Message, error) {
+	text, ok := t.text[name]
+	if !ok {
+		return nil, fmt.Errorf("mail: no template %q", name)
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&d.Data); err != nil {
+		return nil, fmt.Errorf("mail: template data: %w", err)
+	}
+
+	var subject, plain, html bytes.Buffer
+	if err := text.ExecuteTemplate(&subject, "subject", d); err != nil {
+		return nil, err
+	}
+	if err := text.ExecuteTemplate(&plain, "text", d); err != nil {
+		return nil, err
+	}
+	if err := t.html[name].ExecuteTemplate(&html, "html", d); err != nil {
+		return nil, err
+	}
+	return &Message{
+		To:      []string{d.Recipient},
+		Subject: strings.Join(strings.Fields(subject.String()), " "),
+		Text:    strings.TrimSpace(plain.String()) + "\n",
+		HTML:    html.String(),
+	}, nil
+}
@@ -0,0 +1,99 @@
+package mail_test
+
+import (
+	"encoding/json"
+	"myapp/mail"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func loadTemplates(t *testing.T) *mail.Templates {
+	t.Helper()
+	ts, err := mail.LoadTemplates()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ts
+}
+
+func TestRenderAlert(t *testing.T) {
+	data, _ := json.Marshal(map[string]any{
+		"rule":         "Deaths <up>",
+		"severity":     "critical",
+		"country":      "Spain",
+		"disease_code": "A15.0",
+		"message":      "Deaths rose by 40% & more",
+		"raised_at":    "2024-06-30 12:00 UTC",
+	})
+	msg, err := loadTemplates(t).Render("alert", data, mail.TemplateData{Recipient: "ana@example.org", BaseURL: "https://health.example.org"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(msg.To, []string{"ana@example.org"}) {
+		t.Errorf("to %v", msg.To)
+	}
+	if want := "[critical] Deaths <up>: A15.0 in Spain"; msg.Subject != want {
+		t.Errorf("subject %q, want %q", msg.Subject, want)
+	}
+	if !strings.HasPrefix(msg.Text, "Deaths rose by 40% & more\n") || !strings.Contains(msg.Text, "https://health.example.org/\n") {
+		t.Errorf("text is not plain:\n%s", msg.Text)
+	}
+	if !strings.Contains(msg.HTML, "Deaths rose by 40% &amp; more") || !strings.Contains(msg.HTML, "Rule: Deaths &lt;up&gt;") {
+		t.Errorf("html is not escaped:\n%s", msg.HTML)
+	}
+	if !strings.Contains(msg.HTML, `href="https://health.example.org/"`) {
+		t.Errorf("html has no link to the dashboard:\n%s", msg.HTML)
+	}
+}
+
+func TestRenderRecordChanged(t *testing.T) {
+	ts := loadTemplates(t)
+	record := map[string]any{"email": "ana@example.org", "cname": "Spain", "disease_code": "A15.0", "total_deaths": 37, "total_patients": 1240}
+	for _, tc := range []struct {
+		data    map[string]any
+		subject string
+		text    []string
+	}{
+		{
+			map[string]any{"operation": "create", "record": record},
+			"Record for A15.0 in Spain added",
+			[]string{"was added under your name.", "Deaths: 37\nPatients: 1240"},
+		},
+		{
+			map[string]any{"operation": "update", "record": record, "previous": map[string]any{"total_deaths": 30, "total_patients": 1200}},
+			"Record for A15.0 in Spain updated",
+			[]string{"was changed.", "Before: 30 deaths, 1200 patients"},
+		},
+		{
+			map[string]any{"operation": "delete", "record": record, "deleted_by": "ben@example.org"},
+			"Record for A15.0 in Spain deleted",
+			[]string{"was moved to the trash by ben@example.org."},
+		},
+	} {
+		data, _ := json.Marshal(tc.data)
+		msg, err := ts.Render("record_changed", data, mail.TemplateData{Recipient: "ana@example.org"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if msg.Subject != tc.subject {
+			t.Errorf("subject %q, want %q", msg.Subject, tc.subject)
+		}
+		for _, s := range tc.text {
+			if !strings.Contains(msg.Text, s) {
+				t.Errorf("%s: text lacks %q:\n%s", tc.data["operation"], s, msg.Text)
+			}
+		}
+	}
+}
+
+func TestRenderErrors(t *testing.T) {
+	ts := loadTemplates(t)
+	if _, err := ts.Render("missing", []byte(`{}`), mail.TemplateData{}); err == nil {
+		t.Error("rendered a missing template")
+	}
+	if _, err := ts.Render("alert", []byte(`[1, 2]`), mail.TemplateData{}); err == nil {
+		t.Error("rendered data that is not an object")
+	}
+}
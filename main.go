@@ -1,19 +1,52 @@
 // main.go
+
+//go:generate go run ./cmd/gen
+//go:generate go run ./cmd/checkassets
+
 package main
 
 import (
-	"html/template"
+	"cmp"
+	"context"
+	"database/sql"
+	"embed"
+	"io/fs"
 	"log"
+	"myapp/alert"
 	"myapp/db"
+	"myapp/fieldcrypt"
 	"myapp/handlers"
+	"myapp/hl7"
+	"myapp/job"
+	"myapp/mail"
+	"myapp/models"
+	"myapp/report"
+	"myapp/web"
+	"myapp/webhook"
 	"net/http"
 	"os"
-	"path/filepath"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
 
 	_ "github.com/lib/pq" // PostgreSQL driver
 )
 
+// Templates and static files are compiled into the binary so it can be run
+// from any directory.
+//
+//go:embed templates static
+var embedded embed.FS
+
 func main() {
+	// Background work stops on SIGINT or SIGTERM, and running jobs are
+	// given time to finish
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
 	// Fetch DATABASE_URL from environment
 	dbURL := os.Getenv("DATABASE_URL")
 	if dbURL == "" {
@@ -28,154 +61,285 @@ func main() {
 
 	log.Println("Successfully connected to the database!")
 
-	// Serve static files
-	fs := http.FileServer(http.Dir("./static"))
-	http.Handle("/static/", http.StripPrefix("/static/", fs))
-
-	templates, err := parseTemplates(
-		"templates/*.html",
-		"templates/users/*.html",
-		"templates/countries/*.html",
-		"templates/disease_types/*.html",
-		"templates/diseases/*.html",
-		"templates/discovers/*.html",
-		"templates/specializes/*.html",
-		"templates/patients/*.html",
-		"templates/public_servants/*.html",
-		"templates/doctors/*.html",
-		"templates/patient_diseases/*.html", 
-		"templates/records/*.html", 
-	)
+	if err := db.Migrate(context.Background(), dbConn); err != nil {
+		log.Fatalf("Failed to migrate the database: %v", err)
+	}
+	if err := db.CheckRowSecurity(ctx, dbConn); err != nil {
+		log.Fatalf("Refusing to start: %v", err)
+	}
+
+	// Master keys for the encrypted personal data, current key first, e.g.
+	// FIELD_ENCRYPTION_KEYS=2025:<base64 of 32 random bytes>,2024:<...>
+	if keys := os.Getenv("FIELD_ENCRYPTION_KEYS"); keys != "" {
+		models.FieldKeys, err = fieldcrypt.ParseKeys(keys)
+		if err != nil {
+			log.Fatalf("Invalid FIELD_ENCRYPTION_KEYS: %v", err)
+		}
+	} else {
+		log.Println("FIELD_ENCRYPTION_KEYS is not set: personal data is stored in plaintext")
+	}
+
+	// Subcommands, e.g. `myapp backup`, run instead of the server
+	if len(os.Args) > 1 {
+		if err := runCommand(ctx, dbConn, os.Args[1:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	// Optional per-query deadline, e.g. DB_QUERY_TIMEOUT=3s
+	if timeout := os.Getenv("DB_QUERY_TIMEOUT"); timeout != "" {
+		d, err := time.ParseDuration(timeout)
+		if err != nil {
+			log.Fatalf("Invalid DB_QUERY_TIMEOUT %q: %v", timeout, err)
+		}
+		models.QueryTimeout = d
+	}
+
+	// Deleted rows stay in the trash this long, e.g. TRASH_RETENTION=720h
+	retention := 30 * 24 * time.Hour
+	if v := os.Getenv("TRASH_RETENTION"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			log.Fatalf("Invalid TRASH_RETENTION %q: %v", v, err)
+		}
+		retention = d
+	}
+
+	// Background work is done for every organization at once, except
+	// alerts, which are evaluated for each in turn
+	system := models.WithAllTenants(ctx)
+
+	// Background jobs; the trash is purged by an hourly one, and reports
+	// are generated on their schedules
+	jobs := job.NewRunner(dbConn)
+	job.Kind[struct{}]("purge_trash").Handle(jobs, purgeTrash(dbConn, retention))
+	if err := jobs.Schedule("purge-trash", "@hourly", "purge_trash", struct{}{}); err != nil {
+		log.Fatalf("Error scheduling jobs: %v", err)
+	}
+	if err := report.Register(jobs, dbConn); err != nil {
+		log.Fatalf("Error scheduling jobs: %v", err)
+	}
+	jobsDone := make(chan struct{})
+	go func() {
+		jobs.Run(system)
+		close(jobsDone)
+	}()
+
+	// The dispatcher, mailer and alert engine stop with ctx; shutdown
+	// waits for them
+	var background sync.WaitGroup
+	runBackground := func(run func()) {
+		background.Add(1)
+		go func() {
+			defer background.Done()
+			run()
+		}()
+	}
+
+	// Deliver queued webhook events
+	runBackground(func() { webhook.NewDispatcher(dbConn).Run(system) })
+
+	// Send queued emails over SMTP, configured by the SMTP_* variables;
+	// without SMTP_HOST they are only logged. Links in emails point to
+	// APP_BASE_URL, e.g. https://health.example.org
+	mailTemplates, err := mail.LoadTemplates()
+	if err != nil {
+		log.Fatalf("Error loading email templates: %v", err)
+	}
+	smtpConfig, err := mail.ConfigFromEnv()
 	if err != nil {
-		log.Fatalf("Error parsing templates: %v", err)
-	}
-
-	dashboardHandler := handlers.NewDashboardHandler(templates)
-	userHandler := handlers.NewUserHandler(dbConn, templates)
-	countryHandler := handlers.NewCountryHandler(dbConn, templates) 
-	diseaseTypeHandler := handlers.NewDiseaseTypeHandler(dbConn, templates)
-	diseaseHandler := handlers.NewDiseaseHandler(dbConn, templates)  
-	discoverHandler := handlers.NewDiscoverHandler(dbConn, templates)
-	specializeHandler := handlers.NewSpecializeHandler(dbConn, templates)
-	patientHandler := handlers.NewPatientHandler(dbConn, templates)
-	publicServantHandler := handlers.NewPublicServantHandler(dbConn, templates)
-	doctorHandler := handlers.NewDoctorHandler(dbConn, templates)
-	patientDiseaseHandler := handlers.NewPatientDiseaseHandler(dbConn, templates)
-	recordHandler := handlers.NewRecordHandler(dbConn, templates)
-
-	// Dashboard route
-	http.HandleFunc("/", dashboardHandler.Dashboard)
-
-	// Routes for CRUD
-	http.HandleFunc("/users", userHandler.ListUsers)
-	http.HandleFunc("/users/view", userHandler.ViewUser)
-	http.HandleFunc("/users/create", userHandler.CreateUser)
-	http.HandleFunc("/users/edit", userHandler.UpdateUser)
-	http.HandleFunc("/users/delete", userHandler.DeleteUser)
-
-	http.HandleFunc("/countries", countryHandler.ListCountries)
-	http.HandleFunc("/countries/view", countryHandler.ViewCountry)
-	http.HandleFunc("/countries/create", countryHandler.CreateCountry)
-	http.HandleFunc("/countries/edit", countryHandler.UpdateCountry)
-	http.HandleFunc("/countries/delete", countryHandler.DeleteCountry)
-
-	http.HandleFunc("/disease_types", diseaseTypeHandler.ListDiseaseTypes)
-	http.HandleFunc("/disease_types/view", diseaseTypeHandler.ViewDiseaseType)
-	http.HandleFunc("/disease_types/create", diseaseTypeHandler.CreateDiseaseType)
-	http.HandleFunc("/disease_types/edit", diseaseTypeHandler.UpdateDiseaseType)
-	http.HandleFunc("/disease_types/delete", diseaseTypeHandler.DeleteDiseaseType)
-
-	http.HandleFunc("/diseases", diseaseHandler.ListDiseases)
-	http.HandleFunc("/diseases/view", diseaseHandler.ViewDisease)
-	http.HandleFunc("/diseases/create", diseaseHandler.CreateDisease)
-	http.HandleFunc("/diseases/edit", diseaseHandler.UpdateDisease)
-	http.HandleFunc("/diseases/delete", diseaseHandler.DeleteDisease)
-
-	http.HandleFunc("/discovers", discoverHandler.ListDiscovers)
-	http.HandleFunc("/discovers/view", discoverHandler.ViewDiscover)
-	http.HandleFunc("/discovers/create", discoverHandler.CreateDiscover)
-	http.HandleFunc("/discovers/edit", discoverHandler.UpdateDiscover)
-	http.HandleFunc("/discovers/delete", discoverHandler.DeleteDiscover)
-
-	http.HandleFunc("/specializes", specializeHandler.ListSpecializes)
-	http.HandleFunc("/specializes/view", specializeHandler.ViewSpecialize)
-	http.HandleFunc("/specializes/create", specializeHandler.CreateSpecialize)
-	http.HandleFunc("/specializes/edit", specializeHandler.UpdateSpecialize)
-	http.HandleFunc("/specializes/delete", specializeHandler.DeleteSpecialize)
-
-	http.HandleFunc("/patients", patientHandler.ListPatients)
-	http.HandleFunc("/patients/view", patientHandler.ViewPatient)
-	http.HandleFunc("/patients/create", patientHandler.CreatePatient)
-	http.HandleFunc("/patients/edit", patientHandler.UpdatePatient)
-	http.HandleFunc("/patients/delete", patientHandler.DeletePatient)
-
-	http.HandleFunc("/public_servants", publicServantHandler.ListPublicServants)
-	http.HandleFunc("/public_servants/view", publicServantHandler.ViewPublicServant)
-	http.HandleFunc("/public_servants/create", publicServantHandler.CreatePublicServant)
-	http.HandleFunc("/public_servants/edit", publicServantHandler.UpdatePublicServant)
-	http.HandleFunc("/public_servants/delete", publicServantHandler.DeletePublicServant)
-
-	http.HandleFunc("/doctors", doctorHandler.ListDoctors)
-	http.HandleFunc("/doctors/view", doctorHandler.ViewDoctor)
-	http.HandleFunc("/doctors/create", doctorHandler.CreateDoctor)
-	http.HandleFunc("/doctors/edit", doctorHandler.UpdateDoctor)
-	http.HandleFunc("/doctors/delete", doctorHandler.DeleteDoctor)
-
-	http.HandleFunc("/patient_diseases", patientDiseaseHandler.ListPatientDiseases)
-	http.HandleFunc("/patient_diseases/view", patientDiseaseHandler.ViewPatientDisease)
-	http.HandleFunc("/patient_diseases/create", patientDiseaseHandler.CreatePatientDisease)
-	http.HandleFunc("/patient_diseases/edit", patientDiseaseHandler.UpdatePatientDisease)
-	http.HandleFunc("/patient_diseases/delete", patientDiseaseHandler.DeletePatientDisease)
-
-	http.HandleFunc("/records", recordHandler.ListRecords)
-	http.HandleFunc("/records/view", recordHandler.ViewRecord)
-	http.HandleFunc("/records/create", recordHandler.CreateRecord)
-	http.HandleFunc("/records/edit", recordHandler.UpdateRecord)
-	http.HandleFunc("/records/delete", recordHandler.DeleteRecord)
+		log.Fatalf("Invalid SMTP configuration: %v", err)
+	}
+	var sender mail.Sender = mail.LogSender{}
+	from := "MyApp <noreply@localhost>"
+	if smtpConfig != nil {
+		sender, from = &mail.SMTPSender{Config: *smtpConfig}, smtpConfig.From
+	}
+	mailer := mail.NewMailer(dbConn, sender, mailTemplates, from)
+	mailer.BaseURL = strings.TrimSuffix(os.Getenv("APP_BASE_URL"), "/")
+	runBackground(func() { mailer.Run(system) })
 
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080" 
+	// Outbreak alerts are logged, emailed to the users who asked for them
+	// and, with ALERT_NOTIFY_URL set, posted there as JSON
+	notifiers := []alert.Notifier{alert.LogNotifier{}, mail.AlertNotifier{DB: dbConn}}
+	if notifyURL := os.Getenv("ALERT_NOTIFY_URL"); notifyURL != "" {
+		notifiers = append(notifiers, alert.NewHTTPNotifier(notifyURL))
 	}
+	alerts := alert.NewEngine(dbConn, notifiers...)
+	runBackground(func() { alerts.Run(ctx) })
 
-	log.Printf("Server starting on port %s", port)
-	err = http.ListenAndServe(":"+port, nil)
+	// DEV=1 serves templates and static files from the working directory
+	// and reparses templates on every request; otherwise the copies embedded
+	// in the binary are used.
+	dev, _ := strconv.ParseBool(os.Getenv("DEV"))
+	templates, static, err := loadAssets(dev)
 	if err != nil {
-		log.Fatalf("Server failed to start: %v", err)
+		log.Fatalf("Error loading assets: %v", err)
+	}
+	if dev {
+		log.Println("Development mode: serving templates and static files from disk")
 	}
-}
 
-func parseTemplates(patterns ...string) (map[string]*template.Template, error) {
-	tmplMap := make(map[string]*template.Template)
-	layoutFiles, err := filepath.Glob("templates/*.html")
+	dashboardHandler := handlers.NewDashboardHandler(dbConn, templates)
+
+	router := handlers.NewRouter(templates)
+
+	// The authenticating proxy, by address or network, e.g.
+	// TRUSTED_PROXIES=10.0.0.0/8. Without it every request is for the
+	// default organization.
+	router.Proxies, err = handlers.ParseTrustedProxies(os.Getenv("TRUSTED_PROXIES"))
 	if err != nil {
-		return nil, err
+		log.Fatalf("Invalid TRUSTED_PROXIES: %v", err)
 	}
 
-	for _, pattern := range patterns {
-		files, err := filepath.Glob(pattern)
-		if err != nil {
-			return nil, err
+	// Each request is for the organization of the user's session, named by
+	// the proxy in X-Forwarded-Organization, or of its subdomain of
+	// TENANT_DOMAIN, e.g. who.health.example.org with
+	// TENANT_DOMAIN=health.example.org. Requests naming neither, or not
+	// from the proxy, are for DEFAULT_ORGANIZATION (default "default"); set
+	// it empty to refuse them.
+	defaultOrg, ok := os.LookupEnv("DEFAULT_ORGANIZATION")
+	if !ok {
+		defaultOrg = "default"
+	}
+	router.Tenants = handlers.NewTenants(dbConn, os.Getenv("TENANT_DOMAIN"), defaultOrg)
+
+	// Users who may reveal personal data, by X-Forwarded-User, e.g.
+	// PERSONAL_DATA_READERS=alice@example.org,bob@example.org
+	router.PersonalDataReaders = make(map[string]bool)
+	for _, user := range strings.Split(os.Getenv("PERSONAL_DATA_READERS"), ",") {
+		if user = strings.TrimSpace(user); user != "" {
+			router.PersonalDataReaders[user] = true
 		}
+	}
+
+	// Users who see every organization's jobs and pause or run schedules,
+	// by X-Forwarded-User, e.g. OPERATORS=ops@example.org
+	router.Operators = make(map[string]bool)
+	for _, user := range strings.Split(os.Getenv("OPERATORS"), ",") {
+		if user = strings.TrimSpace(user); user != "" {
+			router.Operators[user] = true
+		}
+	}
+
+	// Serve static files
+	router.Handle("GET /static/", static)
 
-		for _, file := range files {
-			tmplFiles := append(layoutFiles, file)
-			tmpl, err := template.ParseFiles(tmplFiles...)
-			if err != nil {
-				return nil, err
+	router.Register(dashboardHandler)
+	router.Register(handlers.Resources(dbConn, templates)...)
+	router.Register(handlers.NewPersonHandler(dbConn, templates))
+	router.Register(handlers.NewTrashHandler(dbConn, templates))
+	router.Register(handlers.NewICDHandler(dbConn, templates))
+	router.Register(handlers.NewCountryMergeHandler(dbConn, templates))
+	router.Register(handlers.NewFHIRHandler(dbConn))
+
+	router.Register(handlers.NewWebhookHandler(dbConn, templates))
+	router.Register(handlers.NewEmailHandler(dbConn, templates))
+	router.Register(handlers.NewJobHandler(dbConn, templates, jobs.Wake))
+	router.Register(handlers.NewAlertHandler(dbConn, templates, alerts))
+	router.Register(handlers.NewReportHandler(dbConn, templates, jobs.Wake))
+
+	hl7Handler := handlers.NewHL7Handler(dbConn, templates)
+	router.Register(hl7Handler)
+
+	// HL7 v2 messages over MLLP, e.g. HL7_MLLP_ADDR=:2575, for the
+	// organization HL7_MLLP_ORGANIZATION (default "default")
+	var mllp *hl7.Server
+	if addr := os.Getenv("HL7_MLLP_ADDR"); addr != "" {
+		slug := cmp.Or(os.Getenv("HL7_MLLP_ORGANIZATION"), "default")
+		org, err := models.GetOrganizationBySlug(ctx, dbConn, slug)
+		if err != nil {
+			log.Fatalf("Error finding the MLLP organization: %v", err)
+		}
+		if org == nil {
+			log.Fatalf("Unknown HL7_MLLP_ORGANIZATION %q", slug)
+		}
+		handler := hl7.HandlerFunc(func(ctx context.Context, msg []byte) []byte {
+			return hl7Handler.ServeHL7(models.WithTenant(ctx, org.ID), msg)
+		})
+		mllp = &hl7.Server{Addr: addr, Handler: handler, IdleTimeout: 10 * time.Minute}
+		go func() {
+			log.Printf("MLLP listener starting on %s", addr)
+			if err := mllp.ListenAndServe(); err != hl7.ErrServerClosed {
+				log.Fatalf("MLLP listener failed: %v", err)
 			}
+		}()
+	}
 
-			// Create key based on relative path
-			relPath, err := filepath.Rel("templates", file)
-			if err != nil {
-				return nil, err
+	port := os.Getenv("PORT")
+	if port == "" {
+		port = "8080" 
+	}
+
+	server := &http.Server{Addr: ":" + port, Handler: router}
+	shutdown := make(chan struct{})
+	go func() {
+		defer close(shutdown)
+		<-ctx.Done()
+		log.Println("Shutting down")
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			log.Printf("Error shutting down the server: %v", err)
+		}
+		if mllp != nil {
+			if err := mllp.Close(); err != nil {
+				log.Printf("Error closing the MLLP listener: %v", err)
 			}
-			// Remove .html extension
-			key := relPath[:len(relPath)-len(".html")]
+		}
+	}()
+
+	log.Printf("Server starting on port %s", port)
+	err = server.ListenAndServe()
+	if err != nil && err != http.ErrServerClosed {
+		log.Fatalf("Server failed to start: %v", err)
+	}
+	<-shutdown
+	<-jobsDone
+	background.Wait()
+}
+
+// purgeTrash returns the job that permanently deletes rows that have been
+// in the trash longer than retention.
+func purgeTrash(dbConn *sql.DB, retention time.Duration) func(context.Context, struct{}) error {
+	return func(ctx context.Context, _ struct{}) error {
+		n, err := models.PurgeTrash(ctx, dbConn, time.Now().Add(-retention))
+		if n > 0 {
+			log.Printf("Purged %d rows from the trash", n)
+		}
+		return err
+	}
+}
 
-			tmplMap[key] = tmpl
+// loadAssets prepares the page templates and the static file server, from
+// disk in development and from the embedded files otherwise.
+func loadAssets(dev bool) (*web.Templates, *web.Static, error) {
+	templateFS, staticFS := fs.FS(os.DirFS("templates")), fs.FS(os.DirFS("static"))
+	if !dev {
+		var err error
+		if templateFS, err = fs.Sub(embedded, "templates"); err != nil {
+			return nil, nil, err
 		}
+		if staticFS, err = fs.Sub(embedded, "static"); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if err := web.CheckReferences(templateFS, staticFS); err != nil {
+		return nil, nil, err
 	}
 
-	return tmplMap, nil
+	static, err := web.NewStatic(staticFS, "/static/", dev)
+	if err != nil {
+		return nil, nil, err
+	}
+	funcs := static.Funcs()
+	funcs["mask"] = models.Mask
+	funcs["pathescape"] = web.PathEscape
+	templates, err := web.NewTemplates(templateFS, funcs, dev)
+	if err != nil {
+		return nil, nil, err
+	}
+	return templates, static, nil
 }
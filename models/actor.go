@@ -0,0 +1,17 @@
+package models
+
+import "context"
+
+type actorKey struct{}
+
+// WithActor records who is making the changes done with ctx, e.g. for the
+// deleted_by column.
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// Actor returns the actor recorded by WithActor, or "" if there is none.
+func Actor(ctx context.Context) string {
+	actor, _ := ctx.Value(actorKey{}).(string)
+	return actor
+}
@@ -0,0 +1,347 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// Alert rule kinds.
+const (
+	// RuleFatalityRate is met by a country and disease whose deaths are
+	// more than Threshold percent of its patients.
+	RuleFatalityRate = "fatality_rate"
+	// RuleNewDiscovery is met by a disease first encountered in a country
+	// in the last WindowDays days.
+	RuleNewDiscovery = "new_discovery"
+	// RulePatientGrowth is met by a country and disease whose patients grew
+	// by more than Threshold percent over the last WindowDays days.
+	RulePatientGrowth = "patient_growth"
+)
+
+// AlertRuleKinds lists every rule kind.
+var AlertRuleKinds = []string{RuleFatalityRate, RuleNewDiscovery, RulePatientGrowth}
+
+// Alert severities.
+var AlertSeverities = []string{"info", "warning", "critical"}
+
+// Alert statuses. An open alert is acknowledged when someone is looking
+// into it and resolved when dealt with.
+const (
+	AlertOpen         = "open"
+	AlertAcknowledged = "acknowledged"
+	AlertResolved     = "resolved"
+)
+
+// AlertRule is a condition over records and discoveries, limited to one
+// disease and one country when those are set.
+type AlertRule struct {
+	ID          int
+	Name        string
+	Kind        string
+	DiseaseCode sql.NullString
+	CName       sql.NullString
+	Threshold   float64 // percent
+	MinPatients int     // subjects with fewer patients are ignored
+	WindowDays  int
+	Severity    string
+	Active      bool
+	CreatedAt   time.Time
+}
+
+// AlertFinding is a country and disease that meets a rule.
+type AlertFinding struct {
+	CName       string
+	DiseaseCode string
+	Message     string
+	Value       sql.NullFloat64
+}
+
+// Alert is a finding raised for a rule.
+type Alert struct {
+	ID       int64
+	RuleID   int
+	RuleName string
+	Severity string
+	AlertFinding
+	Status         string
+	RaisedAt       time.Time
+	AcknowledgedAt sql.NullTime
+	AcknowledgedBy sql.NullString
+	ResolvedAt     sql.NullTime
+	ResolvedBy     sql.NullString
+	ClearedAt      sql.NullTime
+}
+
+// ErrNoAlert is returned for an alert or rule that does not exist, or an
+// alert that cannot move to the requested status.
+var ErrNoAlert = errors.New("alert not found")
+
+// GetAlertRules lists every rule by name.
+func GetAlertRules(ctx context.Context, db *sql.DB) ([]AlertRule, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	rows, err := db.QueryContext(ctx, "SELECT id, name, kind, disease_code, cname, threshold, min_patients, window_days, severity, active, created_at"+
+		" FROM alert_rule ORDER BY name, id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []AlertRule
+	for rows.Next() {
+		var x AlertRule
+		if err := rows.Scan(&x.ID, &x.Name, &x.Kind, &x.DiseaseCode, &x.CName, &x.Threshold, &x.MinPatients, &x.WindowDays,
+			&x.Severity, &x.Active, &x.CreatedAt); err != nil {
+			return nil, err
+		}
+		items = append(items, x)
+	}
+	return items, rows.Err()
+}
+
+// CreateAlertRule stores a rule and sets its ID.
+func CreateAlertRule(ctx context.Context, db *sql.DB, x *AlertRule) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	return db.QueryRowContext(ctx, "INSERT INTO alert_rule (name, kind, disease_code, cname, threshold, min_patients, window_days, severity, active)"+
+		" VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) RETURNING id, created_at",
+		x.Name, x.Kind, x.DiseaseCode, x.CName, x.Threshold, x.MinPatients, x.WindowDays, x.Severity, x.Active).
+		Scan(&x.ID, &x.CreatedAt)
+}
+
+// SetAlertRuleActive pauses or resumes a rule. Alerts of a paused rule
+// are left as they are.
+func SetAlertRuleActive(ctx context.Context, db *sql.DB, id int, active bool) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	res, err := db.ExecContext(ctx, "UPDATE alert_rule SET active=$1 WHERE id=$2", active, id)
+	return alertFound(res, err)
+}
+
+// DeleteAlertRule removes a rule and its alerts.
+func DeleteAlertRule(ctx context.Context, db *sql.DB, id int) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	res, err := db.ExecContext(ctx, "DELETE FROM alert_rule WHERE id=$1", id)
+	return alertFound(res, err)
+}
+
+const alertColumns = "a.id, a.rule_id, r.name, r.severity, a.cname, a.disease_code, a.message, a.value, a.status, a.raised_at," +
+	" a.acknowledged_at, a.acknowledged_by, a.resolved_at, a.resolved_by, a.cleared_at"
+
+func scanAlerts(rows *sql.Rows) ([]Alert, error) {
+	defer rows.Close()
+
+	var items []Alert
+	for rows.Next() {
+		var x Alert
+		if err := rows.Scan(&x.ID, &x.RuleID, &x.RuleName, &x.Severity, &x.CName, &x.DiseaseCode, &x.Message, &x.Value, &x.Status,
+			&x.RaisedAt, &x.AcknowledgedAt, &x.AcknowledgedBy, &x.ResolvedAt, &x.ResolvedBy, &x.ClearedAt); err != nil {
+			return nil, err
+		}
+		items = append(items, x)
+	}
+	return items, rows.Err()
+}
+
+// GetUnresolvedAlerts lists the open and acknowledged alerts, most severe
+// and then newest first.
+func GetUnresolvedAlerts(ctx context.Context, db *sql.DB) ([]Alert, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	rows, err := db.QueryContext(ctx, "SELECT "+alertColumns+" FROM alert a JOIN alert_rule r ON r.id = a.rule_id"+
+		" WHERE a.status <> 'resolved'"+
+		" ORDER BY array_position(ARRAY['critical', 'warning', 'info'], r.severity), a.raised_at DESC, a.id DESC")
+	if err != nil {
+		return nil, err
+	}
+	return scanAlerts(rows)
+}
+
+// GetRecentAlerts lists up to limit alerts in any status, newest first.
+func GetRecentAlerts(ctx context.Context, db *sql.DB, limit int) ([]Alert, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	rows, err := db.QueryContext(ctx, "SELECT "+alertColumns+" FROM alert a JOIN alert_rule r ON r.id = a.rule_id"+
+		" ORDER BY a.raised_at DESC, a.id DESC LIMIT $1", limit)
+	if err != nil {
+		return nil, err
+	}
+	return scanAlerts(rows)
+}
+
+// SetAlertStatus acknowledges or resolves an alert. An open alert can be
+// acknowledged, and any unresolved one resolved.
+func SetAlertStatus(ctx context.Context, db *sql.DB, id int64, status string) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	actor := nullString(Actor(ctx))
+	var res sql.Result
+	var err error
+	switch status {
+	case AlertAcknowledged:
+		res, err = db.ExecContext(ctx, "UPDATE alert SET status='acknowledged', acknowledged_at=now(), acknowledged_by=$1"+
+			" WHERE id=$2 AND status='open'", actor, id)
+	case AlertResolved:
+		res, err = db.ExecContext(ctx, "UPDATE alert SET status='resolved', resolved_at=now(), resolved_by=$1"+
+			" WHERE id=$2 AND status <> 'resolved'", actor, id)
+	default:
+		return ErrNoAlert
+	}
+	return alertFound(res, err)
+}
+
+// RaiseAlerts records the outcome of evaluating a rule. A finding raises
+// a new alert unless its subject's last alert is still unresolved, or was
+// resolved while the rule was still met; so a resolved alert comes back
+// only after the rule stops and starts being met again. Subjects no
+// longer found have their last alert marked cleared. The new alerts are
+// returned.
+func RaiseAlerts(ctx context.Context, db *sql.DB, rule *AlertRule, findings []AlertFinding) ([]Alert, error) {
+	var raised []Alert
+	err := inTx(ctx, db, func(ctx context.Context, tx *sql.Tx) error {
+		// Evaluations of the same rule take turns.
+		if _, err := tx.ExecContext(ctx, "SELECT 1 FROM alert_rule WHERE id=$1 FOR UPDATE", rule.ID); err != nil {
+			return err
+		}
+
+		type subject struct{ cname, code string }
+		type last struct {
+			id      int64
+			status  string
+			cleared bool
+		}
+		latest := make(map[subject]last)
+		rows, err := tx.QueryContext(ctx, "SELECT DISTINCT ON (cname, disease_code) id, cname, disease_code, status, cleared_at IS NOT NULL"+
+			" FROM alert WHERE rule_id=$1 ORDER BY cname, disease_code, id DESC", rule.ID)
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			var s subject
+			var l last
+			if err := rows.Scan(&l.id, &s.cname, &s.code, &l.status, &l.cleared); err != nil {
+				rows.Close()
+				return err
+			}
+			latest[s] = l
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		found := make(map[subject]bool)
+		for _, f := range findings {
+			s := subject{f.CName, f.DiseaseCode}
+			found[s] = true
+			l, ok := latest[s]
+			if ok && (l.status != AlertResolved || !l.cleared) {
+				// Keep the unresolved alert current.
+				if l.status != AlertResolved {
+					_, err := tx.ExecContext(ctx, "UPDATE alert SET message=$1, value=$2, cleared_at=NULL WHERE id=$3", f.Message, f.Value, l.id)
+					if err != nil {
+						return err
+					}
+				}
+				continue
+			}
+			a := Alert{RuleID: rule.ID, RuleName: rule.Name, Severity: rule.Severity, AlertFinding: f, Status: AlertOpen}
+			err := tx.QueryRowContext(ctx, "INSERT INTO alert (rule_id, cname, disease_code, message, value) VALUES ($1, $2, $3, $4, $5)"+
+				" RETURNING id, raised_at", rule.ID, f.CName, f.DiseaseCode, f.Message, f.Value).
+				Scan(&a.ID, &a.RaisedAt)
+			if err != nil {
+				return err
+			}
+			raised = append(raised, a)
+		}
+
+		for s, l := range latest {
+			if !found[s] && !l.cleared {
+				if _, err := tx.ExecContext(ctx, "UPDATE alert SET cleared_at=now() WHERE id=$1", l.id); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return raised, nil
+}
+
+// GetUnnotifiedAlerts lists the alerts no notifier has been told about
+// yet, oldest first.
+func GetUnnotifiedAlerts(ctx context.Context, db *sql.DB) ([]Alert, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	rows, err := db.QueryContext(ctx, "SELECT "+alertColumns+" FROM alert a JOIN alert_rule r ON r.id = a.rule_id"+
+		" WHERE a.notified_at IS NULL ORDER BY a.id")
+	if err != nil {
+		return nil, err
+	}
+	return scanAlerts(rows)
+}
+
+// MarkAlertNotified records that the notifiers were told about an alert.
+func MarkAlertNotified(ctx context.Context, db *sql.DB, id int64) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	_, err := db.ExecContext(ctx, "UPDATE alert SET notified_at=now() WHERE id=$1", id)
+	return err
+}
+
+// GetRecordsAsOf returns the records that existed, and were not in the
+// trash, at the given time, from their history.
+func GetRecordsAsOf(ctx context.Context, db *sql.DB, at time.Time) ([]Record, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	rows, err := db.QueryContext(ctx, `SELECT data FROM row_history
+		WHERE table_name='record' AND valid_from <= $1 AND (valid_to IS NULL OR valid_to > $1) AND data->>'deleted_at' IS NULL`, at)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []Record
+	for rows.Next() {
+		var data []byte
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		var x Record
+		if err := json.Unmarshal(data, &x); err != nil {
+			return nil, err
+		}
+		items = append(items, x)
+	}
+	return items, rows.Err()
+}
+
+func alertFound(res sql.Result, err error) error {
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNoAlert
+	}
+	return nil
+}
@@ -0,0 +1,248 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// RowOutcome is what a bulk action did to one selected row.
+type RowOutcome struct {
+	Key     []string
+	OK      bool
+	Message string
+}
+
+// BulkResult reports a bulk action row by row. The action runs in a single
+// transaction: if any row fails, nothing is applied and Committed is false.
+type BulkResult struct {
+	Committed bool
+	Rows      []RowOutcome
+}
+
+// Failed counts the rows that could not be processed.
+func (b *BulkResult) Failed() int {
+	n := 0
+	for _, r := range b.Rows {
+		if !r.OK {
+			n++
+		}
+	}
+	return n
+}
+
+// errBulkFailed rolls back a bulk transaction after some rows failed.
+var errBulkFailed = errors.New("bulk action failed")
+
+// bulk runs fn for every key inside one transaction, each under a savepoint
+// so that a failing row does not hide the outcome of the others, with start
+// and finish, if set, run before and after them. It returns an error only
+// when the transaction itself could not be run or start failed. The
+// transaction is given QueryTimeout plus BulkRowTimeout for every key.
+func bulk(ctx context.Context, db *sql.DB, t *TableInfo, keys [][]string, start func(ctx context.Context, tx *sql.Tx) error, fn func(ctx context.Context, tx *sql.Tx, key []any) (string, error), finish func(ctx context.Context, tx *sql.Tx) error) (*BulkResult, error) {
+	result := &BulkResult{}
+	for _, key := range keys {
+		if len(key) != len(t.Keys) {
+			return nil, fmt.Errorf("%s needs %d key values, got %d", t.Name, len(t.Keys), len(key))
+		}
+	}
+
+	timeout := QueryTimeout
+	if timeout > 0 {
+		timeout += time.Duration(len(keys)) * BulkRowTimeout
+	}
+	err := inTxFor(ctx, db, timeout, func(ctx context.Context, tx *sql.Tx) error {
+		if start != nil {
+			if err := start(ctx, tx); err != nil {
+				return err
+			}
+		}
+		for _, key := range keys {
+			args := make([]any, len(key))
+			for i, v := range key {
+				args[i] = v
+			}
+
+			if _, err := tx.ExecContext(ctx, "SAVEPOINT bulk_row"); err != nil {
+				return err
+			}
+			msg, err := fn(ctx, tx, args)
+			if err != nil {
+				if _, rerr := tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT bulk_row"); rerr != nil {
+					return rerr
+				}
+				result.Rows = append(result.Rows, RowOutcome{Key: key, Message: err.Error()})
+				continue
+			}
+			if _, err := tx.ExecContext(ctx, "RELEASE SAVEPOINT bulk_row"); err != nil {
+				return err
+			}
+			result.Rows = append(result.Rows, RowOutcome{Key: key, OK: true, Message: msg})
+		}
+
+		if result.Failed() > 0 {
+			return errBulkFailed
+		}
+		if finish != nil {
+			return finish(ctx, tx)
+		}
+		return nil
+	})
+	if errors.Is(err, errBulkFailed) {
+		for i := range result.Rows {
+			if result.Rows[i].OK {
+				result.Rows[i].OK = false
+				result.Rows[i].Message = "Not applied: other rows failed"
+			}
+		}
+		return result, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	result.Committed = true
+	return result, nil
+}
+
+// BulkDelete deletes the given rows of table in one transaction. Rows of
+// soft-delete tables go to the trash together with their dependents, as one
+// batch sharing a deletion time.
+func BulkDelete(ctx context.Context, db *sql.DB, table string, keys [][]string) (*BulkResult, error) {
+	t := TableByName(table)
+	if t == nil {
+		return nil, fmt.Errorf("unknown table %q", table)
+	}
+	stamp := time.Now().UTC().Truncate(time.Microsecond)
+	actor := nullString(Actor(ctx))
+
+	del := func(ctx context.Context, tx *sql.Tx, key []any) (string, error) {
+		var res sql.Result
+		var err error
+		if t.SoftDelete {
+			res, err = tx.ExecContext(ctx, "UPDATE "+t.Name+" SET deleted_at=$1, deleted_by=$2 WHERE "+keyWhere(t, "", 3)+" AND deleted_at IS NULL",
+				append([]any{stamp, actor}, key...)...)
+		} else {
+			res, err = tx.ExecContext(ctx, "DELETE FROM "+t.Name+" WHERE "+keyWhere(t, "", 1), key...)
+		}
+		if err != nil {
+			return "", err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return "", errors.New("Not found")
+		}
+		if t.SoftDelete {
+			return "Moved to trash", nil
+		}
+		return "Deleted", nil
+	}
+
+	var cascade func(ctx context.Context, tx *sql.Tx) error
+	if t.SoftDelete {
+		cascade = func(ctx context.Context, tx *sql.Tx) error {
+			return cascadeDelete(ctx, tx, stamp, actor)
+		}
+	}
+	return bulk(ctx, db, t, keys, nil, del, cascade)
+}
+
+// BulkReassign points column, a foreign key of table, at value for every
+// given row in one transaction, e.g. moving patient diseases to another
+// disease code. The referenced row must exist and not be deleted, or it
+// returns ErrMissingParent.
+func BulkReassign(ctx context.Context, db *sql.DB, table, column, value string, keys [][]string) (*BulkResult, error) {
+	t := TableByName(table)
+	if t == nil {
+		return nil, fmt.Errorf("unknown table %q", table)
+	}
+	reassignable := false
+	for _, ref := range t.References {
+		if ref.Column == column {
+			reassignable = true
+		}
+	}
+	if !reassignable {
+		return nil, fmt.Errorf("%s cannot be reassigned by %q", t.Label, column)
+	}
+
+	set := column + "=$1"
+	if t.Versioned {
+		set += ", version=version+1"
+	}
+
+	// The parent is locked until the end, so it cannot be deleted meanwhile.
+	check := func(ctx context.Context, tx *sql.Tx) error {
+		return requireParents(ctx, tx, t.Name, map[string]any{column: value})
+	}
+	move := func(ctx context.Context, tx *sql.Tx, key []any) (string, error) {
+		res, err := tx.ExecContext(ctx, "UPDATE "+t.Name+" SET "+set+" WHERE "+keyWhere(t, "", 2)+" AND deleted_at IS NULL",
+			append([]any{value}, key...)...)
+		if err != nil {
+			return "", err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return "", errors.New("Not found")
+		}
+		return "Reassigned to " + value, nil
+	}
+	return bulk(ctx, db, t, keys, check, move, nil)
+}
+
+// ExportRows reads the given rows of table in one transaction, as text in
+// the order of t.Columns, decrypted. Rows that do not exist are reported
+// in the result and leave nothing to export.
+func ExportRows(ctx context.Context, db *sql.DB, table string, keys [][]string) (*BulkResult, [][]string, error) {
+	t := TableByName(table)
+	if t == nil {
+		return nil, nil, fmt.Errorf("unknown table %q", table)
+	}
+
+	cols := ""
+	for i, c := range t.Columns {
+		if i > 0 {
+			cols += ", "
+		}
+		cols += c.Name + "::text"
+	}
+	live := ""
+	if t.SoftDelete {
+		live = " AND deleted_at IS NULL"
+	}
+
+	var rows [][]string
+	read := func(ctx context.Context, tx *sql.Tx, key []any) (string, error) {
+		values := make([]sql.NullString, len(t.Columns))
+		dest := make([]any, len(values))
+		for i := range values {
+			dest[i] = &values[i]
+		}
+		err := tx.QueryRowContext(ctx, "SELECT "+cols+" FROM "+t.Name+" WHERE "+keyWhere(t, "", 1)+live, key...).Scan(dest...)
+		if err == sql.ErrNoRows {
+			return "", errors.New("Not found")
+		}
+		if err != nil {
+			return "", err
+		}
+		row := make([]string, len(values))
+		for i, v := range values {
+			row[i] = v.String
+			if c := t.Columns[i]; c.Encrypted && v.Valid {
+				if row[i], err = openValue(t.column(c.Name), v.String); err != nil {
+					return "", err
+				}
+			}
+		}
+		rows = append(rows, row)
+		return "Exported", nil
+	}
+
+	result, err := bulk(ctx, db, t, keys, nil, read, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !result.Committed {
+		return result, nil, nil
+	}
+	return result, rows, nil
+}
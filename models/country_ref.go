@@ -0,0 +1,310 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"myapp/iso3166"
+	"sort"
+	"strings"
+)
+
+// ResolveCountry maps a country name as entered or imported to the name of
+// an existing country: an exact match ignoring case, a merged-away name
+// recorded in country_alias, or any name or code of the same ISO 3166
+// country. Names that match nothing are returned unchanged.
+func ResolveCountry(ctx context.Context, db *sql.DB, name string) (string, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	name = strings.TrimSpace(name)
+	var cname string
+	err := db.QueryRowContext(ctx, "SELECT cname FROM Country WHERE lower(cname) = lower($1) AND deleted_at IS NULL"+
+		" UNION ALL SELECT a.cname FROM country_alias a JOIN Country c ON c.cname = a.cname WHERE a.alias_key = $2 AND c.deleted_at IS NULL"+
+		" LIMIT 1", name, iso3166.Key(name)).
+		Scan(&cname)
+	if err == nil {
+		return cname, nil
+	}
+	if err != sql.ErrNoRows {
+		return "", err
+	}
+
+	iso, ok := iso3166.Lookup(name)
+	if !ok {
+		return name, nil
+	}
+	err = db.QueryRowContext(ctx, "SELECT cname FROM Country WHERE (iso_alpha2 = $1 OR lower(cname) = lower($2)) AND deleted_at IS NULL"+
+		" ORDER BY iso_alpha2 = $1 DESC LIMIT 1", iso.Alpha2, iso.Name).
+		Scan(&cname)
+	if err == sql.ErrNoRows {
+		return name, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return cname, nil
+}
+
+// CountryCodes sets the ISO codes of c from the ISO 3166 entry named by
+// its name or by any code already set. It fails if the codes that are set
+// belong to different countries.
+func CountryCodes(c *Country) error {
+	var match *iso3166.Country
+	for _, code := range []sql.NullString{c.ISOAlpha2, c.ISOAlpha3, c.ISONumeric} {
+		if !code.Valid {
+			continue
+		}
+		iso, ok := iso3166.Lookup(code.String)
+		if !ok {
+			return fmt.Errorf("unknown ISO 3166 code %q", code.String)
+		}
+		if match != nil && *match != iso {
+			return fmt.Errorf("ISO codes %s and %s belong to different countries", match.Alpha2, code.String)
+		}
+		match = &iso
+	}
+	if match == nil {
+		iso, ok := iso3166.Lookup(c.CName)
+		if !ok {
+			return nil
+		}
+		match = &iso
+	}
+
+	c.ISOAlpha2 = sql.NullString{String: match.Alpha2, Valid: true}
+	c.ISOAlpha3 = sql.NullString{String: match.Alpha3, Valid: true}
+	c.ISONumeric = sql.NullString{String: match.Numeric, Valid: true}
+	return nil
+}
+
+// BackfillCountryCodes sets the ISO codes of every country that has none
+// and whose name identifies an ISO 3166 country. It returns the number of
+// countries updated and the names it could not place, including those
+// whose codes are already taken by another country, which are likely
+// duplicates to merge.
+func BackfillCountryCodes(ctx context.Context, db *sql.DB) (int, []string, error) {
+	countries, err := GetAllCountries(ctx, db)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	taken := make(map[string]string)
+	for _, c := range countries {
+		if c.ISOAlpha2.Valid {
+			taken[c.ISOAlpha2.String] = c.CName
+		}
+	}
+
+	updated := 0
+	var unmatched []string
+	for _, c := range countries {
+		if c.ISOAlpha2.Valid {
+			continue
+		}
+		iso, ok := iso3166.Lookup(c.CName)
+		if !ok {
+			unmatched = append(unmatched, c.CName)
+			continue
+		}
+		if other, ok := taken[iso.Alpha2]; ok {
+			unmatched = append(unmatched, fmt.Sprintf("%s (same country as %s)", c.CName, other))
+			continue
+		}
+
+		ctx, cancel := withTimeout(ctx)
+		_, err := db.ExecContext(ctx, "UPDATE Country SET iso_alpha2=$1, iso_alpha3=$2, iso_numeric=$3, version=version+1 WHERE cname=$4 AND deleted_at IS NULL",
+			iso.Alpha2, iso.Alpha3, iso.Numeric, c.CName)
+		cancel()
+		if err != nil {
+			return updated, unmatched, fmt.Errorf("%s: %w", c.CName, err)
+		}
+		taken[iso.Alpha2] = c.CName
+		updated++
+	}
+	return updated, unmatched, nil
+}
+
+// SeedCountries adds every ISO 3166 country that does not exist yet, with
+// a population of 0, and returns how many were added.
+func SeedCountries(ctx context.Context, db *sql.DB) (int, error) {
+	added := 0
+	err := inTx(ctx, db, func(ctx context.Context, tx *sql.Tx) error {
+		for _, iso := range iso3166.All() {
+			res, err := tx.ExecContext(ctx, "INSERT INTO Country (cname, population, iso_alpha2, iso_alpha3, iso_numeric)"+
+				" SELECT $1, 0, $2, $3, $4 WHERE NOT EXISTS (SELECT 1 FROM Country WHERE iso_alpha2 = $2 AND deleted_at IS NULL)"+
+				" ON CONFLICT (tenant_id, cname) DO NOTHING", iso.Name, iso.Alpha2, iso.Alpha3, iso.Numeric)
+			if err != nil {
+				return fmt.Errorf("%s: %w", iso.Name, err)
+			}
+			n, _ := res.RowsAffected()
+			added += int(n)
+		}
+		return nil
+	})
+	return added, err
+}
+
+// DuplicateCountries groups the countries that name the same ISO 3166
+// country, e.g. "USA" and "United States", as candidates for a merge. The
+// first name of each group is the one with ISO codes, if any.
+func DuplicateCountries(ctx context.Context, db *sql.DB) ([][]string, error) {
+	countries, err := GetAllCountries(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+
+	groups := make(map[string][]Country)
+	for _, c := range countries {
+		code := c.ISOAlpha2.String
+		if !c.ISOAlpha2.Valid {
+			iso, ok := iso3166.Lookup(c.CName)
+			if !ok {
+				continue
+			}
+			code = iso.Alpha2
+		}
+		groups[code] = append(groups[code], c)
+	}
+
+	var out [][]string
+	for _, g := range groups {
+		if len(g) < 2 {
+			continue
+		}
+		sort.SliceStable(g, func(i, j int) bool { return g[i].ISOAlpha2.Valid && !g[j].ISOAlpha2.Valid })
+		names := make([]string, len(g))
+		for i, c := range g {
+			names[i] = c.CName
+		}
+		out = append(out, names)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i][0] < out[j][0] })
+	return out, nil
+}
+
+// MergeResult counts the rows moved by MergeCountries.
+type MergeResult struct {
+	Users       int
+	Discoveries int
+	Records     int
+	Combined    int // rows folded into an existing row of the target
+}
+
+// ErrMergeTarget is returned by MergeCountries when the target is also
+// one of the countries to merge.
+var ErrMergeTarget = errors.New("cannot merge a country into itself")
+
+// MergeCountries folds duplicate countries into one in a single
+// transaction. Their users, discoveries and records are re-pointed at into;
+// a discovery or record that into already has for the same key is combined
+// with it, keeping the earliest encounter date and summing the totals. The
+// merged countries are deleted, their names kept as aliases of into, and
+// into inherits their ISO codes if it has none.
+func MergeCountries(ctx context.Context, db *sql.DB, into string, from []string) (*MergeResult, error) {
+	result := &MergeResult{}
+	err := inTx(ctx, db, func(ctx context.Context, tx *sql.Tx) error {
+		if err := liveCountry(ctx, tx, into); err != nil {
+			return err
+		}
+		for _, name := range from {
+			if name == into {
+				return ErrMergeTarget
+			}
+			if err := liveCountry(ctx, tx, name); err != nil {
+				return err
+			}
+			if err := mergeCountry(ctx, tx, into, name, result); err != nil {
+				return fmt.Errorf("merging %s: %w", name, err)
+			}
+		}
+		_, err := tx.ExecContext(ctx, "UPDATE Country SET version=version+1 WHERE cname=$1", into)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func liveCountry(ctx context.Context, tx *sql.Tx, name string) error {
+	var ok bool
+	err := tx.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM Country WHERE cname=$1 AND deleted_at IS NULL)", name).Scan(&ok)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("%w: country %q", ErrMissingParent, name)
+	}
+	return nil
+}
+
+func mergeCountry(ctx context.Context, tx *sql.Tx, into, from string, result *MergeResult) error {
+	count := func(n *int, query string) error {
+		res, err := tx.ExecContext(ctx, query, into, from)
+		if err != nil {
+			return err
+		}
+		affected, _ := res.RowsAffected()
+		*n += int(affected)
+		return nil
+	}
+
+	// Fold rows that collide with a row of the target, then move the rest.
+	steps := []struct {
+		n     *int
+		query string
+	}{
+		{&result.Combined, "UPDATE Discover t SET first_enc_date = LEAST(t.first_enc_date, s.first_enc_date), version = t.version + 1," +
+			" deleted_at = CASE WHEN s.deleted_at IS NULL THEN NULL ELSE t.deleted_at END," +
+			" deleted_by = CASE WHEN s.deleted_at IS NULL THEN NULL ELSE t.deleted_by END" +
+			" FROM Discover s WHERE t.cname = $1 AND s.cname = $2 AND s.disease_code = t.disease_code"},
+		{new(int), "DELETE FROM Discover s WHERE s.cname = $2 AND EXISTS (SELECT 1 FROM Discover t WHERE t.cname = $1 AND t.disease_code = s.disease_code)"},
+		{&result.Discoveries, "UPDATE Discover SET cname = $1, version = version + 1 WHERE cname = $2"},
+
+		{&result.Combined, "UPDATE Record t SET total_deaths = t.total_deaths + s.total_deaths, total_patients = t.total_patients + s.total_patients, version = t.version + 1," +
+			" deleted_at = CASE WHEN s.deleted_at IS NULL THEN NULL ELSE t.deleted_at END," +
+			" deleted_by = CASE WHEN s.deleted_at IS NULL THEN NULL ELSE t.deleted_by END" +
+			" FROM Record s WHERE t.cname = $1 AND s.cname = $2 AND s.email = t.email AND s.disease_code = t.disease_code"},
+		{new(int), "DELETE FROM Record s WHERE s.cname = $2 AND EXISTS (SELECT 1 FROM Record t WHERE t.cname = $1 AND t.email = s.email AND t.disease_code = s.disease_code)"},
+		{&result.Records, "UPDATE Record SET cname = $1, version = version + 1 WHERE cname = $2"},
+
+		{&result.Users, "UPDATE Users SET cname = $1, version = version + 1 WHERE cname = $2"},
+		{new(int), "UPDATE country_alias SET cname = $1 WHERE cname = $2"},
+	}
+	for _, s := range steps {
+		if err := count(s.n, s.query); err != nil {
+			return err
+		}
+	}
+
+	var alpha2, alpha3, numeric sql.NullString
+	err := tx.QueryRowContext(ctx, "DELETE FROM Country WHERE cname = $1 RETURNING iso_alpha2, iso_alpha3, iso_numeric", from).
+		Scan(&alpha2, &alpha3, &numeric)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, "UPDATE Country SET iso_alpha2 = $2, iso_alpha3 = $3, iso_numeric = $4 WHERE cname = $1 AND iso_alpha2 IS NULL AND $2::char(2) IS NOT NULL",
+		into, alpha2, alpha3, numeric)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, "INSERT INTO country_alias (alias_key, alias, cname) VALUES ($1, $2, $3)"+
+		" ON CONFLICT (tenant_id, alias_key) DO UPDATE SET cname = EXCLUDED.cname", iso3166.Key(from), from, into)
+	return err
+}
+
+// CountryByISO returns the name of the live country with the given alpha-2
+// code, or "" if there is none.
+func CountryByISO(ctx context.Context, db *sql.DB, alpha2 string) (string, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	var cname string
+	err := db.QueryRowContext(ctx, "SELECT cname FROM Country WHERE iso_alpha2 = $1 AND deleted_at IS NULL", alpha2).Scan(&cname)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return cname, err
+}
@@ -0,0 +1,140 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Diagnosis is a coded diagnosis received from another system.
+type Diagnosis struct {
+	Code        string
+	System      string // coding system as sent, e.g. "I10"
+	Description string
+}
+
+// DiagnosisReview is a received diagnosis whose code matched no disease.
+type DiagnosisReview struct {
+	ID         int
+	ReceivedAt time.Time
+	Source     string
+	Email      string
+	Diagnosis
+}
+
+// IngestResult tells what IngestPatient did with each diagnosis.
+type IngestResult struct {
+	Linked []string    // disease codes added to the patient
+	Queued []Diagnosis // diagnoses waiting on the review page
+}
+
+// ErrReviewed is returned for a review that was already resolved.
+var ErrReviewed = errors.New("diagnosis was already reviewed")
+
+// IngestPatient upserts a person as a patient and adds the diagnoses to
+// it, in one transaction. A diagnosis whose code is not a disease, even
+// ignoring case and dots, is queued for review with source recorded.
+func IngestPatient(ctx context.Context, db *sql.DB, p *ExchangePerson, diagnoses []Diagnosis, source string) (*IngestResult, error) {
+	stamp := time.Now().UTC().Truncate(time.Microsecond)
+	actor := nullString(Actor(ctx))
+	p.Patient = true
+
+	result := &IngestResult{}
+	err := inTx(ctx, db, func(ctx context.Context, tx *sql.Tx) error {
+		if err := upsertPerson(ctx, tx, p, stamp, actor); err != nil {
+			return err
+		}
+		for _, d := range diagnoses {
+			var code string
+			err := tx.QueryRowContext(ctx, "SELECT disease_code FROM Disease"+
+				" WHERE upper(replace(replace(disease_code, '.', ''), ' ', '')) = $1 AND deleted_at IS NULL"+
+				" ORDER BY disease_code = $2 DESC LIMIT 1", ICDKey(d.Code), d.Code).
+				Scan(&code)
+			if err == sql.ErrNoRows {
+				_, err = tx.ExecContext(ctx, "INSERT INTO diagnosis_review (source, email, code, coding_system, description) VALUES ($1, $2, $3, $4, $5)",
+					source, p.User.Email, d.Code, d.System, d.Description)
+				if err != nil {
+					return err
+				}
+				result.Queued = append(result.Queued, d)
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			if err := addPatientDisease(ctx, tx, p.User.Email, code); err != nil {
+				return err
+			}
+			result.Linked = append(result.Linked, code)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func addPatientDisease(ctx context.Context, tx *sql.Tx, email, code string) error {
+	_, err := tx.ExecContext(ctx, "INSERT INTO PatientDisease (email, disease_code) VALUES ($1, $2)"+
+		" ON CONFLICT (tenant_id, email, disease_code) DO UPDATE SET deleted_at = NULL, deleted_by = NULL, version = PatientDisease.version + 1",
+		email, code)
+	return err
+}
+
+// GetDiagnosisReviews lists the diagnoses waiting for review, oldest first.
+func GetDiagnosisReviews(ctx context.Context, db *sql.DB) ([]DiagnosisReview, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	rows, err := db.QueryContext(ctx, "SELECT id, received_at, source, email, code, coding_system, description FROM diagnosis_review"+
+		" WHERE resolved_at IS NULL ORDER BY received_at, id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []DiagnosisReview
+	for rows.Next() {
+		var x DiagnosisReview
+		if err := rows.Scan(&x.ID, &x.ReceivedAt, &x.Source, &x.Email, &x.Code, &x.System, &x.Description); err != nil {
+			return nil, err
+		}
+		items = append(items, x)
+	}
+	return items, rows.Err()
+}
+
+// ResolveDiagnosisReview adds the disease code to the patient of a queued
+// diagnosis, or dismisses the diagnosis if code is "".
+func ResolveDiagnosisReview(ctx context.Context, db *sql.DB, id int, code string) error {
+	actor := nullString(Actor(ctx))
+	return inTx(ctx, db, func(ctx context.Context, tx *sql.Tx) error {
+		var email string
+		err := tx.QueryRowContext(ctx, "UPDATE diagnosis_review SET resolved_at=now(), resolved_by=$1, disease_code=$2"+
+			" WHERE id=$3 AND resolved_at IS NULL RETURNING email", actor, nullString(code), id).
+			Scan(&email)
+		if err == sql.ErrNoRows {
+			return ErrReviewed
+		}
+		if err != nil || code == "" {
+			return err
+		}
+		var disease, patient bool
+		err = tx.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM Disease WHERE disease_code=$1 AND deleted_at IS NULL),"+
+			" EXISTS (SELECT 1 FROM Patients WHERE email=$2 AND deleted_at IS NULL)", code, email).
+			Scan(&disease, &patient)
+		if err != nil {
+			return err
+		}
+		if !disease {
+			return fmt.Errorf("%w: Disease %q", ErrMissingParent, code)
+		}
+		if !patient {
+			return fmt.Errorf("%w: Patients %q", ErrMissingParent, email)
+		}
+		return addPatientDisease(ctx, tx, email, code)
+	})
+}
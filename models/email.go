@@ -0,0 +1,218 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// Which outbreak alerts a user is emailed about.
+const (
+	AlertEmailsNone    = "none"
+	AlertEmailsCountry = "country" // alerts for the user's country
+	AlertEmailsAll     = "all"
+)
+
+// NotificationPreference is what a user is emailed about.
+type NotificationPreference struct {
+	Email         string
+	RecordChanges bool // changes to the records the user reported
+	Alerts        string
+}
+
+// DefaultNotificationPreference applies to users who never chose.
+var DefaultNotificationPreference = NotificationPreference{RecordChanges: true, Alerts: AlertEmailsNone}
+
+// OutboxEmail is an email waiting to be rendered and sent.
+type OutboxEmail struct {
+	ID            int64
+	Recipient     string
+	Template      string
+	Data          json.RawMessage
+	CreatedAt     time.Time
+	Attempts      int
+	NextAttemptAt time.Time
+	LastError     sql.NullString
+	SentAt        sql.NullTime
+	DeadAt        sql.NullTime
+}
+
+// ErrNoEmail is returned for an outbox email that does not exist or is
+// not dead.
+var ErrNoEmail = errors.New("email not found")
+
+// GetNotificationPreference returns a user's preference, or the default.
+func GetNotificationPreference(ctx context.Context, db *sql.DB, email string) (*NotificationPreference, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	p := DefaultNotificationPreference
+	p.Email = email
+	err := db.QueryRowContext(ctx, "SELECT record_changes, alerts FROM notification_preference WHERE email=$1", email).
+		Scan(&p.RecordChanges, &p.Alerts)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// SetNotificationPreference stores a user's preference.
+func SetNotificationPreference(ctx context.Context, db *sql.DB, p *NotificationPreference) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	_, err := db.ExecContext(ctx, "INSERT INTO notification_preference (email, record_changes, alerts) VALUES ($1, $2, $3)"+
+		" ON CONFLICT (tenant_id, email) DO UPDATE SET record_changes = EXCLUDED.record_changes, alerts = EXCLUDED.alerts",
+		p.Email, p.RecordChanges, p.Alerts)
+	return err
+}
+
+// QueueEmail adds an email to the outbox. data is stored as JSON and
+// given to the template when the email is sent.
+func QueueEmail(ctx context.Context, db *sql.DB, recipient, template string, data any) error {
+	b, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	_, err = db.ExecContext(ctx, "INSERT INTO email_outbox (recipient, template, data) VALUES ($1, $2, $3)", recipient, template, b)
+	return err
+}
+
+// QueueAlertEmails adds an email about an alert for every user who asked
+// for alerts of its country, and returns how many were queued.
+func QueueAlertEmails(ctx context.Context, db *sql.DB, a *Alert, template string, data any) (int64, error) {
+	b, err := json.Marshal(data)
+	if err != nil {
+		return 0, err
+	}
+
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	res, err := db.ExecContext(ctx, "INSERT INTO email_outbox (recipient, template, data)"+
+		" SELECT u.email, $1, $2 FROM notification_preference p JOIN Users u ON u.email = p.email"+
+		" WHERE u.deleted_at IS NULL AND (p.alerts = 'all' OR p.alerts = 'country' AND u.cname = $3)",
+		template, b, a.CName)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// ClaimEmails returns up to limit emails that are due, oldest first, and
+// moves their next attempt lease into the future so no other mailer
+// sends them meanwhile.
+func ClaimEmails(ctx context.Context, db *sql.DB, limit int, lease time.Duration) ([]OutboxEmail, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	rows, err := db.QueryContext(ctx, "WITH due AS ("+
+		"SELECT id FROM email_outbox WHERE sent_at IS NULL AND dead_at IS NULL AND next_attempt_at <= now()"+
+		" ORDER BY next_attempt_at, id LIMIT $1 FOR UPDATE SKIP LOCKED)"+
+		" UPDATE email_outbox e SET next_attempt_at = now() + $2 * interval '1 second'"+
+		" FROM due WHERE e.id = due.id"+
+		" RETURNING e.id, e.recipient, e.template, e.data, e.created_at, e.attempts",
+		limit, lease.Seconds())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []OutboxEmail
+	for rows.Next() {
+		var x OutboxEmail
+		if err := rows.Scan(&x.ID, &x.Recipient, &x.Template, &x.Data, &x.CreatedAt, &x.Attempts); err != nil {
+			return nil, err
+		}
+		items = append(items, x)
+	}
+	return items, rows.Err()
+}
+
+// MarkEmailSent records that an email was accepted by the SMTP server.
+func MarkEmailSent(ctx context.Context, db *sql.DB, id int64) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	_, err := db.ExecContext(ctx, "UPDATE email_outbox SET attempts = attempts + 1, last_error=NULL, sent_at=now() WHERE id=$1", id)
+	return err
+}
+
+// MarkEmailFailed records a failed attempt. The email is retried at next,
+// or given up on if next is zero.
+func MarkEmailFailed(ctx context.Context, db *sql.DB, id int64, msg string, next time.Time) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	dead := sql.NullTime{}
+	if next.IsZero() {
+		next, dead = time.Now(), sql.NullTime{Time: time.Now(), Valid: true}
+	}
+	_, err := db.ExecContext(ctx, "UPDATE email_outbox SET attempts = attempts + 1, last_error=$1, next_attempt_at=$2, dead_at=$3"+
+		" WHERE id=$4", msg, next, dead, id)
+	return err
+}
+
+// GetOutboxEmails lists the emails not sent yet, given up on ones first,
+// then up to limit sent ones, newest first.
+func GetOutboxEmails(ctx context.Context, db *sql.DB, limit int) ([]OutboxEmail, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	rows, err := db.QueryContext(ctx, "(SELECT id, recipient, template, data, created_at, attempts, next_attempt_at, last_error, sent_at, dead_at"+
+		" FROM email_outbox WHERE sent_at IS NULL ORDER BY dead_at DESC NULLS LAST, id DESC)"+
+		" UNION ALL (SELECT id, recipient, template, data, created_at, attempts, next_attempt_at, last_error, sent_at, dead_at"+
+		" FROM email_outbox WHERE sent_at IS NOT NULL ORDER BY sent_at DESC LIMIT $1)", limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []OutboxEmail
+	for rows.Next() {
+		var x OutboxEmail
+		if err := rows.Scan(&x.ID, &x.Recipient, &x.Template, &x.Data, &x.CreatedAt, &x.Attempts, &x.NextAttemptAt,
+			&x.LastError, &x.SentAt, &x.DeadAt); err != nil {
+			return nil, err
+		}
+		items = append(items, x)
+	}
+	return items, rows.Err()
+}
+
+// RetryEmail queues an email that was given up on again.
+func RetryEmail(ctx context.Context, db *sql.DB, id int64) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	res, err := db.ExecContext(ctx, "UPDATE email_outbox SET attempts=0, next_attempt_at=now(), dead_at=NULL WHERE id=$1 AND dead_at IS NOT NULL", id)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNoEmail
+	}
+	return nil
+}
+
+// PurgeSentEmails deletes emails sent before cutoff.
+func PurgeSentEmails(ctx context.Context, db *sql.DB, cutoff time.Time) (int64, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	res, err := db.ExecContext(ctx, "DELETE FROM email_outbox WHERE sent_at < $1", cutoff)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
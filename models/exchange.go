@@ -0,0 +1,155 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// An Exchange is a set of rows received from another system, e.g. a FHIR
+// bundle, that UpsertExchange stores as one unit. Rows are matched on their
+// primary key: existing rows are updated and restored from the trash, new
+// ones are inserted.
+type Exchange struct {
+	People          []ExchangePerson
+	PatientDiseases []PatientDisease
+	Records         []Record
+}
+
+// ExchangePerson is a user with the roles the sender knows about. Roles
+// that are not set are left as they are.
+type ExchangePerson struct {
+	User    User
+	Patient bool
+	Doctor  *Doctor
+
+	// Specializations replaces the disease types a doctor specializes in;
+	// nil leaves them unchanged.
+	Specializations []int
+}
+
+// Kinds of rows reported by ExchangeError.
+const (
+	ExchangePersonRow         = "person"
+	ExchangePatientDiseaseRow = "patient disease"
+	ExchangeRecordRow         = "record"
+)
+
+// ExchangeError reports the row of an Exchange that could not be stored.
+// Index is the position of the row within its slice.
+type ExchangeError struct {
+	Kind  string
+	Index int
+	Err   error
+}
+
+func (e *ExchangeError) Error() string {
+	return fmt.Sprintf("%s %d: %v", e.Kind, e.Index+1, e.Err)
+}
+
+func (e *ExchangeError) Unwrap() error { return e.Err }
+
+// UpsertExchange stores every row of x, or none of them if one fails.
+// Users keep their salary, and their phone when the exchange has none. A
+// row referencing a row that does not exist or is in the trash fails with
+// ErrMissingParent.
+func UpsertExchange(ctx context.Context, db *sql.DB, x *Exchange) error {
+	stamp := time.Now().UTC().Truncate(time.Microsecond)
+	actor := nullString(Actor(ctx))
+
+	return inTx(ctx, db, func(ctx context.Context, tx *sql.Tx) error {
+		for i := range x.People {
+			if err := upsertPerson(ctx, tx, &x.People[i], stamp, actor); err != nil {
+				return &ExchangeError{ExchangePersonRow, i, err}
+			}
+		}
+		for i, pd := range x.PatientDiseases {
+			if err := requireParents(ctx, tx, "PatientDisease", map[string]any{"email": pd.Email, "disease_code": pd.DiseaseCode}); err != nil {
+				return &ExchangeError{ExchangePatientDiseaseRow, i, err}
+			}
+			if err := addPatientDisease(ctx, tx, pd.Email, pd.DiseaseCode); err != nil {
+				return &ExchangeError{ExchangePatientDiseaseRow, i, err}
+			}
+		}
+		for i, rec := range x.Records {
+			if err := requireParents(ctx, tx, "Record", map[string]any{"email": rec.Email, "cname": rec.CName, "disease_code": rec.DiseaseCode}); err != nil {
+				return &ExchangeError{ExchangeRecordRow, i, err}
+			}
+			_, err := tx.ExecContext(ctx, "INSERT INTO Record (email, cname, disease_code, total_deaths, total_patients) VALUES ($1, $2, $3, $4, $5)"+
+				" ON CONFLICT (tenant_id, email, cname, disease_code) DO UPDATE SET total_deaths = EXCLUDED.total_deaths, total_patients = EXCLUDED.total_patients,"+
+				" deleted_at = NULL, deleted_by = NULL, version = Record.version + 1",
+				rec.Email, rec.CName, rec.DiseaseCode, rec.TotalDeaths, rec.TotalPatients)
+			if err != nil {
+				return &ExchangeError{ExchangeRecordRow, i, err}
+			}
+		}
+		return nil
+	})
+}
+
+func upsertPerson(ctx context.Context, tx *sql.Tx, p *ExchangePerson, stamp time.Time, actor sql.NullString) error {
+	u := &p.User
+	if err := requireParents(ctx, tx, "Users", map[string]any{"cname": u.CName}); err != nil {
+		return err
+	}
+	_, err := tx.ExecContext(ctx, "INSERT INTO Users (email, name, surname, salary, phone, cname) VALUES ($1, $2, $3, $4, $5, $6)"+
+		" ON CONFLICT (tenant_id, email) DO UPDATE SET name = EXCLUDED.name, surname = EXCLUDED.surname, phone = COALESCE(EXCLUDED.phone, Users.phone),"+
+		" cname = EXCLUDED.cname, deleted_at = NULL, deleted_by = NULL, version = Users.version + 1",
+		u.Email, u.Name, u.Surname, sealed("users.salary", u.Salary), sealed("users.phone", u.Phone), u.CName)
+	if err != nil {
+		return err
+	}
+	if err := addRoles(ctx, tx, u.Email, &Roles{Patient: p.Patient, Doctor: p.Doctor}); err != nil {
+		return err
+	}
+	if p.Doctor == nil || p.Specializations == nil {
+		return nil
+	}
+
+	ids := make([]string, len(p.Specializations))
+	for i, id := range p.Specializations {
+		if err := requireParents(ctx, tx, "Specialize", map[string]any{"id": id}); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, "INSERT INTO Specialize (id, email) VALUES ($1, $2)"+
+			" ON CONFLICT (tenant_id, id, email) DO UPDATE SET deleted_at = NULL, deleted_by = NULL, version = Specialize.version + 1",
+			id, u.Email)
+		if err != nil {
+			return err
+		}
+		ids[i] = fmt.Sprint(id)
+	}
+	query := "UPDATE Specialize SET deleted_at=$1, deleted_by=$2 WHERE email=$3 AND deleted_at IS NULL"
+	if len(ids) > 0 {
+		query += " AND id NOT IN (" + strings.Join(ids, ", ") + ")"
+	}
+	_, err = tx.ExecContext(ctx, query, stamp, actor, u.Email)
+	return err
+}
+
+// DiseaseSystems maps the code of every disease found in the ICD catalog
+// to its system, ICD10 or ICD11.
+func DiseaseSystems(ctx context.Context, db *sql.DB) (map[string]string, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	rows, err := db.QueryContext(ctx, "SELECT DISTINCT ON (d.disease_code) d.disease_code, c.system"+
+		" FROM Disease d JOIN icd_code c ON c.code = d.disease_code"+
+		" WHERE d.deleted_at IS NULL AND NOT d.custom ORDER BY d.disease_code, c.system")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	systems := make(map[string]string)
+	for rows.Next() {
+		var code, system string
+		if err := rows.Scan(&code, &system); err != nil {
+			return nil, err
+		}
+		systems[code] = system
+	}
+	return systems, rows.Err()
+}
@@ -0,0 +1,207 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Rotation counts what RotateFieldKeys rewrote.
+type Rotation struct {
+	Rows     int64 // rows of the tables
+	Versions int64 // row versions in row_history
+}
+
+// rotateBatch is how many rows RotateFieldKeys rewrites per transaction.
+const rotateBatch = 500
+
+// RotateFieldKeys brings every value of the encrypted columns under the
+// current master key of FieldKeys: values under an older key have their
+// data key rewrapped, and plaintext ones are encrypted, both in the tables
+// and in their history. ctx must see every organization.
+//
+// It works in batches, each in its own transaction, so it can be stopped
+// and run again. While a batch changes a table the table's triggers are
+// off: the new ciphertexts are not recorded as changes, nor sent to
+// webhooks.
+func RotateFieldKeys(ctx context.Context, db *sql.DB) (*Rotation, error) {
+	if FieldKeys == nil {
+		return nil, errors.New("no field encryption keys are configured")
+	}
+	prefix := FieldKeys.CurrentPrefix()
+
+	var r Rotation
+	for _, t := range Tables {
+		var cols []string
+		for _, c := range t.Columns {
+			if c.Encrypted {
+				cols = append(cols, c.Name)
+			}
+		}
+		if len(cols) == 0 {
+			continue
+		}
+		for {
+			n, err := rotateRows(ctx, db, t, cols, prefix)
+			r.Rows += n
+			if err != nil {
+				return &r, fmt.Errorf("%s: %w", t.Name, err)
+			}
+			if n < rotateBatch {
+				break
+			}
+		}
+		for {
+			n, err := rotateVersions(ctx, db, t, cols, prefix)
+			r.Versions += n
+			if err != nil {
+				return &r, fmt.Errorf("history of %s: %w", t.Name, err)
+			}
+			if n < rotateBatch {
+				break
+			}
+		}
+	}
+	return &r, nil
+}
+
+// stale renders the condition that a column expression, such as phone or
+// data->>'phone', holds a value not yet under the current key, given as
+// $1.
+func stale(exprs []string) string {
+	parts := make([]string, len(exprs))
+	for i, e := range exprs {
+		parts[i] = fmt.Sprintf("(%s IS NOT NULL AND left(%s, length($1)) <> $1)", e, e)
+	}
+	return strings.Join(parts, " OR ")
+}
+
+// rotateRows rewrites one batch of rows of t and returns how many.
+func rotateRows(ctx context.Context, db *sql.DB, t *TableInfo, cols []string, prefix string) (int64, error) {
+	keys := append([]string{"tenant_id"}, t.Keys...)
+	var set []string
+	for i, c := range cols {
+		set = append(set, fmt.Sprintf("%s=$%d", c, i+1))
+	}
+	update := "UPDATE " + t.Name + " SET " + strings.Join(set, ", ") +
+		fmt.Sprintf(" WHERE tenant_id=$%d AND ", len(cols)+1) + keyWhere(t, "", len(cols)+2)
+
+	var n int64
+	err := inTx(ctx, db, func(ctx context.Context, tx *sql.Tx) error {
+		rows, err := tx.QueryContext(ctx, "SELECT "+strings.Join(keys, ", ")+", "+strings.Join(cols, ", ")+
+			" FROM "+t.Name+" WHERE "+stale(cols)+fmt.Sprintf(" LIMIT %d FOR UPDATE", rotateBatch), prefix)
+		if err != nil {
+			return err
+		}
+		var batch [][]sql.NullString
+		for rows.Next() {
+			values := make([]sql.NullString, len(keys)+len(cols))
+			dest := make([]any, len(values))
+			for i := range values {
+				dest[i] = &values[i]
+			}
+			if err := rows.Scan(dest...); err != nil {
+				rows.Close()
+				return err
+			}
+			batch = append(batch, values)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		if len(batch) == 0 {
+			return nil
+		}
+
+		if _, err := tx.ExecContext(ctx, "ALTER TABLE "+t.Name+" DISABLE TRIGGER USER"); err != nil {
+			return err
+		}
+		for _, values := range batch {
+			args := make([]any, 0, len(values))
+			for i, c := range cols {
+				v := values[len(keys)+i]
+				if v.Valid {
+					if v.String, err = FieldKeys.Rewrap(t.column(c), v.String); err != nil {
+						return err
+					}
+				}
+				args = append(args, v)
+			}
+			for _, k := range values[:len(keys)] {
+				args = append(args, k.String)
+			}
+			if _, err := tx.ExecContext(ctx, update, args...); err != nil {
+				return err
+			}
+		}
+		n = int64(len(batch))
+		_, err = tx.ExecContext(ctx, "ALTER TABLE "+t.Name+" ENABLE TRIGGER USER")
+		return err
+	})
+	return n, err
+}
+
+// rotateVersions rewrites one batch of the history of t and returns how
+// many versions.
+func rotateVersions(ctx context.Context, db *sql.DB, t *TableInfo, cols []string, prefix string) (int64, error) {
+	exprs := make([]string, len(cols))
+	for i, c := range cols {
+		exprs[i] = "data->>'" + c + "'"
+	}
+
+	var n int64
+	err := inTx(ctx, db, func(ctx context.Context, tx *sql.Tx) error {
+		rows, err := tx.QueryContext(ctx, "SELECT id, "+strings.Join(exprs, ", ")+" FROM row_history"+
+			" WHERE table_name=$2 AND ("+stale(exprs)+fmt.Sprintf(") ORDER BY id LIMIT %d FOR UPDATE", rotateBatch),
+			prefix, strings.ToLower(t.Name))
+		if err != nil {
+			return err
+		}
+		type version struct {
+			id     int64
+			values []sql.NullString
+		}
+		var batch []version
+		for rows.Next() {
+			v := version{values: make([]sql.NullString, len(cols))}
+			dest := []any{&v.id}
+			for i := range v.values {
+				dest = append(dest, &v.values[i])
+			}
+			if err := rows.Scan(dest...); err != nil {
+				rows.Close()
+				return err
+			}
+			batch = append(batch, v)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		for _, v := range batch {
+			patch := make(map[string]string)
+			for i, c := range cols {
+				if v.values[i].Valid {
+					if patch[c], err = FieldKeys.Rewrap(t.column(c), v.values[i].String); err != nil {
+						return err
+					}
+				}
+			}
+			b, err := json.Marshal(patch)
+			if err != nil {
+				return err
+			}
+			if _, err := tx.ExecContext(ctx, "UPDATE row_history SET data = data || $1::jsonb WHERE id=$2", b, v.id); err != nil {
+				return err
+			}
+		}
+		n = int64(len(batch))
+		return nil
+	})
+	return n, err
+}
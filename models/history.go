@@ -0,0 +1,228 @@
+package models
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Every insert, update and delete is recorded in row_history by the
+// record_history trigger (db/migrations/0002_row_history.sql): one row per
+// version with the row's columns as JSON and the interval during which it
+// was current.
+
+// ErrNoVersion is returned when reverting to a version that does not
+// belong to the row.
+var ErrNoVersion = errors.New("version not found")
+
+// Version is one state of a row.
+type Version struct {
+	ID        int64          `json:"id"`
+	ValidFrom time.Time      `json:"valid_from"`
+	ValidTo   *time.Time     `json:"valid_to,omitempty"` // nil for the current version
+	Data      map[string]any `json:"data"`
+	Changes   []Change       `json:"changes"` // differences from the previous version
+}
+
+// Change is a column whose value differs between two versions.
+type Change struct {
+	Column string `json:"column"`
+	Label  string `json:"label"`
+	Old    any    `json:"old"`
+	New    any    `json:"new"`
+}
+
+// Deleted reports whether the row was soft-deleted in this version.
+func (v *Version) Deleted() bool {
+	return v.Data["deleted_at"] != nil
+}
+
+// GetHistory returns the versions of a row, newest first.
+func GetHistory(ctx context.Context, db *sql.DB, table string, key []string) ([]Version, error) {
+	t, rowKey, err := historyKey(table, key)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	rows, err := db.QueryContext(ctx, "SELECT id, valid_from, valid_to, data FROM row_history WHERE table_name=$1 AND row_key=$2::jsonb ORDER BY valid_from, id",
+		strings.ToLower(t.Name), rowKey)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var versions []Version
+	for rows.Next() {
+		var (
+			v       Version
+			validTo sql.NullTime
+			data    []byte
+		)
+		if err := rows.Scan(&v.ID, &v.ValidFrom, &validTo, &data); err != nil {
+			return nil, err
+		}
+		if validTo.Valid {
+			v.ValidTo = &validTo.Time
+		}
+		if v.Data, err = decodeRow(data); err != nil {
+			return nil, err
+		}
+		if err := t.openRow(v.Data); err != nil {
+			return nil, err
+		}
+		if n := len(versions); n > 0 {
+			v.Changes = diff(t, versions[n-1].Data, v.Data)
+		}
+		versions = append(versions, v)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i, j := 0, len(versions)-1; i < j; i, j = i+1, j-1 {
+		versions[i], versions[j] = versions[j], versions[i]
+	}
+	return versions, nil
+}
+
+// GetAsOf returns the rows of table that existed, and were not in the
+// trash, at the given time.
+func GetAsOf(ctx context.Context, db *sql.DB, table string, at time.Time) ([]map[string]any, error) {
+	t := TableByName(table)
+	if t == nil {
+		return nil, fmt.Errorf("unknown table %q", table)
+	}
+
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	rows, err := db.QueryContext(ctx, `SELECT data FROM row_history
+		WHERE table_name=$1 AND valid_from <= $2 AND (valid_to IS NULL OR valid_to > $2) AND data->>'deleted_at' IS NULL
+		ORDER BY id`, strings.ToLower(t.Name), at)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := []map[string]any{}
+	for rows.Next() {
+		var data []byte
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		row, err := decodeRow(data)
+		if err != nil {
+			return nil, err
+		}
+		if err := t.openRow(row); err != nil {
+			return nil, err
+		}
+		delete(row, "deleted_at")
+		delete(row, "deleted_by")
+		items = append(items, row)
+	}
+	return items, rows.Err()
+}
+
+// RevertToVersion sets the non-key columns of a live row back to the values
+// they had in one of its versions. The revert itself becomes a new version.
+func RevertToVersion(ctx context.Context, db *sql.DB, table string, key []string, versionID int64) error {
+	t, rowKey, err := historyKey(table, key)
+	if err != nil {
+		return err
+	}
+
+	var set []string
+	for _, c := range t.Columns {
+		if !t.isKey(c.Name) {
+			set = append(set, c.Name+" = r."+c.Name)
+		}
+	}
+	if len(set) == 0 {
+		return fmt.Errorf("%s has no columns to revert", t.Label)
+	}
+	if t.Versioned {
+		set = append(set, "version = t.version + 1")
+	}
+
+	args := []any{versionID, strings.ToLower(t.Name), rowKey}
+	for _, v := range key {
+		args = append(args, v)
+	}
+
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	res, err := db.ExecContext(ctx, "UPDATE "+t.Name+" t SET "+strings.Join(set, ", ")+
+		" FROM row_history h, jsonb_populate_record(NULL::"+t.Name+", h.data) r"+
+		" WHERE h.id=$1 AND h.table_name=$2 AND h.row_key=$3::jsonb AND "+keyWhere(t, "t.", 4)+" AND t.deleted_at IS NULL", args...)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNoVersion
+	}
+	return nil
+}
+
+func (t *TableInfo) isKey(column string) bool {
+	for _, k := range t.Keys {
+		if k == column {
+			return true
+		}
+	}
+	return false
+}
+
+// historyKey returns the table and the row_key JSON of a row. The trigger
+// stores every key value as text.
+func historyKey(table string, key []string) (*TableInfo, string, error) {
+	t := TableByName(table)
+	if t == nil {
+		return nil, "", fmt.Errorf("unknown table %q", table)
+	}
+	if len(key) != len(t.Keys) {
+		return nil, "", fmt.Errorf("%s needs %d key values, got %d", t.Name, len(t.Keys), len(key))
+	}
+
+	obj := make(map[string]string, len(key))
+	for i, k := range t.Keys {
+		obj[k] = key[i]
+	}
+	b, err := json.Marshal(obj)
+	if err != nil {
+		return nil, "", err
+	}
+	return t, string(b), nil
+}
+
+// decodeRow keeps numbers as json.Number so large values print unchanged.
+func decodeRow(data []byte) (map[string]any, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var row map[string]any
+	if err := dec.Decode(&row); err != nil {
+		return nil, err
+	}
+	return row, nil
+}
+
+func diff(t *TableInfo, old, new map[string]any) []Change {
+	var changes []Change
+	cols := append([]ColumnInfo{}, t.Columns...)
+	cols = append(cols, ColumnInfo{Name: "deleted_at", Label: "Deleted At"}, ColumnInfo{Name: "deleted_by", Label: "Deleted By"})
+	for _, c := range cols {
+		if fmt.Sprint(old[c.Name]) != fmt.Sprint(new[c.Name]) {
+			changes = append(changes, Change{Column: c.Name, Label: c.Label, Old: old[c.Name], New: new[c.Name]})
+		}
+	}
+	return changes
+}
@@ -0,0 +1,185 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// ICD code systems of the local catalog.
+const (
+	ICD10 = "ICD-10"
+	ICD11 = "ICD-11"
+)
+
+// ICDCode is one entry of the ICD catalog.
+type ICDCode struct {
+	System  string `json:"system"`
+	Code    string `json:"code"`
+	Title   string `json:"title"`
+	Chapter string `json:"chapter"`
+
+	// DiseaseTypeID is the disease type the organization mapped the
+	// code's chapter to.
+	DiseaseTypeID sql.NullInt64 `json:"disease_type_id"`
+}
+
+// ICDChapter is a chapter of the ICD catalog and the disease type it maps
+// to, if any. The catalog is shared by every organization; the mappings
+// are each organization's own, in icd_chapter_type.
+type ICDChapter struct {
+	System        string
+	Chapter       string
+	Title         string
+	DiseaseTypeID sql.NullInt64
+	Codes         int
+}
+
+// ICDKey normalizes a code for lookups: "a00.1 " and "A001" are the same.
+func ICDKey(code string) string {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	return strings.NewReplacer(".", "", " ", "").Replace(code)
+}
+
+const icdSelect = "SELECT c.system, c.code, c.title, c.chapter, ct.disease_type_id FROM icd_code c" +
+	" LEFT JOIN icd_chapter_type ct ON ct.system = c.system AND ct.chapter = c.chapter"
+
+func scanICDCodes(rows *sql.Rows) ([]ICDCode, error) {
+	defer rows.Close()
+
+	var codes []ICDCode
+	for rows.Next() {
+		var c ICDCode
+		if err := rows.Scan(&c.System, &c.Code, &c.Title, &c.Chapter, &c.DiseaseTypeID); err != nil {
+			return nil, err
+		}
+		codes = append(codes, c)
+	}
+	return codes, rows.Err()
+}
+
+// SearchICD finds up to limit codes starting with q or with q in their
+// title, codes first.
+func SearchICD(ctx context.Context, db *sql.DB, q string, limit int) ([]ICDCode, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	q = strings.TrimSpace(q)
+	title := "%" + strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(q) + "%"
+	rows, err := db.QueryContext(ctx, icdSelect+
+		" WHERE c.code_key LIKE $1 || '%' OR c.title ILIKE $2"+
+		" ORDER BY c.code_key LIKE $1 || '%' DESC, c.code_key, c.system LIMIT $3",
+		ICDKey(q), title, limit)
+	if err != nil {
+		return nil, err
+	}
+	return scanICDCodes(rows)
+}
+
+// LookupICD returns the catalog entries matching code in either system.
+func LookupICD(ctx context.Context, db *sql.DB, code string) ([]ICDCode, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	rows, err := db.QueryContext(ctx, icdSelect+" WHERE c.code_key = $1 ORDER BY c.system", ICDKey(code))
+	if err != nil {
+		return nil, err
+	}
+	return scanICDCodes(rows)
+}
+
+// GetICDChapters lists the chapters of both systems with their code counts.
+func GetICDChapters(ctx context.Context, db *sql.DB) ([]ICDChapter, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	rows, err := db.QueryContext(ctx, "SELECT ch.system, ch.chapter, ch.title, ct.disease_type_id,"+
+		" (SELECT count(*) FROM icd_code c WHERE c.system = ch.system AND c.chapter = ch.chapter)"+
+		" FROM icd_chapter ch LEFT JOIN icd_chapter_type ct ON ct.system = ch.system AND ct.chapter = ch.chapter"+
+		" ORDER BY ch.system, ch.chapter")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var chapters []ICDChapter
+	for rows.Next() {
+		var ch ICDChapter
+		if err := rows.Scan(&ch.System, &ch.Chapter, &ch.Title, &ch.DiseaseTypeID, &ch.Codes); err != nil {
+			return nil, err
+		}
+		chapters = append(chapters, ch)
+	}
+	return chapters, rows.Err()
+}
+
+// SetChapterType maps an ICD chapter to a disease type, or removes the
+// mapping when typeID is not valid.
+func SetChapterType(ctx context.Context, db *sql.DB, system, chapter string, typeID sql.NullInt64) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	var exists bool
+	err := db.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM icd_chapter WHERE system=$1 AND chapter=$2)", system, chapter).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("unknown chapter %s %s", system, chapter)
+	}
+
+	if !typeID.Valid {
+		_, err = db.ExecContext(ctx, "DELETE FROM icd_chapter_type WHERE system=$1 AND chapter=$2", system, chapter)
+		return err
+	}
+	_, err = db.ExecContext(ctx, "INSERT INTO icd_chapter_type (system, chapter, disease_type_id) VALUES ($1, $2, $3)"+
+		" ON CONFLICT (tenant_id, system, chapter) DO UPDATE SET disease_type_id = EXCLUDED.disease_type_id", system, chapter, typeID)
+	return err
+}
+
+// icdBatch is the number of codes inserted per statement by ImportICD.
+const icdBatch = 500
+
+// ImportICD replaces the codes of one system with the given ones in a
+// single transaction. Chapters are upserted so their disease type mapping
+// survives a reimport of a newer release.
+func ImportICD(ctx context.Context, db *sql.DB, system string, chapters []ICDChapter, codes []ICDCode) error {
+	if system != ICD10 && system != ICD11 {
+		return fmt.Errorf("unknown ICD system %q", system)
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM icd_code WHERE system=$1", system); err != nil {
+		return err
+	}
+	for _, ch := range chapters {
+		_, err := tx.ExecContext(ctx, "INSERT INTO icd_chapter (system, chapter, title) VALUES ($1, $2, $3)"+
+			" ON CONFLICT (system, chapter) DO UPDATE SET title = EXCLUDED.title", system, ch.Chapter, ch.Title)
+		if err != nil {
+			return fmt.Errorf("chapter %s: %w", ch.Chapter, err)
+		}
+	}
+
+	for start := 0; start < len(codes); start += icdBatch {
+		batch := codes[start:min(start+icdBatch, len(codes))]
+		values := make([]string, len(batch))
+		args := make([]any, 0, 5*len(batch))
+		for i, c := range batch {
+			n := len(args)
+			values[i] = fmt.Sprintf("($%d, $%d, $%d, $%d, $%d)", n+1, n+2, n+3, n+4, n+5)
+			args = append(args, system, c.Code, ICDKey(c.Code), c.Title, c.Chapter)
+		}
+		_, err := tx.ExecContext(ctx, "INSERT INTO icd_code (system, code, code_key, title, chapter) VALUES "+
+			strings.Join(values, ", ")+" ON CONFLICT (system, code) DO NOTHING", args...)
+		if err != nil {
+			return fmt.Errorf("codes %s to %s: %w", batch[0].Code, batch[len(batch)-1].Code, err)
+		}
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,383 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Job statuses. A job waiting for a retry is queued again, with its last
+// error kept.
+const (
+	JobQueued    = "queued"
+	JobRunning   = "running"
+	JobSucceeded = "succeeded"
+	JobFailed    = "failed" // gave up after max_attempts
+	JobCancelled = "cancelled"
+)
+
+// JobStatuses lists the statuses in the order they are shown.
+var JobStatuses = []string{JobQueued, JobRunning, JobSucceeded, JobFailed, JobCancelled}
+
+// Job is one run of a background task; see package job.
+type Job struct {
+	ID          int64
+	Kind        string
+	Payload     json.RawMessage
+	Status      string
+	Attempts    int // started so far, including a running one
+	MaxAttempts int
+	RunAt       time.Time
+	LockedBy    sql.NullString
+	LockedUntil sql.NullTime
+	LastError   sql.NullString
+	Schedule    sql.NullString
+	CreatedAt   time.Time
+	StartedAt   sql.NullTime
+	FinishedAt  sql.NullTime
+}
+
+// JobSchedule adds a job of Kind whenever its cron Spec is due.
+type JobSchedule struct {
+	Name      string
+	Spec      string
+	Kind      string
+	Payload   json.RawMessage
+	Active    bool
+	NextRunAt time.Time
+	LastRunAt sql.NullTime
+}
+
+// ErrNoJob is returned for a job or schedule that does not exist or is
+// not in a state the change applies to, including a running job whose
+// worker lost its lease.
+var ErrNoJob = errors.New("job not found")
+
+const jobColumns = "id, kind, payload, status, attempts, max_attempts, run_at, locked_by, locked_until, last_error," +
+	" schedule, created_at, started_at, finished_at"
+
+func scanJob(rows *sql.Rows) (Job, error) {
+	var j Job
+	err := rows.Scan(&j.ID, &j.Kind, &j.Payload, &j.Status, &j.Attempts, &j.MaxAttempts, &j.RunAt, &j.LockedBy,
+		&j.LockedUntil, &j.LastError, &j.Schedule, &j.CreatedAt, &j.StartedAt, &j.FinishedAt)
+	return j, err
+}
+
+func queryJobs(ctx context.Context, db *sql.DB, query string, args ...any) ([]Job, error) {
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var jobs []Job
+	for rows.Next() {
+		j, err := scanJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, j)
+	}
+	return jobs, rows.Err()
+}
+
+// EnqueueJob adds j to the queue and sets its ID. A zero RunAt means now
+// and a zero MaxAttempts the default of 5. The job belongs to the
+// organization of ctx and only it sees the job; with none, or all, only
+// work for every organization does.
+func EnqueueJob(ctx context.Context, db *sql.DB, j *Job) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	if len(j.Payload) == 0 {
+		j.Payload = json.RawMessage("{}")
+	}
+	if j.RunAt.IsZero() {
+		j.RunAt = time.Now()
+	}
+	if j.MaxAttempts == 0 {
+		j.MaxAttempts = 5
+	}
+	j.Status = JobQueued
+	return db.QueryRowContext(ctx, "INSERT INTO job (kind, payload, max_attempts, run_at, schedule) VALUES ($1, $2, $3, $4, $5)"+
+		" RETURNING id, created_at", j.Kind, []byte(j.Payload), j.MaxAttempts, j.RunAt, j.Schedule).Scan(&j.ID, &j.CreatedAt)
+}
+
+// ClaimJobs starts up to limit due jobs of the given kinds for worker,
+// leasing them for lease. Running jobs whose lease ran out, because their
+// worker died, are due again.
+func ClaimJobs(ctx context.Context, db *sql.DB, kinds []string, worker string, limit int, lease time.Duration) ([]Job, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	return queryJobs(ctx, db, "WITH due AS ("+
+		"SELECT id FROM job WHERE kind = ANY($1)"+
+		" AND (status = 'queued' AND run_at <= now() OR status = 'running' AND locked_until < now())"+
+		" ORDER BY run_at, id LIMIT $2 FOR UPDATE SKIP LOCKED)"+
+		" UPDATE job j SET status = 'running', attempts = attempts + 1, locked_by = $3,"+
+		" locked_until = now() + $4 * interval '1 second', started_at = now()"+
+		" FROM due WHERE j.id = due.id RETURNING j.id, j.kind, j.payload, j.status, j.attempts, j.max_attempts, j.run_at,"+
+		" j.locked_by, j.locked_until, j.last_error, j.schedule, j.created_at, j.started_at, j.finished_at",
+		pq.Array(kinds), limit, worker, lease.Seconds())
+}
+
+// ExtendJobLease keeps a running job leased to worker for another lease.
+// It returns ErrNoJob if the job was cancelled or claimed by another
+// worker meanwhile.
+func ExtendJobLease(ctx context.Context, db *sql.DB, id int64, worker string, lease time.Duration) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	return jobUpdated(db.ExecContext(ctx, "UPDATE job SET locked_until = now() + $1 * interval '1 second'"+
+		" WHERE id=$2 AND status='running' AND locked_by=$3", lease.Seconds(), id, worker))
+}
+
+// FinishJob records that worker ran a job successfully.
+func FinishJob(ctx context.Context, db *sql.DB, id int64, worker string) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	return jobUpdated(db.ExecContext(ctx, "UPDATE job SET status='succeeded', last_error=NULL, locked_by=NULL, locked_until=NULL,"+
+		" finished_at=now() WHERE id=$1 AND status='running' AND locked_by=$2", id, worker))
+}
+
+// FailJob records a failed attempt by worker. The job is retried at next,
+// or marked failed if next is zero.
+func FailJob(ctx context.Context, db *sql.DB, id int64, worker, msg string, next time.Time) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	if next.IsZero() {
+		return jobUpdated(db.ExecContext(ctx, "UPDATE job SET status='failed', last_error=$1, locked_by=NULL, locked_until=NULL,"+
+			" finished_at=now() WHERE id=$2 AND status='running' AND locked_by=$3", msg, id, worker))
+	}
+	return jobUpdated(db.ExecContext(ctx, "UPDATE job SET status='queued', last_error=$1, run_at=$2, locked_by=NULL, locked_until=NULL"+
+		" WHERE id=$3 AND status='running' AND locked_by=$4", msg, next, id, worker))
+}
+
+// ReleaseJob puts back a job that worker stopped without finishing, as
+// when shutting down; the attempt is not counted.
+func ReleaseJob(ctx context.Context, db *sql.DB, id int64, worker string) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	return jobUpdated(db.ExecContext(ctx, "UPDATE job SET status='queued', attempts = attempts - 1, run_at=now(),"+
+		" locked_by=NULL, locked_until=NULL WHERE id=$1 AND status='running' AND locked_by=$2", id, worker))
+}
+
+// GetJobs returns up to limit jobs with the given status, or any status
+// if it is empty, newest first.
+func GetJobs(ctx context.Context, db *sql.DB, status string, limit int) ([]Job, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	return queryJobs(ctx, db, "SELECT "+jobColumns+" FROM job WHERE $1 = '' OR status = $1 ORDER BY id DESC LIMIT $2", status, limit)
+}
+
+// GetJob returns one job.
+func GetJob(ctx context.Context, db *sql.DB, id int64) (*Job, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	jobs, err := queryJobs(ctx, db, "SELECT "+jobColumns+" FROM job WHERE id=$1", id)
+	if err != nil {
+		return nil, err
+	}
+	if len(jobs) == 0 {
+		return nil, ErrNoJob
+	}
+	return &jobs[0], nil
+}
+
+// JobCounts returns how many jobs there are in each status.
+func JobCounts(ctx context.Context, db *sql.DB) (map[string]int, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	rows, err := db.QueryContext(ctx, "SELECT status, count(*) FROM job GROUP BY status")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int)
+	for rows.Next() {
+		var status string
+		var n int
+		if err := rows.Scan(&status, &n); err != nil {
+			return nil, err
+		}
+		counts[status] = n
+	}
+	return counts, rows.Err()
+}
+
+// RetryJob queues a failed or cancelled job again with fresh attempts.
+func RetryJob(ctx context.Context, db *sql.DB, id int64) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	return jobUpdated(db.ExecContext(ctx, "UPDATE job SET status='queued', attempts=0, run_at=now(), finished_at=NULL"+
+		" WHERE id=$1 AND status IN ('failed', 'cancelled')", id))
+}
+
+// CancelJob cancels a queued or running job. A running job is stopped
+// when its worker next extends the lease.
+func CancelJob(ctx context.Context, db *sql.DB, id int64) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	return jobUpdated(db.ExecContext(ctx, "UPDATE job SET status='cancelled', locked_by=NULL, locked_until=NULL, finished_at=now()"+
+		" WHERE id=$1 AND status IN ('queued', 'running')", id))
+}
+
+// PurgeJobs deletes succeeded and cancelled jobs that finished before
+// cutoff. Failed jobs are kept until they are retried.
+func PurgeJobs(ctx context.Context, db *sql.DB, cutoff time.Time) (int64, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	res, err := db.ExecContext(ctx, "DELETE FROM job WHERE status IN ('succeeded', 'cancelled') AND finished_at < $1", cutoff)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// SaveJobSchedules stores the schedules defined in code and deletes the
+// others. A new schedule, or one whose spec changed, first runs at its
+// NextRunAt; otherwise the stored next run and active flag are kept.
+func SaveJobSchedules(ctx context.Context, db *sql.DB, schedules []JobSchedule) error {
+	return inTx(ctx, db, func(ctx context.Context, tx *sql.Tx) error {
+		names := make([]string, len(schedules))
+		for i, s := range schedules {
+			names[i] = s.Name
+			payload := s.Payload
+			if len(payload) == 0 {
+				payload = json.RawMessage("{}")
+			}
+			_, err := tx.ExecContext(ctx, "INSERT INTO job_schedule (name, spec, kind, payload, next_run_at) VALUES ($1, $2, $3, $4, $5)"+
+				" ON CONFLICT (name) DO UPDATE SET kind = EXCLUDED.kind, payload = EXCLUDED.payload, spec = EXCLUDED.spec,"+
+				" next_run_at = CASE WHEN job_schedule.spec = EXCLUDED.spec THEN job_schedule.next_run_at ELSE EXCLUDED.next_run_at END",
+				s.Name, s.Spec, s.Kind, []byte(payload), s.NextRunAt)
+			if err != nil {
+				return err
+			}
+		}
+		_, err := tx.ExecContext(ctx, "DELETE FROM job_schedule WHERE NOT name = ANY($1)", pq.Array(names))
+		return err
+	})
+}
+
+// GetJobSchedules returns every schedule by name.
+func GetJobSchedules(ctx context.Context, db *sql.DB) ([]JobSchedule, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	rows, err := db.QueryContext(ctx, "SELECT name, spec, kind, payload, active, next_run_at, last_run_at FROM job_schedule ORDER BY name")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var schedules []JobSchedule
+	for rows.Next() {
+		var s JobSchedule
+		if err := rows.Scan(&s.Name, &s.Spec, &s.Kind, &s.Payload, &s.Active, &s.NextRunAt, &s.LastRunAt); err != nil {
+			return nil, err
+		}
+		schedules = append(schedules, s)
+	}
+	return schedules, rows.Err()
+}
+
+// SetJobScheduleActive pauses or resumes a schedule. Only work for every
+// organization may change schedules; for others it returns ErrNoJob.
+func SetJobScheduleActive(ctx context.Context, db *sql.DB, name string, active bool) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	return jobUpdated(db.ExecContext(ctx, "UPDATE job_schedule SET active=$1 WHERE name=$2", active, name))
+}
+
+// RunJobSchedule queues a job for a schedule now, outside its spec.
+func RunJobSchedule(ctx context.Context, db *sql.DB, name string) (*Job, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	j := &Job{Schedule: sql.NullString{String: name, Valid: true}}
+	err := db.QueryRowContext(ctx, "SELECT kind, payload FROM job_schedule WHERE name=$1", name).Scan(&j.Kind, &j.Payload)
+	if err == sql.ErrNoRows {
+		return nil, ErrNoJob
+	}
+	if err != nil {
+		return nil, err
+	}
+	return j, EnqueueJob(ctx, db, j)
+}
+
+// QueueScheduledJobs queues a job for every active schedule that is due
+// and moves it to its next run, given by next. Runs missed while no
+// worker was up are queued once. It returns the number of jobs queued.
+func QueueScheduledJobs(ctx context.Context, db *sql.DB, next func(s *JobSchedule, after time.Time) (time.Time, error)) (int, error) {
+	var n int
+	err := inTx(ctx, db, func(ctx context.Context, tx *sql.Tx) error {
+		rows, err := tx.QueryContext(ctx, "SELECT name, spec, kind, payload, active, next_run_at, last_run_at FROM job_schedule"+
+			" WHERE active AND next_run_at <= now() FOR UPDATE SKIP LOCKED")
+		if err != nil {
+			return err
+		}
+		var due []JobSchedule
+		for rows.Next() {
+			var s JobSchedule
+			if err := rows.Scan(&s.Name, &s.Spec, &s.Kind, &s.Payload, &s.Active, &s.NextRunAt, &s.LastRunAt); err != nil {
+				rows.Close()
+				return err
+			}
+			due = append(due, s)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		now := time.Now()
+		for i := range due {
+			s := &due[i]
+			at, err := next(s, now)
+			if err != nil {
+				return err
+			}
+			if _, err := tx.ExecContext(ctx, "INSERT INTO job (kind, payload, schedule) VALUES ($1, $2, $3)",
+				s.Kind, []byte(s.Payload), s.Name); err != nil {
+				return err
+			}
+			if _, err := tx.ExecContext(ctx, "UPDATE job_schedule SET next_run_at=$1, last_run_at=now() WHERE name=$2",
+				at, s.Name); err != nil {
+				return err
+			}
+		}
+		n = len(due)
+		return nil
+	})
+	return n, err
+}
+
+// jobUpdated turns an update that matched no row into ErrNoJob.
+func jobUpdated(res sql.Result, err error) error {
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNoJob
+	}
+	return nil
+}
@@ -0,0 +1,209 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// A person is a Users row together with the role rows that share its email:
+// Patients, Doctor and PublicServant. The functions below change them as a
+// unit inside one transaction. Removing a role or a person soft-deletes it,
+// and with it every dependent row; see trash.go.
+
+// Roles describes which roles a person has. A nil Doctor or PublicServant
+// means the person does not have that role.
+type Roles struct {
+	Patient       bool           `json:"patient"`
+	Doctor        *Doctor        `json:"doctor,omitempty"`
+	PublicServant *PublicServant `json:"public_servant,omitempty"`
+}
+
+// Dependents are the rows that reference a person through one of its roles
+// and are deleted along with it.
+type Dependents struct {
+	PatientDiseases []PatientDisease `json:"patient_diseases"`
+	Specializations []Specialize     `json:"specializations"`
+	Records         []Record         `json:"records"`
+}
+
+// Empty reports whether nothing depends on the person.
+func (d *Dependents) Empty() bool {
+	return len(d.PatientDiseases) == 0 && len(d.Specializations) == 0 && len(d.Records) == 0
+}
+
+// Role names used by GetRoles, RemoveRole and the person screens.
+const (
+	RolePatient       = "patient"
+	RoleDoctor        = "doctor"
+	RolePublicServant = "public_servant"
+)
+
+// GetRoles returns the roles held by email.
+func GetRoles(ctx context.Context, db *sql.DB, email string) (*Roles, error) {
+	patient, err := GetPatient(ctx, db, email)
+	if err != nil {
+		return nil, err
+	}
+	doctor, err := GetDoctor(ctx, db, email)
+	if err != nil {
+		return nil, err
+	}
+	servant, err := GetPublicServant(ctx, db, email)
+	if err != nil {
+		return nil, err
+	}
+	return &Roles{Patient: patient != nil, Doctor: doctor, PublicServant: servant}, nil
+}
+
+// CreatePerson inserts a user and its roles, or nothing if any insert fails.
+// It returns ErrInTrash if the email belongs to a deleted user.
+func CreatePerson(ctx context.Context, db *sql.DB, u *User, roles *Roles) error {
+	err := inTx(ctx, db, func(ctx context.Context, tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, "INSERT INTO Users (email, name, surname, salary, phone, cname) VALUES ($1, $2, $3, $4, $5, $6)",
+			u.Email, u.Name, u.Surname, sealed("users.salary", u.Salary), sealed("users.phone", u.Phone), u.CName)
+		if err != nil {
+			return err
+		}
+		return addRoles(ctx, tx, u.Email, roles)
+	})
+	if err != nil {
+		return trashedKey(ctx, db, err, "Users", u.Email)
+	}
+	return nil
+}
+
+// AddRoles grants the roles set in roles to email. Roles the person already
+// has are updated, e.g. a doctor's degree.
+func AddRoles(ctx context.Context, db *sql.DB, email string, roles *Roles) error {
+	return inTx(ctx, db, func(ctx context.Context, tx *sql.Tx) error {
+		return addRoles(ctx, tx, email, roles)
+	})
+}
+
+func addRoles(ctx context.Context, tx *sql.Tx, email string, roles *Roles) error {
+	if roles.Patient {
+		if _, err := tx.ExecContext(ctx, "INSERT INTO Patients (email) VALUES ($1) ON CONFLICT (tenant_id, email) DO UPDATE SET deleted_at = NULL, deleted_by = NULL, version = Patients.version + 1", email); err != nil {
+			return err
+		}
+	}
+	if d := roles.Doctor; d != nil {
+		_, err := tx.ExecContext(ctx, "INSERT INTO Doctor (email, degree) VALUES ($1, $2) ON CONFLICT (tenant_id, email) DO UPDATE SET degree = EXCLUDED.degree, deleted_at = NULL, deleted_by = NULL, version = Doctor.version + 1",
+			email, d.Degree)
+		if err != nil {
+			return err
+		}
+	}
+	if ps := roles.PublicServant; ps != nil {
+		_, err := tx.ExecContext(ctx, "INSERT INTO PublicServant (email, department) VALUES ($1, $2) ON CONFLICT (tenant_id, email) DO UPDATE SET department = EXCLUDED.department, deleted_at = NULL, deleted_by = NULL, version = PublicServant.version + 1",
+			email, ps.Department)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetDependents returns the rows referencing email through its roles, or
+// only those of role when it is not empty.
+func GetDependents(ctx context.Context, db *sql.DB, email, role string) (*Dependents, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	d := &Dependents{}
+	if role == "" || role == RolePatient {
+		rows, err := db.QueryContext(ctx, "SELECT email, disease_code FROM PatientDisease WHERE email=$1 AND deleted_at IS NULL ORDER BY disease_code", email)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var x PatientDisease
+			if err := rows.Scan(&x.Email, &x.DiseaseCode); err != nil {
+				return nil, err
+			}
+			d.PatientDiseases = append(d.PatientDiseases, x)
+		}
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+	if role == "" || role == RoleDoctor {
+		rows, err := db.QueryContext(ctx, "SELECT id, email FROM Specialize WHERE email=$1 AND deleted_at IS NULL ORDER BY id", email)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var x Specialize
+			if err := rows.Scan(&x.ID, &x.Email); err != nil {
+				return nil, err
+			}
+			d.Specializations = append(d.Specializations, x)
+		}
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+	if role == "" || role == RolePublicServant {
+		rows, err := db.QueryContext(ctx, "SELECT email, cname, disease_code, total_deaths, total_patients FROM Record WHERE email=$1 AND deleted_at IS NULL ORDER BY cname, disease_code", email)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var x Record
+			if err := rows.Scan(&x.Email, &x.CName, &x.DiseaseCode, &x.TotalDeaths, &x.TotalPatients); err != nil {
+				return nil, err
+			}
+			d.Records = append(d.Records, x)
+		}
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+	return d, nil
+}
+
+// RemoveRole moves one role of email to the trash together with the rows
+// that depend on it.
+func RemoveRole(ctx context.Context, db *sql.DB, email, role string) error {
+	switch role {
+	case RolePatient:
+		return DeletePatient(ctx, db, email)
+	case RoleDoctor:
+		return DeleteDoctor(ctx, db, email)
+	case RolePublicServant:
+		return DeletePublicServant(ctx, db, email)
+	}
+	return fmt.Errorf("unknown role %q", role)
+}
+
+// DeletePerson moves a user, its roles and every dependent row to the
+// trash.
+func DeletePerson(ctx context.Context, db *sql.DB, email string) error {
+	return DeleteUser(ctx, db, email)
+}
+
+// inTx runs fn in a transaction bounded by QueryTimeout, committing if it
+// returns nil and rolling back otherwise.
+func inTx(ctx context.Context, db *sql.DB, fn func(ctx context.Context, tx *sql.Tx) error) error {
+	return inTxFor(ctx, db, QueryTimeout, fn)
+}
+
+// inTxFor is inTx with a deadline of d instead of QueryTimeout.
+func inTxFor(ctx context.Context, db *sql.DB, d time.Duration, fn func(ctx context.Context, tx *sql.Tx) error) error {
+	ctx, cancel := timeoutAfter(ctx, d)
+	defer cancel()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err := fn(ctx, tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
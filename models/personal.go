@@ -0,0 +1,209 @@
+package models
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"myapp/fieldcrypt"
+	"strings"
+	"unicode"
+)
+
+// Personal data is marked in db/schema.sql: a column with mask= is shown
+// masked unless the user may and asks to see it, and one with encrypted=
+// is also stored encrypted, in a TEXT column, by the generated models.
+
+// FieldKeys encrypts the encrypted columns. Without it their values are
+// written in plaintext, and encrypted ones cannot be read.
+var FieldKeys *fieldcrypt.Keyring
+
+// Personal reports whether the column holds personal data.
+func (c ColumnInfo) Personal() bool {
+	return c.Mask != ""
+}
+
+// Personal reports whether any column of t holds personal data.
+func (t *TableInfo) Personal() bool {
+	for _, c := range t.Columns {
+		if c.Personal() {
+			return true
+		}
+	}
+	return false
+}
+
+// RedactRow sets the personal columns of a row of t to nil.
+func (t *TableInfo) RedactRow(row map[string]any) {
+	for _, c := range t.Columns {
+		if _, ok := row[c.Name]; ok && c.Personal() {
+			row[c.Name] = nil
+		}
+	}
+}
+
+// MaskRow masks the personal columns of a row of t, leaving NULLs alone.
+func (t *TableInfo) MaskRow(row map[string]any) {
+	for _, c := range t.Columns {
+		if v := row[c.Name]; v != nil && c.Personal() {
+			row[c.Name] = Mask(c.Mask, fmt.Sprint(v))
+		}
+	}
+}
+
+// sealed is a query argument that writes v, a value or driver.Valuer,
+// encrypted for column, e.g. "users.phone". NULL stays NULL.
+func sealed(column string, v any) driver.Valuer {
+	return sealedValue{column: column, v: v}
+}
+
+// SealValue is sealed for code writing encrypted columns without the
+// models, such as the seeder's COPY.
+func SealValue(column string, v any) driver.Valuer {
+	return sealed(column, v)
+}
+
+type sealedValue struct {
+	column string
+	v      any
+}
+
+func (s sealedValue) Value() (driver.Value, error) {
+	v := s.v
+	if valuer, ok := v.(driver.Valuer); ok {
+		var err error
+		if v, err = valuer.Value(); err != nil {
+			return nil, err
+		}
+	}
+	if v == nil {
+		return nil, nil
+	}
+	plaintext := fmt.Sprint(v)
+	if FieldKeys == nil {
+		return plaintext, nil
+	}
+	return FieldKeys.Seal(s.column, plaintext)
+}
+
+// opened is a Scan destination that decrypts a value of column into dest.
+func opened(column string, dest sql.Scanner) sql.Scanner {
+	return &openedValue{column: column, dest: dest}
+}
+
+type openedValue struct {
+	column string
+	dest   sql.Scanner
+}
+
+func (o *openedValue) Scan(src any) error {
+	var s string
+	switch v := src.(type) {
+	case nil:
+		return o.dest.Scan(nil)
+	case string:
+		s = v
+	case []byte:
+		s = string(v)
+	default:
+		return o.dest.Scan(src)
+	}
+	plaintext, err := openValue(o.column, s)
+	if err != nil {
+		return err
+	}
+	return o.dest.Scan(plaintext)
+}
+
+// openValue decrypts a value of column. Values written before the column
+// was encrypted are returned as they are.
+func openValue(column, s string) (string, error) {
+	if !fieldcrypt.Sealed(s) {
+		return s, nil
+	}
+	if FieldKeys == nil {
+		return "", fmt.Errorf("%s is encrypted but no field encryption keys are configured", column)
+	}
+	return FieldKeys.Open(column, s)
+}
+
+// openRow decrypts the encrypted columns of a row of t read as JSON, such
+// as a version from row_history.
+func (t *TableInfo) openRow(row map[string]any) error {
+	for _, c := range t.Columns {
+		s, ok := row[c.Name].(string)
+		if !c.Encrypted || !ok {
+			continue
+		}
+		v, err := openValue(t.column(c.Name), s)
+		if err != nil {
+			return err
+		}
+		row[c.Name] = v
+	}
+	return nil
+}
+
+// column names a column of t for encryption, e.g. "users.phone".
+func (t *TableInfo) column(name string) string {
+	return strings.ToLower(t.Name) + "." + name
+}
+
+// Mask hides most of a personal value for display, keeping enough to tell
+// values apart:
+//
+//	phone   +7 912 345 12 34  ->  +7 *** *** 12 34  (country code and last 4 digits)
+//	code    E11.9             ->  E**.*             (first character)
+//	number  52000             ->  ***
+//
+// An empty value stays empty.
+func Mask(kind, value string) string {
+	if value == "" {
+		return ""
+	}
+	switch kind {
+	case "phone":
+		return maskPhone(value)
+	case "code":
+		var b strings.Builder
+		for i, r := range value {
+			if i > 0 && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+				r = '*'
+			}
+			b.WriteRune(r)
+		}
+		return b.String()
+	}
+	return "***"
+}
+
+func maskPhone(value string) string {
+	digits := 0
+	for _, r := range value {
+		if unicode.IsDigit(r) {
+			digits++
+		}
+	}
+	tail := 4
+	if digits < 8 {
+		tail = 0
+	}
+
+	var b strings.Builder
+	seen, prefix := 0, strings.HasPrefix(strings.TrimSpace(value), "+")
+	for _, r := range value {
+		if !unicode.IsDigit(r) {
+			if r != '+' && seen > 0 {
+				prefix = false
+			}
+			b.WriteRune(r)
+			continue
+		}
+		seen++
+		if prefix && seen <= 3 || seen > digits-tail {
+			b.WriteRune(r)
+		} else {
+			b.WriteRune('*')
+		}
+	}
+	return b.String()
+}
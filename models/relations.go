@@ -0,0 +1,214 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+)
+
+// Join queries behind the related-data sections of the view pages. Unlike
+// the per-table files these are written by hand.
+
+// DiscoveryDetail is a Discover row with the description of its disease.
+type DiscoveryDetail struct {
+	Discover
+	DiseaseDescription string `json:"disease_description"`
+}
+
+// RecordDetail is a Record row with the name of the public servant who
+// submitted it and the description of its disease.
+type RecordDetail struct {
+	Record
+	ServantName        string `json:"servant_name"`
+	DiseaseDescription string `json:"disease_description"`
+}
+
+// SpecializedDoctor is a doctor specialized in a disease type.
+type SpecializedDoctor struct {
+	Email   string `json:"email"`
+	Name    string `json:"name"`
+	Surname string `json:"surname"`
+	Degree  string `json:"degree"`
+}
+
+const userColumns = "u.email, u.name, u.surname, u.salary, u.phone, u.cname"
+
+// GetUsersByCountry returns the users living in a country.
+func GetUsersByCountry(ctx context.Context, db *sql.DB, cname string) ([]User, error) {
+	return queryUsers(ctx, db, "SELECT "+userColumns+" FROM Users u WHERE u.cname=$1 AND u.deleted_at IS NULL ORDER BY u.surname, u.name", cname)
+}
+
+// GetPatientsByDisease returns the users registered as having a disease.
+func GetPatientsByDisease(ctx context.Context, db *sql.DB, diseaseCode string) ([]User, error) {
+	return queryUsers(ctx, db, "SELECT "+userColumns+" FROM Users u JOIN PatientDisease pd ON pd.email = u.email WHERE pd.disease_code=$1 AND pd.deleted_at IS NULL AND u.deleted_at IS NULL ORDER BY u.surname, u.name", diseaseCode)
+}
+
+func queryUsers(ctx context.Context, db *sql.DB, query string, args ...any) ([]User, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []User
+	for rows.Next() {
+		var x User
+		if err := rows.Scan(&x.Email, &x.Name, &x.Surname, opened("users.salary", &x.Salary), opened("users.phone", &x.Phone), &x.CName); err != nil {
+			return nil, err
+		}
+		items = append(items, x)
+	}
+	return items, rows.Err()
+}
+
+// GetDiscoveriesByCountry returns the diseases first encountered in a
+// country, oldest first.
+func GetDiscoveriesByCountry(ctx context.Context, db *sql.DB, cname string) ([]DiscoveryDetail, error) {
+	return queryDiscoveries(ctx, db, "d.cname=$1", cname)
+}
+
+// GetDiscoveriesByDisease returns the countries where a disease was
+// encountered, oldest first.
+func GetDiscoveriesByDisease(ctx context.Context, db *sql.DB, diseaseCode string) ([]DiscoveryDetail, error) {
+	return queryDiscoveries(ctx, db, "d.disease_code=$1", diseaseCode)
+}
+
+func queryDiscoveries(ctx context.Context, db *sql.DB, where string, args ...any) ([]DiscoveryDetail, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	rows, err := db.QueryContext(ctx, "SELECT d.cname, d.disease_code, d.first_enc_date, dis.description FROM Discover d JOIN Disease dis ON dis.disease_code = d.disease_code WHERE "+where+" AND d.deleted_at IS NULL AND dis.deleted_at IS NULL ORDER BY d.first_enc_date", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []DiscoveryDetail
+	for rows.Next() {
+		var x DiscoveryDetail
+		if err := rows.Scan(&x.CName, &x.DiseaseCode, &x.FirstEncDate, &x.DiseaseDescription); err != nil {
+			return nil, err
+		}
+		items = append(items, x)
+	}
+	return items, rows.Err()
+}
+
+// GetRecordsByCountry returns the records submitted for a country.
+func GetRecordsByCountry(ctx context.Context, db *sql.DB, cname string) ([]RecordDetail, error) {
+	return queryRecords(ctx, db, "r.cname=$1", cname)
+}
+
+// GetRecordsByServant returns the records submitted by a public servant.
+func GetRecordsByServant(ctx context.Context, db *sql.DB, email string) ([]RecordDetail, error) {
+	return queryRecords(ctx, db, "r.email=$1", email)
+}
+
+func queryRecords(ctx context.Context, db *sql.DB, where string, args ...any) ([]RecordDetail, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	rows, err := db.QueryContext(ctx, `SELECT r.email, r.cname, r.disease_code, r.total_deaths, r.total_patients, u.name || ' ' || u.surname, dis.description
+		FROM Record r
+		JOIN Users u ON u.email = r.email
+		JOIN Disease dis ON dis.disease_code = r.disease_code
+		WHERE `+where+` AND r.deleted_at IS NULL AND u.deleted_at IS NULL AND dis.deleted_at IS NULL
+		ORDER BY r.cname, r.disease_code, r.email`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []RecordDetail
+	for rows.Next() {
+		var x RecordDetail
+		if err := rows.Scan(&x.Email, &x.CName, &x.DiseaseCode, &x.TotalDeaths, &x.TotalPatients, &x.ServantName, &x.DiseaseDescription); err != nil {
+			return nil, err
+		}
+		items = append(items, x)
+	}
+	return items, rows.Err()
+}
+
+// GetDoctorsBySpecialization returns the doctors specialized in a disease
+// type.
+func GetDoctorsBySpecialization(ctx context.Context, db *sql.DB, id int) ([]SpecializedDoctor, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	rows, err := db.QueryContext(ctx, `SELECT u.email, u.name, u.surname, doc.degree
+		FROM Specialize s
+		JOIN Doctor doc ON doc.email = s.email
+		JOIN Users u ON u.email = s.email
+		WHERE s.id=$1 AND s.deleted_at IS NULL AND doc.deleted_at IS NULL AND u.deleted_at IS NULL
+		ORDER BY u.surname, u.name`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []SpecializedDoctor
+	for rows.Next() {
+		var x SpecializedDoctor
+		if err := rows.Scan(&x.Email, &x.Name, &x.Surname, &x.Degree); err != nil {
+			return nil, err
+		}
+		items = append(items, x)
+	}
+	return items, rows.Err()
+}
+
+// GetDiseasesByPatient returns the diseases a patient has.
+func GetDiseasesByPatient(ctx context.Context, db *sql.DB, email string) ([]Disease, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	rows, err := db.QueryContext(ctx, `SELECT dis.disease_code, dis.pathogen, dis.description, dis.id
+		FROM PatientDisease pd
+		JOIN Disease dis ON dis.disease_code = pd.disease_code
+		WHERE pd.email=$1 AND pd.deleted_at IS NULL AND dis.deleted_at IS NULL
+		ORDER BY dis.disease_code`, email)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []Disease
+	for rows.Next() {
+		var x Disease
+		if err := rows.Scan(&x.DiseaseCode, &x.Pathogen, &x.Description, &x.ID); err != nil {
+			return nil, err
+		}
+		items = append(items, x)
+	}
+	return items, rows.Err()
+}
+
+// GetSpecializationsByDoctor returns the disease types a doctor is
+// specialized in.
+func GetSpecializationsByDoctor(ctx context.Context, db *sql.DB, email string) ([]DiseaseType, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	rows, err := db.QueryContext(ctx, `SELECT dt.id, dt.description
+		FROM Specialize s
+		JOIN DiseaseType dt ON dt.id = s.id
+		WHERE s.email=$1 AND s.deleted_at IS NULL AND dt.deleted_at IS NULL
+		ORDER BY dt.description`, email)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []DiseaseType
+	for rows.Next() {
+		var x DiseaseType
+		if err := rows.Scan(&x.ID, &x.Description); err != nil {
+			return nil, err
+		}
+		items = append(items, x)
+	}
+	return items, rows.Err()
+}
@@ -0,0 +1,228 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// Report scopes: a report covers one country, or all, broken down by
+// disease, or one disease, or all, broken down by country.
+const (
+	ReportCountry = "country"
+	ReportDisease = "disease"
+)
+
+// ReportSchedule generates a report whenever its cron Spec is due,
+// covering the PeriodDays before.
+type ReportSchedule struct {
+	ID         int
+	Name       string
+	Scope      string
+	Subject    sql.NullString // the country or disease; all if NULL
+	Spec       string
+	PeriodDays int
+	Active     bool
+	NextRunAt  time.Time
+	LastRunAt  sql.NullTime
+	CreatedAt  time.Time
+}
+
+// Report is a generated report. HTML and PDF are only loaded by
+// GetReport.
+type Report struct {
+	ID          int64
+	ScheduleID  sql.NullInt64
+	Title       string
+	Scope       string
+	Subject     sql.NullString
+	PeriodStart time.Time
+	PeriodEnd   time.Time
+	GeneratedAt time.Time
+	HTML        string
+	PDF         []byte
+	PDFSize     int
+}
+
+// ErrNoReport is returned for a report or schedule that does not exist.
+var ErrNoReport = errors.New("report not found")
+
+// GetReportSchedules returns every report schedule by name.
+func GetReportSchedules(ctx context.Context, db *sql.DB) ([]ReportSchedule, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	rows, err := db.QueryContext(ctx, "SELECT id, name, scope, subject, spec, period_days, active, next_run_at, last_run_at, created_at"+
+		" FROM report_schedule ORDER BY name, id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var schedules []ReportSchedule
+	for rows.Next() {
+		var s ReportSchedule
+		if err := rows.Scan(&s.ID, &s.Name, &s.Scope, &s.Subject, &s.Spec, &s.PeriodDays, &s.Active, &s.NextRunAt,
+			&s.LastRunAt, &s.CreatedAt); err != nil {
+			return nil, err
+		}
+		schedules = append(schedules, s)
+	}
+	return schedules, rows.Err()
+}
+
+// CreateReportSchedule stores a new schedule, which first runs at
+// s.NextRunAt, and sets its ID.
+func CreateReportSchedule(ctx context.Context, db *sql.DB, s *ReportSchedule) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	return db.QueryRowContext(ctx, "INSERT INTO report_schedule (name, scope, subject, spec, period_days, active, next_run_at)"+
+		" VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id, created_at",
+		s.Name, s.Scope, s.Subject, s.Spec, s.PeriodDays, s.Active, s.NextRunAt).Scan(&s.ID, &s.CreatedAt)
+}
+
+// SetReportScheduleActive pauses or resumes a schedule. A resumed
+// schedule runs next at next rather than catching up.
+func SetReportScheduleActive(ctx context.Context, db *sql.DB, id int, active bool, next time.Time) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	return reportFound(db.ExecContext(ctx, "UPDATE report_schedule SET active=$1,"+
+		" next_run_at = CASE WHEN $1 AND NOT active THEN $2 ELSE next_run_at END WHERE id=$3", active, next, id))
+}
+
+// DeleteReportSchedule deletes a schedule; its reports are kept.
+func DeleteReportSchedule(ctx context.Context, db *sql.DB, id int) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	return reportFound(db.ExecContext(ctx, "DELETE FROM report_schedule WHERE id=$1", id))
+}
+
+// QueueDueReports queues a job of kind for every active report schedule
+// that is due, with the schedule and the period to cover as its payload,
+// and moves the schedule to its next run, given by next. It returns the
+// number of jobs queued.
+func QueueDueReports(ctx context.Context, db *sql.DB, kind string, next func(spec string, after time.Time) (time.Time, error)) (int, error) {
+	var n int
+	err := inTx(ctx, db, func(ctx context.Context, tx *sql.Tx) error {
+		rows, err := tx.QueryContext(ctx, "SELECT id, spec, next_run_at FROM report_schedule"+
+			" WHERE active AND next_run_at <= now() FOR UPDATE SKIP LOCKED")
+		if err != nil {
+			return err
+		}
+		var due []ReportSchedule
+		for rows.Next() {
+			var s ReportSchedule
+			if err := rows.Scan(&s.ID, &s.Spec, &s.NextRunAt); err != nil {
+				rows.Close()
+				return err
+			}
+			due = append(due, s)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		now := time.Now()
+		for _, s := range due {
+			at, err := next(s.Spec, now)
+			if err != nil {
+				return err
+			}
+			// The report covers the period up to when it was due.
+			if _, err := tx.ExecContext(ctx, "INSERT INTO job (kind, payload, schedule)"+
+				" SELECT $1, jsonb_build_object('tenant_id', tenant_id, 'schedule_id', id, 'name', name, 'scope', scope, 'subject', subject,"+
+				" 'period_days', period_days, 'end', next_run_at), 'report:' || name FROM report_schedule WHERE id=$2",
+				kind, s.ID); err != nil {
+				return err
+			}
+			if _, err := tx.ExecContext(ctx, "UPDATE report_schedule SET next_run_at=$1, last_run_at=now() WHERE id=$2",
+				at, s.ID); err != nil {
+				return err
+			}
+		}
+		n = len(due)
+		return nil
+	})
+	return n, err
+}
+
+// SaveReport stores a generated report and sets its ID.
+func SaveReport(ctx context.Context, db *sql.DB, r *Report) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	return db.QueryRowContext(ctx, "INSERT INTO report (schedule_id, title, scope, subject, period_start, period_end, html, pdf)"+
+		" VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id, generated_at",
+		r.ScheduleID, r.Title, r.Scope, r.Subject, r.PeriodStart, r.PeriodEnd, r.HTML, r.PDF).Scan(&r.ID, &r.GeneratedAt)
+}
+
+// GetReports returns up to limit reports, newest first, without their
+// contents.
+func GetReports(ctx context.Context, db *sql.DB, limit int) ([]Report, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	rows, err := db.QueryContext(ctx, "SELECT id, schedule_id, title, scope, subject, period_start, period_end, generated_at,"+
+		" octet_length(pdf) FROM report ORDER BY generated_at DESC, id DESC LIMIT $1", limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var reports []Report
+	for rows.Next() {
+		var r Report
+		if err := rows.Scan(&r.ID, &r.ScheduleID, &r.Title, &r.Scope, &r.Subject, &r.PeriodStart, &r.PeriodEnd,
+			&r.GeneratedAt, &r.PDFSize); err != nil {
+			return nil, err
+		}
+		reports = append(reports, r)
+	}
+	return reports, rows.Err()
+}
+
+// GetReport returns a report with its contents.
+func GetReport(ctx context.Context, db *sql.DB, id int64) (*Report, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	var r Report
+	err := db.QueryRowContext(ctx, "SELECT id, schedule_id, title, scope, subject, period_start, period_end, generated_at, html, pdf"+
+		" FROM report WHERE id=$1", id).Scan(&r.ID, &r.ScheduleID, &r.Title, &r.Scope, &r.Subject, &r.PeriodStart,
+		&r.PeriodEnd, &r.GeneratedAt, &r.HTML, &r.PDF)
+	if err == sql.ErrNoRows {
+		return nil, ErrNoReport
+	}
+	if err != nil {
+		return nil, err
+	}
+	r.PDFSize = len(r.PDF)
+	return &r, nil
+}
+
+// DeleteReport deletes an archived report.
+func DeleteReport(ctx context.Context, db *sql.DB, id int64) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	return reportFound(db.ExecContext(ctx, "DELETE FROM report WHERE id=$1", id))
+}
+
+func reportFound(res sql.Result, err error) error {
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNoReport
+	}
+	return nil
+}
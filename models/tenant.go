@@ -0,0 +1,153 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Every row of the application's data belongs to an organization, in its
+// tenant_id column. The database connection follows the organization of
+// the context each query runs with (see db/tenant.go): row-level security
+// (db/migrations/0012_organizations.sql) then only lets the query see and
+// change that organization's rows, and new rows get its tenant_id. Models
+// therefore never filter on tenant_id themselves.
+
+type tenantKey struct{}
+
+// allTenants is the tenant of work done for every organization.
+const allTenants = -1
+
+// WithTenant scopes the queries done with ctx to the organization id.
+func WithTenant(ctx context.Context, id int) context.Context {
+	return context.WithValue(ctx, tenantKey{}, id)
+}
+
+// WithAllTenants lets the queries done with ctx see the rows of every
+// organization, for background work such as delivering queued emails. It
+// cannot insert rows into the tenant tables.
+func WithAllTenants(ctx context.Context) context.Context {
+	return context.WithValue(ctx, tenantKey{}, allTenants)
+}
+
+// Tenant returns the organization set by WithTenant. ok is false when
+// there is none, or ctx is for every organization.
+func Tenant(ctx context.Context) (id int, ok bool) {
+	id, ok = ctx.Value(tenantKey{}).(int)
+	return id, ok && id != allTenants
+}
+
+// TenantSetting is the value of the app.tenant setting the row-level
+// security policies read for ctx: the organization id, "all", or "" for
+// no organization, which sees no rows.
+func TenantSetting(ctx context.Context) string {
+	id, ok := ctx.Value(tenantKey{}).(int)
+	switch {
+	case !ok:
+		return ""
+	case id == allTenants:
+		return "all"
+	}
+	return strconv.Itoa(id)
+}
+
+// Organization is a tenant: an agency whose data is kept apart from the
+// others'.
+type Organization struct {
+	ID        int
+	Slug      string // in subdomains, e.g. who.health.example.org
+	Name      string
+	CreatedAt time.Time
+}
+
+// ErrInvalidSlug is returned by CreateOrganization for a slug that cannot
+// be a subdomain.
+var ErrInvalidSlug = errors.New("a slug is 1 to 40 lower-case letters, digits and inner hyphens")
+
+var slugRe = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]{0,38}[a-z0-9])?$`)
+
+// GetOrganizations returns every organization by slug.
+func GetOrganizations(ctx context.Context, db *sql.DB) ([]Organization, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	rows, err := db.QueryContext(ctx, "SELECT id, slug, name, created_at FROM organization ORDER BY slug")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var orgs []Organization
+	for rows.Next() {
+		var o Organization
+		if err := rows.Scan(&o.ID, &o.Slug, &o.Name, &o.CreatedAt); err != nil {
+			return nil, err
+		}
+		orgs = append(orgs, o)
+	}
+	return orgs, rows.Err()
+}
+
+// GetOrganizationBySlug returns the organization with the slug, or nil if
+// there is none.
+func GetOrganizationBySlug(ctx context.Context, db *sql.DB, slug string) (*Organization, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	var o Organization
+	err := db.QueryRowContext(ctx, "SELECT id, slug, name, created_at FROM organization WHERE slug=$1", strings.ToLower(slug)).
+		Scan(&o.ID, &o.Slug, &o.Name, &o.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &o, nil
+}
+
+// CreateOrganization adds an organization. It starts without any data.
+func CreateOrganization(ctx context.Context, db *sql.DB, slug, name string) (*Organization, error) {
+	if !slugRe.MatchString(slug) {
+		return nil, ErrInvalidSlug
+	}
+	if name = strings.TrimSpace(name); name == "" {
+		return nil, errors.New("the organization needs a name")
+	}
+
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	o := Organization{Slug: slug, Name: name}
+	err := db.QueryRowContext(ctx, "INSERT INTO organization (slug, name) VALUES ($1, $2) RETURNING id, created_at", slug, name).
+		Scan(&o.ID, &o.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &o, nil
+}
+
+// ForEachOrganization calls fn with a context scoped to each organization
+// in turn. An organization that fails does not stop the others; the errors
+// are joined.
+func ForEachOrganization(ctx context.Context, db *sql.DB, fn func(ctx context.Context, o *Organization) error) error {
+	orgs, err := GetOrganizations(ctx, db)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for i := range orgs {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err := fn(WithTenant(ctx, orgs[i].ID), &orgs[i]); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", orgs[i].Slug, err))
+		}
+	}
+	return errors.Join(errs...)
+}
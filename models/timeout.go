@@ -0,0 +1,31 @@
+package models
+
+import (
+	"context"
+	"time"
+)
+
+// QueryTimeout is the deadline applied to every model query on top of the
+// caller's context. A zero or negative value disables the per-query deadline.
+var QueryTimeout = 5 * time.Second
+
+// JobTimeout replaces QueryTimeout for the work of background jobs, such
+// as purging the trash, which may touch every table in one transaction. A
+// zero or negative value leaves them bounded by the caller's context only.
+var JobTimeout = 10 * time.Minute
+
+// BulkRowTimeout is added to QueryTimeout for every selected row of a bulk
+// action, which handles the whole selection in one transaction.
+var BulkRowTimeout = 50 * time.Millisecond
+
+func withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	return timeoutAfter(ctx, QueryTimeout)
+}
+
+// timeoutAfter bounds ctx by d, unless d is zero or negative.
+func timeoutAfter(ctx context.Context, d time.Duration) (context.Context, context.CancelFunc) {
+	if d <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, d)
+}
@@ -0,0 +1,123 @@
+package models_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"myapp/db"
+	"myapp/models"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// These tests need a database:
+//
+//	DATABASE_URL=... go test ./models
+
+// openDB connects to DATABASE_URL and migrates it, or skips the test.
+func openDB(t *testing.T) *sql.DB {
+	t.Helper()
+	dbURL := os.Getenv("DATABASE_URL")
+	if dbURL == "" {
+		t.Skip("DATABASE_URL is not set")
+	}
+	conn, err := db.NewPostgresDB(dbURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	if err := db.Migrate(context.Background(), conn); err != nil {
+		t.Fatal(err)
+	}
+	return conn
+}
+
+// setQueryTimeout sets models.QueryTimeout until the test ends.
+func setQueryTimeout(t *testing.T, d time.Duration) {
+	old := models.QueryTimeout
+	models.QueryTimeout = d
+	t.Cleanup(func() { models.QueryTimeout = old })
+}
+
+// lockOrganizations keeps every query of the organization table waiting
+// until the returned func is called, or the test ends.
+func lockOrganizations(t *testing.T, conn *sql.DB) (unlock func()) {
+	t.Helper()
+	tx, err := conn.BeginTx(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tx.Exec("LOCK TABLE organization IN ACCESS EXCLUSIVE MODE"); err != nil {
+		tx.Rollback()
+		t.Fatal(err)
+	}
+	unlock = func() { tx.Rollback() }
+	t.Cleanup(unlock)
+	return unlock
+}
+
+// wantCancelled checks that err is a query stopped by its context, after
+// at most max.
+func wantCancelled(t *testing.T, err error, took, max time.Duration) {
+	t.Helper()
+	var pqErr *pq.Error
+	switch {
+	case err == nil:
+		t.Error("the query succeeded")
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+	case errors.As(err, &pqErr) && pqErr.Code == "57014": // query_canceled
+	default:
+		t.Errorf("failed with %v instead of being cancelled", err)
+	}
+	if took > max {
+		t.Errorf("stopped after %v instead of %v", took, max)
+	}
+}
+
+func TestQueryCancelledByContext(t *testing.T) {
+	conn := openDB(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := conn.ExecContext(ctx, "SELECT pg_sleep(30)")
+	wantCancelled(t, err, time.Since(start), 5*time.Second)
+}
+
+func TestQueryTimeout(t *testing.T) {
+	conn := openDB(t)
+	setQueryTimeout(t, 200*time.Millisecond)
+	lockOrganizations(t, conn)
+
+	start := time.Now()
+	_, err := models.GetOrganizations(context.Background(), conn)
+	wantCancelled(t, err, time.Since(start), 5*time.Second)
+}
+
+func TestQueryTimeoutKeepsShorterDeadline(t *testing.T) {
+	conn := openDB(t)
+	setQueryTimeout(t, time.Minute)
+	lockOrganizations(t, conn)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := models.GetOrganizations(ctx, conn)
+	wantCancelled(t, err, time.Since(start), 5*time.Second)
+}
+
+func TestQueryTimeoutDisabled(t *testing.T) {
+	conn := openDB(t)
+	setQueryTimeout(t, 0)
+	unlock := lockOrganizations(t, conn)
+
+	// With no deadline the query waits out a lock held longer than any
+	// timeout the other tests use.
+	time.AfterFunc(time.Second, unlock)
+	if _, err := models.GetOrganizations(context.Background(), conn); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,341 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Soft-deleted rows keep their data and get deleted_at and deleted_by set.
+// Deleting a row also deletes every row that references it, directly or
+// through other rows, with the very same deleted_at value; that shared
+// timestamp is what ties the rows of one deletion together so that they can
+// be restored as a unit.
+
+// ErrNotInTrash is returned when restoring a row that is not deleted.
+var ErrNotInTrash = errors.New("row is not in the trash")
+
+// ErrInTrash is returned when creating a row whose key is held by a row in
+// the trash.
+var ErrInTrash = errors.New("a deleted row with this key is in the trash; restore it from /trash instead")
+
+// ErrMissingParent is returned when a row would reference a row that does
+// not exist or is in the trash, which the foreign keys alone accept.
+var ErrMissingParent = errors.New("no such row, or it is in the trash")
+
+// RestoreBlockedError is returned when restoring a row whose parent is
+// still deleted.
+type RestoreBlockedError struct {
+	Parent string // label of the deleted parent table
+}
+
+func (e *RestoreBlockedError) Error() string {
+	return fmt.Sprintf("the %s this row belongs to is deleted; restore it first", strings.ToLower(e.Parent))
+}
+
+// TrashItem is a row deleted directly, as opposed to one deleted along
+// with the row it references.
+type TrashItem struct {
+	Table      *TableInfo
+	Key        []string // primary key values in Table.Keys order
+	DeletedAt  time.Time
+	DeletedBy  string
+	Dependents int // rows deleted together with this one
+}
+
+// TableByName returns the metadata of a table, or nil.
+func TableByName(name string) *TableInfo {
+	for _, t := range Tables {
+		if strings.EqualFold(t.Name, name) {
+			return t
+		}
+	}
+	return nil
+}
+
+func softDelete(ctx context.Context, db *sql.DB, table string, keys ...any) error {
+	t := TableByName(table)
+	stamp := time.Now().UTC().Truncate(time.Microsecond)
+	actor := Actor(ctx)
+
+	return inTx(ctx, db, func(ctx context.Context, tx *sql.Tx) error {
+		res, err := tx.ExecContext(ctx, "UPDATE "+t.Name+" SET deleted_at=$1, deleted_by=$2 WHERE "+keyWhere(t, "", 3)+" AND deleted_at IS NULL",
+			append([]any{stamp, nullString(actor)}, keys...)...)
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return nil
+		}
+
+		return cascadeDelete(ctx, tx, stamp, nullString(actor))
+	})
+}
+
+// cascadeDelete moves to the trash every live row whose parent was deleted
+// at stamp, so they are restored together.
+func cascadeDelete(ctx context.Context, tx *sql.Tx, stamp time.Time, actor sql.NullString) error {
+	// Tables lists parents first, so one pass reaches every descendant.
+	for _, child := range Tables {
+		if !child.SoftDelete || len(child.References) == 0 {
+			continue
+		}
+		_, err := tx.ExecContext(ctx, "UPDATE "+child.Name+" c SET deleted_at=$1, deleted_by=$2 WHERE c.deleted_at IS NULL AND ("+
+			parentsWhere(child, "p.deleted_at = $1", " OR ")+")", stamp, actor)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Restore brings back a deleted row together with the rows that were
+// deleted along with it.
+func Restore(ctx context.Context, db *sql.DB, table string, key []string) error {
+	t := TableByName(table)
+	if t == nil || !t.SoftDelete {
+		return fmt.Errorf("unknown table %q", table)
+	}
+	if len(key) != len(t.Keys) {
+		return fmt.Errorf("%s needs %d key values, got %d", t.Name, len(t.Keys), len(key))
+	}
+	args := make([]any, len(key))
+	for i, v := range key {
+		args[i] = v
+	}
+
+	return inTx(ctx, db, func(ctx context.Context, tx *sql.Tx) error {
+		var stamp time.Time
+		err := tx.QueryRowContext(ctx, "SELECT deleted_at FROM "+t.Name+" WHERE "+keyWhere(t, "", 1)+" AND deleted_at IS NOT NULL", args...).
+			Scan(&stamp)
+		if err == sql.ErrNoRows {
+			return ErrNotInTrash
+		}
+		if err != nil {
+			return err
+		}
+
+		for _, ref := range t.References {
+			var deleted bool
+			err := tx.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM "+t.Name+" c JOIN "+ref.Table+" p ON p."+ref.RefColumn+" = c."+ref.Column+
+				" WHERE "+keyWhere(t, "c.", 1)+" AND p.deleted_at IS NOT NULL)", args...).
+				Scan(&deleted)
+			if err != nil {
+				return err
+			}
+			if deleted {
+				label := ref.Table
+				if parent := TableByName(ref.Table); parent != nil {
+					label = parent.Label
+				}
+				return &RestoreBlockedError{Parent: label}
+			}
+		}
+
+		_, err = tx.ExecContext(ctx, "UPDATE "+t.Name+" SET deleted_at=NULL, deleted_by=NULL WHERE "+keyWhere(t, "", 1), args...)
+		if err != nil {
+			return err
+		}
+
+		// A row of the same deletion comes back once all its parents are
+		// live again.
+		for _, child := range Tables {
+			if !child.SoftDelete || len(child.References) == 0 {
+				continue
+			}
+			_, err := tx.ExecContext(ctx, "UPDATE "+child.Name+" c SET deleted_at=NULL, deleted_by=NULL WHERE c.deleted_at = $1 AND "+
+				parentsWhere(child, "p.deleted_at IS NULL", " AND "), stamp)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// GetTrash returns the rows deleted directly, newest first, with the number
+// of rows that went with each of them.
+func GetTrash(ctx context.Context, db *sql.DB) ([]TrashItem, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	var items []TrashItem
+	batches := make(map[time.Time]int)
+	for _, t := range Tables {
+		if !t.SoftDelete {
+			continue
+		}
+
+		cols := make([]string, len(t.Keys))
+		for i, k := range t.Keys {
+			cols[i] = "c." + k + "::text"
+		}
+		query := "SELECT " + strings.Join(cols, ", ") + ", c.deleted_at, COALESCE(c.deleted_by, '')"
+		if len(t.References) > 0 {
+			query += ", " + parentsWhere(t, "p.deleted_at = c.deleted_at", " OR ")
+		} else {
+			query += ", false"
+		}
+		query += " FROM " + t.Name + " c WHERE c.deleted_at IS NOT NULL"
+
+		rows, err := db.QueryContext(ctx, query)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			item := TrashItem{Table: t, Key: make([]string, len(t.Keys))}
+			var cascaded bool
+			dest := make([]any, 0, len(t.Keys)+3)
+			for i := range item.Key {
+				dest = append(dest, &item.Key[i])
+			}
+			dest = append(dest, &item.DeletedAt, &item.DeletedBy, &cascaded)
+			if err := rows.Scan(dest...); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			batches[item.DeletedAt.UTC()]++
+			if !cascaded {
+				items = append(items, item)
+			}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	for i := range items {
+		items[i].Dependents = batches[items[i].DeletedAt.UTC()] - 1
+	}
+	sort.SliceStable(items, func(i, j int) bool { return items[i].DeletedAt.After(items[j].DeletedAt) })
+	return items, nil
+}
+
+// PurgeTrash permanently deletes rows that were deleted before cutoff and
+// returns how many were removed. Rows still referenced by a row that stays
+// are kept until it goes. It runs as a job, so it is bounded by JobTimeout
+// rather than QueryTimeout.
+func PurgeTrash(ctx context.Context, db *sql.DB, cutoff time.Time) (int64, error) {
+	var total int64
+	err := inTxFor(ctx, db, JobTimeout, func(ctx context.Context, tx *sql.Tx) error {
+		// Children first, so no foreign key points at a purged row.
+		for i := len(Tables) - 1; i >= 0; i-- {
+			t := Tables[i]
+			if !t.SoftDelete {
+				continue
+			}
+			query := "DELETE FROM " + t.Name + " p WHERE p.deleted_at < $1"
+			for _, child := range Tables {
+				for _, ref := range child.References {
+					if strings.EqualFold(ref.Table, t.Name) {
+						query += " AND NOT EXISTS (SELECT 1 FROM " + child.Name + " c WHERE c.tenant_id = p.tenant_id AND c." + ref.Column + " = p." + ref.RefColumn + ")"
+					}
+				}
+			}
+			res, err := tx.ExecContext(ctx, query, cutoff)
+			if err != nil {
+				return fmt.Errorf("purging %s: %w", t.Name, err)
+			}
+			n, _ := res.RowsAffected()
+			total += n
+		}
+		return nil
+	})
+	return total, err
+}
+
+// trashedKey returns ErrInTrash when err, from inserting a row of table
+// with key values keys, is a unique violation because a deleted row holds
+// that key, and err otherwise.
+func trashedKey(ctx context.Context, db *sql.DB, err error, table string, keys ...any) error {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) || pqErr.Code != "23505" {
+		return err
+	}
+	t := TableByName(table)
+
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	var trashed bool
+	if qerr := db.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM "+t.Name+" WHERE "+keyWhere(t, "", 1)+" AND deleted_at IS NOT NULL)", keys...).
+		Scan(&trashed); qerr != nil || !trashed {
+		return err
+	}
+	return ErrInTrash
+}
+
+// RequireParents returns ErrMissingParent unless the value of every
+// foreign key column of table in row names a live row of the referenced
+// table.
+func RequireParents(ctx context.Context, db *sql.DB, table string, row map[string]any) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+	return requireParents(ctx, db, table, row)
+}
+
+// queryer is a *sql.DB or *sql.Tx.
+type queryer interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// requireParents is RequireParents for q. Within a transaction the parents
+// are locked FOR SHARE, so they are neither deleted nor re-keyed before it
+// ends.
+func requireParents(ctx context.Context, q queryer, table string, row map[string]any) error {
+	t := TableByName(table)
+	if t == nil {
+		return fmt.Errorf("unknown table %q", table)
+	}
+	for _, ref := range t.References {
+		value, ok := row[ref.Column]
+		if !ok {
+			continue
+		}
+		var one int
+		err := q.QueryRowContext(ctx, "SELECT 1 FROM "+ref.Table+" WHERE "+ref.RefColumn+"=$1 AND deleted_at IS NULL FOR SHARE", value).
+			Scan(&one)
+		if err == sql.ErrNoRows {
+			label := ref.Table
+			if parent := TableByName(ref.Table); parent != nil {
+				label = parent.Label
+			}
+			return fmt.Errorf("%w: %s %q", ErrMissingParent, label, fmt.Sprint(value))
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// keyWhere renders "a=$from AND b=$from+1" for the key of t, with every
+// column prefixed by alias.
+func keyWhere(t *TableInfo, alias string, from int) string {
+	parts := make([]string, len(t.Keys))
+	for i, k := range t.Keys {
+		parts[i] = fmt.Sprintf("%s%s=$%d", alias, k, from+i)
+	}
+	return strings.Join(parts, " AND ")
+}
+
+// parentsWhere renders one EXISTS test per foreign key of the row aliased c,
+// checking cond against the referenced row aliased p.
+func parentsWhere(t *TableInfo, cond, sep string) string {
+	parts := make([]string, len(t.References))
+	for i, ref := range t.References {
+		parts[i] = "EXISTS (SELECT 1 FROM " + ref.Table + " p WHERE p." + ref.RefColumn + " = c." + ref.Column + " AND " + cond + ")"
+	}
+	return strings.Join(parts, sep)
+}
+
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
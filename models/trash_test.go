@@ -0,0 +1,98 @@
+package models_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"myapp/models"
+	"testing"
+	"time"
+)
+
+// openOrg connects like openDB and returns the context of a new
+// organization, which is removed with all its rows when the test ends.
+func openOrg(t *testing.T) (*sql.DB, context.Context) {
+	t.Helper()
+	conn := openDB(t)
+	ctx := context.Background()
+	o, err := models.CreateOrganization(ctx, conn, fmt.Sprintf("trash-%06d", rand.IntN(1e6)), "Trash test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		ctx := models.WithAllTenants(context.Background())
+		var tables []string
+		for i := len(models.Tables) - 1; i >= 0; i-- {
+			tables = append(tables, models.Tables[i].Name)
+		}
+		for _, table := range append(tables, "row_history", "email_outbox", "organization") {
+			column := "tenant_id"
+			if table == "organization" {
+				column = "id"
+			}
+			if _, err := conn.ExecContext(ctx, "DELETE FROM "+table+" WHERE "+column+" = $1", o.ID); err != nil {
+				t.Errorf("cleaning up %s: %v", table, err)
+			}
+		}
+	})
+	return conn, models.WithTenant(ctx, o.ID)
+}
+
+func TestCreateInTrash(t *testing.T) {
+	conn, ctx := openOrg(t)
+
+	if err := models.CreateCountry(ctx, conn, &models.Country{CName: "Atlantis"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := models.CreateCountry(ctx, conn, &models.Country{CName: "Atlantis"}); err == nil || errors.Is(err, models.ErrInTrash) {
+		t.Errorf("creating a live key: got %v, want the unique violation", err)
+	}
+	if err := models.DeleteCountry(ctx, conn, "Atlantis"); err != nil {
+		t.Fatal(err)
+	}
+	if err := models.CreateCountry(ctx, conn, &models.Country{CName: "Atlantis"}); !errors.Is(err, models.ErrInTrash) {
+		t.Errorf("creating a trashed key: got %v, want ErrInTrash", err)
+	}
+
+	// Purging is bounded by JobTimeout, not by QueryTimeout.
+	setQueryTimeout(t, time.Nanosecond)
+	n, err := models.PurgeTrash(ctx, conn, time.Now().Add(time.Second))
+	if err != nil || n != 1 {
+		t.Fatalf("purged %d rows: %v", n, err)
+	}
+	setQueryTimeout(t, time.Minute)
+	if err := models.CreateCountry(ctx, conn, &models.Country{CName: "Atlantis"}); err != nil {
+		t.Errorf("creating a purged key: %v", err)
+	}
+}
+
+func TestPurgeKeepsReferencedRows(t *testing.T) {
+	conn, ctx := openOrg(t)
+	if err := models.CreateCountry(ctx, conn, &models.Country{CName: "Atlantis"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := models.CreateUser(ctx, conn, &models.User{Email: "ana@example.org", Name: "Ana", Surname: "Diaz", CName: "Atlantis"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// A live user of a country in the trash, as earlier versions allowed.
+	if _, err := conn.ExecContext(ctx, "UPDATE Country SET deleted_at = now() - interval '1 day' WHERE cname = 'Atlantis'"); err != nil {
+		t.Fatal(err)
+	}
+	if err := models.RequireParents(ctx, conn, "Users", map[string]any{"cname": "Atlantis"}); !errors.Is(err, models.ErrMissingParent) {
+		t.Errorf("referencing a trashed country: got %v, want ErrMissingParent", err)
+	}
+	if n, err := models.PurgeTrash(ctx, conn, time.Now()); err != nil || n != 0 {
+		t.Fatalf("purged %d rows: %v; want the referenced country kept", n, err)
+	}
+
+	// Once the user is in the trash too, both go.
+	if err := models.DeleteUser(ctx, conn, "ana@example.org"); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := models.PurgeTrash(ctx, conn, time.Now().Add(time.Second)); err != nil || n != 2 {
+		t.Errorf("purged %d rows: %v; want the user and the country", n, err)
+	}
+}
@@ -0,0 +1,7 @@
+package models
+
+import "errors"
+
+// ErrConflict is returned by updates of versioned tables when the row was
+// changed, or deleted, since the version the caller read.
+var ErrConflict = errors.New("the row was changed by someone else")
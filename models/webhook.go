@@ -0,0 +1,280 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Webhook operations. Moving a row to the trash is a delete, restoring
+// it a create.
+const (
+	WebhookCreate = "create"
+	WebhookUpdate = "update"
+	WebhookDelete = "delete"
+)
+
+// WebhookOperations lists the operations a webhook can subscribe to.
+var WebhookOperations = []string{WebhookCreate, WebhookUpdate, WebhookDelete}
+
+// Webhook is an endpoint notified of changes to one table. The
+// queue_webhooks trigger (db/migrations/0007_webhooks.sql) queues a
+// WebhookDelivery for it in the transaction of every matching change.
+type Webhook struct {
+	ID         int
+	URL        string
+	Secret     string // key of the HMAC signature of every delivery
+	Entity     string // lower-case table name
+	Operations []string
+
+	// Column, if set, limits updates to those changing it, and
+	// IncreaseOnly to those where its numeric value rises.
+	Column       sql.NullString
+	IncreaseOnly bool
+
+	Active    bool
+	CreatedAt time.Time
+}
+
+// WebhookDelivery is one queued event for one webhook.
+type WebhookDelivery struct {
+	ID            int64
+	WebhookID     int
+	URL           string
+	Secret        string
+	Event         string // entity.operation, e.g. discover.create
+	Payload       json.RawMessage
+	CreatedAt     time.Time
+	Attempts      int
+	NextAttemptAt time.Time
+	LastStatus    sql.NullInt64
+	LastError     sql.NullString
+	DeliveredAt   sql.NullTime
+	DeadAt        sql.NullTime
+}
+
+// ErrNoWebhook is returned for a webhook or delivery that does not exist.
+var ErrNoWebhook = errors.New("webhook not found")
+
+// GetWebhooks lists every webhook, newest first.
+func GetWebhooks(ctx context.Context, db *sql.DB) ([]Webhook, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	rows, err := db.QueryContext(ctx, "SELECT id, url, secret, entity, operations, column_name, increase_only, active, created_at"+
+		" FROM webhook ORDER BY id DESC")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []Webhook
+	for rows.Next() {
+		var x Webhook
+		if err := rows.Scan(&x.ID, &x.URL, &x.Secret, &x.Entity, pq.Array(&x.Operations), &x.Column, &x.IncreaseOnly, &x.Active, &x.CreatedAt); err != nil {
+			return nil, err
+		}
+		items = append(items, x)
+	}
+	return items, rows.Err()
+}
+
+// CreateWebhook stores a webhook and sets its ID.
+func CreateWebhook(ctx context.Context, db *sql.DB, x *Webhook) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	return db.QueryRowContext(ctx, "INSERT INTO webhook (url, secret, entity, operations, column_name, increase_only, active)"+
+		" VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id, created_at",
+		x.URL, x.Secret, x.Entity, pq.Array(x.Operations), x.Column, x.IncreaseOnly, x.Active).
+		Scan(&x.ID, &x.CreatedAt)
+}
+
+// SetWebhookActive pauses or resumes a webhook. Changes made while it is
+// paused are not queued for it.
+func SetWebhookActive(ctx context.Context, db *sql.DB, id int, active bool) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	res, err := db.ExecContext(ctx, "UPDATE webhook SET active=$1 WHERE id=$2", active, id)
+	return webhookFound(res, err)
+}
+
+// DeleteWebhook removes a webhook and its deliveries.
+func DeleteWebhook(ctx context.Context, db *sql.DB, id int) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	res, err := db.ExecContext(ctx, "DELETE FROM webhook WHERE id=$1", id)
+	return webhookFound(res, err)
+}
+
+// PingWebhook queues a webhook.ping event for a webhook, to check the
+// endpoint receives and verifies deliveries.
+func PingWebhook(ctx context.Context, db *sql.DB, id int) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	res, err := db.ExecContext(ctx, "INSERT INTO webhook_delivery (webhook_id, event, payload)"+
+		" SELECT id, 'webhook.ping', jsonb_build_object('event', 'webhook.ping', 'entity', 'webhook', 'operation', 'ping',"+
+		" 'occurred_at', now(), 'data', jsonb_build_object('id', id, 'url', url)) FROM webhook WHERE id=$1", id)
+	return webhookFound(res, err)
+}
+
+// ClaimWebhookDeliveries returns up to limit deliveries that are due, oldest
+// first, and moves their next attempt lease into the future so no other
+// dispatcher picks them up meanwhile. A dispatcher that dies mid-delivery
+// thus has its deliveries retried once the lease ends.
+func ClaimWebhookDeliveries(ctx context.Context, db *sql.DB, limit int, lease time.Duration) ([]WebhookDelivery, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	rows, err := db.QueryContext(ctx, "WITH due AS ("+
+		"SELECT id FROM webhook_delivery WHERE delivered_at IS NULL AND dead_at IS NULL AND next_attempt_at <= now()"+
+		" ORDER BY next_attempt_at, id LIMIT $1 FOR UPDATE SKIP LOCKED)"+
+		" UPDATE webhook_delivery d SET next_attempt_at = now() + $2 * interval '1 second'"+
+		" FROM due, webhook w WHERE d.id = due.id AND w.id = d.webhook_id"+
+		" RETURNING d.id, d.webhook_id, w.url, w.secret, d.event, d.payload, d.created_at, d.attempts",
+		limit, lease.Seconds())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []WebhookDelivery
+	for rows.Next() {
+		var x WebhookDelivery
+		if err := rows.Scan(&x.ID, &x.WebhookID, &x.URL, &x.Secret, &x.Event, &x.Payload, &x.CreatedAt, &x.Attempts); err != nil {
+			return nil, err
+		}
+		items = append(items, x)
+	}
+	return items, rows.Err()
+}
+
+// MarkWebhookDelivered records a successful attempt.
+func MarkWebhookDelivered(ctx context.Context, db *sql.DB, id int64, status int) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	_, err := db.ExecContext(ctx, "UPDATE webhook_delivery SET attempts = attempts + 1, last_status=$1, last_error=NULL, delivered_at=now()"+
+		" WHERE id=$2", status, id)
+	return err
+}
+
+// MarkWebhookFailed records a failed attempt, with status 0 when no
+// response was received. The delivery is retried at next, or moved to
+// the dead letters if next is zero.
+func MarkWebhookFailed(ctx context.Context, db *sql.DB, id int64, status int, msg string, next time.Time) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	dead := sql.NullTime{}
+	if next.IsZero() {
+		next, dead = time.Now(), sql.NullTime{Time: time.Now(), Valid: true}
+	}
+	_, err := db.ExecContext(ctx, "UPDATE webhook_delivery SET attempts = attempts + 1, last_status=$1, last_error=$2,"+
+		" next_attempt_at=$3, dead_at=$4 WHERE id=$5",
+		sql.NullInt64{Int64: int64(status), Valid: status != 0}, msg, next, dead, id)
+	return err
+}
+
+// GetDeadWebhookDeliveries lists the deliveries that were given up on,
+// most recent first.
+func GetDeadWebhookDeliveries(ctx context.Context, db *sql.DB) ([]WebhookDelivery, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	rows, err := db.QueryContext(ctx, "SELECT d.id, d.webhook_id, w.url, d.event, d.payload, d.created_at, d.attempts,"+
+		" d.last_status, d.last_error, d.dead_at FROM webhook_delivery d JOIN webhook w ON w.id = d.webhook_id"+
+		" WHERE d.dead_at IS NOT NULL ORDER BY d.dead_at DESC, d.id DESC")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []WebhookDelivery
+	for rows.Next() {
+		var x WebhookDelivery
+		if err := rows.Scan(&x.ID, &x.WebhookID, &x.URL, &x.Event, &x.Payload, &x.CreatedAt, &x.Attempts,
+			&x.LastStatus, &x.LastError, &x.DeadAt); err != nil {
+			return nil, err
+		}
+		items = append(items, x)
+	}
+	return items, rows.Err()
+}
+
+// WebhookQueue counts the deliveries per webhook that are still to be
+// attempted.
+func WebhookQueue(ctx context.Context, db *sql.DB) (map[int]int, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	rows, err := db.QueryContext(ctx, "SELECT webhook_id, count(*) FROM webhook_delivery"+
+		" WHERE delivered_at IS NULL AND dead_at IS NULL GROUP BY webhook_id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := make(map[int]int)
+	for rows.Next() {
+		var id, n int
+		if err := rows.Scan(&id, &n); err != nil {
+			return nil, err
+		}
+		counts[id] = n
+	}
+	return counts, rows.Err()
+}
+
+// RetryWebhookDelivery takes a delivery out of the dead letters and
+// queues it with a fresh count of attempts.
+func RetryWebhookDelivery(ctx context.Context, db *sql.DB, id int64) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	res, err := db.ExecContext(ctx, "UPDATE webhook_delivery SET attempts=0, next_attempt_at=now(), dead_at=NULL"+
+		" WHERE id=$1 AND dead_at IS NOT NULL", id)
+	return webhookFound(res, err)
+}
+
+// DiscardWebhookDelivery deletes a dead delivery.
+func DiscardWebhookDelivery(ctx context.Context, db *sql.DB, id int64) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	res, err := db.ExecContext(ctx, "DELETE FROM webhook_delivery WHERE id=$1 AND dead_at IS NOT NULL", id)
+	return webhookFound(res, err)
+}
+
+// PurgeWebhookDeliveries deletes deliveries that succeeded before cutoff.
+func PurgeWebhookDeliveries(ctx context.Context, db *sql.DB, cutoff time.Time) (int64, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	res, err := db.ExecContext(ctx, "DELETE FROM webhook_delivery WHERE delivered_at < $1", cutoff)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+func webhookFound(res sql.Result, err error) error {
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNoWebhook
+	}
+	return nil
+}
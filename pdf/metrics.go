@@ -0,0 +1,84 @@
+package pdf
+
+import "strings"
+
+// Character widths of the printable ASCII characters, 0x20 to 0x7e, in
+// thousandths of the font size, from the Adobe font metrics.
+var widths = [][95]int{
+	Helvetica: {
+		278, 278, 355, 556, 556, 889, 667, 191, 333, 333, 389, 584, 278, 333, 278, 278,
+		556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 278, 278, 584, 584, 584, 556,
+		1015, 667, 667, 722, 722, 667, 611, 778, 722, 278, 500, 667, 556, 833, 722, 778,
+		667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 278, 278, 278, 469, 556,
+		333, 556, 556, 500, 556, 556, 278, 556, 556, 222, 222, 500, 222, 833, 556, 556,
+		556, 556, 333, 500, 278, 556, 500, 722, 500, 500, 500, 334, 260, 334, 584,
+	},
+	HelveticaBold: {
+		278, 333, 474, 556, 556, 889, 722, 238, 333, 333, 389, 584, 278, 333, 278, 278,
+		556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 333, 333, 584, 584, 584, 611,
+		975, 722, 722, 722, 722, 667, 611, 778, 722, 278, 556, 722, 611, 833, 722, 778,
+		667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 333, 278, 333, 584, 556,
+		333, 556, 611, 556, 611, 556, 333, 611, 611, 278, 278, 556, 278, 889, 611, 611,
+		611, 611, 389, 556, 333, 611, 556, 778, 556, 556, 500, 389, 280, 389, 584,
+	},
+}
+
+// TextWidth returns the width of s in points. Characters outside ASCII
+// are taken to be as wide as an "n".
+func TextWidth(font Font, size float64, s string) float64 {
+	w := 0
+	for _, c := range []byte(encode(s)) {
+		if c >= 0x20 && c <= 0x7e {
+			w += widths[font][c-0x20]
+		} else {
+			w += widths[font]['n'-0x20]
+		}
+	}
+	return float64(w) * size / 1000
+}
+
+// Truncate shortens s with an ellipsis to fit in width.
+func Truncate(font Font, size, width float64, s string) string {
+	if TextWidth(font, size, s) <= width {
+		return s
+	}
+	r := []rune(s)
+	for len(r) > 0 && TextWidth(font, size, string(r)+"…") > width {
+		r = r[:len(r)-1]
+	}
+	return string(r) + "…"
+}
+
+// Wrap breaks s into lines that fit in width, at spaces where it can.
+func Wrap(font Font, size, width float64, s string) []string {
+	var lines []string
+	for _, para := range strings.Split(s, "\n") {
+		line := ""
+		for _, word := range strings.Fields(para) {
+			try := word
+			if line != "" {
+				try = line + " " + word
+			}
+			if TextWidth(font, size, try) <= width {
+				line = try
+				continue
+			}
+			if line != "" {
+				lines = append(lines, line)
+			}
+			// A word too long for a line is cut.
+			for TextWidth(font, size, word) > width {
+				r := []rune(word)
+				n := len(r) - 1
+				for n > 1 && TextWidth(font, size, string(r[:n])) > width {
+					n--
+				}
+				lines = append(lines, string(r[:n]))
+				word = string(r[n:])
+			}
+			line = word
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
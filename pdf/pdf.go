@@ -0,0 +1,194 @@
+// Package pdf writes simple PDF documents: pages of text in the standard
+// Helvetica fonts, lines and filled rectangles. The standard fonts are
+// built into every PDF reader, so nothing is embedded; they cover the
+// Windows-1252 (WinAnsi) character set, and other characters are written
+// as "?".
+//
+// Coordinates are in points (1/72 inch) from the top left corner of the
+// page, and text is placed by its baseline.
+package pdf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// A4 page size in points.
+const (
+	A4Width  = 595.28
+	A4Height = 841.89
+)
+
+// Font is one of the standard fonts.
+type Font int
+
+const (
+	Helvetica Font = iota
+	HelveticaBold
+)
+
+var fontNames = []string{"Helvetica", "Helvetica-Bold"}
+
+// Document is a PDF document being built.
+type Document struct {
+	Title   string
+	Author  string
+	Created time.Time
+
+	Width, Height float64 // of every page
+
+	pages []*Page
+}
+
+// New returns an empty A4 document.
+func New(title string) *Document {
+	return &Document{Title: title, Created: time.Now(), Width: A4Width, Height: A4Height}
+}
+
+// Page is a page of a Document.
+type Page struct {
+	doc     *Document
+	content bytes.Buffer
+}
+
+// AddPage adds a page at the end of d.
+func (d *Document) AddPage() *Page {
+	p := &Page{doc: d}
+	d.pages = append(d.pages, p)
+	return p
+}
+
+// Pages returns the number of pages.
+func (d *Document) Pages() int {
+	return len(d.pages)
+}
+
+// Text draws s with its baseline starting at x, y.
+func (p *Page) Text(x, y float64, font Font, size float64, s string) {
+	fmt.Fprintf(&p.content, "BT /F%d %s Tf %s %s Td (%s) Tj ET\n",
+		font+1, num(size), num(x), num(p.doc.Height-y), escape(encode(s)))
+}
+
+// TextGray draws s like Text, in a shade of gray from 0 (black) to 1
+// (white).
+func (p *Page) TextGray(x, y float64, font Font, size float64, gray float64, s string) {
+	fmt.Fprintf(&p.content, "q %s g\n", num(gray))
+	p.Text(x, y, font, size, s)
+	p.content.WriteString("Q\n")
+}
+
+// Line draws a black line of the given width.
+func (p *Page) Line(x1, y1, x2, y2, width float64) {
+	fmt.Fprintf(&p.content, "%s w %s %s m %s %s l S\n",
+		num(width), num(x1), num(p.doc.Height-y1), num(x2), num(p.doc.Height-y2))
+}
+
+// Rect fills a rectangle with its top left corner at x, y in a shade of
+// gray.
+func (p *Page) Rect(x, y, w, h, gray float64) {
+	fmt.Fprintf(&p.content, "q %s g %s %s %s %s re f Q\n",
+		num(gray), num(x), num(p.doc.Height-y-h), num(w), num(h))
+}
+
+// WriteTo writes the document to w.
+func (d *Document) WriteTo(w io.Writer) (int64, error) {
+	var b bytes.Buffer
+	var offsets []int
+	obj := func(body string) {
+		offsets = append(offsets, b.Len())
+		fmt.Fprintf(&b, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+
+	// Objects 1 and 2 are the catalog and the page tree, 3 the info
+	// dictionary, then come the fonts and, for each page, the page and
+	// its content stream.
+	b.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+	firstPage := 4 + len(fontNames)
+	kids := make([]string, len(d.pages))
+	for i := range d.pages {
+		kids[i] = fmt.Sprintf("%d 0 R", firstPage+2*i)
+	}
+	obj("<< /Type /Catalog /Pages 2 0 R >>")
+	obj(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(d.pages)))
+	obj(fmt.Sprintf("<< /Title (%s) /Author (%s) /Producer (myapp) /CreationDate (D:%s) >>",
+		escape(encode(d.Title)), escape(encode(d.Author)), d.Created.UTC().Format("20060102150405Z")))
+	var fonts strings.Builder
+	for i, name := range fontNames {
+		obj(fmt.Sprintf("<< /Type /Font /Subtype /Type1 /BaseFont /%s /Encoding /WinAnsiEncoding >>", name))
+		fmt.Fprintf(&fonts, "/F%d %d 0 R ", i+1, 4+i)
+	}
+
+	for i, p := range d.pages {
+		obj(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %s %s] /Resources << /Font << %s>> >> /Contents %d 0 R >>",
+			num(d.Width), num(d.Height), fonts.String(), firstPage+2*i+1))
+
+		var z bytes.Buffer
+		zw := zlib.NewWriter(&z)
+		zw.Write(p.content.Bytes())
+		zw.Close()
+		offsets = append(offsets, b.Len())
+		fmt.Fprintf(&b, "%d 0 obj\n<< /Length %d /Filter /FlateDecode >>\nstream\n", len(offsets), z.Len())
+		b.Write(z.Bytes())
+		b.WriteString("\nendstream\nendobj\n")
+	}
+
+	xref := b.Len()
+	fmt.Fprintf(&b, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&b, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&b, "trailer\n<< /Size %d /Root 1 0 R /Info 3 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+	return b.WriteTo(w)
+}
+
+// Bytes returns the document.
+func (d *Document) Bytes() []byte {
+	var b bytes.Buffer
+	d.WriteTo(&b)
+	return b.Bytes()
+}
+
+// num formats a coordinate without needless digits.
+func num(f float64) string {
+	s := fmt.Sprintf("%.2f", f)
+	s = strings.TrimRight(strings.TrimRight(s, "0"), ".")
+	if s == "-0" {
+		return "0"
+	}
+	return s
+}
+
+// escape escapes a PDF string literal.
+func escape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "(", `\(`, ")", `\)`).Replace(s)
+}
+
+// cp1252 maps the characters that Windows-1252 puts in 0x80-0x9f.
+var cp1252 = map[rune]byte{
+	'€': 0x80, '‚': 0x82, 'ƒ': 0x83, '„': 0x84, '…': 0x85, '†': 0x86, '‡': 0x87, 'ˆ': 0x88,
+	'‰': 0x89, 'Š': 0x8a, '‹': 0x8b, 'Œ': 0x8c, 'Ž': 0x8e, '‘': 0x91, '’': 0x92, '“': 0x93,
+	'”': 0x94, '•': 0x95, '–': 0x96, '—': 0x97, '˜': 0x98, '™': 0x99, 'š': 0x9a, '›': 0x9b,
+	'œ': 0x9c, 'ž': 0x9e, 'Ÿ': 0x9f,
+}
+
+// encode converts s to WinAnsi bytes.
+func encode(s string) string {
+	b := make([]byte, 0, len(s))
+	for _, r := range s {
+		switch {
+		case r < 0x20:
+			b = append(b, ' ')
+		case r < 0x80 || r >= 0xa0 && r <= 0xff:
+			b = append(b, byte(r))
+		case cp1252[r] != 0:
+			b = append(b, cp1252[r])
+		default:
+			b = append(b, '?')
+		}
+	}
+	return string(b)
+}
@@ -0,0 +1,71 @@
+package report
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"myapp/job"
+	"myapp/models"
+)
+
+// Generate is the job that builds a report and archives it.
+var Generate = job.Kind[Request]("generate_report")
+
+// queueDue is the job that queues the reports whose schedules are due.
+var queueDue = job.Kind[struct{}]("queue_reports")
+
+// Register adds the report jobs to r. Report schedules are checked every
+// five minutes, those of every organization at once; each report is
+// generated for the organization of its request.
+func Register(r *job.Runner, db *sql.DB) error {
+	Generate.Handle(r, func(ctx context.Context, req Request) error {
+		if req.TenantID == 0 {
+			return job.Permanent(errors.New("the report request names no organization"))
+		}
+		_, err := Run(models.WithTenant(ctx, req.TenantID), db, &req)
+		return err
+	})
+	queueDue.Handle(r, func(ctx context.Context, _ struct{}) error {
+		_, err := models.QueueDueReports(ctx, db, string(Generate), job.NextRun)
+		if err == nil {
+			r.Wake()
+		}
+		return err
+	})
+	return r.Schedule("report-schedules", "*/5 * * * *", string(queueDue), struct{}{})
+}
+
+// Run builds the report req asks for, renders it and archives it.
+func Run(ctx context.Context, db *sql.DB, req *Request) (*models.Report, error) {
+	d, err := Load(ctx, db, req.Start())
+	if err != nil {
+		return nil, err
+	}
+	rep, err := Build(req, d)
+	if err != nil {
+		return nil, job.Permanent(err)
+	}
+	html, err := rep.HTML()
+	if err != nil {
+		return nil, job.Permanent(err)
+	}
+
+	x := &models.Report{
+		Title:       rep.Title,
+		Scope:       req.Scope,
+		PeriodStart: rep.Start,
+		PeriodEnd:   rep.End,
+		HTML:        string(html),
+		PDF:         rep.PDF(),
+	}
+	if req.ScheduleID != 0 {
+		x.ScheduleID = sql.NullInt64{Int64: int64(req.ScheduleID), Valid: true}
+	}
+	if req.Subject != "" {
+		x.Subject = sql.NullString{String: req.Subject, Valid: true}
+	}
+	if err := models.SaveReport(ctx, db, x); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
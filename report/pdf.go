@@ -0,0 +1,188 @@
+package report
+
+import (
+	"fmt"
+	"myapp/pdf"
+	"strings"
+)
+
+// Page layout of the PDF, in points.
+const (
+	margin     = 50.0
+	bodySize   = 9.0
+	lineHeight = 14.0
+)
+
+// column of a PDF table.
+type column struct {
+	title string
+	width float64
+	right bool // aligned right, for numbers
+}
+
+// writer lays out a PDF top to bottom, starting new pages as needed.
+type writer struct {
+	doc    *pdf.Document
+	page   *pdf.Page
+	y      float64
+	footer string
+}
+
+func (w *writer) newPage() {
+	w.page = w.doc.AddPage()
+	w.y = margin
+	w.page.TextGray(margin, w.doc.Height-margin/2, pdf.Helvetica, 8, 0.4, w.footer)
+	label := fmt.Sprintf("Page %d", w.doc.Pages())
+	w.page.TextGray(w.doc.Width-margin-pdf.TextWidth(pdf.Helvetica, 8, label), w.doc.Height-margin/2, pdf.Helvetica, 8, 0.4, label)
+}
+
+// space makes sure h points are left on the page.
+func (w *writer) space(h float64) {
+	if w.page == nil || w.y+h > w.doc.Height-margin {
+		w.newPage()
+	}
+}
+
+func (w *writer) width() float64 {
+	return w.doc.Width - 2*margin
+}
+
+// text writes a wrapped paragraph.
+func (w *writer) text(font pdf.Font, size, gray float64, s string) {
+	for _, line := range pdf.Wrap(font, size, w.width(), s) {
+		w.space(size * 1.5)
+		w.y += size * 1.2
+		w.page.TextGray(margin, w.y, font, size, gray, line)
+		w.y += size * 0.3
+	}
+}
+
+func (w *writer) heading(s string) {
+	w.space(50) // keep a heading with what follows
+	w.y += 18
+	w.text(pdf.HelveticaBold, 12, 0, s)
+	w.page.Line(margin, w.y+2, margin+w.width(), w.y+2, 0.5)
+	w.y += 8
+}
+
+// table writes rows under a header that is repeated on every page. The
+// last row is bold if total is set.
+func (w *writer) table(cols []column, rows [][]string, total bool) {
+	header := func() {
+		w.page.Rect(margin, w.y, w.width(), lineHeight, 0.9)
+		w.row(cols, nil, pdf.HelveticaBold)
+	}
+	w.space(2 * lineHeight)
+	header()
+	for i, cells := range rows {
+		if w.y+lineHeight > w.doc.Height-margin {
+			w.newPage()
+			header()
+		}
+		font := pdf.Helvetica
+		if total && i == len(rows)-1 {
+			font = pdf.HelveticaBold
+			w.page.Line(margin, w.y, margin+w.width(), w.y, 0.8)
+		}
+		w.row(cols, cells, font)
+	}
+	w.y += 6
+}
+
+// row writes one table row, or the header if cells is nil, truncating
+// cells that do not fit.
+func (w *writer) row(cols []column, cells []string, font pdf.Font) {
+	x := margin
+	for i, c := range cols {
+		s := c.title
+		if cells != nil {
+			s = cells[i]
+		}
+		s = pdf.Truncate(font, bodySize, c.width-8, s)
+		tx := x + 4
+		if c.right {
+			tx = x + c.width - 4 - pdf.TextWidth(font, bodySize, s)
+		}
+		w.page.Text(tx, w.y+lineHeight-4, font, bodySize, s)
+		x += c.width
+	}
+	w.y += lineHeight
+	if cells != nil {
+		w.page.Line(margin, w.y, margin+w.width(), w.y, 0.2)
+	}
+}
+
+// PDF renders r as an A4 PDF document.
+func (r *Report) PDF() []byte {
+	doc := pdf.New(r.Title)
+	w := &writer{doc: doc, footer: r.Title + " - generated " + r.Generated.Format("2006-01-02 15:04 MST")}
+	w.newPage()
+
+	w.text(pdf.HelveticaBold, 18, 0, r.Title)
+	w.y += 2
+	w.text(pdf.Helvetica, 10, 0.4, r.Start.Format("2 January 2006")+" to "+r.End.Format("2 January 2006"))
+
+	w.heading("Cases by " + strings.ToLower(r.GroupBy))
+	if len(r.Rows) == 0 {
+		w.text(pdf.Helvetica, bodySize, 0, "No records.")
+	} else {
+		cols := []column{
+			{title: r.GroupBy, width: 119},
+			{title: "Patients", width: 56, right: true},
+			{title: "Deaths", width: 50, right: true},
+			{title: "CFR", width: 40, right: true},
+			{title: "New pat.", width: 52, right: true},
+			{title: "New deaths", width: 56, right: true},
+			{title: "Pat./100k", width: 60, right: true},
+			{title: "Deaths/100k", width: 62, right: true},
+		}
+		var rows [][]string
+		for _, row := range append(r.Rows, r.Total) {
+			cfr, patients, deaths := "-", "-", "-"
+			if row.Patients > 0 {
+				cfr = fmt.Sprintf("%.1f%%", row.CFR())
+			}
+			if row.Population > 0 {
+				patients = fmt.Sprintf("%.1f", row.PatientsPer100k())
+				deaths = fmt.Sprintf("%.2f", row.DeathsPer100k())
+			}
+			rows = append(rows, []string{row.Label, formatInt(row.Patients), formatInt(row.Deaths), cfr,
+				formatSigned(row.NewPatients), formatSigned(row.NewDeaths), patients, deaths})
+		}
+		w.table(cols, rows, true)
+		w.text(pdf.Helvetica, 8, 0.4, "CFR is the case fatality rate, deaths over patients. New cases are the change in the records during the period.")
+	}
+
+	w.heading("Newly discovered diseases")
+	if len(r.Discoveries) == 0 {
+		w.text(pdf.Helvetica, bodySize, 0, "No disease was first encountered during the period.")
+	} else {
+		cols := []column{{title: "First encountered", width: 95}, {title: "Country", width: 130}, {title: "Disease", width: 270}}
+		var rows [][]string
+		for _, x := range r.Discoveries {
+			disease := x.DiseaseCode
+			if x.Description != "" {
+				disease += " - " + x.Description
+			}
+			rows = append(rows, []string{x.Date.Format("2006-01-02"), x.CName, disease})
+		}
+		w.table(cols, rows, false)
+	}
+
+	w.heading("Doctors by specialization")
+	if len(r.Specializations) == 0 {
+		w.text(pdf.Helvetica, bodySize, 0, "No doctors are specialized in the diseases of this report.")
+	}
+	for _, s := range r.Specializations {
+		w.space(3 * lineHeight)
+		w.text(pdf.HelveticaBold, 10, 0, fmt.Sprintf("%s (%d doctors)", s.Type, s.Count))
+		cols := []column{{title: "Doctor", width: 150}, {title: "Degree", width: 90}, {title: "Country", width: 130},
+			{title: "Specializations", width: 125, right: true}}
+		var rows [][]string
+		for _, d := range s.Doctors {
+			rows = append(rows, []string{d.Name, d.Degree, d.CName, formatInt(d.Specializations)})
+		}
+		w.table(cols, rows, false)
+	}
+	return doc.Bytes()
+}
@@ -0,0 +1,50 @@
+package report
+
+import (
+	"bytes"
+	"embed"
+	"html/template"
+	"strconv"
+	"strings"
+)
+
+//go:embed templates
+var templateFS embed.FS
+
+var funcs = template.FuncMap{
+	"lower":  strings.ToLower,
+	"int":    formatInt,
+	"signed": formatSigned,
+}
+
+var htmlTemplate = template.Must(template.New("report.html").Funcs(funcs).ParseFS(templateFS, "templates/report.html"))
+
+// HTML renders r as a standalone HTML page.
+func (r *Report) HTML() ([]byte, error) {
+	var b bytes.Buffer
+	if err := htmlTemplate.Execute(&b, r); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// formatInt formats n with thousands separators, as in 1,234,567.
+func formatInt(n int) string {
+	s := strconv.Itoa(n)
+	sign := ""
+	if n < 0 {
+		sign, s = "-", s[1:]
+	}
+	for i := len(s) - 3; i > 0; i -= 3 {
+		s = s[:i] + "," + s[i:]
+	}
+	return sign + s
+}
+
+// formatSigned formats a change, as in +1,234 or -5.
+func formatSigned(n int) string {
+	if n > 0 {
+		return "+" + formatInt(n)
+	}
+	return formatInt(n)
+}
@@ -0,0 +1,380 @@
+// Package report generates epidemiology summaries of the records, as
+// HTML and PDF, on demand and on schedules. Reports are built in jobs
+// (see package job) and archived in the report table.
+package report
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"fmt"
+	"myapp/models"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Request says what a report covers. It is the payload of the
+// generate_report job.
+type Request struct {
+	TenantID   int       `json:"tenant_id"` // the organization the report is for
+	ScheduleID int       `json:"schedule_id,omitempty"`
+	Name       string    `json:"name,omitempty"` // of the schedule, for the title
+	Scope      string    `json:"scope"`          // models.ReportCountry or models.ReportDisease
+	Subject    string    `json:"subject,omitempty"`
+	PeriodDays int       `json:"period_days"`
+	End        time.Time `json:"end"`
+}
+
+// Start returns the start of the period covered.
+func (req *Request) Start() time.Time {
+	return req.End.AddDate(0, 0, -req.PeriodDays)
+}
+
+// Data is what reports are built from.
+type Data struct {
+	Countries    []models.Country
+	Diseases     []models.Disease
+	DiseaseTypes []models.DiseaseType
+	Records      []models.Record
+	Past         []models.Record // as of the start of the period
+	Discovers    []models.Discover
+	Users        []models.User
+	Doctors      []models.Doctor
+	Specializes  []models.Specialize
+}
+
+// Load reads the data for a report whose period starts at start.
+func Load(ctx context.Context, db *sql.DB, start time.Time) (*Data, error) {
+	d := &Data{}
+	var err error
+	if d.Countries, err = models.GetAllCountries(ctx, db); err != nil {
+		return nil, err
+	}
+	if d.Diseases, err = models.GetAllDiseases(ctx, db); err != nil {
+		return nil, err
+	}
+	if d.DiseaseTypes, err = models.GetAllDiseaseTypes(ctx, db); err != nil {
+		return nil, err
+	}
+	if d.Records, err = models.GetAllRecords(ctx, db); err != nil {
+		return nil, err
+	}
+	if d.Past, err = models.GetRecordsAsOf(ctx, db, start); err != nil {
+		return nil, err
+	}
+	if d.Discovers, err = models.GetAllDiscovers(ctx, db); err != nil {
+		return nil, err
+	}
+	if d.Users, err = models.GetAllUsers(ctx, db); err != nil {
+		return nil, err
+	}
+	if d.Doctors, err = models.GetAllDoctors(ctx, db); err != nil {
+		return nil, err
+	}
+	if d.Specializes, err = models.GetAllSpecializes(ctx, db); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// Report is a built report, ready to be rendered.
+type Report struct {
+	Title     string
+	Scope     string
+	Subject   string
+	Start     time.Time
+	End       time.Time
+	Generated time.Time
+
+	GroupBy string // what the rows are: "Disease" or "Country"
+	Rows    []Row  // by patients, most first
+	Total   Row
+
+	Discoveries     []Discovery
+	Specializations []Specialization
+}
+
+// Row sums the records of a disease or country.
+type Row struct {
+	Label       string
+	Description string // of the disease
+	Population  int64  // per-capita rates are based on
+	Patients    int
+	Deaths      int
+	NewPatients int // during the period
+	NewDeaths   int
+}
+
+// CFR returns the case fatality rate in percent, deaths over patients.
+func (r Row) CFR() float64 {
+	if r.Patients == 0 {
+		return 0
+	}
+	return 100 * float64(r.Deaths) / float64(r.Patients)
+}
+
+// PatientsPer100k returns the patients per 100,000 people.
+func (r Row) PatientsPer100k() float64 {
+	return per100k(r.Patients, r.Population)
+}
+
+// DeathsPer100k returns the deaths per 100,000 people.
+func (r Row) DeathsPer100k() float64 {
+	return per100k(r.Deaths, r.Population)
+}
+
+func per100k(n int, population int64) float64 {
+	if population == 0 {
+		return 0
+	}
+	return 100000 * float64(n) / float64(population)
+}
+
+// Discovery is a disease first encountered in a country during the
+// period.
+type Discovery struct {
+	CName       string
+	DiseaseCode string
+	Description string
+	Date        time.Time
+}
+
+// Specialization lists the doctors specialized in a disease type, those
+// with the most specializations first.
+type Specialization struct {
+	Type    string
+	Count   int
+	Doctors []Doctor // the first few
+}
+
+// Doctor is a doctor in a Specialization.
+type Doctor struct {
+	Name            string
+	Email           string
+	Degree          string
+	CName           string
+	Specializations int
+}
+
+// topDoctors is how many doctors each Specialization lists.
+const topDoctors = 5
+
+// Build builds the report req asks for from d.
+func Build(req *Request, d *Data) (*Report, error) {
+	if req.Scope != models.ReportCountry && req.Scope != models.ReportDisease {
+		return nil, fmt.Errorf("report: unknown scope %q", req.Scope)
+	}
+	if req.PeriodDays < 1 {
+		return nil, fmt.Errorf("report: period of %d days", req.PeriodDays)
+	}
+
+	r := &Report{
+		Scope:     req.Scope,
+		Subject:   req.Subject,
+		Start:     req.Start(),
+		End:       req.End,
+		Generated: time.Now(),
+	}
+	population := make(map[string]int64)
+	var world int64
+	for _, c := range d.Countries {
+		population[c.CName] = c.Population
+		world += c.Population
+	}
+	diseases := make(map[string]models.Disease)
+	for _, x := range d.Diseases {
+		diseases[x.DiseaseCode] = x
+	}
+
+	switch {
+	case req.Scope == models.ReportCountry && req.Subject != "":
+		if _, ok := population[req.Subject]; !ok {
+			return nil, fmt.Errorf("report: no country %q", req.Subject)
+		}
+	case req.Scope == models.ReportDisease && req.Subject != "":
+		if _, ok := diseases[req.Subject]; !ok {
+			return nil, fmt.Errorf("report: no disease %q", req.Subject)
+		}
+	}
+	r.Title = title(req, diseases)
+
+	// A country report of one country, and a disease report of all, are
+	// broken down by disease; the others by country.
+	byCountry := (req.Scope == models.ReportCountry) == (req.Subject == "")
+	r.GroupBy = "Disease"
+	if byCountry {
+		r.GroupBy = "Country"
+	}
+	inScope := func(cname, code string) bool {
+		switch {
+		case req.Subject == "":
+			return true
+		case req.Scope == models.ReportCountry:
+			return cname == req.Subject
+		default:
+			return code == req.Subject
+		}
+	}
+
+	type key struct{ email, cname, code string }
+	past := make(map[key]models.Record)
+	for _, x := range d.Past {
+		past[key{x.Email, x.CName, x.DiseaseCode}] = x
+	}
+	rows := make(map[string]*Row)
+	for _, x := range d.Records {
+		if !inScope(x.CName, x.DiseaseCode) {
+			continue
+		}
+		label := x.DiseaseCode
+		if byCountry {
+			label = x.CName
+		}
+		row := rows[label]
+		if row == nil {
+			row = &Row{Label: label}
+			switch {
+			case byCountry:
+				row.Population = population[x.CName]
+			case req.Scope == models.ReportCountry:
+				row.Population = population[req.Subject]
+			default:
+				row.Population = world
+			}
+			if !byCountry {
+				row.Description = diseases[x.DiseaseCode].Description
+			}
+			rows[label] = row
+		}
+		p := past[key{x.Email, x.CName, x.DiseaseCode}]
+		row.Patients += x.TotalPatients
+		row.Deaths += x.TotalDeaths
+		row.NewPatients += x.TotalPatients - p.TotalPatients
+		row.NewDeaths += x.TotalDeaths - p.TotalDeaths
+	}
+
+	r.Total.Label = "Total"
+	for _, row := range rows {
+		r.Rows = append(r.Rows, *row)
+		r.Total.Patients += row.Patients
+		r.Total.Deaths += row.Deaths
+		r.Total.NewPatients += row.NewPatients
+		r.Total.NewDeaths += row.NewDeaths
+		if byCountry {
+			r.Total.Population += row.Population
+		}
+	}
+	if !byCountry {
+		r.Total.Population = world
+		if req.Scope == models.ReportCountry {
+			r.Total.Population = population[req.Subject]
+		}
+	}
+	slices.SortFunc(r.Rows, func(a, b Row) int {
+		return cmp.Or(cmp.Compare(b.Patients, a.Patients), strings.Compare(a.Label, b.Label))
+	})
+
+	for _, x := range d.Discovers {
+		if !inScope(x.CName, x.DiseaseCode) || x.FirstEncDate.Before(dayOf(r.Start)) || x.FirstEncDate.After(r.End) {
+			continue
+		}
+		r.Discoveries = append(r.Discoveries, Discovery{
+			CName:       x.CName,
+			DiseaseCode: x.DiseaseCode,
+			Description: diseases[x.DiseaseCode].Description,
+			Date:        x.FirstEncDate,
+		})
+	}
+	slices.SortFunc(r.Discoveries, func(a, b Discovery) int {
+		return cmp.Or(a.Date.Compare(b.Date), strings.Compare(a.CName, b.CName), strings.Compare(a.DiseaseCode, b.DiseaseCode))
+	})
+
+	r.Specializations = specializations(req, d, diseases, rows, byCountry)
+	return r, nil
+}
+
+// specializations lists the doctors by the disease types the report is
+// about: those of the diseases with records in the report, or of its
+// disease. A country report only lists the country's doctors.
+func specializations(req *Request, d *Data, diseases map[string]models.Disease, rows map[string]*Row, byCountry bool) []Specialization {
+	types := make(map[int]bool)
+	switch {
+	case req.Scope == models.ReportDisease && req.Subject != "":
+		types[diseases[req.Subject].ID] = true
+	case !byCountry:
+		for code := range rows {
+			types[diseases[code].ID] = true
+		}
+	default:
+		for _, x := range d.Records {
+			if req.Subject == "" || x.CName == req.Subject {
+				types[diseases[x.DiseaseCode].ID] = true
+			}
+		}
+	}
+
+	users := make(map[string]models.User)
+	for _, u := range d.Users {
+		users[u.Email] = u
+	}
+	doctors := make(map[string]Doctor)
+	for _, x := range d.Doctors {
+		u, ok := users[x.Email]
+		if !ok || req.Scope == models.ReportCountry && req.Subject != "" && u.CName != req.Subject {
+			continue
+		}
+		doctors[x.Email] = Doctor{Name: u.Name + " " + u.Surname, Email: x.Email, Degree: x.Degree, CName: u.CName}
+	}
+	for _, s := range d.Specializes {
+		if doc, ok := doctors[s.Email]; ok {
+			doc.Specializations++
+			doctors[s.Email] = doc
+		}
+	}
+
+	byType := make(map[int][]Doctor)
+	for _, s := range d.Specializes {
+		if doc, ok := doctors[s.Email]; ok && types[s.ID] {
+			byType[s.ID] = append(byType[s.ID], doc)
+		}
+	}
+	var list []Specialization
+	for _, t := range d.DiseaseTypes {
+		docs := byType[t.ID]
+		if len(docs) == 0 {
+			continue
+		}
+		slices.SortFunc(docs, func(a, b Doctor) int {
+			return cmp.Or(cmp.Compare(b.Specializations, a.Specializations), strings.Compare(a.Name, b.Name))
+		})
+		list = append(list, Specialization{Type: t.Description, Count: len(docs), Doctors: docs[:min(len(docs), topDoctors)]})
+	}
+	slices.SortFunc(list, func(a, b Specialization) int {
+		return cmp.Or(cmp.Compare(b.Count, a.Count), strings.Compare(a.Type, b.Type))
+	})
+	return list
+}
+
+// title names a report after its schedule and subject.
+func title(req *Request, diseases map[string]models.Disease) string {
+	name := req.Name
+	if name == "" {
+		name = "Epidemiology report"
+	}
+	switch {
+	case req.Subject == "" && req.Scope == models.ReportCountry:
+		return name + ": all countries"
+	case req.Subject == "":
+		return name + ": all diseases"
+	case req.Scope == models.ReportDisease:
+		return name + ": " + req.Subject + " (" + diseases[req.Subject].Description + ")"
+	default:
+		return name + ": " + req.Subject
+	}
+}
+
+// dayOf returns the start of the day of t, as a DATE column is read.
+func dayOf(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
@@ -0,0 +1,92 @@
+package seed
+
+// diseaseType is a disease type and the pathogen of its diseases.
+type diseaseType struct {
+	Description string
+	Pathogen    string
+}
+
+var diseaseTypes = []diseaseType{
+	{"Bacterial infections", "bacteria"},
+	{"Viral infections", "virus"},
+	{"Parasitic infections", "parasite"},
+	{"Fungal infections", "fungus"},
+	{"Chronic non-communicable diseases", "none"},
+}
+
+// disease is a disease with its ICD-10 code, its type (an index in
+// diseaseTypes) and a typical case fatality rate.
+type disease struct {
+	Code        string
+	Description string
+	Type        int
+	CFR         float64
+}
+
+var diseases = []disease{
+	{"A00", "Cholera", 0, 0.01},
+	{"A01.0", "Typhoid fever", 0, 0.01},
+	{"A06", "Amoebiasis", 2, 0.001},
+	{"A07.1", "Giardiasis", 2, 0.0001},
+	{"A15", "Respiratory tuberculosis", 0, 0.12},
+	{"A20", "Plague", 0, 0.1},
+	{"A22", "Anthrax", 0, 0.2},
+	{"A27", "Leptospirosis", 0, 0.05},
+	{"A30", "Leprosy", 0, 0.001},
+	{"A36", "Diphtheria", 0, 0.05},
+	{"A37", "Whooping cough", 0, 0.005},
+	{"A39", "Meningococcal infection", 0, 0.1},
+	{"A80", "Acute poliomyelitis", 1, 0.05},
+	{"A82", "Rabies", 1, 0.99},
+	{"A90", "Dengue fever", 1, 0.005},
+	{"A92.0", "Chikungunya virus disease", 1, 0.001},
+	{"A95", "Yellow fever", 1, 0.2},
+	{"A98.4", "Ebola virus disease", 1, 0.5},
+	{"B01", "Varicella", 1, 0.0001},
+	{"B05", "Measles", 1, 0.01},
+	{"B06", "Rubella", 1, 0.0001},
+	{"B15", "Acute hepatitis A", 1, 0.002},
+	{"B16", "Acute hepatitis B", 1, 0.01},
+	{"B17.1", "Acute hepatitis C", 1, 0.005},
+	{"B20", "HIV disease", 1, 0.02},
+	{"B26", "Mumps", 1, 0.0001},
+	{"B37", "Candidiasis", 3, 0.01},
+	{"B44", "Aspergillosis", 3, 0.3},
+	{"B45", "Cryptococcosis", 3, 0.2},
+	{"B50", "Plasmodium falciparum malaria", 2, 0.003},
+	{"B55", "Leishmaniasis", 2, 0.01},
+	{"B57", "Chagas disease", 2, 0.01},
+	{"B65", "Schistosomiasis", 2, 0.0005},
+	{"B74", "Filariasis", 2, 0.0001},
+	{"J10", "Influenza due to other identified influenza virus", 1, 0.001},
+	{"J13", "Pneumonia due to Streptococcus pneumoniae", 0, 0.05},
+	{"U07.1", "COVID-19", 1, 0.01},
+	{"E11", "Type 2 diabetes mellitus", 4, 0.002},
+	{"I10", "Essential (primary) hypertension", 4, 0.001},
+	{"J45", "Asthma", 4, 0.0005},
+	{"C34", "Malignant neoplasm of bronchus and lung", 4, 0.6},
+}
+
+var firstNames = []string{
+	"Aisha", "Alejandro", "Amara", "Ana", "Arjun", "Beatriz", "Carlos", "Chen", "Chiara", "Chloe",
+	"Daniel", "David", "Elena", "Emma", "Fatima", "Felipe", "Hana", "Hiroshi", "Ibrahim", "Ines",
+	"Ivan", "Jakob", "James", "Jin", "Kofi", "Laila", "Lars", "Lea", "Li", "Lucas",
+	"Maria", "Mateo", "Mei", "Mohammed", "Nadia", "Nikolai", "Noah", "Olga", "Omar", "Priya",
+	"Rahul", "Rosa", "Sakura", "Samuel", "Sara", "Sofia", "Tariq", "Thandiwe", "Tomas", "Wei",
+	"Yasmin", "Yuki", "Zainab", "Zanele",
+}
+
+var surnames = []string{
+	"Abdullah", "Adeyemi", "Andersen", "Bauer", "Chen", "Costa", "Da Silva", "Dubois", "Fernandez", "Fischer",
+	"Garcia", "Gonzalez", "Gupta", "Haddad", "Hansen", "Hernandez", "Ivanov", "Jansen", "Kim", "Kowalski",
+	"Kumar", "Lee", "Lopez", "Martin", "Martinez", "Mensah", "Mueller", "Nakamura", "Nguyen", "Novak",
+	"Okafor", "Olsen", "Park", "Patel", "Perez", "Petrov", "Rossi", "Sato", "Schmidt", "Singh",
+	"Smith", "Suzuki", "Tanaka", "Wang", "Yilmaz", "Zhang",
+}
+
+var degrees = []string{"MD", "MBBS", "DO", "MD, PhD", "MD, MPH"}
+
+var departments = []string{
+	"Epidemiology", "Disease Surveillance", "Public Health", "Health Statistics", "Emergency Preparedness",
+	"Immunization", "Environmental Health",
+}
@@ -0,0 +1,463 @@
+// Package seed fills an empty organization with fake but plausible data for
+// demos and load tests: countries from ISO 3166 with populations, users
+// with phones and salaries, real diseases by type, doctors with degrees
+// and specializations, patients with diseases, and public servants with
+// the records they reported in countries where the disease has been
+// discovered.
+//
+// The data is generated from a seeded random number generator, one
+// stream per table, so a seed, scale and date always give the same rows,
+// and written with COPY in one transaction. Disease types get their ids
+// from the database, which are shared by every organization.
+package seed
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"math/rand/v2"
+	"myapp/iso3166"
+	"myapp/models"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Config says how much data to generate.
+type Config struct {
+	Seed      uint64
+	Countries int       // at most the 249 of ISO 3166
+	Users     int       // about 70% are patients, 5% doctors, 3% public servants
+	Today     time.Time // discoveries are dated up to this day
+}
+
+// Share of users with each role; a user can have several.
+const (
+	patientShare = 0.70
+	doctorShare  = 0.05
+	servantShare = 0.03
+)
+
+// discoveredShare is the share of diseases discovered in each country.
+const discoveredShare = 0.4
+
+// Count is how many rows were added to a table.
+type Count struct {
+	Table string
+	Rows  int
+}
+
+// ErrNotEmpty is returned when the organization already has data.
+var ErrNotEmpty = errors.New("seed: the organization already has countries, users or disease types")
+
+// Roles of a person.
+const (
+	patient = 1 << iota
+	doctor
+	servant
+)
+
+type person struct {
+	first, last uint8
+	country     uint16
+	roles       uint8
+}
+
+type country struct {
+	name       string
+	population int64
+	diseases   []int // discovered, as indexes in diseases
+	weight     int64 // cumulative population, for picking by population
+}
+
+type generator struct {
+	cfg       Config
+	out       sink
+	countries []country
+	typeIDs   []int // of diseaseTypes
+	people    []person
+	counts    []Count
+}
+
+// Run adds the data cfg asks for to the organization of ctx (see
+// models.WithTenant), which must have none.
+func Run(ctx context.Context, db *sql.DB, cfg Config) ([]Count, error) {
+	if _, ok := models.Tenant(ctx); !ok {
+		return nil, errors.New("seed: no organization to seed")
+	}
+	if cfg.Countries < 1 || cfg.Countries > len(iso3166.All()) {
+		return nil, fmt.Errorf("seed: the number of countries must be from 1 to %d", len(iso3166.All()))
+	}
+	if cfg.Users < 1 {
+		return nil, errors.New("seed: the number of users must be at least 1")
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var used bool
+	if err := tx.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM Country) OR EXISTS (SELECT 1 FROM Users)"+
+		" OR EXISTS (SELECT 1 FROM DiseaseType)").Scan(&used); err != nil {
+		return nil, err
+	}
+	if used {
+		return nil, ErrNotEmpty
+	}
+	// Nobody is emailed about the seeded records.
+	if _, err := tx.ExecContext(ctx, "ALTER TABLE Record DISABLE TRIGGER record_email"); err != nil {
+		return nil, err
+	}
+
+	g := &generator{cfg: cfg, out: txSink{tx}}
+	if err := g.run(ctx); err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.ExecContext(ctx, "ALTER TABLE Record ENABLE TRIGGER record_email"); err != nil {
+		return nil, err
+	}
+	return g.counts, tx.Commit()
+}
+
+// rng returns the random stream of a table.
+func (g *generator) rng(table string) *rand.Rand {
+	var h uint64 = 14695981039346656037 // FNV-1a
+	for i := 0; i < len(table); i++ {
+		h = (h ^ uint64(table[i])) * 1099511628211
+	}
+	return rand.New(rand.NewPCG(g.cfg.Seed, h))
+}
+
+// run generates every table in dependency order.
+func (g *generator) run(ctx context.Context) error {
+	steps := []func(context.Context) error{
+		g.genCountries, g.genDiseaseTypes, g.genDiseases, g.genDiscovers, g.genUsers,
+		g.genPatients, g.genPatientDiseases, g.genDoctors, g.genSpecializes, g.genPublicServants, g.genRecords,
+	}
+	for _, step := range steps {
+		if err := step(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// A sink stores the generated rows.
+type sink interface {
+	// copyRows stores the rows gen emits into table and counts them.
+	copyRows(ctx context.Context, table string, columns []string, gen func(emit func(...any) error) error) (int, error)
+	// addDiseaseType stores a disease type and returns its id.
+	addDiseaseType(ctx context.Context, description string) (int, error)
+}
+
+// copyRows stores the rows gen emits into table.
+func (g *generator) copyRows(ctx context.Context, table string, columns []string, gen func(emit func(...any) error) error) error {
+	n, err := g.out.copyRows(ctx, table, columns, gen)
+	if err != nil {
+		return fmt.Errorf("seed: %s: %w", table, err)
+	}
+	g.counts = append(g.counts, Count{Table: table, Rows: n})
+	log.Printf("Seeded %d rows of %s", n, table)
+	return nil
+}
+
+// txSink writes the rows in a transaction.
+type txSink struct {
+	tx *sql.Tx
+}
+
+// copyRows copies the rows with COPY. COPY cannot write to a table under
+// row-level security, so they are copied into a temporary table first
+// and inserted from there.
+func (s txSink) copyRows(ctx context.Context, table string, columns []string, gen func(emit func(...any) error) error) (int, error) {
+	staging, list := "seed_"+table, strings.Join(columns, ", ")
+	if _, err := s.tx.ExecContext(ctx, "CREATE TEMP TABLE "+staging+" ON COMMIT DROP AS SELECT "+list+" FROM "+table+" WITH NO DATA"); err != nil {
+		return 0, err
+	}
+	stmt, err := s.tx.PrepareContext(ctx, pq.CopyIn(staging, columns...))
+	if err != nil {
+		return 0, err
+	}
+	defer stmt.Close()
+
+	n := 0
+	emit := func(values ...any) error {
+		n++
+		_, err := stmt.ExecContext(ctx, values...)
+		return err
+	}
+	if err := gen(emit); err != nil {
+		return 0, err
+	}
+	if _, err := stmt.ExecContext(ctx); err != nil {
+		return 0, err
+	}
+	if _, err := s.tx.ExecContext(ctx, "INSERT INTO "+table+" ("+list+") SELECT "+list+" FROM "+staging); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+func (s txSink) addDiseaseType(ctx context.Context, description string) (int, error) {
+	var id int
+	err := s.tx.QueryRowContext(ctx, "INSERT INTO diseasetype (description) VALUES ($1) RETURNING id", description).Scan(&id)
+	return id, err
+}
+
+func (g *generator) genCountries(ctx context.Context) error {
+	r := g.rng("country")
+	all := iso3166.All()
+	r.Shuffle(len(all), func(i, j int) { all[i], all[j] = all[j], all[i] })
+	all = all[:g.cfg.Countries]
+	sort.Slice(all, func(i, j int) bool { return all[i].Name < all[j].Name })
+
+	var total int64
+	for _, c := range all {
+		// Populations are spread evenly on a log scale, 50 thousand to
+		// 500 million, rounded to the thousand.
+		population := int64(math.Exp(math.Log(5e4)+r.Float64()*math.Log(1e4))) / 1000 * 1000
+		total += population
+		g.countries = append(g.countries, country{name: c.Name, population: population, weight: total})
+	}
+	return g.copyRows(ctx, "country", []string{"cname", "population", "iso_alpha2", "iso_alpha3", "iso_numeric"}, func(emit func(...any) error) error {
+		for i, c := range all {
+			if err := emit(c.Name, g.countries[i].population, c.Alpha2, c.Alpha3, c.Numeric); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// pickCountry picks a country, the more populous the likelier.
+func (g *generator) pickCountry(r *rand.Rand) int {
+	w := r.Int64N(g.countries[len(g.countries)-1].weight)
+	return sort.Search(len(g.countries), func(i int) bool { return g.countries[i].weight > w })
+}
+
+// genDiseaseTypes inserts the few disease types one by one, for their ids.
+func (g *generator) genDiseaseTypes(ctx context.Context) error {
+	for _, t := range diseaseTypes {
+		id, err := g.out.addDiseaseType(ctx, t.Description)
+		if err != nil {
+			return fmt.Errorf("seed: diseasetype: %w", err)
+		}
+		g.typeIDs = append(g.typeIDs, id)
+	}
+	g.counts = append(g.counts, Count{Table: "diseasetype", Rows: len(diseaseTypes)})
+	log.Printf("Seeded %d rows of diseasetype", len(diseaseTypes))
+	return nil
+}
+
+func (g *generator) genDiseases(ctx context.Context) error {
+	return g.copyRows(ctx, "disease", []string{"disease_code", "pathogen", "description", "id"}, func(emit func(...any) error) error {
+		for _, d := range diseases {
+			if err := emit(d.Code, diseaseTypes[d.Type].Pathogen, d.Description, g.typeIDs[d.Type]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// genDiscovers discovers some of the diseases in each country, a few of
+// them in the last two months so reports and alerts have something new.
+func (g *generator) genDiscovers(ctx context.Context) error {
+	r := g.rng("discover")
+	today := g.cfg.Today
+	return g.copyRows(ctx, "discover", []string{"cname", "disease_code", "first_enc_date"}, func(emit func(...any) error) error {
+		for i := range g.countries {
+			c := &g.countries[i]
+			for j, d := range diseases {
+				if r.Float64() >= discoveredShare {
+					continue
+				}
+				c.diseases = append(c.diseases, j)
+				days := 60 + r.IntN(40*365)
+				if r.Float64() < 0.05 {
+					days = r.IntN(60)
+				}
+				if err := emit(c.name, d.Code, today.AddDate(0, 0, -days).Format(time.DateOnly)); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// email returns the address of the i-th person.
+func (p person) email(i int) string {
+	name := firstNames[p.first] + "." + surnames[p.last]
+	return strings.ToLower(strings.ReplaceAll(name, " ", "")) + fmt.Sprintf(".%d@example.org", i+1)
+}
+
+func (g *generator) genUsers(ctx context.Context) error {
+	r := g.rng("users")
+	g.people = make([]person, g.cfg.Users)
+	for i := range g.people {
+		p := &g.people[i]
+		p.first = uint8(r.IntN(len(firstNames)))
+		p.last = uint8(r.IntN(len(surnames)))
+		p.country = uint16(g.pickCountry(r))
+		if r.Float64() < patientShare {
+			p.roles |= patient
+		}
+		if r.Float64() < doctorShare {
+			p.roles |= doctor
+		}
+		if r.Float64() < servantShare || i == 0 {
+			p.roles |= servant
+		}
+	}
+
+	return g.copyRows(ctx, "users", []string{"email", "name", "surname", "salary", "phone", "cname"}, func(emit func(...any) error) error {
+		for i, p := range g.people {
+			var salary any // unknown for some
+			if r.Float64() < 0.85 {
+				salary = 18000 + r.IntN(1800)*100
+			}
+			phone := fmt.Sprintf("+%d %03d %03d %04d", 1+r.IntN(998), r.IntN(1000), r.IntN(1000), r.IntN(10000))
+			err := emit(p.email(i), firstNames[p.first], surnames[p.last],
+				models.SealValue("users.salary", salary), models.SealValue("users.phone", phone), g.countries[p.country].name)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// each emits the email of every person with role.
+func (g *generator) each(role uint8, fn func(i int, p person) error) error {
+	for i, p := range g.people {
+		if p.roles&role != 0 {
+			if err := fn(i, p); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// pick returns k distinct numbers below n, in order.
+func pick(r *rand.Rand, n, k int) []int {
+	k = min(k, n)
+	picked := make([]int, 0, k)
+	for len(picked) < k {
+		x := r.IntN(n)
+		if !slices.Contains(picked, x) {
+			picked = append(picked, x)
+		}
+	}
+	slices.Sort(picked)
+	return picked
+}
+
+func (g *generator) genPatients(ctx context.Context) error {
+	return g.copyRows(ctx, "patients", []string{"email"}, func(emit func(...any) error) error {
+		return g.each(patient, func(i int, p person) error { return emit(p.email(i)) })
+	})
+}
+
+// genPatientDiseases gives every patient one to three diseases, those
+// discovered in their country if there are any.
+func (g *generator) genPatientDiseases(ctx context.Context) error {
+	r := g.rng("patientdisease")
+	return g.copyRows(ctx, "patientdisease", []string{"email", "disease_code"}, func(emit func(...any) error) error {
+		return g.each(patient, func(i int, p person) error {
+			local := g.countries[p.country].diseases
+			for _, j := range pick(r, max(len(local), 1), 1+r.IntN(3)) {
+				code := diseases[r.IntN(len(diseases))].Code
+				if len(local) > 0 {
+					code = diseases[local[j]].Code
+				}
+				if err := emit(p.email(i), code); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	})
+}
+
+func (g *generator) genDoctors(ctx context.Context) error {
+	r := g.rng("doctor")
+	return g.copyRows(ctx, "doctor", []string{"email", "degree"}, func(emit func(...any) error) error {
+		return g.each(doctor, func(i int, p person) error { return emit(p.email(i), degrees[r.IntN(len(degrees))]) })
+	})
+}
+
+// genSpecializes gives every doctor one to three disease types.
+func (g *generator) genSpecializes(ctx context.Context) error {
+	r := g.rng("specialize")
+	return g.copyRows(ctx, "specialize", []string{"id", "email"}, func(emit func(...any) error) error {
+		return g.each(doctor, func(i int, p person) error {
+			for _, t := range pick(r, len(diseaseTypes), 1+r.IntN(3)) {
+				if err := emit(g.typeIDs[t], p.email(i)); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	})
+}
+
+func (g *generator) genPublicServants(ctx context.Context) error {
+	r := g.rng("publicservant")
+	return g.copyRows(ctx, "publicservant", []string{"email", "department"}, func(emit func(...any) error) error {
+		return g.each(servant, func(i int, p person) error {
+			var department any
+			if r.Float64() < 0.9 {
+				department = departments[r.IntN(len(departments))]
+			}
+			return emit(p.email(i), department)
+		})
+	})
+}
+
+// genRecords has every public servant report 5 to 30 diseases discovered
+// in their country or, for one in four, anywhere. Patients are up to one
+// in a thousand people, and deaths follow the disease's fatality rate.
+func (g *generator) genRecords(ctx context.Context) error {
+	r := g.rng("record")
+	return g.copyRows(ctx, "record", []string{"email", "cname", "disease_code", "total_deaths", "total_patients"}, func(emit func(...any) error) error {
+		return g.each(servant, func(i int, p person) error {
+			type key struct{ country, disease int }
+			seen := make(map[key]bool)
+			for range 5 + r.IntN(26) {
+				c := int(p.country)
+				if r.Float64() < 0.25 {
+					c = g.pickCountry(r)
+				}
+				local := g.countries[c].diseases
+				if len(local) == 0 {
+					continue
+				}
+				k := key{c, local[r.IntN(len(local))]}
+				if seen[k] {
+					continue
+				}
+				seen[k] = true
+
+				d := diseases[k.disease]
+				prevalence := math.Exp(math.Log(1e-7) + r.Float64()*math.Log(1e4))
+				patients := max(1, int(min(float64(g.countries[c].population)*prevalence, 1e8)))
+				deaths := int(float64(patients) * d.CFR * (0.5 + r.Float64()))
+				if err := emit(p.email(i), g.countries[c].name, d.Code, min(deaths, patients), patients); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	})
+}
@@ -0,0 +1,63 @@
+package seed
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// memSink keeps the generated rows by table.
+type memSink struct {
+	rows  map[string][][]any
+	types int
+}
+
+func (s *memSink) copyRows(ctx context.Context, table string, columns []string, gen func(emit func(...any) error) error) (int, error) {
+	n := 0
+	err := gen(func(values ...any) error {
+		if len(values) != len(columns) {
+			return fmt.Errorf("%d values for %d columns", len(values), len(columns))
+		}
+		s.rows[table] = append(s.rows[table], values)
+		n++
+		return nil
+	})
+	return n, err
+}
+
+func (s *memSink) addDiseaseType(ctx context.Context, description string) (int, error) {
+	s.types++
+	return s.types, nil
+}
+
+// generate runs the generator for cfg without a database.
+func generate(t *testing.T, cfg Config) map[string][][]any {
+	t.Helper()
+	out := &memSink{rows: make(map[string][][]any)}
+	g := &generator{cfg: cfg, out: out}
+	if err := g.run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return out.rows
+}
+
+func TestSameSeedSameData(t *testing.T) {
+	cfg := Config{Seed: 42, Countries: 20, Users: 300, Today: time.Date(2024, 6, 30, 0, 0, 0, 0, time.UTC)}
+	a, b := generate(t, cfg), generate(t, cfg)
+	for _, table := range []string{"country", "disease", "discover", "users", "patients", "patientdisease",
+		"doctor", "specialize", "publicservant", "record"} {
+		if len(a[table]) == 0 {
+			t.Errorf("no rows of %s", table)
+		}
+		if !reflect.DeepEqual(a[table], b[table]) {
+			t.Errorf("the rows of %s differ between runs", table)
+		}
+	}
+
+	cfg.Seed++
+	if c := generate(t, cfg); reflect.DeepEqual(a["users"], c["users"]) {
+		t.Error("another seed gave the same users")
+	}
+}
@@ -0,0 +1,14 @@
+// Selection for the bulk actions on list pages: a checkbox with
+// data-select-all="<form id>" checks or clears every row checkbox that
+// belongs to that form.
+document.addEventListener("change", function (event) {
+  var all = event.target.closest("[data-select-all]");
+  if (!all) {
+    return;
+  }
+  var form = all.getAttribute("data-select-all");
+  var boxes = document.querySelectorAll('input[type="checkbox"][name="row"][form="' + form + '"]');
+  for (var i = 0; i < boxes.length; i++) {
+    boxes[i].checked = all.checked;
+  }
+});
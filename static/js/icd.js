@@ -0,0 +1,61 @@
+// Autocomplete for ICD codes. An input with data-icd-search="<url>" asks
+// <url>?q=<text> for matching codes while the user types and offers them
+// in the datalist named by data-icd-list. Picking a code fills the inputs
+// named by data-icd-description (if still empty) and data-icd-type with the
+// code's title and the disease type mapped to its chapter.
+(function () {
+  var timer;
+  var found = {};
+
+  function search(input) {
+    var url = input.getAttribute("data-icd-search") + "?q=" + encodeURIComponent(input.value);
+    fetch(url, { headers: { Accept: "application/json" } })
+      .then(function (resp) {
+        return resp.ok ? resp.json() : [];
+      })
+      .then(function (codes) {
+        var list = document.getElementById(input.getAttribute("data-icd-list"));
+        if (!list) {
+          return;
+        }
+        list.textContent = "";
+        found = {};
+        codes.forEach(function (c) {
+          var option = document.createElement("option");
+          option.value = c.code;
+          option.label = c.system + ": " + c.title;
+          list.appendChild(option);
+          found[c.code] = c;
+        });
+      });
+  }
+
+  function pick(input) {
+    var c = found[input.value];
+    if (!c) {
+      return;
+    }
+    var description = document.getElementById(input.getAttribute("data-icd-description"));
+    if (description && description.value === "") {
+      description.value = c.title.slice(0, 140);
+    }
+    var type = document.getElementById(input.getAttribute("data-icd-type"));
+    if (type && c.disease_type_id.Valid) {
+      type.value = String(c.disease_type_id.Int64);
+    }
+  }
+
+  document.addEventListener("input", function (event) {
+    var input = event.target.closest("[data-icd-search]");
+    if (!input) {
+      return;
+    }
+    pick(input);
+    clearTimeout(timer);
+    if (input.value.trim().length >= 2) {
+      timer = setTimeout(function () {
+        search(input);
+      }, 200);
+    }
+  });
+})();
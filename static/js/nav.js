@@ -0,0 +1,15 @@
+// Toggles the collapsed navigation menu on small screens, standing in for
+// Bootstrap's collapse plugin: a button with data-bs-toggle="collapse"
+// shows or hides the element named by its data-bs-target.
+document.addEventListener("click", function (event) {
+  var toggle = event.target.closest('[data-bs-toggle="collapse"]');
+  if (!toggle) {
+    return;
+  }
+  var target = document.querySelector(toggle.getAttribute("data-bs-target"));
+  if (!target) {
+    return;
+  }
+  var open = target.classList.toggle("show");
+  toggle.setAttribute("aria-expanded", open ? "true" : "false");
+});
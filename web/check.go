@@ -0,0 +1,151 @@
+package web
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"strings"
+)
+
+var (
+	assetRe    = regexp.MustCompile(`\basset\s+"([^"]+)"`)
+	staticRe   = regexp.MustCompile(`(?:href|src)\s*=\s*"(/static/[^"{]*)"`)
+	externalRe = regexp.MustCompile(`<(?:link|script|img)\b[^>]*\b(?:href|src)\s*=\s*"((?:https?:)?//[^"]*)"`)
+	cssURLRe   = regexp.MustCompile(`url\(\s*['"]?([^'")]+)['"]?\s*\)`)
+
+	actionRe    = regexp.MustCompile(`(?s)\{\{-?\s*(.*?)\s*-?\}\}`)
+	controlRe   = regexp.MustCompile(`^(?:if|else|end|range|with|break|continue|/\*|\$\w*\s*:?=)`)
+	classAttrRe = regexp.MustCompile(`\bclass\s*=\s*"([^"]*)"`)
+	commentRe   = regexp.MustCompile(`(?s)/\*.*?\*/`)
+	preludeRe   = regexp.MustCompile(`([^{}]*)\{`)
+	selectorRe  = regexp.MustCompile(`\.(-?[_a-zA-Z][\w-]*)`)
+)
+
+// CheckReferences reports every template reference that would break the
+// page: asset names missing from static, hard-coded /static/ URLs that
+// bypass fingerprinting, and stylesheets, scripts or images loaded from
+// another host. It also checks that url(...) references in stylesheets
+// resolve inside static, and that every class in a template's class
+// attributes is defined by one of them.
+func CheckReferences(templates, static fs.FS) error {
+	var errs []error
+
+	defined, err := cssClasses(static)
+	if err != nil {
+		return err
+	}
+
+	err = fs.WalkDir(templates, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || path.Ext(name) != ".html" {
+			return err
+		}
+		src, err := fs.ReadFile(templates, name)
+		if err != nil {
+			return err
+		}
+
+		for _, m := range assetRe.FindAllStringSubmatch(string(src), -1) {
+			if !exists(static, strings.TrimPrefix(m[1], "/")) {
+				errs = append(errs, fmt.Errorf("%s: asset %q does not exist in static/", name, m[1]))
+			}
+		}
+		for _, m := range staticRe.FindAllStringSubmatch(string(src), -1) {
+			errs = append(errs, fmt.Errorf("%s: %s is not fingerprinted; use {{ asset %q }}", name, m[1], strings.TrimPrefix(m[1], "/static/")))
+		}
+		for _, m := range externalRe.FindAllStringSubmatch(string(src), -1) {
+			errs = append(errs, fmt.Errorf("%s: %s is loaded from another host; vendor it under static/", name, m[1]))
+		}
+		for _, class := range classes(string(src)) {
+			if !defined[class] {
+				errs = append(errs, fmt.Errorf("%s: class %q is not defined in static/; add it to css/ui.css", name, class))
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	err = fs.WalkDir(static, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || path.Ext(name) != ".css" {
+			return err
+		}
+		src, err := fs.ReadFile(static, name)
+		if err != nil {
+			return err
+		}
+
+		for _, m := range cssURLRe.FindAllStringSubmatch(string(src), -1) {
+			ref := m[1]
+			switch {
+			case strings.HasPrefix(ref, "data:"), strings.HasPrefix(ref, "#"):
+				continue
+			case strings.Contains(ref, "//"):
+				errs = append(errs, fmt.Errorf("static/%s: %s is loaded from another host; vendor it under static/", name, ref))
+			case !exists(static, path.Join(path.Dir(name), ref)):
+				errs = append(errs, fmt.Errorf("static/%s: %s does not exist", name, ref))
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return errors.Join(errs...)
+}
+
+// classes returns the class names of the class attributes of a template,
+// each once. Names completed by a template action, such as
+// bg-{{ .Color }}, cannot be checked and are left out; those inside
+// conditions, such as {{ if .Done }}text-muted{{ end }}, are kept.
+func classes(src string) []string {
+	src = actionRe.ReplaceAllStringFunc(src, func(action string) string {
+		if controlRe.MatchString(actionRe.FindStringSubmatch(action)[1]) {
+			return " "
+		}
+		return "\x00" // output, unknown at this point
+	})
+	var names []string
+	seen := make(map[string]bool)
+	for _, m := range classAttrRe.FindAllStringSubmatch(src, -1) {
+		for _, name := range strings.Fields(m[1]) {
+			if !strings.Contains(name, "\x00") && !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	return names
+}
+
+// cssClasses returns the classes the selectors of the stylesheets in
+// static mention.
+func cssClasses(static fs.FS) (map[string]bool, error) {
+	defined := make(map[string]bool)
+	err := fs.WalkDir(static, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || path.Ext(name) != ".css" {
+			return err
+		}
+		src, err := fs.ReadFile(static, name)
+		if err != nil {
+			return err
+		}
+		// Selectors, and at-rule preludes, are what comes before a {.
+		css := commentRe.ReplaceAllString(string(src), "")
+		for _, prelude := range preludeRe.FindAllStringSubmatch(css, -1) {
+			for _, m := range selectorRe.FindAllStringSubmatch(prelude[1], -1) {
+				defined[m[1]] = true
+			}
+		}
+		return nil
+	})
+	return defined, err
+}
+
+func exists(fsys fs.FS, name string) bool {
+	_, err := fs.Stat(fsys, name)
+	return err == nil
+}
@@ -0,0 +1,38 @@
+package web
+
+import (
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestCheckReferencesClasses(t *testing.T) {
+	static := fstest.MapFS{
+		"css/ui.css": {Data: []byte(`/* .commented { } */
+.btn, .btn-primary:hover { color: red; background: url(data:image/png;base64,x.y); }
+@media (min-width: 768px) { .col-md-6 { width: 50%; } }
+.table > tr.table-warning > * { color: blue; }
+`)},
+	}
+	templates := fstest.MapFS{
+		"ok.html": {Data: []byte(`<a class="btn btn-primary {{ if .X }}col-md-6{{ end }}">
+<tr {{ if eq .S "x" }}class="table-warning"{{ end }}>
+<span class="bg-{{ .Color }}">`)},
+		"bad.html": {Data: []byte(`<p class="btn commented png">
+<div class="{{ if .X }}missing{{ else }}btn{{ end }}">`)},
+	}
+
+	err := CheckReferences(templates, static)
+	if err == nil {
+		t.Fatal("no error")
+	}
+	lines := strings.Split(err.Error(), "\n")
+	want := []string{
+		`bad.html: class "commented" is not defined in static/; add it to css/ui.css`,
+		`bad.html: class "png" is not defined in static/; add it to css/ui.css`,
+		`bad.html: class "missing" is not defined in static/; add it to css/ui.css`,
+	}
+	if strings.Join(lines, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got\n%s\nwant\n%s", err, strings.Join(want, "\n"))
+	}
+}
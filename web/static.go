@@ -0,0 +1,138 @@
+package web
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+)
+
+// hashLen is the number of hex digits of the content hash put into
+// fingerprinted file names.
+const hashLen = 10
+
+// Static serves the files of a static asset tree under a URL prefix.
+//
+// In production every file is read into memory at startup and is available
+// under a fingerprinted name, e.g. /static/css/styles.3f9a0c1b2d.css, which
+// is cached by browsers for a year. The plain name is still served but must
+// be revalidated, using the content hash as ETag. In development files are
+// read from disk on every request and never cached.
+type Static struct {
+	prefix string
+	fsys   fs.FS
+	dev    bool
+
+	files  map[string]*asset // by plain name, e.g. "css/styles.css"
+	hashed map[string]*asset // by fingerprinted name
+}
+
+type asset struct {
+	name   string
+	hashed string
+	etag   string
+	data   []byte
+}
+
+// NewStatic indexes fsys for serving under prefix, e.g. "/static/".
+func NewStatic(fsys fs.FS, prefix string, dev bool) (*Static, error) {
+	s := &Static{
+		prefix: prefix,
+		fsys:   fsys,
+		dev:    dev,
+		files:  make(map[string]*asset),
+		hashed: make(map[string]*asset),
+	}
+	if dev {
+		return s, nil
+	}
+
+	err := fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		data, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return err
+		}
+
+		sum := sha256.Sum256(data)
+		hash := hex.EncodeToString(sum[:])[:hashLen]
+		ext := path.Ext(name)
+		a := &asset{
+			name:   name,
+			hashed: strings.TrimSuffix(name, ext) + "." + hash + ext,
+			etag:   `"` + hash + `"`,
+			data:   data,
+		}
+		s.files[name] = a
+		s.hashed[a.hashed] = a
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// URL returns the URL of the asset called name, fingerprinted when running
+// from embedded files. It is exposed to templates as the "asset" function,
+// so a reference to a missing file fails the page instead of producing a
+// dead link.
+func (s *Static) URL(name string) (string, error) {
+	name = strings.TrimPrefix(name, "/")
+	if s.dev {
+		if _, err := fs.Stat(s.fsys, name); err != nil {
+			return "", fmt.Errorf("asset %q not found", name)
+		}
+		return s.prefix + name, nil
+	}
+
+	a, ok := s.files[name]
+	if !ok {
+		return "", fmt.Errorf("asset %q not found", name)
+	}
+	return s.prefix + a.hashed, nil
+}
+
+// Funcs returns the template functions backed by s.
+func (s *Static) Funcs() template.FuncMap {
+	return template.FuncMap{"asset": s.URL}
+}
+
+func (s *Static) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name, ok := strings.CutPrefix(r.URL.Path, s.prefix)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	if s.dev {
+		w.Header().Set("Cache-Control", "no-store")
+		http.StripPrefix(s.prefix, http.FileServerFS(s.fsys)).ServeHTTP(w, r)
+		return
+	}
+
+	if a, ok := s.hashed[name]; ok {
+		w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+		s.serve(w, r, a)
+		return
+	}
+	if a, ok := s.files[name]; ok {
+		w.Header().Set("Cache-Control", "no-cache")
+		s.serve(w, r, a)
+		return
+	}
+	http.NotFound(w, r)
+}
+
+func (s *Static) serve(w http.ResponseWriter, r *http.Request, a *asset) {
+	w.Header().Set("ETag", a.etag)
+	http.ServeContent(w, r, a.name, time.Time{}, bytes.NewReader(a.data))
+}
@@ -0,0 +1,102 @@
+// Package web loads the page templates and static assets served by the
+// application, either from the copies embedded in the binary or, in
+// development, straight from disk.
+package web
+
+import (
+	"fmt"
+	"html/template"
+	"io/fs"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// Templates holds the page templates of a template tree: every top-level
+// *.html file is a layout shared by all pages, and every file in a
+// subdirectory is a page. Pages are looked up by their path without the
+// extension, e.g. "records/list".
+type Templates struct {
+	fsys   fs.FS
+	funcs  template.FuncMap
+	reload bool
+	pages  map[string]*template.Template
+}
+
+// NewTemplates parses every page in fsys. With reload set, pages are parsed
+// again from fsys on every lookup so edits show up without a restart.
+func NewTemplates(fsys fs.FS, funcs template.FuncMap, reload bool) (*Templates, error) {
+	t := &Templates{
+		fsys:   fsys,
+		funcs:  funcs,
+		reload: reload,
+	}
+
+	pages, err := t.parseAll()
+	if err != nil {
+		return nil, err
+	}
+	if !reload {
+		t.pages = pages
+	}
+	return t, nil
+}
+
+// Template returns the parsed page called name.
+func (t *Templates) Template(name string) (*template.Template, error) {
+	if t.reload {
+		file := name + ".html"
+		if _, err := fs.Stat(t.fsys, file); err != nil {
+			return nil, fmt.Errorf("template %q not found", name)
+		}
+		return t.parse(file)
+	}
+
+	tmpl, ok := t.pages[name]
+	if !ok {
+		return nil, fmt.Errorf("template %q not found", name)
+	}
+	return tmpl, nil
+}
+
+func (t *Templates) parseAll() (map[string]*template.Template, error) {
+	pages := make(map[string]*template.Template)
+	for _, pattern := range []string{"*.html", "*/*.html"} {
+		files, err := fs.Glob(t.fsys, pattern)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, file := range files {
+			tmpl, err := t.parse(file)
+			if err != nil {
+				return nil, err
+			}
+			pages[strings.TrimSuffix(file, path.Ext(file))] = tmpl
+		}
+	}
+	return pages, nil
+}
+
+// parse builds the template for one page on top of the layouts.
+func (t *Templates) parse(file string) (*template.Template, error) {
+	layouts, err := fs.Glob(t.fsys, "*.html")
+	if err != nil {
+		return nil, err
+	}
+	if len(layouts) == 0 {
+		return nil, fmt.Errorf("no layouts found for %s", file)
+	}
+	if path.Dir(file) != "." {
+		layouts = append(layouts, file)
+	}
+
+	return template.New(path.Base(layouts[0])).Funcs(t.funcs).ParseFS(t.fsys, layouts...)
+}
+
+// PathEscape escapes v for use as one segment of a URL path, the
+// "pathescape" template function: html/template only normalizes the path
+// of a URL, so a key containing "/" or "?" would otherwise change it.
+func PathEscape(v any) string {
+	return url.PathEscape(fmt.Sprint(v))
+}
@@ -0,0 +1,243 @@
+// Package webhook delivers the events queued in webhook_delivery to their
+// endpoints as signed JSON POST requests, retrying with exponential
+// backoff.
+//
+// Every request carries these headers:
+//
+//	X-Webhook-Event:     discover.create
+//	X-Webhook-Delivery:  42
+//	X-Webhook-Timestamp: 1718000000
+//	X-Webhook-Signature: sha256=<hex HMAC-SHA256 of "<timestamp>.<body>">
+//
+// The HMAC key is the webhook's secret. Receivers should check the
+// signature with Verify, or an equivalent, and ignore deliveries they
+// have already seen: a delivery can arrive more than once.
+package webhook
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/rand/v2"
+	"myapp/models"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Request headers.
+const (
+	EventHeader     = "X-Webhook-Event"
+	DeliveryHeader  = "X-Webhook-Delivery"
+	TimestampHeader = "X-Webhook-Timestamp"
+	SignatureHeader = "X-Webhook-Signature"
+)
+
+// Sign returns the signature header value of body sent at t.
+func Sign(secret string, t time.Time, body []byte) string {
+	return "sha256=" + hex.EncodeToString(mac(secret, strconv.FormatInt(t.Unix(), 10), body))
+}
+
+func mac(secret, timestamp string, body []byte) []byte {
+	m := hmac.New(sha256.New, []byte(secret))
+	m.Write([]byte(timestamp))
+	m.Write([]byte("."))
+	m.Write(body)
+	return m.Sum(nil)
+}
+
+// Errors returned by Verify.
+var (
+	ErrSignature = errors.New("webhook: signature does not match")
+	ErrExpired   = errors.New("webhook: timestamp outside tolerance")
+)
+
+// Verify checks the signature of a received request whose body has been
+// read into body. Requests stamped more than tolerance away from now are
+// rejected to limit replays; zero disables the check.
+func Verify(secret string, h http.Header, body []byte, tolerance time.Duration) error {
+	timestamp := h.Get(TimestampHeader)
+	sec, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("webhook: bad %s %q", TimestampHeader, timestamp)
+	}
+	sig, ok := strings.CutPrefix(h.Get(SignatureHeader), "sha256=")
+	if !ok {
+		return ErrSignature
+	}
+	got, err := hex.DecodeString(sig)
+	if err != nil || !hmac.Equal(got, mac(secret, timestamp, body)) {
+		return ErrSignature
+	}
+	if tolerance > 0 {
+		if d := time.Since(time.Unix(sec, 0)); d > tolerance || d < -tolerance {
+			return ErrExpired
+		}
+	}
+	return nil
+}
+
+// Dispatcher delivers due deliveries. Several dispatchers, in one process
+// or many, can share a database: each claims its own deliveries.
+type Dispatcher struct {
+	DB     *sql.DB
+	Client *http.Client
+
+	Interval    time.Duration // between polls when nothing is due
+	Batch       int           // deliveries claimed at a time
+	Workers     int           // concurrent requests
+	MaxAttempts int           // failures before a delivery is dead
+	Retention   time.Duration // successful deliveries are kept this long
+
+	// Backoff returns the wait after the n-th failed attempt.
+	Backoff func(n int) time.Duration
+}
+
+// NewDispatcher returns a dispatcher with the default settings: up to 10
+// attempts spread over about four hours, and a week of delivered events
+// kept.
+func NewDispatcher(db *sql.DB) *Dispatcher {
+	return &Dispatcher{
+		DB:          db,
+		Client:      &http.Client{Timeout: 10 * time.Second},
+		Interval:    5 * time.Second,
+		Batch:       50,
+		Workers:     4,
+		MaxAttempts: 10,
+		Retention:   7 * 24 * time.Hour,
+		Backoff:     Exponential(30*time.Second, 6*time.Hour),
+	}
+}
+
+// Exponential returns a backoff of base after the first failure, doubling
+// after each further one up to max, with up to 10% added at random so
+// deliveries that failed together are not retried together.
+func Exponential(base, max time.Duration) func(int) time.Duration {
+	return func(n int) time.Duration {
+		d := base
+		for i := 1; i < n && d < max; i++ {
+			d *= 2
+		}
+		d = min(d, max)
+		return d + rand.N(d/10+1)
+	}
+}
+
+// Run delivers until ctx is done, and purges old deliveries hourly.
+func (d *Dispatcher) Run(ctx context.Context) {
+	var purged time.Time
+	for {
+		if time.Since(purged) > time.Hour {
+			if _, err := models.PurgeWebhookDeliveries(ctx, d.DB, time.Now().Add(-d.Retention)); err != nil && ctx.Err() == nil {
+				log.Printf("Error purging webhook deliveries: %v", err)
+			}
+			purged = time.Now()
+		}
+		n, err := d.DeliverDue(ctx)
+		if err != nil && ctx.Err() == nil {
+			log.Printf("Error delivering webhooks: %v", err)
+		}
+		if n == d.Batch {
+			continue // probably more due
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(d.Interval):
+		}
+	}
+}
+
+// DeliverDue claims one batch of due deliveries and attempts each,
+// returning how many were claimed.
+func (d *Dispatcher) DeliverDue(ctx context.Context) (int, error) {
+	// Claimed deliveries are not retried before the lease ends, which
+	// must outlast the slowest batch.
+	lease := d.Client.Timeout*time.Duration((d.Batch+d.Workers-1)/d.Workers) + time.Minute
+	deliveries, err := models.ClaimWebhookDeliveries(ctx, d.DB, d.Batch, lease)
+	if err != nil {
+		return 0, err
+	}
+
+	jobs := make(chan models.WebhookDelivery)
+	errs := make(chan error, len(deliveries))
+	var wg sync.WaitGroup
+	for range min(d.Workers, len(deliveries)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for x := range jobs {
+				if err := d.attempt(ctx, &x); err != nil {
+					errs <- err
+				}
+			}
+		}()
+	}
+	for _, x := range deliveries {
+		jobs <- x
+	}
+	close(jobs)
+	wg.Wait()
+	close(errs)
+	return len(deliveries), <-errs
+}
+
+// attempt sends one delivery and records the outcome.
+func (d *Dispatcher) attempt(ctx context.Context, x *models.WebhookDelivery) error {
+	status, err := Send(ctx, d.Client, x)
+	if ctx.Err() != nil {
+		return nil // shutting down: retried when the lease ends
+	}
+	if err == nil {
+		return models.MarkWebhookDelivered(context.WithoutCancel(ctx), d.DB, x.ID, status)
+	}
+
+	var next time.Time
+	if n := x.Attempts + 1; n < d.MaxAttempts {
+		next = time.Now().Add(d.Backoff(n))
+	}
+	return models.MarkWebhookFailed(context.WithoutCancel(ctx), d.DB, x.ID, status, truncate(err.Error(), 500), next)
+}
+
+// Send posts one delivery and returns the response status, 0 if there
+// was none. Statuses other than 2xx are errors.
+func Send(ctx context.Context, client *http.Client, x *models.WebhookDelivery) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, x.URL, strings.NewReader(string(x.Payload)))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "myapp-webhooks/1")
+	req.Header.Set(EventHeader, x.Event)
+	req.Header.Set(DeliveryHeader, strconv.FormatInt(x.ID, 10))
+	now := time.Now()
+	req.Header.Set(TimestampHeader, strconv.FormatInt(now.Unix(), 10))
+	req.Header.Set(SignatureHeader, Sign(x.Secret, now, x.Payload))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 == 2 {
+		io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+		return resp.StatusCode, nil
+	}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 300))
+	return resp.StatusCode, fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(body)))
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return strings.ToValidUTF8(s[:n], "")
+}
@@ -0,0 +1,301 @@
+package webhook_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"myapp/db"
+	"myapp/models"
+	"myapp/webhook"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const secret = "s3cret"
+
+func TestSignVerify(t *testing.T) {
+	body := []byte(`{"event":"discover.create"}`)
+	now := time.Now()
+	header := func(ts time.Time, sig string) http.Header {
+		h := make(http.Header)
+		h.Set(webhook.TimestampHeader, strconv.FormatInt(ts.Unix(), 10))
+		h.Set(webhook.SignatureHeader, sig)
+		return h
+	}
+
+	if err := webhook.Verify(secret, header(now, webhook.Sign(secret, now, body)), body, time.Minute); err != nil {
+		t.Errorf("a signed request: %v", err)
+	}
+	for _, tc := range []struct {
+		name string
+		h    http.Header
+		body []byte
+		want error
+	}{
+		{"changed body", header(now, webhook.Sign(secret, now, body)), []byte(`{}`), webhook.ErrSignature},
+		{"other secret", header(now, webhook.Sign("other", now, body)), body, webhook.ErrSignature},
+		{"other timestamp", header(now.Add(time.Second), webhook.Sign(secret, now, body)), body, webhook.ErrSignature},
+		{"no scheme", header(now, strings.TrimPrefix(webhook.Sign(secret, now, body), "sha256=")), body, webhook.ErrSignature},
+		{"not hex", header(now, "sha256=zz"), body, webhook.ErrSignature},
+		{"too old", header(now.Add(-time.Hour), webhook.Sign(secret, now.Add(-time.Hour), body)), body, webhook.ErrExpired},
+		{"in the future", header(now.Add(time.Hour), webhook.Sign(secret, now.Add(time.Hour), body)), body, webhook.ErrExpired},
+	} {
+		if err := webhook.Verify(secret, tc.h, tc.body, time.Minute); !errors.Is(err, tc.want) {
+			t.Errorf("%s: got %v, want %v", tc.name, err, tc.want)
+		}
+	}
+
+	h := header(now, webhook.Sign(secret, now, body))
+	h.Del(webhook.TimestampHeader)
+	if err := webhook.Verify(secret, h, body, time.Minute); err == nil {
+		t.Error("a request without a timestamp verified")
+	}
+	old := now.Add(-24 * time.Hour)
+	if err := webhook.Verify(secret, header(old, webhook.Sign(secret, old, body)), body, 0); err != nil {
+		t.Errorf("without a tolerance an old request: %v", err)
+	}
+}
+
+// receiver records the requests it is sent and answers them with status.
+type receiver struct {
+	*httptest.Server
+	status   atomic.Int32
+	requests atomic.Int32
+
+	mu     sync.Mutex
+	header http.Header // of the last request
+	err    error       // verifying the last request
+}
+
+func newReceiver(t *testing.T, status int) *receiver {
+	rc := &receiver{}
+	rc.status.Store(int32(status))
+	rc.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rc.requests.Add(1)
+		body, _ := io.ReadAll(r.Body)
+		rc.mu.Lock()
+		rc.header, rc.err = r.Header.Clone(), webhook.Verify(secret, r.Header, body, time.Minute)
+		rc.mu.Unlock()
+		status := int(rc.status.Load())
+		w.WriteHeader(status)
+		fmt.Fprintf(w, "answered %d\n", status)
+	}))
+	t.Cleanup(rc.Close)
+	return rc
+}
+
+// last returns the headers of the last request and whether it verified.
+func (rc *receiver) last() (http.Header, error) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	return rc.header, rc.err
+}
+
+func TestSend(t *testing.T) {
+	x := &models.WebhookDelivery{ID: 42, Secret: secret, Event: "discover.create", Payload: []byte(`{"event":"discover.create"}`)}
+
+	t.Run("2xx", func(t *testing.T) {
+		rc := newReceiver(t, http.StatusNoContent)
+		x.URL = rc.URL
+		status, err := webhook.Send(context.Background(), rc.Client(), x)
+		if err != nil || status != http.StatusNoContent {
+			t.Fatalf("got %d, %v", status, err)
+		}
+		h, err := rc.last()
+		if err != nil {
+			t.Errorf("the receiver could not verify the request: %v", err)
+		}
+		if h.Get(webhook.EventHeader) != "discover.create" || h.Get(webhook.DeliveryHeader) != "42" || h.Get("Content-Type") != "application/json" {
+			t.Errorf("headers %v", h)
+		}
+	})
+	t.Run("non-2xx", func(t *testing.T) {
+		rc := newReceiver(t, http.StatusServiceUnavailable)
+		x.URL = rc.URL
+		status, err := webhook.Send(context.Background(), rc.Client(), x)
+		if status != http.StatusServiceUnavailable || err == nil || !strings.Contains(err.Error(), "answered 503") {
+			t.Errorf("got %d, %v; want 503 with the response body", status, err)
+		}
+	})
+	t.Run("redirect", func(t *testing.T) {
+		rc := newReceiver(t, http.StatusFound)
+		x.URL = rc.URL
+		if status, err := webhook.Send(context.Background(), rc.Client(), x); status != http.StatusFound || err == nil {
+			t.Errorf("got %d, %v; want a failed 302", status, err)
+		}
+	})
+	t.Run("no response", func(t *testing.T) {
+		rc := newReceiver(t, http.StatusOK)
+		x.URL = rc.URL
+		rc.Close()
+		if status, err := webhook.Send(context.Background(), http.DefaultClient, x); status != 0 || err == nil {
+			t.Errorf("got %d, %v; want 0 and an error", status, err)
+		}
+	})
+}
+
+func TestExponential(t *testing.T) {
+	backoff := webhook.Exponential(time.Second, 10*time.Second)
+	for n, want := range map[int]time.Duration{1: time.Second, 2: 2 * time.Second, 3: 4 * time.Second, 4: 8 * time.Second, 5: 10 * time.Second, 20: 10 * time.Second} {
+		for range 20 {
+			if d := backoff(n); d < want || d > want+want/10 {
+				t.Errorf("backoff(%d) = %v, want %v plus up to 10%%", n, d, want)
+			}
+		}
+	}
+}
+
+// The dispatcher tests need a database:
+//
+//	DATABASE_URL=... go test ./webhook
+//
+// They work in a throwaway organization, which is removed afterwards, so
+// that they only see deliveries of their own.
+
+// openOrg connects to DATABASE_URL, or skips the test, and returns the
+// context of a new organization.
+func openOrg(t *testing.T) (*sql.DB, context.Context) {
+	t.Helper()
+	dbURL := os.Getenv("DATABASE_URL")
+	if dbURL == "" {
+		t.Skip("DATABASE_URL is not set")
+	}
+	conn, err := db.NewPostgresDB(dbURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	ctx := context.Background()
+	if err := db.Migrate(ctx, conn); err != nil {
+		t.Fatal(err)
+	}
+	o, err := models.CreateOrganization(ctx, conn, fmt.Sprintf("webhook-%06d", rand.IntN(1e6)), "Webhook test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		ctx := models.WithAllTenants(context.Background())
+		for _, q := range []string{"DELETE FROM webhook WHERE tenant_id = $1", "DELETE FROM organization WHERE id = $1"} {
+			if _, err := conn.ExecContext(ctx, q, o.ID); err != nil {
+				t.Errorf("cleaning up: %v", err)
+			}
+		}
+	})
+	return conn, models.WithTenant(ctx, o.ID)
+}
+
+// queue adds a webhook sending to url and queues a ping for it.
+func queue(t *testing.T, ctx context.Context, conn *sql.DB, url string) *models.Webhook {
+	t.Helper()
+	w := &models.Webhook{URL: url, Secret: secret, Entity: "country", Operations: []string{models.WebhookCreate}, Active: true}
+	if err := models.CreateWebhook(ctx, conn, w); err != nil {
+		t.Fatal(err)
+	}
+	if err := models.PingWebhook(ctx, conn, w.ID); err != nil {
+		t.Fatal(err)
+	}
+	return w
+}
+
+// deliver has d claim and attempt due deliveries once, returning how many.
+func deliver(t *testing.T, ctx context.Context, d *webhook.Dispatcher) int {
+	t.Helper()
+	n, err := d.DeliverDue(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestDispatcherDelivers(t *testing.T) {
+	conn, ctx := openOrg(t)
+	rc := newReceiver(t, http.StatusOK)
+	w := queue(t, ctx, conn, rc.URL)
+
+	d := webhook.NewDispatcher(conn)
+	d.Client = rc.Client()
+	if n := deliver(t, ctx, d); n != 1 {
+		t.Fatalf("claimed %d deliveries", n)
+	}
+	if _, err := rc.last(); err != nil {
+		t.Errorf("the receiver could not verify the ping: %v", err)
+	}
+	queued, err := models.WebhookQueue(ctx, conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if queued[w.ID] != 0 {
+		t.Errorf("%d deliveries still queued", queued[w.ID])
+	}
+	if n := deliver(t, ctx, d); n != 0 {
+		t.Errorf("claimed %d deliveries after delivering", n)
+	}
+}
+
+func TestDispatcherDeadLetter(t *testing.T) {
+	conn, ctx := openOrg(t)
+	rc := newReceiver(t, http.StatusInternalServerError)
+	w := queue(t, ctx, conn, rc.URL)
+
+	d := webhook.NewDispatcher(conn)
+	d.Client = rc.Client()
+	d.MaxAttempts = 3
+	var waits []int
+	d.Backoff = func(n int) time.Duration {
+		waits = append(waits, n)
+		return -time.Hour // due again at once
+	}
+
+	for attempt := 1; attempt <= d.MaxAttempts; attempt++ {
+		if n := deliver(t, ctx, d); n != 1 {
+			t.Fatalf("attempt %d claimed %d deliveries", attempt, n)
+		}
+		dead, err := models.GetDeadWebhookDeliveries(ctx, conn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if attempt < d.MaxAttempts && len(dead) > 0 {
+			t.Fatalf("dead after %d attempts", attempt)
+		}
+		if attempt == d.MaxAttempts {
+			if len(dead) != 1 {
+				t.Fatalf("%d dead deliveries after %d attempts", len(dead), attempt)
+			}
+			x := dead[0]
+			if x.WebhookID != w.ID || x.Attempts != d.MaxAttempts || x.LastStatus.Int64 != 500 || !strings.Contains(x.LastError.String, "answered 500") {
+				t.Errorf("dead delivery %+v", x)
+			}
+		}
+	}
+	if fmt.Sprint(waits) != "[1 2]" {
+		t.Errorf("backed off after attempts %v, want [1 2]", waits)
+	}
+	if n := deliver(t, ctx, d); n != 0 {
+		t.Errorf("claimed %d dead deliveries", n)
+	}
+	if got := rc.requests.Load(); got != int32(d.MaxAttempts) {
+		t.Errorf("%d requests, want %d", got, d.MaxAttempts)
+	}
+
+	dead, err := models.GetDeadWebhookDeliveries(ctx, conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := models.RetryWebhookDelivery(ctx, conn, dead[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	rc.status.Store(http.StatusOK)
+	if n := deliver(t, ctx, d); n != 1 {
+		t.Errorf("claimed %d deliveries after a retry", n)
+	}
+}